@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/compiler"
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/logger"
+	"github.com/theduql/duql/internal/project"
+	"github.com/theduql/duql/internal/semantic"
+	"github.com/theduql/duql/internal/validator"
+)
+
+// buildManifest describes what duql build produced. It is written to
+// manifest.json in the output directory.
+type buildManifest struct {
+	Name string `json:"name,omitempty"`
+	// Queries are in the order they can run.
+	Queries []builtQuery `json:"queries"`
+}
+
+type builtQuery struct {
+	// File is the query, relative to the root of the project.
+	File string `json:"file"`
+	// SQL is the compiled file, relative to the output directory.
+	SQL    string             `json:"sql"`
+	Target duql.TargetDialect `json:"target"`
+	Into   *duql.Into         `json:"into,omitempty"`
+	Reads  []string           `json:"reads,omitempty"`
+	// Depends are the queries producing what the query reads.
+	Depends []string      `json:"depends,omitempty"`
+	Columns []builtColumn `json:"columns,omitempty"`
+	// Params are the arguments the SQL expects, in the order they are
+	// passed.
+	Params []compiler.Param `json:"params,omitempty"`
+}
+
+type builtColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// buildProject compiles every query of the project at path in the order
+// they depend on each other, writing one SQL file per query to the output
+// directory of the manifest, or to out when it is not empty, along with
+// manifest.json. The columns of each result are known to the queries
+// reading it, so a catalog only has to describe the source tables.
+func buildProject(path string, target duql.TargetDialect, out string, opts validator.Options) error {
+	log := logger.GetLogger()
+
+	m, err := project.LoadManifest(path)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		out = m.Path(m.Out)
+	}
+	for _, t := range []duql.TargetDialect{target, m.Target} {
+		if t == "" {
+			continue
+		}
+		if _, err := compiler.Capabilities(t); err != nil {
+			return err
+		}
+	}
+
+	tables, err := m.Catalog()
+	if err != nil {
+		return fmt.Errorf("unable to load the catalog: %w", err)
+	}
+	if opts.Catalog != nil {
+		tables = append(tables, opts.Catalog)
+	}
+	var sources catalog.Provider
+	if len(tables) > 0 {
+		sources = tables
+	}
+
+	files, err := m.Files(validator.IsQueryFile)
+	if err != nil {
+		return err
+	}
+	queries := make(map[string]*duql.Query)
+	var list []*duql.Query
+	for _, file := range files {
+		query, err := loadQuery(file, opts)
+		if err != nil {
+			return err
+		}
+		if err := query.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if query.Into != nil && !query.Into.Materialized() {
+			// A cte is only a name, and building it would create nothing
+			// for the queries reading it.
+			return fmt.Errorf("%s: into %s must have a kind of view, table or temp table to be built", file, query.Into.Name)
+		}
+		queries[file] = query
+		list = append(list, query)
+	}
+
+	g, err := project.New(m.Dir, files, list, sources)
+	if err != nil {
+		return fmt.Errorf("unable to build the query graph: %w", err)
+	}
+	if len(g.Conflicts) > 0 {
+		return fmt.Errorf("%s", g.Conflicts[0])
+	}
+	order, err := g.Order()
+	if err != nil {
+		return err
+	}
+
+	// results holds the columns of what the queries built so far produce.
+	results := make(catalog.Tables)
+	manifest := buildManifest{Name: m.Name}
+	for _, node := range order {
+		file := filepath.Join(m.Dir, filepath.FromSlash(node.File))
+		query := queries[file]
+
+		provider, err := validator.QueryCatalog(file, query, validator.Options{Catalog: sources})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if provider != nil {
+			provider = catalog.Chain{results, provider}
+		} else {
+			// Without a catalog the source tables are unknown, but the
+			// results built so far are still checked.
+			provider = catalog.Chain{results, catalog.Unlisted{}}
+		}
+		analysis := semantic.Analyze(query, semantic.Options{Catalog: provider, Dir: filepath.Dir(file)})
+		for _, problem := range analysis.Problems {
+			log.Error(fmt.Sprintf("❌ %s: %s", file, problem))
+		}
+		if len(analysis.Problems) > 0 {
+			return fmt.Errorf("%s: %w", file, analysis.Problems[0])
+		}
+
+		// The target of the project is a default for queries without a
+		// settings.target; the command line overrides both.
+		compileTarget := target
+		if compileTarget == "" && (query.Settings == nil || query.Settings.Target == "") {
+			compileTarget = m.Target
+		}
+		result, err := compiler.Compile(query, compiler.Options{Target: compileTarget})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, warning := range result.Warnings {
+			log.Warn(fmt.Sprintf("%s: %s", file, warning))
+		}
+
+		name, err := outputName(m.Dir, file)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(out, name)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(dest, []byte(result.SQL+"\n"), 0o644); err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("ℹ️  Generated %s SQL: %s", result.Target, dest))
+
+		built := builtQuery{
+			File:   node.File,
+			SQL:    filepath.ToSlash(name),
+			Target: result.Target,
+			Into:   query.Into,
+			Reads:  node.Reads,
+			Params: result.Params,
+		}
+		for _, read := range node.Reads {
+			if p := g.Producer(read); p != nil {
+				built.Depends = append(built.Depends, p.File)
+			}
+		}
+		var columns []catalog.Column
+		for _, col := range analysis.Output.Columns {
+			built.Columns = append(built.Columns, builtColumn{Name: col.Name, Type: col.Type})
+			columns = append(columns, catalog.Column{Name: col.Name, Type: col.Type, Nullable: col.Nullable})
+		}
+		if node.Into != "" {
+			results[node.Into] = &catalog.Table{Name: node.Into, Columns: columns, Open: analysis.Output.Open}
+		}
+		manifest.Queries = append(manifest.Queries, built)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+	dest := filepath.Join(out, "manifest.json")
+	if err := os.WriteFile(dest, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	log.Info(fmt.Sprintf("ℹ️  Built %d queries into %s", len(manifest.Queries), out))
+	return nil
+}
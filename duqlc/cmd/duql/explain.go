@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/explain"
+	"github.com/theduql/duql/internal/validator"
+)
+
+// explainQueries prints, for every query at path, the columns each step
+// produces and the SQL it becomes, in the given format. Nothing else is
+// written to stdout, so JSON output can be piped.
+func explainQueries(path string, target duql.TargetDialect, format string, opts validator.Options) error {
+	files, err := queryFiles(path)
+	if err != nil {
+		return err
+	}
+
+	var plans []*explain.Plan
+	for _, file := range files {
+		query, err := loadQuery(file, opts)
+		if err != nil {
+			return err
+		}
+		if err := query.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		provider, err := validator.QueryCatalog(file, query, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		plan, err := explain.New(file, query, target, provider)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		plans = append(plans, plan)
+	}
+	return explain.Write(os.Stdout, plans, format)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/theduql/duql/internal/compiler"
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/gogen"
+	"github.com/theduql/duql/internal/logger"
+	"github.com/theduql/duql/internal/validator"
+)
+
+// genGo writes a Go function for every query at path to out, one
+// <query>.duql.go file each, plus db.go with the interface they run on.
+// Nothing is written unless every query compiles.
+func genGo(path string, target duql.TargetDialect, out, pkg string, opts validator.Options) error {
+	log := logger.GetLogger()
+
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("%q is not a Go package name; set one with --package", pkg)
+	}
+	if target != "" {
+		if _, err := compiler.Capabilities(target); err != nil {
+			return err
+		}
+	}
+	if err := validator.ValidateWith(path, opts); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	files, err := queryFiles(path)
+	if err != nil {
+		return err
+	}
+
+	sources := make(map[string][]byte)
+	owners := make(map[string]string)
+	var names []string
+	for _, file := range files {
+		query, err := loadQuery(file, opts)
+		if err != nil {
+			return err
+		}
+		provider, err := validator.QueryCatalog(file, query, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		q, err := gogen.New(file, query, target, provider)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, warning := range q.Result.Warnings {
+			log.Warn(fmt.Sprintf("%s: %s", file, warning))
+		}
+		if owner, ok := owners[q.Name]; ok {
+			return fmt.Errorf("%s and %s both generate %s; rename one of them", owner, file, q.Name)
+		}
+		owners[q.Name] = file
+
+		src, err := gogen.Write(pkg, q)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		name := filepath.Base(file)
+		for _, ext := range []string{".yaml", ".yml", ".duql"} {
+			name = strings.TrimSuffix(name, ext)
+		}
+		name += ".duql.go"
+		if _, ok := sources[name]; ok {
+			return fmt.Errorf("%s: another query is also written to %s; rename one of them", file, name)
+		}
+		sources[name] = src
+		names = append(names, name)
+	}
+
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(out, "db.go"), gogen.DB(pkg), 0o644); err != nil {
+		return err
+	}
+	for i, name := range names {
+		dest := filepath.Join(out, name)
+		if err := os.WriteFile(dest, sources[name], 0o644); err != nil {
+			return err
+		}
+		log.Info(fmt.Sprintf("ℹ️  Generated Go: %s → %s", files[i], dest))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/project"
+	"github.com/theduql/duql/internal/validator"
+)
+
+// graphQueries prints how the queries at path depend on each other through
+// into and dataset, as DOT, Mermaid, JSON or the order they can run in.
+func graphQueries(path string, format string, opts validator.Options) error {
+	files, err := queryFiles(path)
+	if err != nil {
+		return err
+	}
+	root := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+
+	var queries []*duql.Query
+	for _, file := range files {
+		query, err := loadQuery(file, opts)
+		if err != nil {
+			return err
+		}
+		queries = append(queries, query)
+	}
+	g, err := project.New(root, files, queries, opts.Catalog)
+	if err != nil {
+		return fmt.Errorf("unable to build the query graph: %w", err)
+	}
+	return project.Write(os.Stdout, g, format)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/theduql/duql/internal/lineage"
+	"github.com/theduql/duql/internal/validator"
+)
+
+// traceLineage prints the source columns of every output column of the
+// queries at path, as JSON or as a Graphviz DOT graph.
+func traceLineage(path string, format string, opts validator.Options) error {
+	files, err := queryFiles(path)
+	if err != nil {
+		return err
+	}
+
+	var queries []*lineage.Query
+	for _, file := range files {
+		query, err := loadQuery(file, opts)
+		if err != nil {
+			return err
+		}
+		if err := query.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		provider, err := validator.QueryCatalog(file, query, opts)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		queries = append(queries, lineage.Trace(file, query, provider))
+	}
+	return lineage.Write(os.Stdout, queries, format)
+}
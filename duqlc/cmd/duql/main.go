@@ -1,11 +1,18 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/compiler"
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/loader"
 	"github.com/theduql/duql/internal/logger"
 	"github.com/theduql/duql/internal/validator"
 	"go.uber.org/zap"
@@ -93,7 +100,7 @@ func main() {
 			case "Validate":
 				err = validator.Validate(path)
 			case "Generate SQL":
-				err = generateSQL(path)
+				err = generateSQL(path, "", validator.Options{})
 			case "Quit":
 				return
 			}
@@ -107,54 +114,260 @@ func main() {
 	}
 }
 
+const usage = "duql [validate|generate|explain|lineage|graph|build|gen go|run] [--package <name>] [--db <file> | --profile <name> | --memory <MB>] [--max-rows <n>] [--timeout <duration>] [--param <name>=<value> …] [--catalog <file>] [--catalog-ddl <dir>] [--catalog-sqlite <db>] [--target <target> | --targets <target>,… --out <dir>] [--format <format>] [--var <name>=<value> …] [file|directory]"
+
 func handleCommand(args []string) {
 	log := logger.GetLogger()
 
-	if len(args) < 2 {
-		log.Error("Invalid command. To use try: duql [validate|generate] [file|directory]")
+	// build reads the project in the current directory by default; every
+	// other command needs a path.
+	if len(args) < 2 && (len(args) == 0 || args[0] != "build") {
+		log.Error("Invalid command. To use try: " + usage)
 		os.Exit(1)
 	}
 
 	command := args[0]
-	path := args[1]
+	// gen takes the language to generate before its flags.
+	var lang string
+	if command == "gen" {
+		lang = args[1]
+		args = append([]string{command}, args[2:]...)
+	}
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	target := flags.String("target", "", "compile for this target instead of settings.target")
+	targets := flags.String("targets", "", "comma-separated targets to compile every query for")
+	out := flags.String("out", "", "directory to write one subdirectory of SQL files per target to, with --targets (default out); directory to build to, overriding the manifest; directory to write Go to, for gen go (default db)")
+	pkg := flags.String("package", "", "Go package of the generated code (default the base name of --out)")
+	catalogFile := flags.String("catalog", "", "YAML or JSON catalog of the tables queries may read")
+	catalogDDL := flags.String("catalog-ddl", "", "directory or file of SQL DDL to build the catalog from")
+	catalogSQLite := flags.String("catalog-sqlite", "", "SQLite database whose tables and views make up the catalog")
+	format := flags.String("format", "", "output format: tree, json or markdown for explain (default tree); json or dot for lineage (default json); dot, mermaid, order or json for graph (default dot); table, csv, json or ndjson for run (default table)")
+	db := flags.String("db", "", "SQLite database to run the query on, for run")
+	profileName := flags.String("profile", "", "connection in ~/.duql/profiles.yml to run the query on, for run")
+	maxRows := flags.Int("max-rows", 1000, "most rows run prints; 0 prints every row")
+	timeout := flags.Duration("timeout", 30*time.Second, "how long run waits for the query; 0 waits forever")
+	memory := flags.Int64("memory", 0, "megabytes of rows each sort or group holds before spilling to disk, for run without --db or --profile (default 256)")
+	params := make(varFlags)
+	flags.Var(params, "param", "value of a $name parameter as name=value, for run; may be repeated")
+	vars := make(varFlags)
+	flags.Var(vars, "var", "value of a ${name} variable as name=value; may be repeated")
+	if err := flags.Parse(args[1:]); err != nil || flags.NArg() > 1 || (*target != "" && *targets != "") {
+		log.Error("Invalid command. To use try: " + usage)
+		os.Exit(1)
+	}
+	path := flags.Arg(0)
+	if path == "" {
+		if command != "build" {
+			log.Error("Invalid command. To use try: " + usage)
+			os.Exit(1)
+		}
+		path = "."
+	}
+
+	opts := validator.Options{Vars: vars}
+	var catalogs catalog.Chain
+	if *catalogFile != "" {
+		tables, err := catalog.LoadFile(*catalogFile)
+		if err != nil {
+			log.Error(fmt.Sprintf("Unable to Load Catalog: %s", err))
+			os.Exit(1)
+		}
+		catalogs = append(catalogs, tables)
+	}
+	if *catalogDDL != "" {
+		tables, err := catalog.LoadDDL(*catalogDDL)
+		if err != nil {
+			log.Error(fmt.Sprintf("Unable to Load Catalog: %s", err))
+			os.Exit(1)
+		}
+		catalogs = append(catalogs, tables)
+	}
+	if *catalogSQLite != "" {
+		tables, err := catalog.LoadSQLite(*catalogSQLite)
+		if err != nil {
+			log.Error(fmt.Sprintf("Unable to Load Catalog: %s", err))
+			os.Exit(1)
+		}
+		catalogs = append(catalogs, tables)
+	}
+	if len(catalogs) > 0 {
+		opts.Catalog = catalogs
+	}
 
 	switch command {
 	case "validate":
-		err := validator.Validate(path)
+		err := validator.ValidateWith(path, opts)
 		if err != nil {
 			log.Error(fmt.Sprintf("Validation Failed: %s", path))
 			os.Exit(1)
 		}
 		log.Info("Validation Successful!")
 	case "generate":
-		err := generateSQL(path)
+		var err error
+		if *targets != "" {
+			dir := *out
+			if dir == "" {
+				dir = "out"
+			}
+			err = generateTargets(path, strings.Split(*targets, ","), dir, opts)
+		} else {
+			err = generateSQL(path, duql.ParseTargetDialect(*target), opts)
+		}
 		if err != nil {
 			log.Error(fmt.Sprintf("SQL Generation Failed: %s", err))
 			os.Exit(1)
 		}
 		log.Info("SQL Generation Successful!")
+	case "explain":
+		err := explainQueries(path, duql.ParseTargetDialect(*target), *format, opts)
+		if err != nil {
+			log.Error(fmt.Sprintf("Explain Failed: %s", err))
+			os.Exit(1)
+		}
+	case "lineage":
+		err := traceLineage(path, *format, opts)
+		if err != nil {
+			log.Error(fmt.Sprintf("Lineage Failed: %s", err))
+			os.Exit(1)
+		}
+	case "graph":
+		err := graphQueries(path, *format, opts)
+		if err != nil {
+			log.Error(fmt.Sprintf("Graph Failed: %s", err))
+			os.Exit(1)
+		}
+	case "build":
+		err := buildProject(path, duql.ParseTargetDialect(*target), *out, opts)
+		if err != nil {
+			log.Error(fmt.Sprintf("Build Failed: %s", err))
+			os.Exit(1)
+		}
+		log.Info("Build Successful!")
+	case "run":
+		conn, err := connection(*db, *profileName)
+		if err == nil {
+			err = runQuery(path, conn, duql.ParseTargetDialect(*target), *format, *maxRows, *timeout, *memory<<20, params, opts)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("Run Failed: %s", err))
+			os.Exit(1)
+		}
+	case "gen":
+		if lang != "go" {
+			log.Error(fmt.Sprintf("Unknown Language: %s; only go is supported", lang))
+			os.Exit(1)
+		}
+		dir := *out
+		if dir == "" {
+			dir = "db"
+		}
+		name := *pkg
+		if name == "" {
+			name = filepath.Base(dir)
+		}
+		err := genGo(path, duql.ParseTargetDialect(*target), dir, name, opts)
+		if err != nil {
+			log.Error(fmt.Sprintf("Go Generation Failed: %s", err))
+			os.Exit(1)
+		}
+		log.Info("Go Generation Successful!")
 	default:
 		log.Error(fmt.Sprintf("Unkonwn Command: %s", command))
 		os.Exit(1)
 	}
 }
 
-func generateSQL(path string) error {
+// generateSQL compiles every query at path and prints the SQL. Nothing is
+// printed unless all of them compile, so a query that uses a feature the
+// target cannot express never produces partial output.
+func generateSQL(path string, target duql.TargetDialect, opts validator.Options) error {
 	log := logger.GetLogger()
 
+	if target != "" {
+		if _, err := compiler.Capabilities(target); err != nil {
+			return err
+		}
+	}
+
 	// First, validate the input
-	err := validator.Validate(path)
+	err := validator.ValidateWith(path, opts)
 	if err != nil {
 		return fmt.Errorf("validation failed: %w", err)
 	}
 
-	// TODO: Implement DUQL to PRQL conversion
-	// TODO: Implement PRQL to SQL conversion using prqlc
+	files, err := queryFiles(path)
+	if err != nil {
+		return err
+	}
+
+	var results []*compiler.Result
+	for _, file := range files {
+		query, err := loadQuery(file, opts)
+		if err != nil {
+			return err
+		}
+
+		result, err := compiler.Compile(query, compiler.Options{Target: target})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, warning := range result.Warnings {
+			log.Warn(fmt.Sprintf("%s: %s", file, warning))
+		}
+		results = append(results, result)
+	}
 
-	log.Info("SQL generation not yet implemented")
+	for i, result := range results {
+		log.Info(fmt.Sprintf("ℹ️  Generated %s SQL: %s", result.Target, files[i]))
+		fmt.Println(result.SQL)
+	}
+
+	return nil
+}
+
+// varFlags collects the repeated --var name=value flags.
+type varFlags map[string]string
+
+func (v varFlags) String() string {
+	return ""
+}
+
+func (v varFlags) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %s", s)
+	}
+	v[name] = value
 	return nil
 }
 
+func loadQuery(file string, opts validator.Options) (*duql.Query, error) {
+	return loader.Load(file, loader.Options{Vars: opts.Vars})
+}
+
+// queryFiles lists the DUQL files at path, which may be a file or a directory.
+func queryFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && validator.IsQueryFile(file) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
 func promptForPath() (string, error) {
 	fmt.Print("Enter the path to the file or directory: ")
 	var path string
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theduql/duql/internal/compiler"
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/engine"
+	"github.com/theduql/duql/internal/profile"
+	"github.com/theduql/duql/internal/results"
+	"github.com/theduql/duql/internal/validator"
+)
+
+// runQuery compiles the query at path for the target of conn, or for
+// target when it is set, runs it and prints at most maxRows of the rows it
+// returns in the given format. Without conn the query runs in memory on
+// the CSV and NDJSON files it reads, holding about memory bytes of rows
+// per sort or group before spilling to disk. Nothing else is written to
+// stdout, so the rows can be piped.
+func runQuery(path string, conn *profile.Profile, target duql.TargetDialect, format string, maxRows int, timeout time.Duration, memory int64, params map[string]string, opts validator.Options) error {
+	if format != "" && !slices.Contains(results.Formats, format) {
+		return fmt.Errorf("unknown format %s, expected one of %s", format, strings.Join(results.Formats, ", "))
+	}
+	if conn != nil {
+		if target == "" {
+			target = conn.Target
+		}
+		if _, err := compiler.Capabilities(target); err != nil {
+			return err
+		}
+	}
+
+	files, err := queryFiles(path)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return fmt.Errorf("%s: run takes one query, found %d", path, len(files))
+	}
+	file := files[0]
+	query, err := loadQuery(file, opts)
+	if err != nil {
+		return err
+	}
+	if err := query.Validate(); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var rows results.Rows
+	if conn == nil {
+		values, err := engineParams(query.Params, params)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if rows, err = engine.Run(ctx, query, engine.Options{Params: values, MemoryLimit: memory, Dir: filepath.Dir(file)}); err != nil {
+			return queryError(file, err, timeout)
+		}
+	} else {
+		result, err := compiler.Compile(query, compiler.Options{Target: target})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		args, err := bindParams(query.Params, result.Params, params)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		db, err := conn.Open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if rows, err = db.QueryContext(ctx, result.SQL, args...); err != nil {
+			return queryError(file, err, timeout)
+		}
+	}
+	set, err := results.Read(rows, maxRows)
+	if err != nil {
+		return queryError(file, err, timeout)
+	}
+	if set.Truncated && format != "" && format != "table" {
+		fmt.Fprintf(os.Stderr, "stopped after %d rows; raise --max-rows to see more\n", len(set.Rows))
+	}
+	return results.Write(os.Stdout, set, format)
+}
+
+// queryError names file in an error running it, and says how to wait
+// longer when it timed out.
+func queryError(file string, err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%s: stopped after %s; raise --timeout to wait longer", file, timeout)
+	}
+	return fmt.Errorf("%s: %w", file, err)
+}
+
+// connection returns the profile run connects with: the SQLite database
+// db, or the profile called name in the profiles file, or nil when
+// neither is set.
+func connection(db, name string) (*profile.Profile, error) {
+	switch {
+	case db != "" && name != "":
+		return nil, fmt.Errorf("set either --db or --profile, not both")
+	case db != "":
+		return &profile.Profile{Name: db, Driver: "sqlite", DSN: db, Target: duql.SQLite}, nil
+	case name == "":
+		// Without a database the query runs in memory on files.
+		return nil, nil
+	}
+	path, err := profile.Path()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := profile.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return profiles.Get(name)
+}
+
+// bindParams converts the --param values to the types the params are
+// declared with and orders them for the placeholders of the SQL.
+func bindParams(declared duql.Params, params []compiler.Param, values map[string]string) ([]any, error) {
+	for name := range values {
+		if declared.Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown parameter %s; declare it in params", name)
+		}
+	}
+	args := make([]any, len(params))
+	for i, p := range params {
+		value, ok := values[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing value for parameter %s; set it with --param %s=…", p.Name, p.Name)
+		}
+		arg, err := paramValue(p.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+		}
+		switch p.Placeholder[0] {
+		case ':', '@':
+			arg = sql.Named(p.Name, arg)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// engineParams converts the --param values to the types the params are
+// declared with, for a query run in memory. Params without a value are
+// reported if the query uses them.
+func engineParams(declared duql.Params, values map[string]string) (map[string]any, error) {
+	args := make(map[string]any)
+	for name, value := range values {
+		p := declared.Lookup(name)
+		if p == nil {
+			return nil, fmt.Errorf("unknown parameter %s; declare it in params", name)
+		}
+		arg, err := paramValue(p.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %w", name, err)
+		}
+		args[p.Name] = arg
+	}
+	return args, nil
+}
+
+// paramValue parses value as a parameter of type typ.
+func paramValue(typ duql.ParamType, value string) (any, error) {
+	switch typ {
+	case duql.ParamInteger:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %s", value)
+		}
+		return n, nil
+	case duql.ParamNumber:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number, got %s", value)
+		}
+		return f, nil
+	case duql.ParamBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false, got %s", value)
+		}
+		return b, nil
+	case duql.ParamDate:
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return nil, fmt.Errorf("expected a date such as 2024-05-01, got %s", value)
+		}
+	case duql.ParamTimestamp:
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			if _, err := time.Parse(time.DateTime, value); err != nil {
+				return nil, fmt.Errorf("expected a timestamp such as 2024-05-01T12:00:00Z, got %s", value)
+			}
+		}
+	}
+	// Dates and timestamps are passed as text, which the database reads
+	// as the type of what they are compared with.
+	return value, nil
+}
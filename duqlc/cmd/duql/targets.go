@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/theduql/duql/internal/compiler"
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/logger"
+	"github.com/theduql/duql/internal/validator"
+)
+
+// generateTargets compiles every query at path once per target, writing
+// out/<target>/<query>.sql. A query that fails for one target does not stop
+// the others; the failures are reported together at the end.
+func generateTargets(path string, names []string, out string, opts validator.Options) error {
+	log := logger.GetLogger()
+
+	var targets []duql.TargetDialect
+	for _, name := range names {
+		target := duql.ParseTargetDialect(name)
+		if _, err := compiler.Capabilities(target); err != nil {
+			return err
+		}
+		targets = append(targets, target)
+	}
+
+	if err := validator.ValidateWith(path, opts); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	files, err := queryFiles(path)
+	if err != nil {
+		return err
+	}
+
+	// failures maps each target to the files that failed for it.
+	failures := make(map[duql.TargetDialect][]string)
+	for _, file := range files {
+		query, err := loadQuery(file, opts)
+		if err != nil {
+			return err
+		}
+		name, err := outputName(path, file)
+		if err != nil {
+			return err
+		}
+
+		for _, target := range targets {
+			result, err := compiler.Compile(query, compiler.Options{Target: target})
+			if err != nil {
+				failures[target] = append(failures[target], fmt.Sprintf("%s: %s", file, err))
+				continue
+			}
+			for _, warning := range result.Warnings {
+				log.Warn(fmt.Sprintf("%s (%s): %s", file, target, warning))
+			}
+
+			dest := filepath.Join(out, strings.TrimPrefix(string(target), "sql."), name)
+			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(dest, []byte(result.SQL+"\n"), 0o644); err != nil {
+				return err
+			}
+			log.Info(fmt.Sprintf("ℹ️  Generated %s SQL: %s", target, dest))
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+	failed := make([]string, 0, len(failures))
+	for target := range failures {
+		failed = append(failed, string(target))
+	}
+	sort.Strings(failed)
+	for _, target := range failed {
+		for _, failure := range failures[duql.TargetDialect(target)] {
+			log.Error(fmt.Sprintf("❌ %s: %s", target, failure))
+		}
+	}
+	return fmt.Errorf("failed for %s", strings.Join(failed, ", "))
+}
+
+// outputName is the path of the SQL file for a query, relative to the
+// target directory, mirroring the layout of the input directory.
+func outputName(root, file string) (string, error) {
+	rel := filepath.Base(file)
+	if info, err := os.Stat(root); err == nil && info.IsDir() {
+		var err error
+		if rel, err = filepath.Rel(root, file); err != nil {
+			return "", err
+		}
+	}
+	for _, ext := range []string{".yaml", ".yml", ".duql"} {
+		rel = strings.TrimSuffix(rel, ext)
+	}
+	return rel + ".sql", nil
+}
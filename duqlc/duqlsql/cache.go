@@ -0,0 +1,54 @@
+package duqlsql
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cache keeps the most recently used compiled queries, keyed by the hash
+// of their source.
+type cache struct {
+	mu   sync.Mutex
+	size int
+	// order holds the entries, the most recently used first.
+	order   *list.List
+	entries map[[32]byte]*list.Element
+}
+
+type cacheEntry struct {
+	key  [32]byte
+	stmt *statement
+}
+
+func newCache(size int) *cache {
+	return &cache{size: size, order: list.New(), entries: make(map[[32]byte]*list.Element)}
+}
+
+func (c *cache) get(key [32]byte) (*statement, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).stmt, true
+}
+
+// add keeps stmt, dropping the least recently used query when the cache
+// is full.
+func (c *cache) add(key [32]byte, stmt *statement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cacheEntry).stmt = stmt
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, stmt: stmt})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
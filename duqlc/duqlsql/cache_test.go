@@ -0,0 +1,34 @@
+package duqlsql
+
+import "testing"
+
+func TestCache(t *testing.T) {
+	key := func(b byte) [32]byte { return [32]byte{b} }
+	stmt := func(s string) *statement { return &statement{sql: s} }
+
+	c := newCache(2)
+	c.add(key(1), stmt("one"))
+	c.add(key(2), stmt("two"))
+	if got, ok := c.get(key(1)); !ok || got.sql != "one" {
+		t.Fatalf("get(1) = %v, %v", got, ok)
+	}
+	// 2 is now the least recently used, so adding 3 drops it.
+	c.add(key(3), stmt("three"))
+	if _, ok := c.get(key(2)); ok {
+		t.Error("get(2) found a dropped query")
+	}
+	for b, want := range map[byte]string{1: "one", 3: "three"} {
+		if got, ok := c.get(key(b)); !ok || got.sql != want {
+			t.Errorf("get(%d) = %v, %v, want %s", b, got, ok, want)
+		}
+	}
+
+	// Adding a key again replaces its query without growing the cache.
+	c.add(key(1), stmt("uno"))
+	if got, _ := c.get(key(1)); got.sql != "uno" {
+		t.Errorf("get(1) = %s, want uno", got.sql)
+	}
+	if c.order.Len() != 2 || len(c.entries) != 2 {
+		t.Errorf("cache holds %d entries and %d keys, want 2", c.order.Len(), len(c.entries))
+	}
+}
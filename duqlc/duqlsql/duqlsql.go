@@ -0,0 +1,223 @@
+// Package duqlsql runs DUQL queries on any database/sql driver. A query is
+// compiled for the dialect of the database the first time it runs, and the
+// SQL is cached for the next time, so tools can take DUQL from their users
+// wherever they took SQL.
+package duqlsql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/theduql/duql/internal/compiler"
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/loader"
+)
+
+// DefaultCacheSize is how many compiled queries a DB keeps unless
+// Options.CacheSize says otherwise.
+const DefaultCacheSize = 256
+
+// Options configure a DB.
+type Options struct {
+	// Target is the dialect queries are compiled for, such as sql.postgres
+	// or postgres. Without one, each query is compiled for its
+	// settings.target.
+	Target string
+	// Dir is where the files queries import or read as datasets are looked
+	// up. Defaults to the working directory.
+	Dir string
+	// Vars are values for ${name} variables. The environment is read when
+	// a query is first compiled, not each time it runs.
+	Vars map[string]string
+	// CacheSize is how many compiled queries are kept.
+	CacheSize int
+}
+
+// DB is a database whose Query and Exec methods take DUQL. The embedded
+// *sql.DB is left as is, so its other methods, such as Prepare and
+// QueryRow, still take SQL.
+type DB struct {
+	*sql.DB
+	target duql.TargetDialect
+	opts   Options
+	cache  *cache
+}
+
+// Open opens a database with the driver registered as driverName, like
+// sql.Open.
+func Open(driverName, dataSourceName string, opts Options) (*DB, error) {
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := New(db, opts)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return wrapped, nil
+}
+
+// New runs DUQL queries on db.
+func New(db *sql.DB, opts Options) (*DB, error) {
+	var target duql.TargetDialect
+	if opts.Target != "" {
+		target = duql.ParseTargetDialect(opts.Target)
+		if _, err := compiler.Capabilities(target); err != nil {
+			return nil, err
+		}
+	}
+	size := opts.CacheSize
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &DB{DB: db, target: target, opts: opts, cache: newCache(size)}, nil
+}
+
+// QueryContext compiles query and runs it. Its arguments are either
+// sql.Named values naming the params of the query, or one value per param
+// in the order they are declared; they are passed to the driver the way
+// the placeholders of the dialect want them.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := db.statement(query)
+	if err != nil {
+		return nil, err
+	}
+	bound, err := stmt.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	return db.DB.QueryContext(ctx, stmt.sql, bound...)
+}
+
+// Query is QueryContext with the background context.
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// ExecContext compiles query, such as one writing into a table, and runs
+// it without returning rows. Its arguments are those of QueryContext.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := db.statement(query)
+	if err != nil {
+		return nil, err
+	}
+	bound, err := stmt.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	return db.DB.ExecContext(ctx, stmt.sql, bound...)
+}
+
+// Exec is ExecContext with the background context.
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// Compile returns the SQL query runs as, to use with a *sql.Tx or
+// *sql.Stmt. The SQL takes its arguments in the order and form of the
+// placeholders of the dialect.
+func (db *DB) Compile(query string) (string, error) {
+	stmt, err := db.statement(query)
+	if err != nil {
+		return "", err
+	}
+	return stmt.sql, nil
+}
+
+// statement is a compiled query.
+type statement struct {
+	sql string
+	// declared are the names of the params of the query in the order they
+	// are declared, which positional arguments follow.
+	declared []string
+	params   []compiler.Param
+}
+
+// statement compiles query, or returns it from the cache.
+func (db *DB) statement(query string) (*statement, error) {
+	key := sha256.Sum256([]byte(query))
+	if stmt, ok := db.cache.get(key); ok {
+		return stmt, nil
+	}
+
+	dir := db.opts.Dir
+	if dir == "" {
+		dir = "."
+	}
+	q, err := loader.Parse(filepath.Join(dir, "query"), []byte(query), loader.Options{Vars: db.opts.Vars})
+	if err != nil {
+		return nil, err
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	res, err := compiler.Compile(q, compiler.Options{Target: db.target})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Params) > 0 && strings.Contains(res.Params[0].Placeholder, "{") {
+		return nil, fmt.Errorf("%s binds params with clickhouse.WithParameters, which database/sql cannot pass", res.Target)
+	}
+
+	stmt := &statement{sql: res.SQL, params: res.Params}
+	for _, p := range q.Params {
+		stmt.declared = append(stmt.declared, p.Name)
+	}
+	db.cache.add(key, stmt)
+	return stmt, nil
+}
+
+// bind orders args for the placeholders of the SQL: one per ?, one per
+// number for $1, and a sql.Named value per name for :name and @name.
+func (s *statement) bind(args []any) ([]any, error) {
+	values := make(map[string]any, len(args))
+	named := 0
+	for _, arg := range args {
+		if n, ok := arg.(sql.NamedArg); ok {
+			if !s.declares(n.Name) {
+				return nil, fmt.Errorf("unknown parameter %s; declare it in params", n.Name)
+			}
+			values[n.Name] = n.Value
+			named++
+		}
+	}
+	switch {
+	case named == len(args):
+	case named > 0:
+		return nil, fmt.Errorf("arguments must all be named or all be positional")
+	case len(args) != len(s.declared):
+		return nil, fmt.Errorf("query declares %d params, got %d arguments", len(s.declared), len(args))
+	default:
+		for i, arg := range args {
+			values[s.declared[i]] = arg
+		}
+	}
+
+	bound := make([]any, len(s.params))
+	for i, p := range s.params {
+		value, ok := values[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing argument for parameter %s", p.Name)
+		}
+		switch p.Placeholder[0] {
+		case ':', '@':
+			value = sql.Named(p.Name, value)
+		}
+		bound[i] = value
+	}
+	return bound, nil
+}
+
+func (s *statement) declares(name string) bool {
+	for _, d := range s.declared {
+		if d == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package duqlsql
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/theduql/duql/internal/compiler"
+)
+
+func TestBind(t *testing.T) {
+	declared := []string{"user_id", "since"}
+	tests := []struct {
+		name   string
+		params []compiler.Param
+		args   []any
+		want   []any
+		err    string
+	}{
+		{
+			name:   "positional for question marks",
+			params: []compiler.Param{{Name: "user_id", Placeholder: "?"}, {Name: "since", Placeholder: "?"}, {Name: "user_id", Placeholder: "?"}},
+			args:   []any{7, "2024-01-01"},
+			want:   []any{7, "2024-01-01", 7},
+		},
+		{
+			name:   "named for numbers",
+			params: []compiler.Param{{Name: "since", Placeholder: "$1"}, {Name: "user_id", Placeholder: "$2"}},
+			args:   []any{sql.Named("user_id", 7), sql.Named("since", "2024-01-01")},
+			want:   []any{"2024-01-01", 7},
+		},
+		{
+			name:   "positional for names",
+			params: []compiler.Param{{Name: "user_id", Placeholder: "@user_id"}, {Name: "since", Placeholder: "@since"}},
+			args:   []any{7, "2024-01-01"},
+			want:   []any{sql.Named("user_id", 7), sql.Named("since", "2024-01-01")},
+		},
+		{
+			name:   "too few",
+			params: []compiler.Param{{Name: "user_id", Placeholder: "?"}},
+			args:   []any{7},
+			err:    "query declares 2 params, got 1 arguments",
+		},
+		{
+			name:   "mixed",
+			params: []compiler.Param{{Name: "user_id", Placeholder: "?"}},
+			args:   []any{7, sql.Named("since", "2024-01-01")},
+			err:    "arguments must all be named or all be positional",
+		},
+		{
+			name:   "unknown name",
+			params: []compiler.Param{{Name: "user_id", Placeholder: "?"}},
+			args:   []any{sql.Named("until", "2024-01-01")},
+			err:    "unknown parameter until; declare it in params",
+		},
+		{
+			name:   "missing name",
+			params: []compiler.Param{{Name: "user_id", Placeholder: "$1"}, {Name: "since", Placeholder: "$2"}},
+			args:   []any{sql.Named("user_id", 7)},
+			err:    "missing argument for parameter since",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &statement{declared: declared, params: tt.params}
+			got, err := s.bind(tt.args)
+			switch {
+			case tt.err != "":
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("got error %v, want %s", err, tt.err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	db, err := Open("sqlite", ":memory:", Options{Target: "sqlite", CacheSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.DB.Exec(`CREATE TABLE users (id INTEGER, name TEXT, age INTEGER);
+		INSERT INTO users VALUES (1, 'ada', 36), (2, 'alan', 41), (3, 'grace', 85)`); err != nil {
+		t.Fatal(err)
+	}
+
+	const query = `
+params:
+  min_age: integer
+  max_age: integer
+dataset: users
+steps:
+  - filter: age >= $min_age && age <= $max_age
+  - sort: id
+  - select: [name]`
+	for _, args := range [][]any{
+		{40, 90},
+		{sql.Named("max_age", 90), sql.Named("min_age", 40)},
+	} {
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, name)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		rows.Close()
+		if want := []string{"alan", "grace"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("Query(%v) = %v, want %v", args, names, want)
+		}
+	}
+
+	key := sha256.Sum256([]byte(query))
+	if _, ok := db.cache.get(key); !ok {
+		t.Error("the compiled query is not cached")
+	}
+	if _, err := db.Compile("dataset: users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.cache.get(key); ok {
+		t.Error("the cache kept more queries than its size")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	if _, err := New(nil, Options{Target: "nosuchdb"}); err == nil {
+		t.Error("New accepted an unknown target")
+	}
+	db, err := New(nil, Options{Target: "clickhouse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Compile("params: {n: integer}\ndataset: t\nsteps:\n  - filter: a == $n")
+	if err == nil || !strings.Contains(err.Error(), "clickhouse.WithParameters") {
+		t.Errorf("got error %v, want clickhouse params rejected", err)
+	}
+	if _, err := db.Compile("dataset: t\nsteps:\n  - filter: a == $n"); err == nil {
+		t.Error("Compile accepted an undeclared param")
+	}
+}
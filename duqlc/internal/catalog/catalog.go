@@ -0,0 +1,99 @@
+// Package catalog describes the tables and columns a query can read from.
+package catalog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider looks up table definitions.
+type Provider interface {
+	// Table returns the table with the given name, which may be qualified
+	// with a schema, or nil when the provider does not know it.
+	Table(name string) (*Table, error)
+}
+
+type Table struct {
+	Name        string   `yaml:"name,omitempty" json:"name,omitempty"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Columns     []Column `yaml:"columns" json:"columns"`
+	// Open means the table may have columns besides Columns, as the result
+	// of a query whose columns are not all known does.
+	Open bool `yaml:"open,omitempty" json:"open,omitempty"`
+}
+
+type Column struct {
+	Name        string `yaml:"name" json:"name"`
+	Type        string `yaml:"type,omitempty" json:"type,omitempty"`
+	Nullable    bool   `yaml:"nullable" json:"nullable"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// Column returns the column with the given name, or nil. Names are
+// compared without regard to case, as most databases do for unquoted names.
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if strings.EqualFold(t.Columns[i].Name, name) {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// Chain asks each provider in turn and returns the first table found.
+type Chain []Provider
+
+func (c Chain) Table(name string) (*Table, error) {
+	for _, p := range c {
+		t, err := p.Table(name)
+		if err != nil || t != nil {
+			return t, err
+		}
+	}
+	return nil, nil
+}
+
+// Unlisted knows every table but none of its columns. At the end of a
+// chain, it lets queries read tables the other providers do not list.
+type Unlisted struct{}
+
+func (Unlisted) Table(name string) (*Table, error) {
+	return &Table{Name: name, Open: true}, nil
+}
+
+// Tables is a provider backed by a map of table definitions. Lookups try
+// the name as given, then without schema qualifiers on either side,
+// ignoring case. A name that matches several tables is an error rather
+// than one of them.
+type Tables map[string]*Table
+
+func (ts Tables) Table(name string) (*Table, error) {
+	if t, ok := ts[name]; ok {
+		return t, nil
+	}
+	for _, match := range []func(key string) bool{
+		func(key string) bool { return strings.EqualFold(key, name) },
+		func(key string) bool { return strings.EqualFold(unqualified(key), unqualified(name)) },
+	} {
+		var keys []string
+		for key := range ts {
+			if match(key) {
+				keys = append(keys, key)
+			}
+		}
+		switch len(keys) {
+		case 0:
+			continue
+		case 1:
+			return ts[keys[0]], nil
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("table %s is ambiguous; qualify it as one of %s", name, strings.Join(keys, ", "))
+	}
+	return nil, nil
+}
+
+func unqualified(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,60 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTablesTable(t *testing.T) {
+	ts := Tables{
+		"public.users":     {Name: "public.users"},
+		"analytics.events": {Name: "analytics.events"},
+		"staging.events":   {Name: "staging.events"},
+		"Orders":           {Name: "Orders"},
+	}
+	tests := []struct {
+		name string
+		want string
+		err  string
+	}{
+		{name: "public.users", want: "public.users"},
+		{name: "users", want: "public.users"},
+		{name: "other.users", want: "public.users"},
+		{name: "PUBLIC.USERS", want: "public.users"},
+		{name: "orders", want: "Orders"},
+		{name: "analytics.events", want: "analytics.events"},
+		{name: "events", err: "table events is ambiguous; qualify it as one of analytics.events, staging.events"},
+		{name: "missing"},
+	}
+	for _, tt := range tests {
+		got, err := ts.Table(tt.name)
+		switch {
+		case tt.err != "":
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Table(%s): got error %v, want %s", tt.name, err, tt.err)
+			}
+		case err != nil:
+			t.Errorf("Table(%s): %v", tt.name, err)
+		case tt.want == "" && got != nil:
+			t.Errorf("Table(%s) = %s, want none", tt.name, got.Name)
+		case tt.want != "" && (got == nil || got.Name != tt.want):
+			t.Errorf("Table(%s) = %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	c := Chain{Tables{"users": {Name: "users"}}, Unlisted{}}
+	if got, _ := c.Table("users"); got == nil || got.Open {
+		t.Errorf("Table(users) = %+v, want the listed table", got)
+	}
+	got, err := c.Table("raw.events")
+	if err != nil || got == nil || !got.Open || got.Name != "raw.events" {
+		t.Errorf("Table(raw.events) = %+v, %v, want an open table", got, err)
+	}
+
+	ambiguous := Chain{Tables{"a.t": {}, "b.t": {}}, Unlisted{}}
+	if _, err := ambiguous.Table("t"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("got error %v, want the ambiguity reported", err)
+	}
+}
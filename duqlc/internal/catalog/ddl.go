@@ -0,0 +1,692 @@
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadDDL builds a catalog from the CREATE TABLE, ALTER TABLE and CREATE
+// VIEW statements in the .sql files of a directory, or in a single .sql
+// file. Files are read in name order, as migration tools apply them.
+// Statements the catalog has no use for, such as inserts and indexes, are
+// skipped.
+func LoadDDL(path string) (Tables, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && strings.EqualFold(filepath.Ext(file), ".sql") {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+	}
+
+	d := &ddl{tables: make(Tables)}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.parse(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return d.tables, nil
+}
+
+type ddl struct {
+	tables Tables
+}
+
+// tokenKind distinguishes the tokens of a SQL statement.
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	// quotedToken is a quoted identifier, already unquoted.
+	quotedToken
+	stringToken
+	punctToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// is reports whether t is the keyword or punctuation s.
+func (t token) is(s string) bool {
+	return (t.kind == wordToken || t.kind == punctToken) && strings.EqualFold(t.text, s)
+}
+
+// statements splits SQL text into tokenized statements, dropping comments.
+func statements(sql string) ([][]token, error) {
+	var stmts [][]token
+	var cur []token
+	for i := 0; i < len(sql); {
+		ch := sql[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case ch == ';':
+			if len(cur) > 0 {
+				stmts = append(stmts, cur)
+			}
+			cur = nil
+			i++
+		case ch == '\'' || ch == '"' || ch == '`':
+			text, n, err := quoted(sql[i:], ch)
+			if err != nil {
+				return nil, err
+			}
+			kind := quotedToken
+			if ch == '\'' {
+				kind = stringToken
+			}
+			cur = append(cur, token{kind, text})
+			i += n
+		case ch == '[':
+			end := strings.IndexByte(sql[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated identifier")
+			}
+			cur = append(cur, token{quotedToken, sql[i+1 : i+end]})
+			i += end + 1
+		case ch == '$':
+			// A dollar-quoted string such as $$ … $$ or $body$ … $body$.
+			end := strings.IndexByte(sql[i+1:], '$')
+			tag := ""
+			if end >= 0 {
+				tag = sql[i : i+end+2]
+			}
+			if tag == "" || strings.ContainsAny(tag[1:len(tag)-1], " \t\n;") {
+				cur = append(cur, token{punctToken, "$"})
+				i++
+				continue
+			}
+			close := strings.Index(sql[i+len(tag):], tag)
+			if close < 0 {
+				return nil, fmt.Errorf("unterminated %s string", tag)
+			}
+			cur = append(cur, token{stringToken, sql[i+len(tag) : i+len(tag)+close]})
+			i += len(tag) + close + len(tag)
+		case isWordByte(ch):
+			start := i
+			for i < len(sql) && isWordByte(sql[i]) {
+				i++
+			}
+			cur = append(cur, token{wordToken, sql[start:i]})
+		default:
+			cur = append(cur, token{punctToken, string(ch)})
+			i++
+		}
+	}
+	if len(cur) > 0 {
+		stmts = append(stmts, cur)
+	}
+	return stmts, nil
+}
+
+func isWordByte(ch byte) bool {
+	return ch == '_' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= 0x80
+}
+
+// quoted reads a string or identifier starting with q, where a doubled q
+// stands for itself. It returns the unquoted text and the length read.
+func quoted(s string, q byte) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && q == '\'' && i+1 < len(s) {
+			// MySQL style escapes; harmless for the text the catalog keeps.
+			b.WriteByte(s[i+1])
+			i++
+			continue
+		}
+		if s[i] != q {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == q {
+			b.WriteByte(q)
+			i++
+			continue
+		}
+		return b.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("unterminated %c", q)
+}
+
+func (d *ddl) parse(sql string) error {
+	stmts, err := statements(sql)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		p := &ddlParser{toks: stmt}
+		switch {
+		case p.accept("CREATE"):
+			p.accept("OR", "REPLACE")
+			p.acceptAny("TEMP", "TEMPORARY", "GLOBAL", "LOCAL", "UNLOGGED", "EXTERNAL", "TRANSIENT")
+			p.acceptAny("TEMP", "TEMPORARY")
+			switch {
+			case p.accept("TABLE"):
+				d.createTable(p)
+			case p.accept("VIEW"), p.accept("MATERIALIZED", "VIEW"):
+				d.createView(p)
+			}
+		case p.accept("ALTER", "TABLE"):
+			d.alterTable(p)
+		case p.accept("DROP"):
+			if p.acceptAny("TABLE", "VIEW") || p.accept("MATERIALIZED", "VIEW") {
+				p.accept("IF", "EXISTS")
+				if name, ok := p.name(); ok {
+					d.drop(name)
+				}
+			}
+		case p.accept("COMMENT", "ON", "COLUMN"):
+			d.commentOnColumn(p)
+		}
+	}
+	return nil
+}
+
+// ddlParser walks the tokens of one statement.
+type ddlParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *ddlParser) peek() token {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return token{kind: punctToken}
+}
+
+func (p *ddlParser) done() bool {
+	return p.pos >= len(p.toks)
+}
+
+// accept consumes the words if they come next.
+func (p *ddlParser) accept(words ...string) bool {
+	if p.pos+len(words) > len(p.toks) {
+		return false
+	}
+	for i, w := range words {
+		if !p.toks[p.pos+i].is(w) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+// acceptAny consumes one of the words if it comes next.
+func (p *ddlParser) acceptAny(words ...string) bool {
+	for _, w := range words {
+		if p.accept(w) {
+			return true
+		}
+	}
+	return false
+}
+
+// ident reads a plain or quoted identifier.
+func (p *ddlParser) ident() (string, bool) {
+	t := p.peek()
+	if p.done() || (t.kind != wordToken && t.kind != quotedToken) {
+		return "", false
+	}
+	p.pos++
+	return t.text, true
+}
+
+// name reads a possibly qualified name such as schema.table.
+func (p *ddlParser) name() (string, bool) {
+	part, ok := p.ident()
+	if !ok {
+		return "", false
+	}
+	parts := []string{part}
+	for p.peek().is(".") {
+		p.pos++
+		part, ok := p.ident()
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "."), true
+}
+
+// group returns the tokens up to the parenthesis closing the one just
+// consumed, split at top level commas.
+func (p *ddlParser) group() [][]token {
+	var items [][]token
+	var cur []token
+	depth := 0
+	for ; !p.done(); p.pos++ {
+		t := p.peek()
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")") && depth == 0:
+			p.pos++
+			return append(items, cur)
+		case t.is(")"):
+			depth--
+		case t.is(",") && depth == 0:
+			items = append(items, cur)
+			cur = nil
+			continue
+		}
+		cur = append(cur, t)
+	}
+	return append(items, cur)
+}
+
+func (d *ddl) createTable(p *ddlParser) {
+	p.accept("IF", "NOT", "EXISTS")
+	name, ok := p.name()
+	if !ok || !p.accept("(") {
+		// CREATE TABLE … AS SELECT has no column list to read.
+		return
+	}
+	t := &Table{Name: name}
+	for _, item := range p.group() {
+		if len(item) == 0 || isTableConstraint(item[0]) {
+			continue
+		}
+		if col, ok := columnDef(item); ok {
+			t.Columns = append(t.Columns, col)
+		}
+	}
+	// MySQL table options may include COMMENT = '…'.
+	for ; !p.done(); p.pos++ {
+		if p.accept("COMMENT") {
+			p.accept("=")
+			if desc := p.peek(); desc.kind == stringToken {
+				t.Description = desc.text
+			}
+			break
+		}
+	}
+	d.tables[name] = t
+}
+
+func isTableConstraint(t token) bool {
+	if t.kind != wordToken {
+		return false
+	}
+	switch strings.ToUpper(t.text) {
+	case "CONSTRAINT", "PRIMARY", "FOREIGN", "UNIQUE", "CHECK", "KEY", "INDEX", "EXCLUDE", "FULLTEXT", "SPATIAL", "PERIOD", "LIKE":
+		return true
+	}
+	return false
+}
+
+// columnOptions start the part of a column definition after its type.
+var columnOptions = map[string]bool{
+	"NOT": true, "NULL": true, "DEFAULT": true, "PRIMARY": true, "REFERENCES": true,
+	"UNIQUE": true, "CHECK": true, "CONSTRAINT": true, "COLLATE": true,
+	"GENERATED": true, "AUTO_INCREMENT": true, "AUTOINCREMENT": true,
+	"COMMENT": true, "IDENTITY": true, "AS": true, "ON": true, "CHARACTER": true,
+	"CHARSET": true, "ENCODE": true, "OPTIONS": true, "MASKING": true, "WITH": true,
+}
+
+// columnDef reads `name type [options]`.
+func columnDef(item []token) (Column, bool) {
+	if item[0].kind != wordToken && item[0].kind != quotedToken {
+		return Column{}, false
+	}
+	col := Column{Name: item[0].text, Nullable: true}
+
+	i := 1
+	var typ strings.Builder
+	depth := 0
+	for ; i < len(item); i++ {
+		t := item[i]
+		if depth == 0 && t.kind == wordToken && columnOptions[strings.ToUpper(t.text)] {
+			// CHARACTER VARYING is a type, not a character set, and so is
+			// TIMESTAMP WITH TIME ZONE.
+			character := strings.EqualFold(t.text, "CHARACTER") && i == 1
+			zone := t.is("WITH") && i+1 < len(item) && item[i+1].is("TIME")
+			if !character && !zone {
+				break
+			}
+		}
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		}
+		if typ.Len() > 0 && t.kind == wordToken && !strings.HasSuffix(typ.String(), "(") && !strings.HasSuffix(typ.String(), " ") {
+			typ.WriteByte(' ')
+		}
+		typ.WriteString(t.text)
+		if t.is(",") {
+			typ.WriteByte(' ')
+		}
+	}
+	col.Type = strings.ToLower(typ.String())
+
+	for ; i < len(item); i++ {
+		t := item[i]
+		switch {
+		case t.is("NOT") && i+1 < len(item) && item[i+1].is("NULL"):
+			col.Nullable = false
+			i++
+		case t.is("PRIMARY"):
+			col.Nullable = false
+		case t.is("COMMENT") && i+1 < len(item) && item[i+1].kind == stringToken:
+			col.Description = item[i+1].text
+			i++
+		}
+	}
+	return col, true
+}
+
+func (d *ddl) alterTable(p *ddlParser) {
+	p.accept("IF", "EXISTS")
+	p.accept("ONLY")
+	name, ok := p.name()
+	if !ok {
+		return
+	}
+	t, _ := d.tables.Table(name)
+	if t == nil {
+		return
+	}
+	var action []token
+	actions := [][]token{}
+	depth := 0
+	for ; !p.done(); p.pos++ {
+		tok := p.peek()
+		switch {
+		case tok.is("("):
+			depth++
+		case tok.is(")"):
+			depth--
+		case tok.is(",") && depth == 0:
+			actions = append(actions, action)
+			action = nil
+			continue
+		}
+		action = append(action, tok)
+	}
+	actions = append(actions, action)
+
+	for _, action := range actions {
+		a := &ddlParser{toks: action}
+		switch {
+		case a.accept("ADD"):
+			a.accept("COLUMN")
+			a.accept("IF", "NOT", "EXISTS")
+			if a.done() || isTableConstraint(a.peek()) {
+				continue
+			}
+			if col, ok := columnDef(a.toks[a.pos:]); ok && t.Column(col.Name) == nil {
+				t.Columns = append(t.Columns, col)
+			}
+		case a.accept("DROP"):
+			a.accept("COLUMN")
+			a.accept("IF", "EXISTS")
+			if col, ok := a.ident(); ok {
+				t.dropColumn(col)
+			}
+		case a.accept("RENAME", "COLUMN"), a.accept("RENAME"):
+			from, ok := a.ident()
+			if ok && a.accept("TO") {
+				to, ok := a.ident()
+				if col := t.Column(from); ok && col != nil {
+					col.Name = to
+				}
+			}
+		case a.accept("ALTER"), a.accept("MODIFY"):
+			a.accept("COLUMN")
+			col, ok := a.ident()
+			if c := t.Column(col); ok && c != nil {
+				switch {
+				case a.accept("SET", "NOT", "NULL"):
+					c.Nullable = false
+				case a.accept("DROP", "NOT", "NULL"):
+					c.Nullable = true
+				case a.accept("TYPE"), a.accept("SET", "DATA", "TYPE"):
+					if def, ok := columnDef(append([]token{{wordToken, col}}, a.toks[a.pos:]...)); ok {
+						c.Type = def.Type
+					}
+				}
+			}
+		}
+	}
+}
+
+func (t *Table) dropColumn(name string) {
+	for i, col := range t.Columns {
+		if strings.EqualFold(col.Name, name) {
+			t.Columns = append(t.Columns[:i], t.Columns[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *ddl) drop(name string) {
+	for key := range d.tables {
+		if strings.EqualFold(key, name) {
+			delete(d.tables, key)
+		}
+	}
+}
+
+func (d *ddl) commentOnColumn(p *ddlParser) {
+	name, ok := p.name()
+	if !ok || !p.accept("IS") || p.peek().kind != stringToken {
+		return
+	}
+	dot := strings.LastIndex(name, ".")
+	if dot < 0 {
+		return
+	}
+	t, _ := d.tables.Table(name[:dot])
+	if t == nil {
+		return
+	}
+	if col := t.Column(name[dot+1:]); col != nil {
+		col.Description = p.peek().text
+	}
+}
+
+// createView reads the column list of a view, either given explicitly or
+// taken from the names in its SELECT list.
+func (d *ddl) createView(p *ddlParser) {
+	p.accept("IF", "NOT", "EXISTS")
+	name, ok := p.name()
+	if !ok {
+		return
+	}
+	t := &Table{Name: name}
+	if p.accept("(") {
+		for _, item := range p.group() {
+			if len(item) > 0 {
+				t.Columns = append(t.Columns, Column{Name: item[0].text, Nullable: true})
+			}
+		}
+		d.tables[name] = t
+		return
+	}
+	for !p.done() && !p.accept("AS") {
+		p.pos++
+	}
+	cols, ok := d.selectColumns(p)
+	if !ok {
+		// A view whose columns cannot be worked out is left out, so that its
+		// columns are not reported as unknown.
+		return
+	}
+	t.Columns = cols
+	d.tables[name] = t
+}
+
+// selectColumns reads the output columns of a SELECT, resolving * against
+// the tables of its FROM clause. It fails when a column has no name that
+// can be known without running the query.
+func (d *ddl) selectColumns(p *ddlParser) ([]Column, bool) {
+	for p.peek().is("(") {
+		p.pos++
+	}
+	if !p.accept("SELECT") {
+		return nil, false
+	}
+	p.acceptAny("DISTINCT", "ALL")
+
+	var items [][]token
+	var cur []token
+	depth := 0
+	for ; !p.done(); p.pos++ {
+		t := p.peek()
+		if depth == 0 && t.is("FROM") {
+			break
+		}
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case t.is(",") && depth == 0:
+			items = append(items, cur)
+			cur = nil
+			continue
+		}
+		cur = append(cur, t)
+	}
+	items = append(items, cur)
+
+	// Tables in FROM and JOIN clauses, by name and alias.
+	from := make(map[string]*Table)
+	var order []*Table
+	for !p.done() {
+		t := p.peek()
+		p.pos++
+		if !(t.is("FROM") || t.is("JOIN") || t.is(",")) {
+			continue
+		}
+		name, ok := p.name()
+		if !ok {
+			continue
+		}
+		table, _ := d.tables.Table(name)
+		if table == nil {
+			continue
+		}
+		order = append(order, table)
+		from[strings.ToLower(name[strings.LastIndex(name, ".")+1:])] = table
+		p.accept("AS")
+		if alias, ok := p.ident(); ok && !isClauseWord(alias) {
+			from[strings.ToLower(alias)] = table
+		} else if ok {
+			p.pos--
+		}
+	}
+	return d.viewColumns(items, from, order)
+}
+
+func isClauseWord(s string) bool {
+	switch strings.ToUpper(s) {
+	case "WHERE", "JOIN", "LEFT", "RIGHT", "FULL", "INNER", "OUTER", "CROSS", "ON",
+		"USING", "GROUP", "ORDER", "HAVING", "LIMIT", "UNION", "WINDOW", "QUALIFY", "NATURAL":
+		return true
+	}
+	return false
+}
+
+func (d *ddl) viewColumns(items [][]token, from map[string]*Table, order []*Table) ([]Column, bool) {
+	var cols []Column
+	for _, item := range items {
+		n := len(item)
+		switch {
+		case n == 0:
+			return nil, false
+		case n == 1 && item[0].is("*"):
+			if len(order) == 0 {
+				return nil, false
+			}
+			for _, t := range order {
+				cols = append(cols, t.Columns...)
+			}
+			continue
+		case n == 3 && item[1].is(".") && item[2].is("*"):
+			t := from[strings.ToLower(item[0].text)]
+			if t == nil {
+				return nil, false
+			}
+			cols = append(cols, t.Columns...)
+			continue
+		}
+
+		// An alias is the last word after AS, after a closing parenthesis,
+		// or after a lone column reference.
+		alias := ""
+		if last := item[n-1]; n >= 2 && (last.kind == wordToken || last.kind == quotedToken) &&
+			(item[n-2].is("AS") || item[n-2].is(")") || n == 2 && item[0].kind != punctToken) {
+			alias = last.text
+			item = item[:n-1]
+			if item[len(item)-1].is("AS") {
+				item = item[:len(item)-1]
+			}
+		}
+
+		// A column reference such as status or o.status keeps the type of
+		// the column it refers to, when the table is known.
+		col := Column{Nullable: true}
+		switch {
+		case len(item) == 1 && (item[0].kind == wordToken || item[0].kind == quotedToken):
+			col.Name = item[0].text
+			for _, t := range order {
+				if c := t.Column(col.Name); c != nil {
+					col = *c
+					break
+				}
+			}
+		case len(item) == 3 && item[1].is(".") && item[2].kind != punctToken:
+			col.Name = item[2].text
+			if t := from[strings.ToLower(item[0].text)]; t != nil {
+				if c := t.Column(col.Name); c != nil {
+					col = *c
+				}
+			}
+		case alias == "":
+			return nil, false
+		}
+		if alias != "" {
+			col.Name = alias
+		}
+		cols = append(cols, col)
+	}
+	return cols, true
+}
@@ -0,0 +1,192 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseDDL(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want Tables
+	}{
+		{
+			name: "create table",
+			sql: `CREATE TABLE users (
+				id BIGINT PRIMARY KEY,
+				name VARCHAR(100) NOT NULL,
+				bio TEXT,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+			);`,
+			want: Tables{"users": {Name: "users", Columns: []Column{
+				{Name: "id", Type: "bigint"},
+				{Name: "name", Type: "varchar(100)"},
+				{Name: "bio", Type: "text", Nullable: true},
+				{Name: "created_at", Type: "timestamp with time zone", Nullable: true},
+			}}},
+		},
+		{
+			name: "quoted and qualified names",
+			sql: `CREATE TABLE IF NOT EXISTS "analytics"."Events" (
+				"Event Id" integer,
+				payload jsonb,
+				CONSTRAINT events_pk PRIMARY KEY ("Event Id")
+			);`,
+			want: Tables{"analytics.Events": {Name: "analytics.Events", Columns: []Column{
+				{Name: "Event Id", Type: "integer", Nullable: true},
+				{Name: "payload", Type: "jsonb", Nullable: true},
+			}}},
+		},
+		{
+			name: "mysql comments",
+			sql: "CREATE TABLE `orders` (\n" +
+				"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+				"  `total` decimal(10,2) COMMENT 'in cents',\n" +
+				"  PRIMARY KEY (`id`)\n" +
+				") ENGINE=InnoDB COMMENT='All orders';",
+			want: Tables{"orders": {Name: "orders", Description: "All orders", Columns: []Column{
+				{Name: "id", Type: "int"},
+				{Name: "total", Type: "decimal(10, 2)", Nullable: true, Description: "in cents"},
+			}}},
+		},
+		{
+			name: "alter table",
+			sql: `CREATE TABLE t (a int, b int, d varchar(10));
+				ALTER TABLE t ADD COLUMN c text NOT NULL, DROP COLUMN b;
+				ALTER TABLE t RENAME COLUMN a TO x;
+				ALTER TABLE t ALTER COLUMN x SET NOT NULL;
+				ALTER TABLE t ALTER COLUMN d TYPE text;`,
+			want: Tables{"t": {Name: "t", Columns: []Column{
+				{Name: "x", Type: "int"},
+				{Name: "d", Type: "text", Nullable: true},
+				{Name: "c", Type: "text"},
+			}}},
+		},
+		{
+			name: "drop and comment",
+			sql: `CREATE TABLE gone (a int);
+				CREATE TABLE kept (a int);
+				DROP TABLE IF EXISTS gone;
+				COMMENT ON COLUMN kept.a IS 'the a';`,
+			want: Tables{"kept": {Name: "kept", Columns: []Column{
+				{Name: "a", Type: "int", Nullable: true, Description: "the a"},
+			}}},
+		},
+		{
+			name: "skipped statements",
+			sql: `-- a comment; with a semicolon
+				/* CREATE TABLE hidden (a int); */
+				CREATE TABLE t (a int);
+				INSERT INTO t VALUES (';');
+				CREATE INDEX t_a ON t (a);
+				CREATE TABLE copy AS SELECT * FROM t;`,
+			want: Tables{"t": {Name: "t", Columns: []Column{
+				{Name: "a", Type: "int", Nullable: true},
+			}}},
+		},
+		{
+			name: "views",
+			sql: `CREATE TABLE orders (id int NOT NULL, total numeric);
+				CREATE VIEW named (x, y) AS SELECT 1, 2;
+				CREATE VIEW renamed AS SELECT o.id, o.total AS amount, count(*) AS n FROM orders o;
+				CREATE OR REPLACE VIEW every AS SELECT * FROM orders WHERE total > 0;
+				CREATE VIEW unnamed AS SELECT total + 1 FROM orders;`,
+			want: Tables{
+				"orders": {Name: "orders", Columns: []Column{
+					{Name: "id", Type: "int"},
+					{Name: "total", Type: "numeric", Nullable: true},
+				}},
+				"named": {Name: "named", Columns: []Column{
+					{Name: "x", Nullable: true},
+					{Name: "y", Nullable: true},
+				}},
+				"renamed": {Name: "renamed", Columns: []Column{
+					{Name: "id", Type: "int"},
+					{Name: "amount", Type: "numeric", Nullable: true},
+					{Name: "n", Nullable: true},
+				}},
+				"every": {Name: "every", Columns: []Column{
+					{Name: "id", Type: "int"},
+					{Name: "total", Type: "numeric", Nullable: true},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &ddl{tables: make(Tables)}
+			if err := d.parse(tt.sql); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(d.tables, tt.want) {
+				t.Errorf("got\n%s\nwant\n%s", describe(d.tables), describe(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseDDLErrors(t *testing.T) {
+	for _, sql := range []string{
+		`CREATE TABLE t (a int DEFAULT 'open`,
+		`CREATE TABLE "t (a int)`,
+	} {
+		d := &ddl{tables: make(Tables)}
+		if err := d.parse(sql); err == nil {
+			t.Errorf("parse(%q) succeeded, want an error", sql)
+		}
+	}
+}
+
+func TestLoadDDLOrder(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"002_add_email.sql": "ALTER TABLE users ADD COLUMN email text;",
+		"001_users.sql":     "CREATE TABLE users (id int);",
+		"notes.txt":         "CREATE TABLE ignored (id int);",
+	}
+	for name, sql := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(sql), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tables, err := LoadDDL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Tables{"users": {Name: "users", Columns: []Column{
+		{Name: "id", Type: "int", Nullable: true},
+		{Name: "email", Type: "text", Nullable: true},
+	}}}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("got\n%s\nwant\n%s", describe(tables), describe(want))
+	}
+}
+
+// describe writes tables out for test failures.
+func describe(tables Tables) string {
+	var names []string
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var s string
+	for _, name := range names {
+		t := tables[name]
+		s += name + ": " + t.Description + "\n"
+		for _, c := range t.Columns {
+			s += "  " + c.Name + " " + c.Type
+			if !c.Nullable {
+				s += " not null"
+			}
+			if c.Description != "" {
+				s += " -- " + c.Description
+			}
+			s += "\n"
+		}
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package catalog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// file is the layout of a catalog file:
+//
+//	tables:
+//	  orders:
+//	    description: One row per order
+//	    columns:
+//	      - name: id
+//	        type: integer
+//	        nullable: false
+//	      - name: status
+//	        type: text
+//
+// JSON files use the same layout. Columns are nullable unless they say
+// otherwise.
+type file struct {
+	Tables map[string]*Table `yaml:"tables"`
+}
+
+// UnmarshalYAML defaults nullable to true.
+func (c *Column) UnmarshalYAML(value *yaml.Node) error {
+	type rawColumn Column
+	raw := rawColumn{Nullable: true}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	*c = Column(raw)
+	return nil
+}
+
+// Load reads a catalog from a directory or .sql file of DDL statements, a
+// SQLite database, or a YAML or JSON catalog file.
+func Load(path string) (Tables, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case info.IsDir() || strings.EqualFold(filepath.Ext(path), ".sql"):
+		return LoadDDL(path)
+	case IsSQLite(path):
+		return LoadSQLite(path)
+	}
+	return LoadFile(path)
+}
+
+// LoadFile reads a YAML or JSON catalog file.
+func LoadFile(path string) (Tables, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is a subset of YAML, so one decoder reads both.
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, t := range f.Tables {
+		if t == nil {
+			return nil, fmt.Errorf("%s: table %s has no definition", path, name)
+		}
+		if t.Name == "" {
+			t.Name = name
+		}
+		for i, col := range t.Columns {
+			if col.Name == "" {
+				return nil, fmt.Errorf("%s: column %d of table %s has no name", path, i+1, name)
+			}
+		}
+	}
+	return Tables(f.Tables), nil
+}
@@ -0,0 +1,358 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sampleRows is how many rows of a CSV or JSON file are read to infer
+// column types. Later rows are assumed to look like the sample.
+const sampleRows = 1000
+
+// InferFile reads the columns of a local data file. Format is csv, json or
+// parquet; when empty it is taken from the file extension. Types are named
+// as DuckDB names them, since DuckDB is the usual engine for local files.
+func InferFile(path string, format string) (*Table, error) {
+	if format == "" || format == "table" {
+		format = FileFormat(path)
+	}
+	base := filepath.Base(path)
+	t := &Table{Name: strings.TrimSuffix(base, filepath.Ext(base))}
+
+	var err error
+	switch format {
+	case "csv":
+		t.Columns, err = inferCSV(path)
+	case "json":
+		t.Columns, err = inferJSON(path)
+	case "parquet":
+		t.Columns, err = inferParquet(path)
+	default:
+		return nil, fmt.Errorf("cannot infer columns of %s files", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// FileFormat returns the data format of a file from its extension, or ""
+// when the extension is not one of a data file.
+func FileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".json", ".ndjson", ".jsonl":
+		return "json"
+	case ".parquet":
+		return "parquet"
+	}
+	return ""
+}
+
+// columnType narrows the type of a column as values are seen, from the most
+// specific type to varchar, which fits anything.
+type columnType struct {
+	name     string
+	seen     bool
+	nullable bool
+}
+
+var csvTypes = []string{"boolean", "bigint", "double", "date", "timestamp", "varchar"}
+
+var dateLayouts = []string{"2006-01-02"}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05Z07:00",
+}
+
+func parses(layouts []string, s string) bool {
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fits reports whether a CSV field can be read as typ.
+func fits(typ, s string) bool {
+	switch typ {
+	case "boolean":
+		return strings.EqualFold(s, "true") || strings.EqualFold(s, "false")
+	case "bigint":
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	case "double":
+		_, err := strconv.ParseFloat(s, 64)
+		return err == nil
+	case "date":
+		return parses(dateLayouts, s)
+	case "timestamp":
+		return parses(timestampLayouts, s)
+	}
+	return true
+}
+
+func (c *columnType) csvValue(s string) {
+	if s == "" {
+		c.nullable = true
+		return
+	}
+	for _, typ := range csvTypes {
+		if fits(typ, s) {
+			c.widen(typ, "varchar")
+			return
+		}
+	}
+}
+
+// widen makes the column type fit values of typ as well. Integers widen to
+// doubles and dates to timestamps; other mixes fall back to fallback.
+func (c *columnType) widen(typ, fallback string) {
+	switch {
+	case !c.seen:
+		c.name = typ
+		c.seen = true
+	case c.name == typ:
+	case c.name == "bigint" && typ == "double", c.name == "double" && typ == "bigint":
+		c.name = "double"
+	case c.name == "date" && typ == "timestamp", c.name == "timestamp" && typ == "date":
+		c.name = "timestamp"
+	default:
+		c.name = fallback
+	}
+}
+
+func (c *columnType) column(name string) Column {
+	typ := c.name
+	if typ == "" {
+		typ = "varchar"
+	}
+	return Column{Name: name, Type: typ, Nullable: c.nullable}
+}
+
+// inferCSV reads the header and a sample of rows. The delimiter is the one
+// of , ; tab and | that splits the header into the most fields.
+func inferCSV(path string) ([]Column, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	header, err := br.Peek(64 * 1024)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	if i := bytes.IndexByte(header, '\n'); i >= 0 {
+		header = header[:i]
+	}
+	delim := ','
+	most := 0
+	for _, d := range []rune{',', ';', '\t', '|'} {
+		if n := bytes.Count(header, []byte(string(d))); n > most {
+			delim, most = d, n
+		}
+	}
+
+	r := csv.NewReader(br)
+	r.Comma = delim
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	names, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	cols := make([]Column, len(names))
+	types := make([]columnType, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if name == "" {
+			name = fmt.Sprintf("column%d", i)
+		}
+		cols[i].Name = name
+	}
+
+	for n := 0; n < sampleRows; n++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for i := range types {
+			if i >= len(record) {
+				types[i].nullable = true
+				continue
+			}
+			types[i].csvValue(record[i])
+		}
+	}
+	for i := range cols {
+		cols[i] = types[i].column(cols[i].Name)
+	}
+	return cols, nil
+}
+
+// inferJSON reads either an array of objects or newline delimited objects,
+// collecting keys in the order they first appear.
+func inferJSON(path string) ([]Column, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	dec.UseNumber()
+
+	first, err := dec.Token()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []map[string]any
+	var order []string
+	keys := make(map[string]bool)
+	add := func(raw json.RawMessage) error {
+		record, keyOrder, err := decodeObject(raw)
+		if err != nil {
+			return err
+		}
+		for _, k := range keyOrder {
+			if !keys[k] {
+				keys[k] = true
+				order = append(order, k)
+			}
+		}
+		records = append(records, record)
+		return nil
+	}
+
+	if d, ok := first.(json.Delim); ok && d == '[' {
+		for dec.More() && len(records) < sampleRows {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+			if err := add(raw); err != nil {
+				return nil, err
+			}
+		}
+	} else if ok && d == '{' {
+		// Newline delimited JSON. The first token was already consumed, so
+		// start again from the top of the file.
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		dec = json.NewDecoder(bufio.NewReader(f))
+		for len(records) < sampleRows {
+			var raw json.RawMessage
+			err := dec.Decode(&raw)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := add(raw); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		return nil, fmt.Errorf("expected an array of objects or one object per line")
+	}
+
+	cols := make([]Column, len(order))
+	for i, k := range order {
+		var typ columnType
+		for _, record := range records {
+			v, ok := record[k]
+			if !ok || v == nil {
+				typ.nullable = true
+				continue
+			}
+			typ.jsonValue(v)
+		}
+		cols[i] = typ.column(k)
+	}
+	return cols, nil
+}
+
+// decodeObject decodes a JSON object and returns its keys in file order.
+func decodeObject(raw json.RawMessage) (map[string]any, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if t, err := dec.Token(); err != nil || t != json.Delim('{') {
+		return nil, nil, errors.New("expected an array of objects or one object per line")
+	}
+	record := make(map[string]any)
+	var order []string
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := t.(string)
+		var v any
+		if err := dec.Decode(&v); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := record[key]; !ok {
+			order = append(order, key)
+		}
+		record[key] = v
+	}
+	return record, order, nil
+}
+
+func jsonType(v any) string {
+	switch v := v.(type) {
+	case bool:
+		return "boolean"
+	case json.Number:
+		if n, err := v.Int64(); err == nil && n != math.MinInt64 {
+			return "bigint"
+		}
+		return "double"
+	case string:
+		switch {
+		case parses(dateLayouts, v):
+			return "date"
+		case parses(timestampLayouts, v):
+			return "timestamp"
+		}
+		return "varchar"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "struct"
+	}
+	return "varchar"
+}
+
+func (c *columnType) jsonValue(v any) {
+	c.widen(jsonType(v), "json")
+}
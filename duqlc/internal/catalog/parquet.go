@@ -0,0 +1,579 @@
+package catalog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Parquet files end with a Thrift encoded FileMetaData, its length as a
+// little endian uint32 and the magic bytes PAR1. Only the schema is read
+// from it, so this is a small Thrift compact protocol reader rather than a
+// dependency on a full Parquet library.
+
+// maxFooter bounds the footer read, so a corrupt length cannot make the
+// reader allocate unbounded memory.
+const maxFooter = 64 << 20
+
+func inferParquet(path string) ([]Column, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if size < 12 {
+		return nil, errors.New("not a parquet file")
+	}
+	tail := make([]byte, 8)
+	if _, err := f.ReadAt(tail, size-8); err != nil {
+		return nil, err
+	}
+	switch string(tail[4:]) {
+	case "PAR1":
+	case "PARE":
+		return nil, errors.New("encrypted parquet files are not supported")
+	default:
+		return nil, errors.New("not a parquet file")
+	}
+	n := int64(binary.LittleEndian.Uint32(tail))
+	if n > size-12 || n > maxFooter {
+		return nil, errors.New("invalid parquet footer length")
+	}
+	footer := make([]byte, n)
+	if _, err := f.ReadAt(footer, size-8-n); err != nil {
+		return nil, err
+	}
+
+	schema, err := readFileSchema(&thrift{buf: footer})
+	if err != nil {
+		return nil, fmt.Errorf("reading parquet footer: %w", err)
+	}
+	return parquetColumns(schema)
+}
+
+// schemaElement is the part of a Parquet SchemaElement the catalog uses.
+type schemaElement struct {
+	name          string
+	physical      int32
+	repetition    int32
+	numChildren   int32
+	converted     int32
+	hasConverted  bool
+	logical       int16
+	scale         int32
+	precision     int32
+	hasPhysical   bool
+	isAdjustedUTC bool
+	intWidth      byte
+	unsigned      bool
+}
+
+// Physical types.
+const (
+	parquetBoolean = iota
+	parquetInt32
+	parquetInt64
+	parquetInt96
+	parquetFloat
+	parquetDouble
+	parquetByteArray
+	parquetFixedLenByteArray
+)
+
+// Repetition types.
+const (
+	parquetRequired = iota
+	parquetOptional
+	parquetRepeated
+)
+
+// Converted types, the older annotations most writers still set.
+const (
+	convertedUTF8            = 0
+	convertedMap             = 1
+	convertedMapKeyValue     = 2
+	convertedList            = 3
+	convertedEnum            = 4
+	convertedDecimal         = 5
+	convertedDate            = 6
+	convertedTimeMillis      = 7
+	convertedTimeMicros      = 8
+	convertedTimestampMillis = 9
+	convertedTimestampMicros = 10
+	convertedUint8           = 11
+	convertedUint16          = 12
+	convertedUint32          = 13
+	convertedUint64          = 14
+	convertedInt8            = 15
+	convertedInt16           = 16
+	convertedInt32           = 17
+	convertedInt64           = 18
+	convertedJSON            = 19
+	convertedBSON            = 20
+	convertedInterval        = 21
+)
+
+// Logical types, by their field id in the LogicalType union.
+const (
+	logicalString    = 1
+	logicalMap       = 2
+	logicalList      = 3
+	logicalEnum      = 4
+	logicalDecimal   = 5
+	logicalDate      = 6
+	logicalTime      = 7
+	logicalTimestamp = 8
+	logicalInteger   = 10
+	logicalJSON      = 12
+	logicalBSON      = 13
+	logicalUUID      = 14
+)
+
+// parquetColumns turns the flattened schema tree into top level columns.
+// The first element is the root; nested groups become a single struct,
+// list or map column.
+func parquetColumns(schema []schemaElement) ([]Column, error) {
+	if len(schema) == 0 {
+		return nil, errors.New("parquet schema is empty")
+	}
+	var cols []Column
+	i := 1
+	for c := int32(0); c < schema[0].numChildren; c++ {
+		if i >= len(schema) {
+			return nil, errors.New("parquet schema is truncated")
+		}
+		e := schema[i]
+		cols = append(cols, Column{
+			Name:     e.name,
+			Type:     parquetType(e),
+			Nullable: e.repetition != parquetRequired,
+		})
+		next, err := skipSubtree(schema, i)
+		if err != nil {
+			return nil, err
+		}
+		i = next
+	}
+	return cols, nil
+}
+
+// skipSubtree returns the index after element i and its descendants.
+func skipSubtree(schema []schemaElement, i int) (int, error) {
+	children := schema[i].numChildren
+	i++
+	for c := int32(0); c < children; c++ {
+		if i >= len(schema) {
+			return 0, errors.New("parquet schema is truncated")
+		}
+		next, err := skipSubtree(schema, i)
+		if err != nil {
+			return 0, err
+		}
+		i = next
+	}
+	return i, nil
+}
+
+func parquetType(e schemaElement) string {
+	if e.numChildren > 0 || !e.hasPhysical {
+		switch {
+		case e.logical == logicalList, e.hasConverted && e.converted == convertedList:
+			return "list"
+		case e.logical == logicalMap, e.hasConverted && (e.converted == convertedMap || e.converted == convertedMapKeyValue):
+			return "map"
+		}
+		return "struct"
+	}
+	if e.repetition == parquetRepeated {
+		// A repeated primitive outside a LIST group is a legacy list.
+		inner := e
+		inner.repetition = parquetRequired
+		return parquetType(inner) + "[]"
+	}
+
+	switch e.logical {
+	case logicalString, logicalEnum:
+		return "varchar"
+	case logicalJSON:
+		return "json"
+	case logicalBSON:
+		return "blob"
+	case logicalUUID:
+		return "uuid"
+	case logicalDate:
+		return "date"
+	case logicalTime:
+		return "time"
+	case logicalTimestamp:
+		if e.isAdjustedUTC {
+			return "timestamp with time zone"
+		}
+		return "timestamp"
+	case logicalDecimal:
+		return fmt.Sprintf("decimal(%d,%d)", e.precision, e.scale)
+	case logicalInteger:
+		names := map[byte]string{8: "tinyint", 16: "smallint", 32: "integer", 64: "bigint"}
+		if name, ok := names[e.intWidth]; ok {
+			if e.unsigned {
+				return "u" + name
+			}
+			return name
+		}
+	}
+
+	if e.hasConverted {
+		switch e.converted {
+		case convertedUTF8, convertedEnum:
+			return "varchar"
+		case convertedJSON:
+			return "json"
+		case convertedBSON:
+			return "blob"
+		case convertedDecimal:
+			return fmt.Sprintf("decimal(%d,%d)", e.precision, e.scale)
+		case convertedDate:
+			return "date"
+		case convertedTimeMillis, convertedTimeMicros:
+			return "time"
+		case convertedTimestampMillis, convertedTimestampMicros:
+			return "timestamp"
+		case convertedUint8:
+			return "utinyint"
+		case convertedUint16:
+			return "usmallint"
+		case convertedUint32:
+			return "uinteger"
+		case convertedUint64:
+			return "ubigint"
+		case convertedInt8:
+			return "tinyint"
+		case convertedInt16:
+			return "smallint"
+		case convertedInt32:
+			return "integer"
+		case convertedInt64:
+			return "bigint"
+		case convertedInterval:
+			return "interval"
+		}
+	}
+
+	switch e.physical {
+	case parquetBoolean:
+		return "boolean"
+	case parquetInt32:
+		return "integer"
+	case parquetInt64:
+		return "bigint"
+	case parquetInt96:
+		return "timestamp"
+	case parquetFloat:
+		return "float"
+	case parquetDouble:
+		return "double"
+	}
+	return "blob"
+}
+
+// Thrift compact protocol types.
+const (
+	thriftStop   = 0
+	thriftTrue   = 1
+	thriftFalse  = 2
+	thriftByte   = 3
+	thriftI16    = 4
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftDouble = 7
+	thriftBinary = 8
+	thriftList   = 9
+	thriftSet    = 10
+	thriftMap    = 11
+	thriftStruct = 12
+)
+
+var errThrift = errors.New("malformed thrift data")
+
+// thrift reads the Thrift compact protocol from a buffer.
+type thrift struct {
+	buf   []byte
+	pos   int
+	depth int
+}
+
+func (t *thrift) byte() (byte, error) {
+	if t.pos >= len(t.buf) {
+		return 0, errThrift
+	}
+	b := t.buf[t.pos]
+	t.pos++
+	return b, nil
+}
+
+func (t *thrift) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(t.buf[t.pos:])
+	if n <= 0 {
+		return 0, errThrift
+	}
+	t.pos += n
+	return v, nil
+}
+
+// varint reads a zigzag encoded integer.
+func (t *thrift) varint() (int64, error) {
+	u, err := t.uvarint()
+	return int64(u>>1) ^ -int64(u&1), err
+}
+
+func (t *thrift) i32() (int32, error) {
+	v, err := t.varint()
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return 0, errThrift
+	}
+	return int32(v), err
+}
+
+func (t *thrift) binary() ([]byte, error) {
+	n, err := t.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(t.buf)-t.pos) {
+		return nil, errThrift
+	}
+	b := t.buf[t.pos : t.pos+int(n)]
+	t.pos += int(n)
+	return b, nil
+}
+
+// field reads a field header, returning its id and type. The id is given
+// as a delta from the previous field in the same struct.
+func (t *thrift) field(last int16) (int16, byte, error) {
+	b, err := t.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+	typ := b & 0x0f
+	if typ == thriftStop {
+		return 0, thriftStop, nil
+	}
+	if delta := int16(b >> 4); delta != 0 {
+		return last + delta, typ, nil
+	}
+	id, err := t.varint()
+	return int16(id), typ, err
+}
+
+// list reads a list header, returning its size and element type.
+func (t *thrift) list() (int, byte, error) {
+	b, err := t.byte()
+	if err != nil {
+		return 0, 0, err
+	}
+	size := uint64(b >> 4)
+	if size == 15 {
+		if size, err = t.uvarint(); err != nil {
+			return 0, 0, err
+		}
+	}
+	// Every element takes at least one byte, except booleans in structs.
+	if size > uint64(len(t.buf)-t.pos) {
+		return 0, 0, errThrift
+	}
+	return int(size), b & 0x0f, nil
+}
+
+// skip skips a value of the given type.
+func (t *thrift) skip(typ byte) error {
+	switch typ {
+	case thriftTrue, thriftFalse:
+		// Booleans are part of the field header, except inside lists where
+		// they take a byte each.
+		return nil
+	case thriftByte:
+		_, err := t.byte()
+		return err
+	case thriftI16, thriftI32, thriftI64:
+		_, err := t.uvarint()
+		return err
+	case thriftDouble:
+		if len(t.buf)-t.pos < 8 {
+			return errThrift
+		}
+		t.pos += 8
+		return nil
+	case thriftBinary:
+		_, err := t.binary()
+		return err
+	case thriftList, thriftSet:
+		n, elem, err := t.list()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if elem == thriftTrue || elem == thriftFalse {
+				if _, err := t.byte(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := t.skip(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftMap:
+		n, err := t.uvarint()
+		if err != nil || n == 0 {
+			return err
+		}
+		kv, err := t.byte()
+		if err != nil {
+			return err
+		}
+		if n > uint64(len(t.buf)-t.pos) {
+			return errThrift
+		}
+		for i := uint64(0); i < n; i++ {
+			if err := t.skip(kv >> 4); err != nil {
+				return err
+			}
+			if err := t.skip(kv & 0x0f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case thriftStruct:
+		return t.structFields(func(int16, byte) (bool, error) { return false, nil })
+	}
+	return errThrift
+}
+
+// structFields calls fn for each field of a struct. When fn reports that it
+// did not read the value, the value is skipped.
+func (t *thrift) structFields(fn func(id int16, typ byte) (bool, error)) error {
+	t.depth++
+	defer func() { t.depth-- }()
+	if t.depth > 64 {
+		return errThrift
+	}
+	var last int16
+	for {
+		id, typ, err := t.field(last)
+		if err != nil {
+			return err
+		}
+		if typ == thriftStop {
+			return nil
+		}
+		last = id
+		read, err := fn(id, typ)
+		if err != nil {
+			return err
+		}
+		if !read {
+			if err := t.skip(typ); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readFileSchema reads field 2 of FileMetaData, the list of SchemaElement.
+func readFileSchema(t *thrift) ([]schemaElement, error) {
+	var schema []schemaElement
+	err := t.structFields(func(id int16, typ byte) (bool, error) {
+		if id != 2 || typ != thriftList {
+			return false, nil
+		}
+		n, elem, err := t.list()
+		if err != nil {
+			return true, err
+		}
+		if elem != thriftStruct {
+			return true, errThrift
+		}
+		for i := 0; i < n; i++ {
+			e, err := readSchemaElement(t)
+			if err != nil {
+				return true, err
+			}
+			schema = append(schema, e)
+		}
+		return true, nil
+	})
+	return schema, err
+}
+
+func readSchemaElement(t *thrift) (schemaElement, error) {
+	var e schemaElement
+	err := t.structFields(func(id int16, typ byte) (bool, error) {
+		var err error
+		switch {
+		case id == 1 && typ == thriftI32:
+			e.physical, err = t.i32()
+			e.hasPhysical = true
+		case id == 3 && typ == thriftI32:
+			e.repetition, err = t.i32()
+		case id == 4 && typ == thriftBinary:
+			var name []byte
+			name, err = t.binary()
+			e.name = string(name)
+		case id == 5 && typ == thriftI32:
+			e.numChildren, err = t.i32()
+			if e.numChildren < 0 {
+				err = errThrift
+			}
+		case id == 6 && typ == thriftI32:
+			e.converted, err = t.i32()
+			e.hasConverted = true
+		case id == 7 && typ == thriftI32:
+			e.scale, err = t.i32()
+		case id == 8 && typ == thriftI32:
+			e.precision, err = t.i32()
+		case id == 10 && typ == thriftStruct:
+			err = readLogicalType(t, &e)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	return e, err
+}
+
+// readLogicalType reads the LogicalType union, keeping which member is set
+// and the details the catalog shows.
+func readLogicalType(t *thrift, e *schemaElement) error {
+	return t.structFields(func(id int16, typ byte) (bool, error) {
+		if typ != thriftStruct {
+			return false, nil
+		}
+		e.logical = id
+		return true, t.structFields(func(field int16, typ byte) (bool, error) {
+			var err error
+			switch {
+			case id == logicalDecimal && field == 1 && typ == thriftI32:
+				e.scale, err = t.i32()
+			case id == logicalDecimal && field == 2 && typ == thriftI32:
+				e.precision, err = t.i32()
+			case id == logicalTimestamp && field == 1 && (typ == thriftTrue || typ == thriftFalse):
+				e.isAdjustedUTC = typ == thriftTrue
+			case id == logicalInteger && field == 1 && typ == thriftByte:
+				e.intWidth, err = t.byte()
+			case id == logicalInteger && field == 2 && (typ == thriftTrue || typ == thriftFalse):
+				e.unsigned = typ == thriftFalse
+			default:
+				return false, nil
+			}
+			return true, err
+		})
+	})
+}
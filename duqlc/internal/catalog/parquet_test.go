@@ -0,0 +1,297 @@
+package catalog
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// compact writes the Thrift compact protocol, for building footers.
+type compact struct {
+	b    []byte
+	last []int16
+}
+
+func (w *compact) begin() { w.last = append(w.last, 0) }
+
+func (w *compact) end() {
+	w.b = append(w.b, thriftStop)
+	w.last = w.last[:len(w.last)-1]
+}
+
+func (w *compact) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.b = append(w.b, byte(delta)<<4|typ)
+	} else {
+		w.b = append(w.b, typ)
+		w.varint(int64(id))
+	}
+	*last = id
+}
+
+func (w *compact) varint(v int64) { w.b = binary.AppendVarint(w.b, v) }
+
+func (w *compact) binary(s string) {
+	w.b = binary.AppendUvarint(w.b, uint64(len(s)))
+	w.b = append(w.b, s...)
+}
+
+func (w *compact) list(n int, elem byte) {
+	if n < 15 {
+		w.b = append(w.b, byte(n)<<4|elem)
+		return
+	}
+	w.b = append(w.b, 0xf0|elem)
+	w.b = binary.AppendUvarint(w.b, uint64(n))
+}
+
+func (w *compact) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.varint(int64(v))
+}
+
+func (w *compact) bool(id int16, v bool) {
+	if v {
+		w.field(id, thriftTrue)
+	} else {
+		w.field(id, thriftFalse)
+	}
+}
+
+// element is a SchemaElement to write; fields left at -1 are not set.
+type element struct {
+	name                 string
+	physical, repetition int32
+	children, converted  int32
+	scale, precision     int32
+	// logical writes the members of the LogicalType union, if set.
+	logical func(w *compact)
+}
+
+func el(name string, physical, repetition int32) element {
+	return element{name: name, physical: physical, repetition: repetition, converted: -1, scale: -1, precision: -1}
+}
+
+func group(name string, repetition, children int32) element {
+	e := el(name, -1, repetition)
+	e.children = children
+	return e
+}
+
+func (e element) write(w *compact) {
+	w.begin()
+	if e.physical >= 0 {
+		w.i32(1, e.physical)
+	}
+	if e.repetition >= 0 {
+		w.i32(3, e.repetition)
+	}
+	w.field(4, thriftBinary)
+	w.binary(e.name)
+	if e.children > 0 {
+		w.i32(5, e.children)
+	}
+	if e.converted >= 0 {
+		w.i32(6, e.converted)
+	}
+	if e.scale >= 0 {
+		w.i32(7, e.scale)
+	}
+	if e.precision >= 0 {
+		w.i32(8, e.precision)
+	}
+	if e.logical != nil {
+		w.field(10, thriftStruct)
+		w.begin()
+		e.logical(w)
+		w.end()
+	}
+	w.end()
+}
+
+// logical writes an empty member of the LogicalType union.
+func logical(id int16) func(w *compact) {
+	return func(w *compact) {
+		w.field(id, thriftStruct)
+		w.begin()
+		w.end()
+	}
+}
+
+// footer writes a FileMetaData with the given schema, and fields the
+// reader must skip around it.
+func footer(schema []element) []byte {
+	w := &compact{}
+	w.begin()
+	w.i32(1, 2)
+	w.field(2, thriftList)
+	w.list(len(schema), thriftStruct)
+	for _, e := range schema {
+		e.write(w)
+	}
+	w.field(3, thriftI64)
+	w.varint(1000)
+	w.field(4, thriftList)
+	w.list(0, thriftStruct)
+	w.field(5, thriftList)
+	w.list(1, thriftStruct)
+	w.begin()
+	w.field(1, thriftBinary)
+	w.binary("writer.note")
+	w.field(2, thriftBinary)
+	w.binary("hello")
+	w.end()
+	w.field(6, thriftBinary)
+	w.binary("duql test")
+	w.end()
+	return w.b
+}
+
+// parquetFile writes a file holding only a footer.
+func parquetFile(t *testing.T, footer []byte, magic string) string {
+	t.Helper()
+	data := append([]byte("PAR1"), footer...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(footer)))
+	data = append(data, magic...)
+	path := filepath.Join(t.TempDir(), "data.parquet")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInferParquet(t *testing.T) {
+	name := el("name", parquetByteArray, parquetOptional)
+	name.logical = logical(logicalString)
+	price := el("price", parquetFixedLenByteArray, parquetOptional)
+	price.logical = func(w *compact) {
+		w.field(logicalDecimal, thriftStruct)
+		w.begin()
+		w.i32(1, 2)
+		w.i32(2, 10)
+		w.end()
+	}
+	at := el("at", parquetInt64, parquetRequired)
+	at.logical = func(w *compact) {
+		w.field(logicalTimestamp, thriftStruct)
+		w.begin()
+		w.bool(1, true)
+		w.end()
+	}
+	small := el("small", parquetInt32, parquetOptional)
+	small.logical = func(w *compact) {
+		w.field(logicalInteger, thriftStruct)
+		w.begin()
+		w.field(1, thriftByte)
+		w.b = append(w.b, 16)
+		w.bool(2, false)
+		w.end()
+	}
+	tags := group("tags", parquetOptional, 1)
+	tags.converted = convertedList
+
+	schema := []element{
+		group("schema", -1, 7),
+		el("id", parquetInt64, parquetRequired),
+		name,
+		price,
+		at,
+		small,
+		tags,
+		group("list", parquetRepeated, 1),
+		el("element", parquetByteArray, parquetOptional),
+		el("scores", parquetDouble, parquetRepeated),
+	}
+	cols, err := inferParquet(parquetFile(t, footer(schema), "PAR1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Column{
+		{Name: "id", Type: "bigint"},
+		{Name: "name", Type: "varchar", Nullable: true},
+		{Name: "price", Type: "decimal(10,2)", Nullable: true},
+		{Name: "at", Type: "timestamp with time zone"},
+		{Name: "small", Type: "usmallint", Nullable: true},
+		{Name: "tags", Type: "list", Nullable: true},
+		{Name: "scores", Type: "double[]", Nullable: true},
+	}
+	if !reflect.DeepEqual(cols, want) {
+		t.Errorf("got %+v, want %+v", cols, want)
+	}
+}
+
+func TestInferParquetErrors(t *testing.T) {
+	good := footer([]element{group("schema", -1, 1), el("id", parquetInt64, parquetRequired)})
+	tests := []struct {
+		name string
+		data func(t *testing.T) string
+		want string
+	}{
+		{"short file", func(t *testing.T) string {
+			path := filepath.Join(t.TempDir(), "short.parquet")
+			os.WriteFile(path, []byte("PAR1PAR1"), 0o644)
+			return path
+		}, "not a parquet file"},
+		{"wrong magic", func(t *testing.T) string { return parquetFile(t, good, "PAR2") }, "not a parquet file"},
+		{"encrypted", func(t *testing.T) string { return parquetFile(t, good, "PARE") }, "encrypted"},
+		{"footer length", func(t *testing.T) string {
+			path := parquetFile(t, good, "PAR1")
+			data, _ := os.ReadFile(path)
+			binary.LittleEndian.PutUint32(data[len(data)-8:], uint32(len(data)))
+			os.WriteFile(path, data, 0o644)
+			return path
+		}, "invalid parquet footer length"},
+		{"truncated footer", func(t *testing.T) string { return parquetFile(t, good[:len(good)/2], "PAR1") }, "malformed thrift data"},
+		{"truncated schema", func(t *testing.T) string {
+			return parquetFile(t, footer([]element{group("schema", -1, 2), el("id", parquetInt64, parquetRequired)}), "PAR1")
+		}, "truncated"},
+		{"empty schema", func(t *testing.T) string { return parquetFile(t, footer(nil), "PAR1") }, "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := inferParquet(tt.data(t))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParquetType(t *testing.T) {
+	conv := func(physical, converted int32) schemaElement {
+		return schemaElement{physical: physical, hasPhysical: true, converted: converted, hasConverted: true}
+	}
+	tests := []struct {
+		e    schemaElement
+		want string
+	}{
+		{schemaElement{physical: parquetBoolean, hasPhysical: true}, "boolean"},
+		{schemaElement{physical: parquetInt32, hasPhysical: true}, "integer"},
+		{schemaElement{physical: parquetInt96, hasPhysical: true}, "timestamp"},
+		{schemaElement{physical: parquetFloat, hasPhysical: true}, "float"},
+		{schemaElement{physical: parquetByteArray, hasPhysical: true}, "blob"},
+		{conv(parquetByteArray, convertedUTF8), "varchar"},
+		{conv(parquetByteArray, convertedJSON), "json"},
+		{conv(parquetInt32, convertedDate), "date"},
+		{conv(parquetInt64, convertedTimestampMillis), "timestamp"},
+		{conv(parquetInt32, convertedUint8), "utinyint"},
+		{conv(parquetInt64, convertedInt64), "bigint"},
+		{schemaElement{physical: parquetInt64, hasPhysical: true, converted: convertedDecimal, hasConverted: true, precision: 18, scale: 4}, "decimal(18,4)"},
+		{schemaElement{physical: parquetFixedLenByteArray, hasPhysical: true, logical: logicalUUID}, "uuid"},
+		{schemaElement{physical: parquetInt64, hasPhysical: true, logical: logicalTimestamp}, "timestamp"},
+		{schemaElement{physical: parquetInt32, hasPhysical: true, logical: logicalInteger, intWidth: 8}, "tinyint"},
+		{schemaElement{numChildren: 1, logical: logicalMap}, "map"},
+		{schemaElement{numChildren: 1, converted: convertedMapKeyValue, hasConverted: true}, "map"},
+		{schemaElement{numChildren: 2}, "struct"},
+		{schemaElement{physical: parquetInt32, hasPhysical: true, repetition: parquetRepeated}, "integer[]"},
+	}
+	for _, tt := range tests {
+		if got := parquetType(tt.e); got != tt.want {
+			t.Errorf("parquetType(%+v) = %s, want %s", tt.e, got, tt.want)
+		}
+	}
+}
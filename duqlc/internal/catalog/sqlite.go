@@ -0,0 +1,119 @@
+package catalog
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// Registers the pure Go "sqlite" driver, so no C toolchain is needed.
+	_ "modernc.org/sqlite"
+)
+
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// IsSQLite reports whether the file at path is a SQLite database.
+func IsSQLite(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, sqliteHeader)
+}
+
+// LoadSQLite reads the tables and views of a SQLite database file, as
+// listed in sqlite_master and described by PRAGMA table_info. The file is
+// opened read only and never created.
+func LoadSQLite(path string) (Tables, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	if !IsSQLite(path) {
+		return nil, fmt.Errorf("%s: not a SQLite database", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(abs), RawQuery: "mode=ro"}
+	db, err := sql.Open("sqlite", u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tables, err := sqliteTables(db)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tables, nil
+}
+
+func sqliteTables(db *sql.DB) (Tables, error) {
+	rows, err := db.Query(`SELECT name FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tables := make(Tables, len(names))
+	for _, name := range names {
+		cols, err := sqliteColumns(db, name)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		tables[name] = &Table{Name: name, Columns: cols}
+	}
+	return tables, nil
+}
+
+func sqliteColumns(db *sql.DB, table string) ([]Column, error) {
+	// PRAGMA arguments cannot be bound, so the name is quoted instead.
+	rows, err := db.Query(`PRAGMA table_info("` + strings.ReplaceAll(table, `"`, `""`) + `")`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []Column
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols = append(cols, Column{
+			Name: name,
+			Type: strings.ToLower(typ),
+			// An INTEGER PRIMARY KEY is the rowid, which is never null.
+			Nullable: notNull == 0 && !(pk > 0 && strings.EqualFold(typ, "INTEGER")),
+		})
+	}
+	return cols, rows.Err()
+}
@@ -0,0 +1,191 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+// Capability is a DUQL feature that not every target can express directly.
+type Capability string
+
+const (
+	FullJoin Capability = "full join"
+	// ExcludeColumns removes columns with select! while every input column
+	// is still passed through, so the columns to keep are not known.
+	ExcludeColumns Capability = "select! without a known column list"
+	Loop           Capability = "loop"
+	// Qualify filters on window functions without a subquery.
+	Qualify     Capability = "qualify"
+	RegexMatch  Capability = "~= (regular expressions)"
+	Intervals   Capability = "interval literals"
+	Booleans    Capability = "boolean literals"
+	OpenTake    Capability = "take without an upper bound"
+	ReadCSV     Capability = "reading csv files"
+	ReadJSON    Capability = "reading json files"
+	ReadParquet Capability = "reading parquet files"
+	// Tables creates or appends to a table from the result of a query.
+	Tables         Capability = "into a table"
+	TempTables     Capability = "into a temp table"
+	ReplaceView    Capability = "replacing a view"
+	ReplaceTable   Capability = "replacing a table"
+	ViewIfMissing  Capability = "creating a view if missing"
+	TableIfMissing Capability = "creating a table if missing"
+)
+
+// Support is how a target handles a capability.
+type Support int
+
+const (
+	// Native means the target has SQL for the feature.
+	Native Support = iota
+	// Emulated means the compiler rewrites the feature into SQL the target
+	// understands, such as a subquery instead of QUALIFY.
+	Emulated
+	Unsupported
+)
+
+func (s Support) String() string {
+	switch s {
+	case Native:
+		return "native"
+	case Emulated:
+		return "emulated"
+	}
+	return "unsupported"
+}
+
+var allCapabilities = []Capability{
+	FullJoin, ExcludeColumns, Loop, Qualify, RegexMatch, Intervals, Booleans,
+	OpenTake, ReadCSV, ReadJSON, ReadParquet, Tables, TempTables, ReplaceView,
+	ReplaceTable, ViewIfMissing, TableIfMissing,
+}
+
+var fileCapabilities = map[duql.DataFormat]Capability{
+	duql.CSV:     ReadCSV,
+	duql.JSON:    ReadJSON,
+	duql.Parquet: ReadParquet,
+}
+
+var noFiles = map[Capability]Support{ReadCSV: Unsupported, ReadJSON: Unsupported, ReadParquet: Unsupported}
+
+// dropFirst is for targets without CREATE OR REPLACE TABLE, which drop the
+// table before creating it again.
+var dropFirst = map[Capability]Support{ReplaceTable: Emulated}
+
+// capabilities lists, for each target, the capabilities it lacks or that
+// are emulated. Anything not listed is native.
+var capabilities = map[duql.TargetDialect]map[Capability]Support{
+	duql.Generic: merge(noFiles, dropFirst, map[Capability]Support{
+		ExcludeColumns: Unsupported,
+		Qualify:        Emulated,
+		ReplaceView:    Emulated,
+		ViewIfMissing:  Unsupported,
+		TableIfMissing: Unsupported,
+	}),
+	duql.Postgres: merge(noFiles, dropFirst, map[Capability]Support{
+		ExcludeColumns: Unsupported,
+		Qualify:        Emulated,
+		ViewIfMissing:  Unsupported,
+	}),
+	duql.GlareDB: {
+		ExcludeColumns: Unsupported,
+		Qualify:        Emulated,
+		ViewIfMissing:  Unsupported,
+	},
+	duql.DuckDB: {},
+	duql.MySQL: merge(noFiles, dropFirst, map[Capability]Support{
+		FullJoin:       Unsupported,
+		ExcludeColumns: Unsupported,
+		Qualify:        Emulated,
+		OpenTake:       Emulated,
+		ViewIfMissing:  Unsupported,
+	}),
+	duql.SQLite: merge(noFiles, dropFirst, map[Capability]Support{
+		ExcludeColumns: Unsupported,
+		Qualify:        Emulated,
+		Intervals:      Unsupported,
+		OpenTake:       Emulated,
+		ReplaceView:    Emulated,
+	}),
+	duql.ClickHouse: {
+		Loop:    Unsupported,
+		Qualify: Emulated,
+	},
+	duql.BigQuery: merge(noFiles, map[Capability]Support{
+		OpenTake: Emulated,
+	}),
+	duql.Snowflake: merge(noFiles, map[Capability]Support{
+		OpenTake: Emulated,
+	}),
+	duql.MSSQL: merge(noFiles, map[Capability]Support{
+		ExcludeColumns: Unsupported,
+		Qualify:        Emulated,
+		RegexMatch:     Unsupported,
+		Intervals:      Unsupported,
+		Booleans:       Emulated,
+		Tables:         Unsupported,
+		TempTables:     Unsupported,
+		ViewIfMissing:  Unsupported,
+	}),
+	duql.Trino: merge(noFiles, map[Capability]Support{
+		ExcludeColumns: Unsupported,
+		Qualify:        Emulated,
+		TempTables:     Unsupported,
+		ViewIfMissing:  Unsupported,
+	}),
+}
+
+func merge(maps ...map[Capability]Support) map[Capability]Support {
+	out := make(map[Capability]Support)
+	for _, m := range maps {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Capabilities returns how target handles each capability, or an error if
+// the target is unknown.
+func Capabilities(target duql.TargetDialect) (map[Capability]Support, error) {
+	if _, err := dialectFor(target); err != nil {
+		return nil, err
+	}
+	out := make(map[Capability]Support, len(allCapabilities))
+	for _, c := range allCapabilities {
+		out[c] = capabilities[target][c]
+	}
+	return out, nil
+}
+
+// UnsupportedError is returned when a query uses a capability its target
+// cannot express.
+type UnsupportedError struct {
+	Capability Capability
+	Target     duql.TargetDialect
+	// Hint suggests how to rewrite the query, if there is a way.
+	Hint string
+}
+
+func (e *UnsupportedError) Error() string {
+	msg := fmt.Sprintf("%s is not supported by %s", e.Capability, e.Target)
+	if e.Hint != "" {
+		msg += "; " + e.Hint
+	}
+	return msg
+}
+
+// supports reports how the target handles c.
+func (d *dialect) supports(c Capability) Support {
+	return capabilities[d.target][c]
+}
+
+// require returns an UnsupportedError when the target cannot express c,
+// natively or by emulation.
+func (d *dialect) require(c Capability) error {
+	if d.supports(c) == Unsupported {
+		return &UnsupportedError{Capability: c, Target: d.target}
+	}
+	return nil
+}
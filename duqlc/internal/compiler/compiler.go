@@ -0,0 +1,395 @@
+// Package compiler translates DUQL queries into SQL for a target dialect.
+package compiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// Options control a compilation.
+type Options struct {
+	// Target overrides the settings.target of the query.
+	Target duql.TargetDialect
+}
+
+// Result is the SQL for one query.
+type Result struct {
+	SQL      string
+	Target   duql.TargetDialect
+	Warnings []string
+	// Steps tells where each step of Query.Steps ended up in SQL.
+	Steps []StepPlan
+	// Tables are the common table expressions of SQL, in order.
+	Tables []Table
+	// Params are the arguments SQL expects, in the order they are passed.
+	Params []Param
+}
+
+// StepPlan is the part of the SQL one step of a query became.
+type StepPlan struct {
+	// Table is the common table expression the step was written to, or
+	// empty when it is part of the final SELECT.
+	Table string
+	// Declarations are the declared names the step uses, sorted.
+	Declarations []string
+}
+
+// Table is a common table expression.
+type Table struct {
+	Name string
+	SQL  string
+}
+
+type compiler struct {
+	d *dialect
+	q *duql.Query
+
+	ctes      []cte
+	recursive bool
+	tables    int
+
+	exprs     map[string]expr.Node
+	funcs     map[string]*expr.Lambda
+	tuples    map[string]map[string]expr.Node
+	pipelines map[string]*duql.Pipeline
+	// compiled holds the declared pipelines already written as CTEs; a
+	// pipeline being compiled maps to false.
+	compiled map[string]bool
+	// files holds the CTE each DUQL file read as a dataset was written
+	// to, shared with the compilers of those files.
+	files map[string]string
+	// nested counts the inline datasets being compiled, whose steps are
+	// not steps of the query.
+	nested int
+	// params holds the types of the parameters used, shared like files.
+	params map[string]duql.ParamType
+
+	// plans records, for each step of Query.Steps, the frame it ended in
+	// and the declarations it used. used collects the declarations of the
+	// step being compiled, and written the CTE it wrote itself, if any.
+	plans   []plan
+	used    map[string]bool
+	written string
+}
+
+type plan struct {
+	f       *frame
+	written string
+	used    []string
+}
+
+// Compile translates q into SQL. The target is taken from opts, then from
+// the query settings, and defaults to generic SQL.
+func Compile(q *duql.Query, opts Options) (*Result, error) {
+	target := opts.Target
+	if target == "" && q.Settings != nil {
+		target = q.Settings.Target
+	}
+	if target == "" {
+		target = duql.Generic
+	}
+	d, err := dialectFor(target)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &compiler{
+		d:         d,
+		q:         q,
+		exprs:     make(map[string]expr.Node),
+		funcs:     make(map[string]*expr.Lambda),
+		tuples:    make(map[string]map[string]expr.Node),
+		pipelines: make(map[string]*duql.Pipeline),
+		compiled:  make(map[string]bool),
+		files:     make(map[string]string),
+		params:    make(map[string]duql.ParamType),
+	}
+	if err := c.declare(); err != nil {
+		return nil, err
+	}
+
+	f, err := c.pipeline(q.Dataset, q.Steps, "steps")
+	if err != nil {
+		return nil, err
+	}
+	main := d.printSelect(f.stmt(d, true))
+	sql := d.printQuery(c.ctes, c.recursive, main)
+	if q.Into.Materialized() {
+		if sql, err = d.materialize(sql, q.Into); err != nil {
+			return nil, fmt.Errorf("into: %w", err)
+		}
+	}
+
+	res := &Result{
+		SQL:      sql,
+		Target:   target,
+		Warnings: q.RawSQLWarnings(target),
+	}
+	for _, p := range c.plans {
+		table := p.written
+		if table == "" {
+			table = p.f.table
+		}
+		res.Steps = append(res.Steps, StepPlan{Table: table, Declarations: p.used})
+	}
+	for _, t := range c.ctes {
+		res.Tables = append(res.Tables, Table{Name: t.name, SQL: t.body})
+	}
+	res.SQL, res.Tables, res.Params = d.bind(res.SQL, res.Tables, c.params)
+	return res, nil
+}
+
+// use records that the step being compiled refers to a declaration.
+func (c *compiler) use(name string) {
+	if c.used != nil {
+		c.used[name] = true
+	}
+}
+
+// declare parses the declare section.
+func (c *compiler) declare() error {
+	for name, value := range c.q.Declare {
+		switch {
+		case value.Pipeline != nil:
+			c.pipelines[name] = value.Pipeline
+		case value.Function != nil:
+			fn := &expr.Lambda{}
+			for _, p := range value.Function.Parameters {
+				param := expr.LambdaParam{Name: p.Name}
+				if p.Default != nil {
+					n, err := expr.FromDUQL(duql.Expression{Value: p.Default})
+					if err != nil {
+						return fmt.Errorf("declare.%s: invalid default for %s: %w", name, p.Name, err)
+					}
+					param.Default = n
+				}
+				fn.Params = append(fn.Params, param)
+			}
+			body, err := expr.FromDUQL(value.Function.Expression)
+			if err != nil {
+				return fmt.Errorf("declare.%s: %w", name, err)
+			}
+			fn.Body = body
+			c.funcs[name] = fn
+		case value.Expression != nil:
+			n, err := expr.FromDUQL(*value.Expression)
+			if err != nil {
+				return fmt.Errorf("declare.%s: %w", name, err)
+			}
+			if fn, ok := n.(*expr.Lambda); ok {
+				c.funcs[name] = fn
+			} else {
+				c.exprs[name] = n
+			}
+		case value.Tuple != nil:
+			fields := make(map[string]expr.Node)
+			for key, v := range value.Tuple {
+				n, err := expr.FromDUQL(duql.Expression{Value: v})
+				if err != nil {
+					return fmt.Errorf("declare.%s.%s: %w", name, key, err)
+				}
+				fields[key] = n
+			}
+			c.tuples[name] = fields
+		}
+	}
+	return nil
+}
+
+// tableName returns a fresh name for a common table expression.
+func (c *compiler) tableName() string {
+	for {
+		name := fmt.Sprintf("table_%d", c.tables)
+		c.tables++
+		if _, taken := c.pipelines[name]; !taken && !c.hasTable(name) {
+			return name
+		}
+	}
+}
+
+// hasTable reports whether a common table expression is named name.
+func (c *compiler) hasTable(name string) bool {
+	for _, t := range c.ctes {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pipeline builds the frame for a dataset followed by steps.
+func (c *compiler) pipeline(ds duql.Dataset, steps duql.Steps, path string) (*frame, error) {
+	from, ref, name, err := c.dataset(ds)
+	if err != nil {
+		return nil, fmt.Errorf("%sdataset: %w", strings.TrimSuffix(path, "steps"), err)
+	}
+	f := newFrame(from, ref, name)
+	return c.steps(f, steps, path)
+}
+
+// dataset renders a dataset as a FROM item, along with the SQL and the
+// DUQL name its columns can be qualified with.
+func (c *compiler) dataset(ds duql.Dataset) (from, ref, name string, err error) {
+	d := c.d
+	if ds.SQL != nil {
+		name := c.tableName()
+		c.ctes = append(c.ctes, cte{name: name, body: strings.TrimSpace(ds.SQL.SQL)})
+		return d.quoteIdent(name), d.quoteIdent(name), name, nil
+	}
+	if ds.Query != nil {
+		name, err := c.subquery(ds)
+		if err != nil {
+			return "", "", "", err
+		}
+		return d.quoteIdent(name), d.quoteIdent(name), name, nil
+	}
+	if path := ds.QueryPath(); path != "" {
+		return "", "", "", fmt.Errorf("%s is a DUQL file; load the query to read it", path)
+	}
+
+	source := ds.Simple
+	var format duql.DataFormat
+	if ds.Complex != nil {
+		source, format = ds.Complex.Name, ds.Complex.Format
+	}
+	if source == "" {
+		return "", "", "", fmt.Errorf("dataset is required")
+	}
+
+	if p, ok := c.pipelines[source]; ok {
+		c.use(source)
+		if err := c.declaredPipeline(source, p); err != nil {
+			return "", "", "", err
+		}
+		// Columns of an imported pipeline are qualified with its name
+		// without the namespace.
+		name := source[strings.LastIndex(source, ".")+1:]
+		return d.quoteIdent(source), d.quoteIdent(source), name, nil
+	}
+
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(source)) {
+		case ".csv":
+			format = duql.CSV
+		case ".json", ".ndjson", ".jsonl":
+			format = duql.JSON
+		case ".parquet":
+			format = duql.Parquet
+		default:
+			format = duql.Table
+		}
+	}
+	if format == duql.Table {
+		parts := strings.Split(source, ".")
+		return d.quotePath(parts), d.quotePath(parts), parts[len(parts)-1], nil
+	}
+
+	if err := d.require(fileCapabilities[format]); err != nil {
+		return "", "", "", err
+	}
+	reader := d.fileReaders[format]
+	path, err := d.quoteString(source)
+	if err != nil {
+		return "", "", "", err
+	}
+	base := filepath.Base(source)
+	name = strings.TrimSuffix(base, filepath.Ext(base))
+	ref = d.quoteIdent(name)
+	return template(reader, path) + " AS " + ref, ref, name, nil
+}
+
+// declaredPipeline writes a declared pipeline as a CTE of the same name.
+func (c *compiler) declaredPipeline(name string, p *duql.Pipeline) error {
+	if done, ok := c.compiled[name]; ok {
+		if !done {
+			return fmt.Errorf("declare.%s: pipeline refers to itself", name)
+		}
+		return nil
+	}
+	if c.hasTable(name) {
+		return fmt.Errorf("declare.%s: %s is also the name of a table written for another DUQL file", name, name)
+	}
+	c.compiled[name] = false
+	f, err := c.pipeline(p.Dataset, p.Steps, "declare."+name+".steps")
+	if err != nil {
+		return err
+	}
+	c.ctes = append(c.ctes, cte{name: name, body: c.d.printSelect(f.stmt(c.d, false))})
+	c.compiled[name] = true
+	return nil
+}
+
+// subquery writes a dataset with steps of its own as a CTE and returns its
+// name. A query read from a DUQL file is compiled with its own declarations
+// into a CTE named after the file, once however often it is read; an
+// inline one is compiled with the declarations of the query.
+func (c *compiler) subquery(ds duql.Dataset) (string, error) {
+	q := ds.Query
+	if ds.Inline() {
+		c.nested++
+		f, err := c.pipeline(q.Dataset, q.Steps, "steps")
+		c.nested--
+		if err != nil {
+			return "", err
+		}
+		name := c.tableName()
+		c.ctes = append(c.ctes, cte{name: name, body: c.d.printSelect(f.stmt(c.d, false))})
+		return name, nil
+	}
+
+	if name, ok := c.files[ds.File]; ok {
+		if name == "" {
+			return "", fmt.Errorf("%s reads itself", ds.File)
+		}
+		return name, nil
+	}
+	c.files[ds.File] = ""
+	sub := &compiler{
+		d:         c.d,
+		q:         q,
+		ctes:      c.ctes,
+		recursive: c.recursive,
+		tables:    c.tables,
+		exprs:     make(map[string]expr.Node),
+		funcs:     make(map[string]*expr.Lambda),
+		tuples:    make(map[string]map[string]expr.Node),
+		pipelines: make(map[string]*duql.Pipeline),
+		compiled:  make(map[string]bool),
+		files:     c.files,
+		nested:    1,
+		params:    c.params,
+	}
+	if err := sub.declare(); err != nil {
+		return "", fmt.Errorf("%s: %w", ds.File, err)
+	}
+	f, err := sub.pipeline(q.Dataset, q.Steps, "steps")
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ds.File, err)
+	}
+	c.ctes, c.recursive, c.tables = sub.ctes, sub.recursive, sub.tables
+
+	name := filepath.Base(ds.File)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, filepath.Ext(name)), ".duql")
+	if _, taken := c.pipelines[name]; taken || c.hasTable(name) || !plainName(name) {
+		name = c.tableName()
+	}
+	c.ctes = append(c.ctes, cte{name: name, body: c.d.printSelect(f.stmt(c.d, false))})
+	c.files[ds.File] = name
+	return name, nil
+}
+
+// plainName reports whether name can be written in an expression without
+// quoting.
+func plainName(name string) bool {
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,227 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+// compile compiles a query written in YAML for target.
+func compile(t *testing.T, src string, target duql.TargetDialect) (*Result, error) {
+	t.Helper()
+	var q duql.Query
+	if err := yaml.Unmarshal([]byte(src), &q); err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	return Compile(&q, Options{Target: target})
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		target duql.TargetDialect
+		src    string
+		want   string
+	}{
+		{
+			name:   "reserved column",
+			target: duql.MySQL,
+			src: `
+dataset: orders
+steps:
+  - select: [rank, amount]`,
+			want: "SELECT\n  `rank`,\n  amount\nFROM\n  orders",
+		},
+		{
+			name:   "text concatenation",
+			target: duql.Postgres,
+			src: `
+dataset: a
+steps:
+  - select:
+      full: first + ' ' + last
+      n: id + 1 + f" of {total}"`,
+			want: "SELECT\n  first || ' ' || last AS \"full\",\n  (id + 1) || ' of ' || total AS n\nFROM\n  a",
+		},
+		{
+			name:   "text concatenation with concat",
+			target: duql.MySQL,
+			src: `
+dataset: a
+steps:
+  - select: {full: first + ' ' + last}`,
+			want: "SELECT\n  CONCAT(first, ' ', last) AS `full`\nFROM\n  a",
+		},
+		{
+			name:   "filter before right join",
+			target: duql.Generic,
+			src: `
+dataset: a
+steps:
+  - filter: x > 1
+  - join: {dataset: b, where: a.id == b.id, retain: right}`,
+			want: "WITH table_0 AS (\n  SELECT\n    *\n  FROM\n    a\n  WHERE\n    x > 1\n)\nSELECT\n  *\nFROM\n  table_0\n  RIGHT JOIN b ON table_0.id = b.id",
+		},
+		{
+			name:   "filter before inner join",
+			target: duql.SQLite,
+			src: `
+dataset: orders
+steps:
+  - filter: id > 3
+  - join: {dataset: customers, where: orders.customer_id == customers.id}`,
+			want: "WITH table_0 AS (\n  SELECT\n    *\n  FROM\n    orders\n  WHERE\n    id > 3\n)\nSELECT\n  *\nFROM\n  table_0\n  JOIN customers ON table_0.customer_id = customers.id",
+		},
+		{
+			name:   "generate before left join",
+			target: duql.Generic,
+			src: `
+dataset: a
+steps:
+  - generate: {total: price * 2}
+  - join: {dataset: b, where: ==id, retain: left}`,
+			want: "WITH table_0 AS (\n  SELECT\n    *,\n    price * 2 AS total\n  FROM\n    a\n)\nSELECT\n  *\nFROM\n  table_0\n  LEFT JOIN b ON table_0.id = b.id",
+		},
+		{
+			name:   "join first",
+			target: duql.Generic,
+			src: `
+dataset: a
+steps:
+  - join: {dataset: b, where: a.id == b.id}
+  - filter: a.x > 1`,
+			want: "SELECT\n  *\nFROM\n  a\n  JOIN b ON a.id = b.id\nWHERE\n  a.x > 1",
+		},
+		{
+			name:   "take in group without qualify",
+			target: duql.Postgres,
+			src: `
+dataset: a
+steps:
+  - select: [g, n]
+  - group:
+      by: [g]
+      steps:
+        - sort: n
+        - take: 2`,
+			want: "WITH table_0 AS (\n  SELECT\n    g,\n    n,\n    ROW_NUMBER() OVER (PARTITION BY g ORDER BY n) AS _row_number\n  FROM\n    a\n)\nSELECT\n  g,\n  n\nFROM\n  table_0\nWHERE\n  _row_number <= 2",
+		},
+		{
+			name:   "computed group key",
+			target: duql.Postgres,
+			src: `
+dataset: sales
+steps:
+  - group:
+      by: [category, year(order_date)]
+      summarize: {n: count id}
+  - sort: year_order_date`,
+			want: "SELECT\n  category,\n  EXTRACT(YEAR FROM order_date) AS year_order_date,\n  COUNT(id) AS n\nFROM\n  sales\nGROUP BY\n  category,\n  EXTRACT(YEAR FROM order_date)\nORDER BY\n  year_order_date",
+		},
+		{
+			name:   "loop replaces a column in place",
+			target: duql.Generic,
+			src: `
+dataset: a
+steps:
+  - select: [n, label]
+  - loop:
+      - generate: {n: n + 1}
+      - filter: n < 5`,
+			want: "WITH RECURSIVE table_0 AS (\n  SELECT\n    n,\n    label\n  FROM\n    a\n  UNION ALL\n  SELECT\n    n + 1 AS n,\n    label\n  FROM\n    table_0\n  WHERE\n    n + 1 < 5\n)\nSELECT\n  *\nFROM\n  table_0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := compile(t, tt.src, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.SQL != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", res.SQL, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	const src = `
+dataset: a
+steps:
+  - %s: b`
+	tests := []struct {
+		target duql.TargetDialect
+		want   map[string]string
+	}{
+		{duql.Generic, map[string]string{"append": "UNION ALL", "union": "UNION", "intersect": "INTERSECT", "except": "EXCEPT"}},
+		{duql.Trino, map[string]string{"append": "UNION ALL", "union": "UNION", "intersect": "INTERSECT", "except": "EXCEPT"}},
+		{duql.MSSQL, map[string]string{"append": "UNION ALL", "union": "UNION", "intersect": "INTERSECT", "except": "EXCEPT"}},
+		{duql.BigQuery, map[string]string{"append": "UNION ALL", "union": "UNION DISTINCT", "intersect": "INTERSECT DISTINCT", "except": "EXCEPT DISTINCT"}},
+		{duql.ClickHouse, map[string]string{"append": "UNION ALL", "union": "UNION DISTINCT", "intersect": "INTERSECT DISTINCT", "except": "EXCEPT DISTINCT"}},
+	}
+	for _, tt := range tests {
+		for step, op := range tt.want {
+			t.Run(string(tt.target)+"/"+step, func(t *testing.T) {
+				res, err := compile(t, fmt.Sprintf(src, step), tt.target)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := "SELECT * FROM a " + op + " SELECT * FROM b"
+				if !strings.Contains(strings.Join(strings.Fields(res.SQL), " "), want) {
+					t.Errorf("got\n%s\nwant it to contain\n%s", res.SQL, want)
+				}
+			})
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "loop over every column",
+			src: `
+dataset: a
+steps:
+  - loop:
+      - generate: {n: n + 1}`,
+			want: "select them first",
+		},
+		{
+			name: "take in group without a known column list",
+			src: `
+dataset: a
+steps:
+  - group:
+      by: [g]
+      steps:
+        - take: 1`,
+			want: "select! without a known column list is not supported by sql.generic; select the columns to keep before take",
+		},
+		{
+			name: "loop adds a column",
+			src: `
+dataset: a
+steps:
+  - select: [n]
+  - loop:
+      - generate: {m: n + 1}`,
+			want: "cannot add columns",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compile(t, tt.src, duql.Generic)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
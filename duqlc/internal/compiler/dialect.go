@@ -0,0 +1,393 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+type intervalStyle int
+
+const (
+	// noIntervals means interval literals cannot be written.
+	noIntervals intervalStyle = iota
+	// intervalText writes INTERVAL '30 days'.
+	intervalText
+	// intervalUnit writes INTERVAL 30 DAY.
+	intervalUnit
+	// intervalQuotedUnit writes INTERVAL '30' DAY.
+	intervalQuotedUnit
+)
+
+type paginationStyle int
+
+const (
+	// limitOffset writes LIMIT n OFFSET m.
+	limitOffset paginationStyle = iota
+	// offsetLimit writes OFFSET m LIMIT n.
+	offsetLimit
+	// offsetFetch writes TOP (n), or OFFSET m ROWS FETCH NEXT n ROWS ONLY
+	// after an ORDER BY, which is then required.
+	offsetFetch
+)
+
+// dialect describes how SQL is spelled for one TargetDialect.
+type dialect struct {
+	target duql.TargetDialect
+
+	// quoteOpen and quoteClose delimit quoted identifiers; a quoteClose inside
+	// an identifier is escaped by prefixing it with identEscape, which
+	// defaults to doubling it.
+	quoteOpen, quoteClose string
+	identEscape           string
+	// foldsLower is set when unquoted identifiers are folded to lower case, so
+	// identifiers containing upper case letters must be quoted to keep them.
+	foldsLower bool
+	// backslashEscapes is set when string literals treat backslash as an
+	// escape character and it must itself be escaped.
+	backslashEscapes bool
+	// quoteEscape replaces a single quote inside a string literal.
+	quoteEscape string
+	// reserved words that must be quoted when used as identifiers.
+	reserved map[string]bool
+
+	// noBooleans is set when TRUE and FALSE must be written as 1 and 0.
+	noBooleans bool
+	// concatFunc spells string concatenation as CONCAT(a, b) instead of a || b.
+	concatFunc bool
+	// modFunc spells a % b as MOD(a, b).
+	modFunc bool
+	// starExclude is the keyword for SELECT * EXCLUDE (…), if supported.
+	starExclude string
+	// recursive is the WITH clause that allows a CTE to refer to itself, or
+	// empty when loops cannot be expressed.
+	recursive string
+	// qualifyNeedsWhere is set when QUALIFY must be paired with a WHERE.
+	qualifyNeedsWhere bool
+	// setQuantifier is written after UNION, INTERSECT and EXCEPT when the
+	// dialect does not default to DISTINCT.
+	setQuantifier string
+
+	pagination paginationStyle
+	// unboundedLimit is the LIMIT to pair with an OFFSET when no limit is
+	// wanted, for dialects that cannot write OFFSET on its own.
+	unboundedLimit string
+	interval       intervalStyle
+
+	// File readers for csv, json and parquet datasets, keyed by format.
+	fileReaders map[duql.DataFormat]string
+	// regexMatch and intDiv are templates for ~= and //.
+	regexMatch string
+	intDiv     string
+	date       string
+	timestamp  string
+	time       string
+
+	// replaceView starts a statement replacing a view, when the target has
+	// one; targets emulating ReplaceView drop the view first.
+	replaceView string
+	// tempTable is the keyword creating a temporary table.
+	tempTable string
+	// tableEngine and tempEngine are written after the name of a table
+	// created from a query, for targets that need a storage engine.
+	tableEngine, tempEngine string
+	// placeholder is how runtime parameters are written.
+	placeholder placeholderStyle
+}
+
+var dialects = map[duql.TargetDialect]*dialect{
+	duql.Generic: {
+		quoteOpen: `"`, quoteClose: `"`,
+		foldsLower: true,
+		reserved:   reservedWords(),
+		recursive:  "WITH RECURSIVE",
+		interval:   intervalText,
+		regexMatch: "REGEXP_LIKE({0}, {1})",
+		intDiv:     "FLOOR({0} / {1})",
+		date:       "DATE {0}", timestamp: "TIMESTAMP {0}", time: "TIME {0}",
+	},
+	duql.Postgres: {
+		quoteOpen: `"`, quoteClose: `"`,
+		foldsLower: true,
+		reserved:   reservedWords(postgresReserved),
+		recursive:  "WITH RECURSIVE",
+		interval:   intervalText,
+		regexMatch: "{0} ~ {1}",
+		intDiv:     "DIV({0}, {1})",
+		date:       "DATE {0}", timestamp: "TIMESTAMP {0}", time: "TIME {0}",
+		placeholder: placeholderNumbered,
+	},
+	duql.GlareDB: {
+		quoteOpen: `"`, quoteClose: `"`,
+		foldsLower: true,
+		reserved:   reservedWords(postgresReserved),
+		recursive:  "WITH RECURSIVE",
+		interval:   intervalText,
+		fileReaders: map[duql.DataFormat]string{
+			duql.CSV:     "read_csv({0})",
+			duql.JSON:    "read_json({0})",
+			duql.Parquet: "read_parquet({0})",
+		},
+		regexMatch: "{0} ~ {1}",
+		intDiv:     "DIV({0}, {1})",
+		date:       "DATE {0}", timestamp: "TIMESTAMP {0}", time: "TIME {0}",
+		placeholder: placeholderNumbered,
+	},
+	duql.DuckDB: {
+		quoteOpen: `"`, quoteClose: `"`,
+		reserved:    reservedWords(postgresReserved, duckdbReserved),
+		starExclude: "EXCLUDE",
+		recursive:   "WITH RECURSIVE",
+		interval:    intervalText,
+		fileReaders: map[duql.DataFormat]string{
+			duql.CSV:     "read_csv_auto({0})",
+			duql.JSON:    "read_json_auto({0})",
+			duql.Parquet: "read_parquet({0})",
+		},
+		regexMatch: "REGEXP_MATCHES({0}, {1})",
+		intDiv:     "{0} // {1}",
+		date:       "DATE {0}", timestamp: "TIMESTAMP {0}", time: "TIME {0}",
+		placeholder: placeholderNumbered,
+	},
+	duql.MySQL: {
+		quoteOpen: "`", quoteClose: "`",
+		backslashEscapes: true,
+		reserved:         reservedWords(mysqlReserved),
+		concatFunc:       true,
+		recursive:        "WITH RECURSIVE",
+		unboundedLimit:   "18446744073709551615",
+		interval:         intervalUnit,
+		regexMatch:       "{0} REGEXP {1}",
+		intDiv:           "{0} DIV {1}",
+		date:             "DATE {0}", timestamp: "TIMESTAMP {0}", time: "TIME {0}",
+	},
+	duql.SQLite: {
+		quoteOpen: `"`, quoteClose: `"`,
+		reserved:       reservedWords(sqliteReserved),
+		recursive:      "WITH RECURSIVE",
+		unboundedLimit: "-1",
+		regexMatch:     "{0} REGEXP {1}",
+		intDiv:         "CAST({0} / {1} AS INTEGER)",
+		date:           "DATE({0})", timestamp: "DATETIME({0})", time: "TIME({0})",
+		placeholder: placeholderColon,
+	},
+	duql.ClickHouse: {
+		quoteOpen: "`", quoteClose: "`",
+		backslashEscapes: true,
+		reserved:         reservedWords(clickhouseReserved),
+		concatFunc:       true,
+		starExclude:      "EXCEPT",
+		setQuantifier:    "DISTINCT",
+		interval:         intervalUnit,
+		fileReaders: map[duql.DataFormat]string{
+			duql.CSV:     "file({0}, 'CSVWithNames')",
+			duql.JSON:    "file({0}, 'JSONEachRow')",
+			duql.Parquet: "file({0}, 'Parquet')",
+		},
+		regexMatch: "match({0}, {1})",
+		intDiv:     "intDiv({0}, {1})",
+		date:       "toDate({0})", timestamp: "toDateTime({0})", time: "{0}",
+		tableEngine: "ENGINE = MergeTree ORDER BY tuple()",
+		tempEngine:  "ENGINE = Memory",
+		placeholder: placeholderTyped,
+	},
+	duql.BigQuery: {
+		quoteOpen: "`", quoteClose: "`",
+		identEscape:       `\`,
+		backslashEscapes:  true,
+		quoteEscape:       `\'`,
+		reserved:          reservedWords(bigqueryReserved),
+		modFunc:           true,
+		starExclude:       "EXCEPT",
+		recursive:         "WITH RECURSIVE",
+		qualifyNeedsWhere: true,
+		setQuantifier:     "DISTINCT",
+		unboundedLimit:    "9223372036854775807",
+		interval:          intervalUnit,
+		regexMatch:        "REGEXP_CONTAINS({0}, {1})",
+		intDiv:            "DIV({0}, {1})",
+		date:              "DATE {0}", timestamp: "TIMESTAMP {0}", time: "TIME {0}",
+		tempTable:   "TEMP",
+		placeholder: placeholderAt,
+	},
+	duql.Snowflake: {
+		quoteOpen: `"`, quoteClose: `"`,
+		backslashEscapes: true,
+		reserved:         reservedWords(snowflakeReserved),
+		starExclude:      "EXCLUDE",
+		recursive:        "WITH RECURSIVE",
+		unboundedLimit:   "NULL",
+		interval:         intervalText,
+		regexMatch:       "REGEXP_INSTR({0}, {1}) > 0",
+		intDiv:           "FLOOR({0} / {1})",
+		date:             "DATE {0}", timestamp: "TIMESTAMP {0}", time: "TIME {0}",
+	},
+	duql.MSSQL: {
+		quoteOpen: "[", quoteClose: "]",
+		reserved:   reservedWords(mssqlReserved),
+		noBooleans: true,
+		concatFunc: true,
+		recursive:  "WITH",
+		pagination: offsetFetch,
+		intDiv:     "FLOOR({0} / {1})",
+		date:       "CAST({0} AS DATE)", timestamp: "CAST({0} AS DATETIME2)", time: "CAST({0} AS TIME)",
+		replaceView: "CREATE OR ALTER VIEW",
+		placeholder: placeholderAt,
+	},
+	duql.Trino: {
+		quoteOpen: `"`, quoteClose: `"`,
+		reserved:   reservedWords(trinoReserved),
+		recursive:  "WITH RECURSIVE",
+		pagination: offsetLimit,
+		interval:   intervalQuotedUnit,
+		regexMatch: "REGEXP_LIKE({0}, {1})",
+		intDiv:     "FLOOR({0} / {1})",
+		date:       "DATE {0}", timestamp: "TIMESTAMP {0}", time: "TIME {0}",
+	},
+}
+
+func init() {
+	for target, d := range dialects {
+		d.target = target
+		if d.identEscape == "" {
+			d.identEscape = d.quoteClose
+		}
+		if d.quoteEscape == "" {
+			d.quoteEscape = "''"
+		}
+		if d.replaceView == "" {
+			d.replaceView = "CREATE OR REPLACE VIEW"
+		}
+		if d.tempTable == "" {
+			d.tempTable = "TEMPORARY"
+		}
+	}
+}
+
+func dialectFor(target duql.TargetDialect) (*dialect, error) {
+	d, ok := dialects[target]
+	if !ok {
+		return nil, fmt.Errorf("unsupported target: %s", target)
+	}
+	return d, nil
+}
+
+// ansiReserved are reserved by the SQL standard and by most engines.
+var ansiReserved = []string{
+	"all", "alter", "and", "any", "array", "as", "asc", "between", "both", "by",
+	"case", "cast", "check", "collate", "column", "constraint", "create", "cross",
+	"current_date", "current_time", "current_timestamp", "current_user",
+	"default", "delete", "desc", "distinct", "drop", "else", "end", "except",
+	"exists", "false", "fetch", "for", "foreign", "from", "full", "grant", "group",
+	"having", "in", "inner", "insert", "intersect", "interval", "into", "is",
+	"join", "lateral", "leading", "left", "like", "limit", "natural", "not",
+	"null", "offset", "on", "only", "or", "order", "outer", "over", "partition",
+	"primary", "references", "right", "rows", "select", "session_user", "some",
+	"table", "then", "to", "trailing", "true", "union", "unique", "update",
+	"user", "using", "values", "when", "where", "window", "with",
+}
+
+var postgresReserved = []string{
+	"analyse", "analyze", "asymmetric", "authorization", "binary", "concurrently",
+	"current_catalog", "current_role", "current_schema", "deferrable", "do",
+	"freeze", "ilike", "initially", "isnull", "localtime", "localtimestamp",
+	"notnull", "overlaps", "placing", "returning", "similar", "symmetric",
+	"tablesample", "variadic", "verbose",
+}
+
+var duckdbReserved = []string{
+	"anti", "asof", "describe", "lambda", "pivot", "pivot_longer", "pivot_wider",
+	"positional", "qualify", "semi", "show", "summarize", "unpivot",
+}
+
+var mysqlReserved = []string{
+	"accessible", "add", "before", "bigint", "blob", "call", "cascade", "change",
+	"char", "character", "condition", "continue", "convert", "cume_dist",
+	"database", "databases", "dec", "decimal", "declare", "delayed", "dense_rank",
+	"describe", "div", "double", "dual", "each", "elseif", "enclosed", "escaped",
+	"exit", "explain", "first_value", "float", "force", "fulltext", "function",
+	"generated", "groups", "high_priority", "if", "ignore", "index", "infile",
+	"int", "integer", "iterate", "key", "keys", "kill", "lag", "last_value",
+	"lead", "leave", "lines", "load", "lock", "long", "loop", "match", "mod",
+	"modifies", "ntile", "of", "percent_rank", "procedure", "range", "rank",
+	"read", "real", "recursive", "regexp", "release", "rename", "repeat",
+	"replace", "require", "restrict", "return", "revoke", "rlike", "row",
+	"row_number", "schema", "schemas", "separator", "show", "signal", "smallint",
+	"spatial", "sql", "ssl", "starting", "straight_join", "system", "terminated",
+	"trigger", "undo", "unlock", "unsigned", "usage", "use", "varchar", "while",
+	"write", "xor", "year_month", "zerofill",
+}
+
+var sqliteReserved = []string{
+	"abort", "action", "add", "after", "analyze", "attach", "autoincrement",
+	"before", "begin", "cascade", "conflict", "database", "deferrable",
+	"deferred", "detach", "each", "escape", "exclusive", "explain", "fail",
+	"glob", "if", "ignore", "immediate", "index", "indexed", "initially",
+	"instead", "isnull", "key", "match", "no", "notnull", "of", "plan", "pragma",
+	"query", "raise", "recursive", "regexp", "reindex", "release", "rename",
+	"replace", "restrict", "row", "savepoint", "temp", "temporary",
+	"transaction", "trigger", "vacuum", "view", "virtual", "without",
+}
+
+var bigqueryReserved = []string{
+	"assert_rows_modified", "contains", "cube", "current", "define", "enum",
+	"escape", "exclude", "extract", "following", "groups", "hash", "if",
+	"ignore", "lookup", "merge", "new", "no", "nulls", "of", "preceding",
+	"proto", "qualify", "range", "recursive", "respect", "rollup", "set",
+	"struct", "tablesample", "treat", "unbounded", "within",
+}
+
+var snowflakeReserved = []string{
+	"account", "connection", "database", "gscluster", "ilike", "increment",
+	"issue", "localtime", "localtimestamp", "minus", "of", "organization",
+	"qualify", "regexp", "revoke", "rlike", "row", "rows", "sample", "schema",
+	"set", "start", "tablesample", "trigger", "try_cast", "view",
+}
+
+var mssqlReserved = []string{
+	"add", "authorization", "backup", "begin", "break", "browse", "bulk",
+	"cascade", "checkpoint", "close", "clustered", "coalesce", "commit",
+	"compute", "contains", "containstable", "continue", "convert", "current",
+	"cursor", "database", "dbcc", "deallocate", "declare", "deny", "disk",
+	"distributed", "double", "dump", "errlvl", "escape", "exec", "execute",
+	"exit", "external", "file", "fillfactor", "freetext", "freetexttable",
+	"function", "goto", "holdlock", "identity", "identity_insert", "identitycol",
+	"if", "index", "key", "kill", "lineno", "load", "merge", "national",
+	"nocheck", "nonclustered", "nullif", "of", "off", "offsets", "open",
+	"opendatasource", "openquery", "openrowset", "openxml", "option", "percent",
+	"pivot", "plan", "precision", "print", "proc", "procedure", "public",
+	"raiserror", "read", "readtext", "reconfigure", "replication", "restore",
+	"restrict", "return", "revert", "revoke", "rollback", "rowcount",
+	"rowguidcol", "rule", "save", "schema", "securityaudit", "semantickeyphrasetable",
+	"semanticsimilaritydetailstable", "semanticsimilaritytable", "set",
+	"setuser", "shutdown", "statistics", "system_user", "tablesample",
+	"textsize", "top", "tran", "transaction", "trigger", "truncate",
+	"try_convert", "tsequal", "unpivot", "updatetext", "use", "varying", "view",
+	"waitfor", "while", "within", "writetext",
+}
+
+var trinoReserved = []string{
+	"cube", "current_catalog", "current_path", "current_role", "current_schema",
+	"deallocate", "describe", "execute", "extract", "grouping", "json_array",
+	"json_exists", "json_object", "json_query", "json_table", "json_value",
+	"listagg", "localtime", "localtimestamp", "normalize", "prepare",
+	"recursive", "rollup", "skip", "trim", "uescape", "unnest",
+}
+
+var clickhouseReserved = []string{
+	"anti", "asof", "final", "format", "global", "ilike", "prewhere", "sample",
+	"semi", "settings",
+}
+
+func reservedWords(extra ...[]string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range ansiReserved {
+		words[w] = true
+	}
+	for _, list := range extra {
+		for _, w := range list {
+			words[w] = true
+		}
+	}
+	return words
+}
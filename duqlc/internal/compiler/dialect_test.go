@@ -0,0 +1,105 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		target duql.TargetDialect
+		name   string
+		want   string
+	}{
+		{duql.Generic, "id", "id"},
+		{duql.Generic, "*", "*"},
+		{duql.Generic, "select", `"select"`},
+		{duql.Generic, "Order", `"Order"`},
+		{duql.Generic, "rank", "rank"},
+		{duql.Generic, `a"b`, `"a""b"`},
+		{duql.Generic, "first name", `"first name"`},
+		{duql.Postgres, "verbose", `"verbose"`},
+		{duql.Postgres, "Name", `"Name"`},
+		{duql.GlareDB, "returning", `"returning"`},
+		{duql.DuckDB, "qualify", `"qualify"`},
+		{duql.DuckDB, "summarize", `"summarize"`},
+		{duql.MySQL, "rank", "`rank`"},
+		{duql.MySQL, "Name", "Name"},
+		{duql.MySQL, "a`b", "`a``b`"},
+		{duql.SQLite, "pragma", `"pragma"`},
+		{duql.SQLite, "Name", "Name"},
+		{duql.ClickHouse, "prewhere", "`prewhere`"},
+		{duql.BigQuery, "qualify", "`qualify`"},
+		{duql.BigQuery, "a`b", "`a\\`b`"},
+		{duql.BigQuery, `a\b`, "`a\\\\b`"},
+		{duql.Snowflake, "minus", `"minus"`},
+		{duql.Snowflake, "Name", "Name"},
+		{duql.MSSQL, "top", "[top]"},
+		{duql.MSSQL, "a]b", "[a]]b]"},
+		{duql.MSSQL, "a[b", "[a[b]"},
+		{duql.Trino, "unnest", `"unnest"`},
+		{duql.Trino, "rank", "rank"},
+	}
+	for _, tt := range tests {
+		d, err := dialectFor(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.quoteIdent(tt.name); got != tt.want {
+			t.Errorf("%s: quoteIdent(%q) = %s, want %s", tt.target, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReservedWordsAreQuoted(t *testing.T) {
+	for target, d := range dialects {
+		for word := range d.reserved {
+			if got := d.quoteIdent(word); got == word {
+				t.Errorf("%s: reserved word %s is not quoted", target, word)
+			}
+		}
+	}
+}
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		target duql.TargetDialect
+		s      string
+		want   string
+	}{
+		{duql.Generic, "it's", `'it''s'`},
+		{duql.Generic, `C:\dir`, `'C:\dir'`},
+		{duql.Postgres, `a\'b`, `'a\''b'`},
+		{duql.MySQL, "it's", `'it''s'`},
+		{duql.MySQL, `C:\dir`, `'C:\\dir'`},
+		{duql.ClickHouse, `a\'b`, `'a\\''b'`},
+		{duql.BigQuery, "it's", `'it\'s'`},
+		{duql.BigQuery, `C:\dir`, `'C:\\dir'`},
+		{duql.Snowflake, `it's \n`, `'it''s \\n'`},
+		{duql.MSSQL, "it's", `'it''s'`},
+		{duql.Trino, "", `''`},
+	}
+	for _, tt := range tests {
+		d, err := dialectFor(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.quoteString(tt.s)
+		if err != nil {
+			t.Errorf("%s: quoteString(%q): %v", tt.target, tt.s, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: quoteString(%q) = %s, want %s", tt.target, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteStringRejectsNUL(t *testing.T) {
+	for target, d := range dialects {
+		if _, err := d.quoteString("a\x00b"); err == nil {
+			t.Errorf("%s: quoteString accepted a NUL character", target)
+		}
+	}
+}
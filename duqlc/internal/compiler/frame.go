@@ -0,0 +1,207 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// frame is the SELECT being built for the current point of a pipeline.
+// Steps add to it until one cannot be expressed in the same SELECT, at
+// which point the frame is wrapped into a common table expression.
+type frame struct {
+	from  string
+	joins []string
+	// relations maps the dataset names a query can qualify columns with
+	// to the SQL that refers to them.
+	relations map[string]string
+	// primary is the relation the pipeline started from.
+	primary string
+
+	// star is set while every input column is still passed through.
+	star    bool
+	exclude []string
+	columns []*column
+
+	where   []string
+	groupBy []string
+	having  []string
+	// qualify filters on window functions in the same SELECT, for dialects
+	// that support it.
+	qualify  []string
+	sort     []sortItem
+	grouped  bool
+	distinct bool
+
+	limit, offset int
+	limited       bool
+
+	// noWrap is set inside a loop, where the recursive reference must stay
+	// in a single SELECT.
+	noWrap bool
+
+	// table is the common table expression the frame was written to, once
+	// it has been.
+	table string
+}
+
+// column is an output column of a frame.
+type column struct {
+	name string
+	sql  string
+	prec int
+	// plain is set when sql already produces name, so no alias is needed.
+	plain     bool
+	aggregate bool
+	window    bool
+}
+
+type sortItem struct {
+	sql  string
+	desc bool
+	// ref is the output column the key refers to, if any, so the order
+	// can be kept when the frame is wrapped.
+	ref string
+}
+
+// newFrame starts a frame reading from, whose columns are qualified by ref.
+func newFrame(from, ref, name string) *frame {
+	return &frame{
+		from:      from,
+		relations: map[string]string{name: ref},
+		primary:   name,
+		star:      true,
+	}
+}
+
+func (f *frame) lookup(name string) *column {
+	for i := len(f.columns) - 1; i >= 0; i-- {
+		if f.columns[i].name == name {
+			return f.columns[i]
+		}
+	}
+	return nil
+}
+
+// set adds a column, replacing an earlier one of the same name.
+func (f *frame) set(col *column) {
+	for i, c := range f.columns {
+		if c.name == col.name && col.name != "" {
+			f.columns[i] = col
+			return
+		}
+	}
+	f.columns = append(f.columns, col)
+}
+
+// hasWindow reports whether the frame computes window functions, in its
+// columns or in its QUALIFY clause.
+func (f *frame) hasWindow() bool {
+	if len(f.qualify) > 0 {
+		return true
+	}
+	for _, c := range f.columns {
+		if c.window {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *frame) orderBy() []string {
+	return orderBy(f.sort)
+}
+
+func orderBy(items []sortItem) []string {
+	keys := make([]string, len(items))
+	for i, s := range items {
+		keys[i] = s.sql
+		if s.desc {
+			keys[i] += " DESC"
+		}
+	}
+	return keys
+}
+
+// stmt renders the frame as a SELECT. The ORDER BY is left out when
+// withOrder is false, as it has no effect inside a common table expression
+// without a LIMIT.
+func (f *frame) stmt(d *dialect, withOrder bool) *selectStmt {
+	s := &selectStmt{
+		distinct: f.distinct,
+		from:     f.from,
+		joins:    f.joins,
+		where:    f.where,
+		groupBy:  f.groupBy,
+		having:   f.having,
+		qualify:  f.qualify,
+	}
+	if f.star {
+		star := "*"
+		if len(f.exclude) > 0 {
+			names := make([]string, len(f.exclude))
+			for i, name := range f.exclude {
+				names[i] = d.quoteIdent(name)
+			}
+			star = fmt.Sprintf("* %s (%s)", d.starExclude, strings.Join(names, ", "))
+		}
+		s.columns = append(s.columns, star)
+	}
+	for _, c := range f.columns {
+		if c.plain || c.name == "" {
+			s.columns = append(s.columns, c.sql)
+		} else {
+			s.columns = append(s.columns, c.sql+" AS "+d.quoteIdent(c.name))
+		}
+	}
+	if withOrder || f.limited {
+		s.orderBy = f.orderBy()
+	}
+	if f.limited {
+		if f.limit >= 0 {
+			s.limit = strconv.Itoa(f.limit)
+		}
+		if f.offset > 0 {
+			s.offset = strconv.Itoa(f.offset)
+		}
+	}
+	return s
+}
+
+// wrap turns the frame into a common table expression and returns a new
+// frame that selects from it.
+func (c *compiler) wrap(f *frame) (*frame, error) {
+	if f.noWrap {
+		return nil, fmt.Errorf("loop steps must fit in a single SELECT")
+	}
+	name := c.tableName()
+	c.ctes = append(c.ctes, cte{name: name, body: c.d.printSelect(f.stmt(c.d, false))})
+	f.table = name
+
+	from := c.d.quoteIdent(name)
+	nf := newFrame(from, from, name)
+	for rel := range f.relations {
+		nf.relations[rel] = from
+	}
+	nf.primary = f.primary
+	nf.relations[f.primary] = from
+	nf.noWrap = f.noWrap
+
+	if !f.star {
+		nf.star = false
+		for _, col := range f.columns {
+			if col.name == "" {
+				// A relation.* column passes through every column of the relation.
+				nf.star = true
+				continue
+			}
+			nf.columns = append(nf.columns, &column{name: col.name, sql: c.d.quoteIdent(col.name), prec: precAtom, plain: true})
+		}
+	}
+	for _, s := range f.sort {
+		if s.ref != "" {
+			nf.sort = append(nf.sort, sortItem{sql: c.d.quoteIdent(s.ref), desc: s.desc, ref: s.ref})
+		}
+	}
+	return nf, nil
+}
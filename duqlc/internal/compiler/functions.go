@@ -0,0 +1,163 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+type funcKind int
+
+const (
+	scalarFunc funcKind = iota
+	aggregateFunc
+	windowFunc
+)
+
+// function is a standard library function. Templates refer to arguments in
+// the order they are written in DUQL, so a piped value is the last one.
+type function struct {
+	kind funcKind
+	sql  string
+	// dialects overrides sql for some targets; an empty template means the
+	// function cannot be expressed on that target.
+	dialects map[duql.TargetDialect]string
+}
+
+func (f *function) template(target duql.TargetDialect) (string, bool) {
+	if t, ok := f.dialects[target]; ok {
+		return t, t != ""
+	}
+	return f.sql, true
+}
+
+// arity is the number of distinct {n} placeholders in the template, or -1
+// when it takes any number of arguments.
+func arity(t string) int {
+	if strings.Contains(t, "{*}") {
+		return -1
+	}
+	n := 0
+	for strings.Contains(t, "{"+string(rune('0'+n))+"}") {
+		n++
+	}
+	return n
+}
+
+var stdlib = map[string]*function{
+	// Aggregates
+	"sum":            {kind: aggregateFunc, sql: "SUM({0})"},
+	"avg":            {kind: aggregateFunc, sql: "AVG({0})"},
+	"average":        {kind: aggregateFunc, sql: "AVG({0})"},
+	"min":            {kind: aggregateFunc, sql: "MIN({0})"},
+	"max":            {kind: aggregateFunc, sql: "MAX({0})"},
+	"count":          {kind: aggregateFunc, sql: "COUNT({0})"},
+	"count_distinct": {kind: aggregateFunc, sql: "COUNT(DISTINCT {0})"},
+	"stddev": {kind: aggregateFunc, sql: "STDDEV({0})", dialects: map[duql.TargetDialect]string{
+		duql.SQLite:     "",
+		duql.ClickHouse: "stddevSamp({0})",
+		duql.MSSQL:      "STDEV({0})",
+	}},
+	"median": {kind: aggregateFunc, sql: "PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY {0})", dialects: map[duql.TargetDialect]string{
+		duql.DuckDB:     "MEDIAN({0})",
+		duql.ClickHouse: "median({0})",
+		duql.Snowflake:  "MEDIAN({0})",
+		duql.BigQuery:   "APPROX_QUANTILES({0}, 2)[OFFSET(1)]",
+		duql.Trino:      "approx_percentile({0}, 0.5)",
+		duql.MySQL:      "",
+		duql.SQLite:     "",
+		duql.MSSQL:      "",
+	}},
+	"any": {kind: aggregateFunc, sql: "BOOL_OR({0})", dialects: map[duql.TargetDialect]string{
+		duql.MySQL:      "MAX({0})",
+		duql.SQLite:     "MAX({0})",
+		duql.ClickHouse: "max({0})",
+		duql.BigQuery:   "LOGICAL_OR({0})",
+		duql.Snowflake:  "BOOLOR_AGG({0})",
+		duql.MSSQL:      "",
+	}},
+	"every": {kind: aggregateFunc, sql: "BOOL_AND({0})", dialects: map[duql.TargetDialect]string{
+		duql.MySQL:      "MIN({0})",
+		duql.SQLite:     "MIN({0})",
+		duql.ClickHouse: "min({0})",
+		duql.BigQuery:   "LOGICAL_AND({0})",
+		duql.Snowflake:  "BOOLAND_AGG({0})",
+		duql.MSSQL:      "",
+	}},
+
+	// Window functions
+	"row_number":   {kind: windowFunc, sql: "ROW_NUMBER()"},
+	"rank":         {kind: windowFunc, sql: "RANK()"},
+	"dense_rank":   {kind: windowFunc, sql: "DENSE_RANK()"},
+	"percent_rank": {kind: windowFunc, sql: "PERCENT_RANK()"},
+	"cume_dist":    {kind: windowFunc, sql: "CUME_DIST()"},
+	"lag":          {kind: windowFunc, sql: "LAG({0})"},
+	"lead":         {kind: windowFunc, sql: "LEAD({0})"},
+	"first":        {kind: windowFunc, sql: "FIRST_VALUE({0})"},
+	"last":         {kind: windowFunc, sql: "LAST_VALUE({0})"},
+
+	// Scalars
+	"coalesce":          {sql: "COALESCE({*})"},
+	"is_null":           {sql: "{0} IS NULL"},
+	"current_date":      {sql: "CURRENT_DATE", dialects: map[duql.TargetDialect]string{duql.ClickHouse: "today()", duql.MSSQL: "CAST(GETDATE() AS DATE)"}},
+	"current_timestamp": {sql: "CURRENT_TIMESTAMP", dialects: map[duql.TargetDialect]string{duql.ClickHouse: "now()"}},
+	"now":               {sql: "CURRENT_TIMESTAMP", dialects: map[duql.TargetDialect]string{duql.ClickHouse: "now()"}},
+	"lower":             {sql: "LOWER({0})"},
+	"upper":             {sql: "UPPER({0})"},
+	"year":              {sql: "EXTRACT(YEAR FROM {0})", dialects: dateParts("%Y", "toYear", "YEAR")},
+	"month":             {sql: "EXTRACT(MONTH FROM {0})", dialects: dateParts("%m", "toMonth", "MONTH")},
+	"day":               {sql: "EXTRACT(DAY FROM {0})", dialects: dateParts("%d", "toDayOfMonth", "DAY")},
+
+	"text.lower": {sql: "LOWER({0})"},
+	"text.upper": {sql: "UPPER({0})"},
+	"text.trim":  {sql: "TRIM({0})"},
+	"text.ltrim": {sql: "LTRIM({0})"},
+	"text.rtrim": {sql: "RTRIM({0})"},
+	"text.length": {sql: "CHAR_LENGTH({0})", dialects: map[duql.TargetDialect]string{
+		duql.SQLite:     "LENGTH({0})",
+		duql.ClickHouse: "lengthUTF8({0})",
+		duql.BigQuery:   "LENGTH({0})",
+		duql.Snowflake:  "LENGTH({0})",
+		duql.Trino:      "length({0})",
+		duql.MSSQL:      "LEN({0})",
+	}},
+	"text.starts_with": {sql: "{1} LIKE CONCAT({0}, '%')", dialects: map[duql.TargetDialect]string{duql.SQLite: "{1} LIKE {0} || '%'", duql.BigQuery: "STARTS_WITH({1}, {0})"}},
+	"text.ends_with":   {sql: "{1} LIKE CONCAT('%', {0})", dialects: map[duql.TargetDialect]string{duql.SQLite: "{1} LIKE '%' || {0}"}},
+	"text.contains":    {sql: "{1} LIKE CONCAT('%', {0}, '%')", dialects: map[duql.TargetDialect]string{duql.SQLite: "{1} LIKE '%' || {0} || '%'"}},
+	"text.equals":      {sql: "{1} = {0}"},
+	"text.replace":     {sql: "REPLACE({2}, {0}, {1})", dialects: map[duql.TargetDialect]string{duql.ClickHouse: "replaceAll({2}, {0}, {1})"}},
+	"text.extract":     {sql: "SUBSTRING({2}, {0}, {1})", dialects: map[duql.TargetDialect]string{duql.SQLite: "SUBSTR({2}, {0}, {1})", duql.BigQuery: "SUBSTR({2}, {0}, {1})", duql.ClickHouse: "substringUTF8({2}, {0}, {1})"}},
+
+	"math.abs":   {sql: "ABS({0})"},
+	"math.floor": {sql: "FLOOR({0})"},
+	"math.ceil":  {sql: "CEIL({0})", dialects: map[duql.TargetDialect]string{duql.MSSQL: "CEILING({0})"}},
+	"math.round": {sql: "ROUND({1}, {0})"},
+	"math.pow":   {sql: "POWER({1}, {0})", dialects: map[duql.TargetDialect]string{duql.ClickHouse: "pow({1}, {0})"}},
+	"math.sqrt":  {sql: "SQRT({0})"},
+	"math.exp":   {sql: "EXP({0})"},
+	"math.ln":    {sql: "LN({0})", dialects: map[duql.TargetDialect]string{duql.ClickHouse: "log({0})", duql.MSSQL: "LOG({0})"}},
+	"math.log10": {sql: "LOG10({0})", dialects: map[duql.TargetDialect]string{duql.Postgres: "LOG({0})", duql.GlareDB: "LOG({0})"}},
+	"math.pi":    {sql: "PI()", dialects: map[duql.TargetDialect]string{duql.ClickHouse: "pi()", duql.BigQuery: "ACOS(-1)"}},
+
+	"date.year":  {sql: "EXTRACT(YEAR FROM {0})", dialects: dateParts("%Y", "toYear", "YEAR")},
+	"date.month": {sql: "EXTRACT(MONTH FROM {0})", dialects: dateParts("%m", "toMonth", "MONTH")},
+	"date.day":   {sql: "EXTRACT(DAY FROM {0})", dialects: dateParts("%d", "toDayOfMonth", "DAY")},
+	"date.to_text": {sql: "TO_CHAR({1}, {0})", dialects: map[duql.TargetDialect]string{
+		duql.DuckDB:     "STRFTIME({1}, {0})",
+		duql.MySQL:      "DATE_FORMAT({1}, {0})",
+		duql.SQLite:     "STRFTIME({0}, {1})",
+		duql.ClickHouse: "formatDateTime({1}, {0})",
+		duql.BigQuery:   "FORMAT_TIMESTAMP({0}, TIMESTAMP({1}))",
+		duql.Trino:      "date_format({1}, {0})",
+		duql.MSSQL:      "FORMAT({1}, {0})",
+	}},
+}
+
+// dateParts spells EXTRACT for the targets that lack it.
+func dateParts(strftime, clickhouse, mssql string) map[duql.TargetDialect]string {
+	return map[duql.TargetDialect]string{
+		duql.SQLite:     "CAST(STRFTIME('" + strftime + "', {0}) AS INTEGER)",
+		duql.ClickHouse: clickhouse + "({0})",
+		duql.MSSQL:      "DATEPART(" + mssql + ", {0})",
+	}
+}
@@ -0,0 +1,74 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+// materialize wraps the query sql in the statements keeping its result as
+// the view or table into describes. Statements are separated by ";\n".
+func (d *dialect) materialize(sql string, into *duql.Into) (string, error) {
+	name := d.quotePath(strings.Split(into.Name, "."))
+	if into.Kind == duql.IntoView {
+		return d.createView(name, sql, into.Mode)
+	}
+
+	temp := into.Kind == duql.IntoTempTable
+	if d.supports(Tables) == Unsupported {
+		return "", &UnsupportedError{
+			Capability: Tables,
+			Target:     d.target,
+			Hint:       "write the result into a view instead",
+		}
+	}
+	if temp {
+		if err := d.require(TempTables); err != nil {
+			return "", err
+		}
+	}
+	if into.Mode == duql.IntoAppend {
+		return "INSERT INTO " + name + "\n" + sql, nil
+	}
+
+	table, engine := "TABLE", d.tableEngine
+	if temp {
+		table, engine = d.tempTable+" TABLE", d.tempEngine
+	}
+	create := "CREATE " + table + " " + name
+	var drop string
+	switch into.Mode {
+	case duql.IntoReplace:
+		switch d.supports(ReplaceTable) {
+		case Native:
+			create = "CREATE OR REPLACE " + table + " " + name
+		case Emulated:
+			drop = "DROP TABLE IF EXISTS " + name + ";\n"
+		}
+	case duql.IntoCreateIfMissing:
+		if err := d.require(TableIfMissing); err != nil {
+			return "", err
+		}
+		create = "CREATE " + table + " IF NOT EXISTS " + name
+	}
+	if engine != "" {
+		create += " " + engine
+	}
+	return drop + create + " AS\n" + sql, nil
+}
+
+func (d *dialect) createView(name, sql string, mode duql.IntoMode) (string, error) {
+	switch mode {
+	case duql.IntoReplace:
+		if d.supports(ReplaceView) == Emulated {
+			return "DROP VIEW IF EXISTS " + name + ";\nCREATE VIEW " + name + " AS\n" + sql, nil
+		}
+		return d.replaceView + " " + name + " AS\n" + sql, nil
+	case duql.IntoCreateIfMissing:
+		if err := d.require(ViewIfMissing); err != nil {
+			return "", err
+		}
+		return "CREATE VIEW IF NOT EXISTS " + name + " AS\n" + sql, nil
+	}
+	return "CREATE VIEW " + name + " AS\n" + sql, nil
+}
@@ -0,0 +1,66 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+func TestMaterialize(t *testing.T) {
+	tests := []struct {
+		target duql.TargetDialect
+		into   string
+		want   string
+	}{
+		{duql.Postgres, "{name: analytics.daily, kind: table}", "CREATE TABLE analytics.daily AS\n"},
+		{duql.Postgres, "{name: analytics.daily, kind: table, mode: replace}", "DROP TABLE IF EXISTS analytics.daily;\nCREATE TABLE analytics.daily AS\n"},
+		{duql.Postgres, "{name: daily, kind: table, mode: create-if-missing}", "CREATE TABLE IF NOT EXISTS daily AS\n"},
+		{duql.Postgres, "{name: daily, kind: table, mode: append}", "INSERT INTO daily\n"},
+		{duql.Postgres, "{name: daily, kind: temp table}", "CREATE TEMPORARY TABLE daily AS\n"},
+		{duql.Postgres, "{name: daily, kind: view, mode: replace}", "CREATE OR REPLACE VIEW daily AS\n"},
+		{duql.DuckDB, "{name: daily, kind: table, mode: replace}", "CREATE OR REPLACE TABLE daily AS\n"},
+		{duql.DuckDB, "{name: daily, kind: view, mode: create-if-missing}", "CREATE VIEW IF NOT EXISTS daily AS\n"},
+		{duql.MySQL, "{name: daily, kind: table, mode: replace}", "DROP TABLE IF EXISTS daily;\nCREATE TABLE daily AS\n"},
+		{duql.MySQL, "{name: order, kind: table, mode: append}", "INSERT INTO `order`\n"},
+		{duql.SQLite, "{name: daily, kind: temp table}", "CREATE TEMPORARY TABLE daily AS\n"},
+		{duql.SQLite, "{name: daily, kind: view, mode: replace}", "DROP VIEW IF EXISTS daily;\nCREATE VIEW daily AS\n"},
+		{duql.BigQuery, "{name: daily, kind: temp table}", "CREATE TEMP TABLE daily AS\n"},
+		{duql.ClickHouse, "{name: daily, kind: table}", "CREATE TABLE daily ENGINE = MergeTree ORDER BY tuple() AS\n"},
+		{duql.ClickHouse, "{name: daily, kind: temp table}", "CREATE TEMPORARY TABLE daily ENGINE = Memory AS\n"},
+		{duql.MSSQL, "{name: dbo.daily, kind: view, mode: replace}", "CREATE OR ALTER VIEW dbo.daily AS\n"},
+		{duql.Snowflake, "{name: daily, kind: table, mode: replace}", "CREATE OR REPLACE TABLE daily AS\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.target)+"/"+tt.into, func(t *testing.T) {
+			res, err := compile(t, "dataset: orders\ninto: "+tt.into, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(res.SQL, tt.want+"SELECT") {
+				t.Errorf("got\n%s\nwant it to start with\n%s", res.SQL, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaterializeErrors(t *testing.T) {
+	tests := []struct {
+		target duql.TargetDialect
+		into   string
+		want   string
+	}{
+		{duql.MSSQL, "{name: daily, kind: table}", "into a table is not supported by sql.mssql; write the result into a view instead"},
+		{duql.Trino, "{name: daily, kind: temp table}", "into a temp table is not supported by sql.trino"},
+		{duql.Generic, "{name: daily, kind: table, mode: create-if-missing}", "creating a table if missing is not supported by sql.generic"},
+		{duql.Postgres, "{name: daily, kind: view, mode: create-if-missing}", "creating a view if missing is not supported by sql.postgres"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.target)+"/"+tt.into, func(t *testing.T) {
+			_, err := compile(t, "dataset: orders\ninto: "+tt.into, tt.target)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
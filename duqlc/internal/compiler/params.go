@@ -0,0 +1,121 @@
+package compiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+type placeholderStyle int
+
+const (
+	// placeholderQuestion writes ? for every use of a parameter, so a
+	// parameter used twice is passed twice.
+	placeholderQuestion placeholderStyle = iota
+	// placeholderNumbered writes $1, $2, … numbering parameters in the
+	// order they first appear.
+	placeholderNumbered
+	// placeholderColon writes :name.
+	placeholderColon
+	// placeholderAt writes @name.
+	placeholderAt
+	// placeholderTyped writes {name:Type}.
+	placeholderTyped
+)
+
+// Param is an argument the compiled SQL expects.
+type Param struct {
+	Name string         `json:"name"`
+	Type duql.ParamType `json:"type"`
+	// Placeholder is how the SQL refers to the argument, such as $1, ? or
+	// @user_id.
+	Placeholder string `json:"placeholder"`
+}
+
+// paramMark stands for a parameter in SQL until the whole query is
+// written, since only then is the order of the placeholders known.
+const paramMark = "\x00"
+
+// param renders a $name reference to a declared parameter.
+func (c *compiler) param(n *expr.Param) (string, int, error) {
+	p := c.q.Params.Lookup(n.Name)
+	if p == nil {
+		return "", 0, &expr.Error{Pos: n.At, Msg: fmt.Sprintf("unknown parameter $%s; declare it in params", n.Name)}
+	}
+	if typ, ok := c.params[p.Name]; ok && typ != p.Type {
+		return "", 0, &expr.Error{Pos: n.At, Msg: fmt.Sprintf("parameter $%s is declared as both %s and %s", p.Name, typ, p.Type)}
+	}
+	c.params[p.Name] = p.Type
+	return paramMark + p.Name + paramMark, precAtom, nil
+}
+
+// bind replaces the parameters in sql with the placeholders of the target
+// and lists the arguments in the order they are passed: one per ? for
+// positional placeholders, one per number for $1, and one per name, in the
+// order they first appear, for named ones. The tables are written with
+// the same placeholders.
+func (d *dialect) bind(sql string, tables []Table, types map[string]duql.ParamType) (string, []Table, []Param) {
+	if len(types) == 0 {
+		return sql, tables, nil
+	}
+	var params []Param
+	placeholders := make(map[string]string)
+	sql = replaceParams(sql, func(name string) string {
+		if d.placeholder == placeholderQuestion {
+			params = append(params, Param{Name: name, Type: types[name], Placeholder: "?"})
+			return "?"
+		}
+		if p, ok := placeholders[name]; ok {
+			return p
+		}
+		var p string
+		switch d.placeholder {
+		case placeholderNumbered:
+			p = "$" + strconv.Itoa(len(params)+1)
+		case placeholderColon:
+			p = ":" + name
+		case placeholderAt:
+			p = "@" + name
+		case placeholderTyped:
+			p = "{" + name + ":" + clickhouseTypes[types[name]] + "}"
+		}
+		placeholders[name] = p
+		params = append(params, Param{Name: name, Type: types[name], Placeholder: p})
+		return p
+	})
+	for i, t := range tables {
+		tables[i].SQL = replaceParams(t.SQL, func(name string) string {
+			if p, ok := placeholders[name]; ok {
+				return p
+			}
+			return "?"
+		})
+	}
+	return sql, tables, params
+}
+
+func replaceParams(sql string, placeholder func(name string) string) string {
+	parts := strings.Split(sql, paramMark)
+	var b strings.Builder
+	for i, part := range parts {
+		if i%2 == 0 {
+			b.WriteString(part)
+		} else {
+			b.WriteString(placeholder(part))
+		}
+	}
+	return b.String()
+}
+
+// clickhouseTypes are the types ClickHouse placeholders are written with.
+var clickhouseTypes = map[duql.ParamType]string{
+	duql.ParamString:    "String",
+	duql.ParamInteger:   "Int64",
+	duql.ParamNumber:    "Float64",
+	duql.ParamBoolean:   "Bool",
+	duql.ParamDate:      "Date",
+	duql.ParamTimestamp: "DateTime",
+}
@@ -0,0 +1,118 @@
+package compiler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+func TestParamPlaceholders(t *testing.T) {
+	const src = `
+params:
+  user_id: integer
+  since: timestamp
+dataset: events
+steps:
+  - filter: owner == $user_id || viewer == $user_id
+  - filter: at > $since`
+	tests := []struct {
+		target duql.TargetDialect
+		where  string
+		params []Param
+	}{
+		{duql.Generic, "(owner = ? OR viewer = ?) AND at > ?", []Param{
+			{"user_id", duql.ParamInteger, "?"},
+			{"user_id", duql.ParamInteger, "?"},
+			{"since", duql.ParamTimestamp, "?"},
+		}},
+		{duql.MySQL, "(owner = ? OR viewer = ?) AND at > ?", []Param{
+			{"user_id", duql.ParamInteger, "?"},
+			{"user_id", duql.ParamInteger, "?"},
+			{"since", duql.ParamTimestamp, "?"},
+		}},
+		{duql.Postgres, "(owner = $1 OR viewer = $1) AND at > $2", []Param{
+			{"user_id", duql.ParamInteger, "$1"},
+			{"since", duql.ParamTimestamp, "$2"},
+		}},
+		{duql.DuckDB, "(owner = $1 OR viewer = $1) AND at > $2", []Param{
+			{"user_id", duql.ParamInteger, "$1"},
+			{"since", duql.ParamTimestamp, "$2"},
+		}},
+		{duql.SQLite, "(owner = :user_id OR viewer = :user_id) AND at > :since", []Param{
+			{"user_id", duql.ParamInteger, ":user_id"},
+			{"since", duql.ParamTimestamp, ":since"},
+		}},
+		{duql.MSSQL, "(owner = @user_id OR viewer = @user_id) AND at > @since", []Param{
+			{"user_id", duql.ParamInteger, "@user_id"},
+			{"since", duql.ParamTimestamp, "@since"},
+		}},
+		{duql.BigQuery, "(owner = @user_id OR viewer = @user_id) AND at > @since", []Param{
+			{"user_id", duql.ParamInteger, "@user_id"},
+			{"since", duql.ParamTimestamp, "@since"},
+		}},
+		{duql.ClickHouse, "(owner = {user_id:Int64} OR viewer = {user_id:Int64}) AND at > {since:DateTime}", []Param{
+			{"user_id", duql.ParamInteger, "{user_id:Int64}"},
+			{"since", duql.ParamTimestamp, "{since:DateTime}"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.target), func(t *testing.T) {
+			res, err := compile(t, src, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			where := strings.Join(strings.Fields(res.SQL[strings.Index(res.SQL, "WHERE")+len("WHERE"):]), " ")
+			if where != tt.where {
+				t.Errorf("got WHERE %s, want %s", where, tt.where)
+			}
+			if !reflect.DeepEqual(res.Params, tt.params) {
+				t.Errorf("got params %v, want %v", res.Params, tt.params)
+			}
+		})
+	}
+}
+
+func TestParamsInTables(t *testing.T) {
+	res, err := compile(t, `
+params:
+  n: integer
+  min: number
+dataset: scores
+steps:
+  - filter: score > $min
+  - take: 10
+  - filter: rank <= $n && score > $min`, duql.Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Param{{"min", duql.ParamNumber, "$1"}, {"n", duql.ParamInteger, "$2"}}
+	if !reflect.DeepEqual(res.Params, want) {
+		t.Errorf("got params %v, want %v", res.Params, want)
+	}
+	if len(res.Tables) == 0 || !strings.Contains(res.Tables[0].SQL, "score > $1") {
+		t.Errorf("tables do not use the placeholders of the query: %+v", res.Tables)
+	}
+	if strings.Contains(res.SQL, paramMark) {
+		t.Errorf("SQL still holds parameter marks: %q", res.SQL)
+	}
+}
+
+func TestParamErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"undeclared", "dataset: t\nsteps:\n  - filter: a == $missing", "unknown parameter $missing; declare it in params"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compile(t, tt.src, duql.Postgres)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The printer is the only place SQL text is assembled. Identifiers and
+// literals from DUQL input always pass through quoteIdent and quoteString,
+// so no input can change the structure of the generated statement.
+
+var plainIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteIdent quotes a single identifier when the dialect requires it.
+func (d *dialect) quoteIdent(name string) string {
+	if name == "*" {
+		return name
+	}
+	if plainIdent.MatchString(name) && !d.reserved[strings.ToLower(name)] &&
+		!(d.foldsLower && strings.ToLower(name) != name) {
+		return name
+	}
+	escaped := name
+	if d.identEscape == `\` {
+		escaped = strings.ReplaceAll(escaped, `\`, `\\`)
+	}
+	escaped = strings.ReplaceAll(escaped, d.quoteClose, d.identEscape+d.quoteClose)
+	return d.quoteOpen + escaped + d.quoteClose
+}
+
+// quotePath quotes each part of a qualified name such as schema.table.
+func (d *dialect) quotePath(parts []string) string {
+	quoted := make([]string, len(parts))
+	for i, p := range parts {
+		quoted[i] = d.quoteIdent(p)
+	}
+	return strings.Join(quoted, ".")
+}
+
+// quoteString writes s as a string literal.
+func (d *dialect) quoteString(s string) (string, error) {
+	if strings.ContainsRune(s, 0) {
+		return "", fmt.Errorf("string literals must not contain NUL characters")
+	}
+	if d.backslashEscapes {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", d.quoteEscape) + "'", nil
+}
+
+// boolean writes a boolean literal.
+func (d *dialect) boolean(v bool) string {
+	switch {
+	case d.noBooleans && v:
+		return "1"
+	case d.noBooleans:
+		return "0"
+	case v:
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// template substitutes {0}, {1}, … with args and {*} with all of them.
+func template(t string, args ...string) string {
+	if strings.Contains(t, "{*}") {
+		t = strings.ReplaceAll(t, "{*}", strings.Join(args, ", "))
+	}
+	for i := len(args) - 1; i >= 0; i-- {
+		t = strings.ReplaceAll(t, fmt.Sprintf("{%d}", i), args[i])
+	}
+	return t
+}
+
+// selectStmt is a single SELECT, with every part already rendered.
+type selectStmt struct {
+	distinct bool
+	columns  []string
+	from     string
+	joins    []string
+	where    []string
+	groupBy  []string
+	having   []string
+	qualify  []string
+	orderBy  []string
+	limit    string
+	offset   string
+}
+
+type cte struct {
+	name string
+	body string
+}
+
+func (d *dialect) printSelect(s *selectStmt) string {
+	var b strings.Builder
+	clause := func(keyword string, items []string, sep string) {
+		if len(items) == 0 {
+			return
+		}
+		b.WriteString(keyword)
+		b.WriteString("\n  ")
+		b.WriteString(strings.Join(items, sep+"\n  "))
+		b.WriteString("\n")
+	}
+
+	keyword := "SELECT"
+	if s.distinct {
+		keyword = "SELECT DISTINCT"
+	}
+	if d.pagination == offsetFetch && s.limit != "" && s.offset == "" {
+		keyword += " TOP (" + s.limit + ")"
+	}
+	columns := s.columns
+	if len(columns) == 0 {
+		columns = []string{"*"}
+	}
+	clause(keyword, columns, ",")
+	if s.from != "" {
+		clause("FROM", append([]string{s.from}, s.joins...), "")
+	}
+	where := s.where
+	if len(s.qualify) > 0 && len(where) == 0 && d.qualifyNeedsWhere {
+		where = []string{d.boolean(true)}
+	}
+	clause("WHERE", where, " AND")
+	clause("GROUP BY", s.groupBy, ",")
+	clause("HAVING", s.having, " AND")
+	clause("QUALIFY", s.qualify, " AND")
+
+	switch {
+	case d.pagination == offsetFetch:
+		orderBy := s.orderBy
+		if s.offset != "" && len(orderBy) == 0 {
+			orderBy = []string{"(SELECT NULL)"}
+		}
+		clause("ORDER BY", orderBy, ",")
+		if s.offset != "" {
+			b.WriteString("OFFSET\n  " + s.offset + " ROWS")
+			if s.limit != "" {
+				b.WriteString(" FETCH NEXT " + s.limit + " ROWS ONLY")
+			}
+			b.WriteString("\n")
+		}
+	case d.pagination == offsetLimit:
+		clause("ORDER BY", s.orderBy, ",")
+		if s.offset != "" {
+			b.WriteString("OFFSET\n  " + s.offset + "\n")
+		}
+		if s.limit != "" {
+			b.WriteString("LIMIT\n  " + s.limit + "\n")
+		}
+	default:
+		clause("ORDER BY", s.orderBy, ",")
+		limit := s.limit
+		if limit == "" && s.offset != "" {
+			limit = d.unboundedLimit
+		}
+		if limit != "" {
+			b.WriteString("LIMIT\n  " + limit)
+			if s.offset != "" {
+				b.WriteString(" OFFSET " + s.offset)
+			}
+			b.WriteString("\n")
+		} else if s.offset != "" {
+			b.WriteString("OFFSET\n  " + s.offset + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// printQuery writes the common table expressions followed by the main statement.
+func (d *dialect) printQuery(ctes []cte, recursive bool, main string) string {
+	if len(ctes) == 0 {
+		return main
+	}
+	var b strings.Builder
+	keyword := "WITH"
+	if recursive {
+		keyword = d.recursive
+	}
+	b.WriteString(keyword + " ")
+	for i, c := range ctes {
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		b.WriteString(d.quoteIdent(c.name))
+		b.WriteString(" AS (\n")
+		b.WriteString(indent(c.body))
+		b.WriteString("\n)")
+	}
+	b.WriteString("\n")
+	b.WriteString(main)
+	return b.String()
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
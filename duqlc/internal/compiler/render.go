@@ -0,0 +1,665 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// SQL operator precedence, loosest first.
+const (
+	precOr = iota + 1
+	precAnd
+	precNot
+	precCompare
+	precAdd
+	precMul
+	precUnary
+	precAtom
+)
+
+// over is the window an aggregate or window function is evaluated over.
+type over struct {
+	partition []string
+	orderBy   []string
+	frame     string
+}
+
+func (o *over) String() string {
+	var parts []string
+	if len(o.partition) > 0 {
+		parts = append(parts, "PARTITION BY "+strings.Join(o.partition, ", "))
+	}
+	if len(o.orderBy) > 0 {
+		parts = append(parts, "ORDER BY "+strings.Join(o.orderBy, ", "))
+	}
+	if o.frame != "" {
+		parts = append(parts, o.frame)
+	}
+	return "OVER (" + strings.Join(parts, " ") + ")"
+}
+
+// scope resolves names while rendering one expression.
+type scope struct {
+	c *compiler
+	f *frame
+	// params are the arguments of the function being expanded.
+	params map[string]*column
+	// over is set inside window and group steps; aggregating is set inside
+	// summarize, where aggregates are not window functions.
+	over        *over
+	aggregating bool
+
+	// aggregate and window report what the rendered expression contained.
+	aggregate bool
+	window    bool
+
+	expanding map[string]bool
+}
+
+func (c *compiler) scope(f *frame) *scope {
+	return &scope{c: c, f: f, expanding: make(map[string]bool)}
+}
+
+// render renders n, adding parentheses when it binds looser than prec.
+func (s *scope) render(n expr.Node, prec int) (string, error) {
+	sql, p, err := s.node(n)
+	if err != nil {
+		return "", err
+	}
+	if p < prec {
+		return "(" + sql + ")", nil
+	}
+	return sql, nil
+}
+
+func (s *scope) node(n expr.Node) (string, int, error) {
+	d := s.c.d
+	switch n := n.(type) {
+	case *expr.Ident:
+		return s.ident(n)
+	case *expr.Number:
+		return n.Text, precAtom, nil
+	case *expr.String:
+		sql, err := d.quoteString(n.Value)
+		if err != nil {
+			return "", 0, errorAt(n, err)
+		}
+		return sql, precAtom, nil
+	case *expr.Bool:
+		return d.boolean(n.Value), precAtom, nil
+	case *expr.Null:
+		return "NULL", precAtom, nil
+	case *expr.Date:
+		return s.date(n)
+	case *expr.Interval:
+		return s.interval(n)
+	case *expr.Param:
+		return s.c.param(n)
+	case *expr.RawSQL:
+		return n.SQL, precAtom, nil
+	case *expr.FString:
+		return s.fstring(n)
+	case *expr.Unary:
+		return s.unary(n)
+	case *expr.Binary:
+		return s.binary(n)
+	case *expr.Case:
+		return s.caseExpr(n)
+	case *expr.Call:
+		return s.call(n)
+	case *expr.Range:
+		return "", 0, errorAt(n, fmt.Errorf("a range can only be used with in or between"))
+	case *expr.Array:
+		return "", 0, errorAt(n, fmt.Errorf("a list can only be used with in"))
+	case *expr.Lambda:
+		return "", 0, errorAt(n, fmt.Errorf("a function can only be declared, not used as a value"))
+	case *expr.NamedArg:
+		return "", 0, errorAt(n, fmt.Errorf("unexpected named argument %s", n.Name))
+	}
+	return "", 0, fmt.Errorf("unsupported expression %T", n)
+}
+
+func errorAt(n expr.Node, err error) error {
+	if _, ok := err.(*expr.Error); ok {
+		return err
+	}
+	return &expr.Error{Pos: n.Pos(), Msg: err.Error()}
+}
+
+func (s *scope) use(col *column) (string, int, error) {
+	s.aggregate = s.aggregate || col.aggregate
+	s.window = s.window || col.window
+	return col.sql, col.prec, nil
+}
+
+func (s *scope) ident(n *expr.Ident) (string, int, error) {
+	d := s.c.d
+	if len(n.Parts) == 1 {
+		name := n.Parts[0]
+		if p, ok := s.params[name]; ok {
+			return s.use(p)
+		}
+		if col := s.f.lookup(name); col != nil {
+			return s.use(col)
+		}
+		if decl, ok := s.c.exprs[name]; ok {
+			return s.declared(n, name, decl)
+		}
+		return d.quoteIdent(name), precAtom, nil
+	}
+
+	// Imported declarations are named <namespace>.<name>.
+	if decl, ok := s.c.exprs[n.Name()]; ok {
+		return s.declared(n, n.Name(), decl)
+	}
+	last := len(n.Parts) - 1
+	if tuple, ok := s.c.tuples[strings.Join(n.Parts[:last], ".")]; ok {
+		name := strings.Join(n.Parts[:last], ".")
+		s.c.use(name)
+		if v, ok := tuple[n.Parts[last]]; ok {
+			return s.node(v)
+		}
+		return "", 0, errorAt(n, fmt.Errorf("%s has no field %s", name, n.Parts[last]))
+	}
+	rel, rest := n.Parts[0], n.Parts[1:]
+	for _, imp := range s.c.q.Import {
+		if imp.Namespace() == rel {
+			return "", 0, errorAt(n, fmt.Errorf("%s declares no %s", imp.Path, strings.Join(rest, ".")))
+		}
+	}
+	if from, ok := s.f.relations[rel]; ok && len(rest) == 1 {
+		return from + "." + d.quoteIdent(rest[0]), precAtom, nil
+	}
+	return d.quotePath(n.Parts), precAtom, nil
+}
+
+// declared inlines the declared expression decl where n refers to it.
+func (s *scope) declared(n *expr.Ident, name string, decl expr.Node) (string, int, error) {
+	s.c.use(name)
+	if s.expanding[name] {
+		return "", 0, errorAt(n, fmt.Errorf("%s is declared in terms of itself", name))
+	}
+	s.expanding[name] = true
+	defer delete(s.expanding, name)
+	return s.node(decl)
+}
+
+func (s *scope) date(n *expr.Date) (string, int, error) {
+	d := s.c.d
+	text := n.Text
+	t := d.date
+	switch {
+	case !strings.Contains(text, "-"):
+		t = d.time
+	case strings.ContainsAny(text, "T:"):
+		t = d.timestamp
+		text = strings.Replace(text, "T", " ", 1)
+	}
+	lit, err := d.quoteString(text)
+	if err != nil {
+		return "", 0, errorAt(n, err)
+	}
+	return template(t, lit), precAtom, nil
+}
+
+var intervalUnits = map[string]string{
+	"second": "SECOND", "minute": "MINUTE", "hour": "HOUR", "day": "DAY",
+	"week": "WEEK", "month": "MONTH", "quarter": "QUARTER", "year": "YEAR",
+}
+
+func (s *scope) interval(n *expr.Interval) (string, int, error) {
+	d := s.c.d
+	if err := d.require(Intervals); err != nil {
+		return "", 0, errorAt(n, err)
+	}
+	switch d.interval {
+	case intervalText:
+		lit, err := d.quoteString(n.Text)
+		if err != nil {
+			return "", 0, errorAt(n, err)
+		}
+		return "INTERVAL " + lit, precAtom, nil
+	case intervalUnit, intervalQuotedUnit:
+		fields := strings.Fields(n.Text)
+		if len(fields) == 2 {
+			amount := fields[0]
+			unit, ok := intervalUnits[strings.TrimSuffix(strings.ToLower(fields[1]), "s")]
+			if ok && strings.Trim(amount, "0123456789") == "" {
+				if d.interval == intervalQuotedUnit {
+					amount = "'" + amount + "'"
+				}
+				return "INTERVAL " + amount + " " + unit, precAtom, nil
+			}
+		}
+		return "", 0, errorAt(n, fmt.Errorf("interval %q must be a whole number followed by a unit", n.Text))
+	}
+	return "", 0, errorAt(n, fmt.Errorf("interval literals are not supported by %s", d.target))
+}
+
+func (s *scope) concat(parts []string) (string, int) {
+	if len(parts) == 1 {
+		return parts[0], precAtom
+	}
+	if s.c.d.concatFunc {
+		return "CONCAT(" + strings.Join(parts, ", ") + ")", precAtom
+	}
+	return strings.Join(parts, " || "), precAdd
+}
+
+func (s *scope) fstring(n *expr.FString) (string, int, error) {
+	var parts []string
+	for _, p := range n.Parts {
+		sql, err := s.render(p, precMul)
+		if err != nil {
+			return "", 0, err
+		}
+		parts = append(parts, sql)
+	}
+	if len(parts) == 0 {
+		return "''", precAtom, nil
+	}
+	sql, prec := s.concat(parts)
+	return sql, prec, nil
+}
+
+func (s *scope) unary(n *expr.Unary) (string, int, error) {
+	switch n.Op {
+	case "-":
+		x, err := s.render(n.X, precUnary)
+		if err != nil {
+			return "", 0, err
+		}
+		if strings.HasPrefix(x, "-") {
+			// Two minus signs in a row would start a comment.
+			x = "(" + x + ")"
+		}
+		return "-" + x, precUnary, nil
+	case "!":
+		x, err := s.render(n.X, precNot)
+		if err != nil {
+			return "", 0, err
+		}
+		return "NOT " + x, precNot, nil
+	}
+	return "", 0, errorAt(n, fmt.Errorf("%s%s can only be used as a join condition", n.Op, exprName(n.X)))
+}
+
+func exprName(n expr.Node) string {
+	if id, ok := n.(*expr.Ident); ok {
+		return id.Name()
+	}
+	return "…"
+}
+
+var binarySQL = map[string]struct {
+	op   string
+	prec int
+}{
+	"||": {"OR", precOr},
+	"&&": {"AND", precAnd},
+	"==": {"=", precCompare},
+	"!=": {"<>", precCompare},
+	"<":  {"<", precCompare},
+	"<=": {"<=", precCompare},
+	">":  {">", precCompare},
+	">=": {">=", precCompare},
+	"+":  {"+", precAdd},
+	"-":  {"-", precAdd},
+	"*":  {"*", precMul},
+	"/":  {"/", precMul},
+	"%":  {"%", precMul},
+}
+
+func (s *scope) binary(n *expr.Binary) (string, int, error) {
+	switch n.Op {
+	case "in", "between":
+		return s.in(n)
+	case "==", "!=":
+		if _, ok := n.Y.(*expr.Null); ok {
+			return s.isNull(n.X, n.Op == "!=")
+		}
+		if _, ok := n.X.(*expr.Null); ok {
+			return s.isNull(n.Y, n.Op == "!=")
+		}
+	}
+
+	if call, ok := s.rankBy(n); ok {
+		return s.call(call)
+	}
+
+	if parts := expr.Concat(n); parts != nil {
+		return s.fstring(&expr.FString{Parts: parts, At: n.At})
+	}
+
+	if n.Op == "%" && s.c.d.modFunc {
+		return s.apply("MOD({0}, {1})", []expr.Node{n.X, n.Y})
+	}
+
+	if op, ok := binarySQL[n.Op]; ok {
+		left := op.prec
+		right := op.prec + 1
+		if op.prec == precCompare {
+			left = op.prec + 1
+		}
+		x, err := s.render(n.X, left)
+		if err != nil {
+			return "", 0, err
+		}
+		y, err := s.render(n.Y, right)
+		if err != nil {
+			return "", 0, err
+		}
+		return x + " " + op.op + " " + y, op.prec, nil
+	}
+
+	var t string
+	switch n.Op {
+	case "??":
+		t = "COALESCE({0}, {1})"
+	case "^":
+		t = "POWER({0}, {1})"
+	case "~=":
+		if err := s.c.d.require(RegexMatch); err != nil {
+			return "", 0, errorAt(n, err)
+		}
+		t = s.c.d.regexMatch
+	case "//":
+		t = s.c.d.intDiv
+	default:
+		return "", 0, errorAt(n, fmt.Errorf("unsupported operator %s", n.Op))
+	}
+	return s.apply(t, []expr.Node{n.X, n.Y})
+}
+
+func (s *scope) isNull(x expr.Node, not bool) (string, int, error) {
+	sql, err := s.render(x, precAdd)
+	if err != nil {
+		return "", 0, err
+	}
+	if not {
+		return sql + " IS NOT NULL", precCompare, nil
+	}
+	return sql + " IS NULL", precCompare, nil
+}
+
+// in renders `x in [a, b]` and `x in a..b`.
+func (s *scope) in(n *expr.Binary) (string, int, error) {
+	x, err := s.render(n.X, precAdd)
+	if err != nil {
+		return "", 0, err
+	}
+	switch y := n.Y.(type) {
+	case *expr.Array:
+		items := make([]string, len(y.Items))
+		for i, item := range y.Items {
+			if items[i], err = s.render(item, precOr); err != nil {
+				return "", 0, err
+			}
+		}
+		if len(items) == 0 {
+			if s.c.d.noBooleans {
+				return "1 = 0", precCompare, nil
+			}
+			return "FALSE", precAtom, nil
+		}
+		return x + " IN (" + strings.Join(items, ", ") + ")", precCompare, nil
+	case *expr.Range:
+		var start, end string
+		if y.Start != nil {
+			if start, err = s.render(y.Start, precAdd); err != nil {
+				return "", 0, err
+			}
+		}
+		if y.End != nil {
+			if end, err = s.render(y.End, precAdd); err != nil {
+				return "", 0, err
+			}
+		}
+		switch {
+		case start != "" && end != "":
+			return x + " BETWEEN " + start + " AND " + end, precCompare, nil
+		case start != "":
+			return x + " >= " + start, precCompare, nil
+		case end != "":
+			return x + " <= " + end, precCompare, nil
+		}
+		return "TRUE", precAtom, nil
+	}
+	return "", 0, errorAt(n.Y, fmt.Errorf("%s expects a list or a range", n.Op))
+}
+
+func (s *scope) caseExpr(n *expr.Case) (string, int, error) {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for _, w := range n.Whens {
+		cond, err := s.render(w.Cond, precOr)
+		if err != nil {
+			return "", 0, err
+		}
+		value, err := s.render(w.Value, precOr)
+		if err != nil {
+			return "", 0, err
+		}
+		b.WriteString(" WHEN " + cond + " THEN " + value)
+	}
+	if n.Else != nil {
+		value, err := s.render(n.Else, precOr)
+		if err != nil {
+			return "", 0, err
+		}
+		b.WriteString(" ELSE " + value)
+	}
+	b.WriteString(" END")
+	return b.String(), precAtom, nil
+}
+
+// apply fills a template with rendered arguments.
+func (s *scope) apply(t string, args []expr.Node) (string, int, error) {
+	// Arguments of operator templates such as `{0} LIKE {1}` need
+	// parentheses unless they bind tightly; those of calls never do.
+	call := strings.HasSuffix(t, ")") && !strings.HasPrefix(t, "{")
+	argPrec := precOr
+	if !call {
+		argPrec = precAdd
+	}
+	rendered := make([]string, len(args))
+	for i, a := range args {
+		sql, err := s.render(a, argPrec)
+		if err != nil {
+			return "", 0, err
+		}
+		rendered[i] = sql
+	}
+	if call {
+		return template(t, rendered...), precAtom, nil
+	}
+	return template(t, rendered...), precCompare, nil
+}
+
+func (s *scope) call(n *expr.Call) (string, int, error) {
+	if fn, ok := s.c.funcs[n.Name]; ok {
+		s.c.use(n.Name)
+		return s.lambda(n, fn)
+	}
+	fn, ok := stdlib[n.Name]
+	if !ok {
+		if strings.Contains(n.Name, ".") {
+			return "", 0, errorAt(n, fmt.Errorf("unknown function %s", n.Name))
+		}
+		// Other functions are passed through to the database as written.
+		return s.apply(n.Name+"({*})", n.Args)
+	}
+	t, ok := fn.template(s.c.d.target)
+	if !ok {
+		return "", 0, errorAt(n, fmt.Errorf("%s is not supported by %s", n.Name, s.c.d.target))
+	}
+
+	args := n.Args
+	var orderBy []string
+	if fn.kind != scalarFunc {
+		var err error
+		if args, orderBy, err = s.windowArgs(n, t); err != nil {
+			return "", 0, err
+		}
+		if n.Name == "count" && len(args) == 0 {
+			t = "COUNT(*)"
+		}
+	}
+	if want := arity(t); want >= 0 && len(args) != want {
+		return "", 0, errorAt(n, fmt.Errorf("%s expects %d arguments, got %d", n.Name, want, len(args)))
+	}
+	sql, prec, err := s.apply(t, args)
+	if err != nil {
+		return "", 0, err
+	}
+
+	switch {
+	case fn.kind == aggregateFunc && s.aggregating:
+		s.aggregate = true
+		return sql, prec, nil
+	case fn.kind == aggregateFunc, fn.kind == windowFunc:
+		s.window = true
+		o := over{}
+		if s.over != nil {
+			o = *s.over
+		}
+		if orderBy != nil {
+			o.orderBy = orderBy
+		} else if s.over == nil && fn.kind == windowFunc {
+			o.orderBy = s.f.orderBy()
+		}
+		if fn.kind == windowFunc {
+			// Ranking functions ignore the frame and some engines reject it.
+			o.frame = ""
+		}
+		return sql + " " + o.String(), precAtom, nil
+	}
+	return sql, prec, nil
+}
+
+// rankBy reads `rank -amount` as ranking by amount descending rather than
+// as a subtraction, when rank is a ranking function and not a column.
+func (s *scope) rankBy(n *expr.Binary) (*expr.Call, bool) {
+	id, ok := n.X.(*expr.Ident)
+	if !ok || n.Op != "-" || len(id.Parts) != 1 {
+		return nil, false
+	}
+	name := id.Parts[0]
+	fn, ok := stdlib[name]
+	if !ok || fn.kind != windowFunc || arity(fn.sql) != 0 || s.f.lookup(name) != nil || s.params[name] != nil {
+		return nil, false
+	}
+	arg := &expr.Unary{Op: "-", X: n.Y, At: n.At}
+	return &expr.Call{Name: name, Args: []expr.Node{arg}, At: id.At}, true
+}
+
+// windowArgs drops a `this` argument, and turns the argument of a ranking
+// function such as `rank -amount` into the order of its window.
+func (s *scope) windowArgs(n *expr.Call, t string) ([]expr.Node, []string, error) {
+	var args []expr.Node
+	for _, a := range n.Args {
+		if id, ok := a.(*expr.Ident); ok && id.Name() == "this" {
+			continue
+		}
+		args = append(args, a)
+	}
+	if arity(t) != 0 || len(args) == 0 {
+		return args, nil, nil
+	}
+	var orderBy []string
+	for _, a := range args {
+		desc := false
+		if u, ok := a.(*expr.Unary); ok && u.Op == "-" {
+			a, desc = u.X, true
+		}
+		sql, err := s.render(a, precOr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if desc {
+			sql += " DESC"
+		}
+		orderBy = append(orderBy, sql)
+	}
+	return nil, orderBy, nil
+}
+
+// lambda expands a declared function, binding positional arguments to the
+// parameters without defaults and named arguments by name.
+func (s *scope) lambda(n *expr.Call, fn *expr.Lambda) (string, int, error) {
+	if s.expanding[n.Name] {
+		return "", 0, errorAt(n, fmt.Errorf("%s is declared in terms of itself", n.Name))
+	}
+
+	params := make(map[string]*column)
+	var positional []string
+	defaults := make(map[string]expr.Node)
+	for _, p := range fn.Params {
+		if p.Default != nil {
+			defaults[p.Name] = p.Default
+		} else {
+			positional = append(positional, p.Name)
+		}
+	}
+
+	bind := func(name string, arg expr.Node) error {
+		sql, prec, err := s.node(arg)
+		if err != nil {
+			return err
+		}
+		params[name] = &column{name: name, sql: sql, prec: prec}
+		return nil
+	}
+
+	i := 0
+	for _, a := range n.Args {
+		if named, ok := a.(*expr.NamedArg); ok {
+			if _, ok := defaults[named.Name]; !ok {
+				return "", 0, errorAt(a, fmt.Errorf("%s has no parameter %s with a default", n.Name, named.Name))
+			}
+			if err := bind(named.Name, named.Value); err != nil {
+				return "", 0, err
+			}
+			continue
+		}
+		if i >= len(positional) {
+			return "", 0, errorAt(n, fmt.Errorf("%s expects %d arguments, got %d", n.Name, len(positional), i+1))
+		}
+		if err := bind(positional[i], a); err != nil {
+			return "", 0, err
+		}
+		i++
+	}
+	if i < len(positional) {
+		return "", 0, errorAt(n, fmt.Errorf("%s expects %d arguments, got %d", n.Name, len(positional), i))
+	}
+	for name, d := range defaults {
+		if _, ok := params[name]; !ok {
+			if err := bind(name, d); err != nil {
+				return "", 0, err
+			}
+		}
+	}
+
+	body := *s
+	body.params = params
+	body.expanding = s.expanding
+	s.expanding[n.Name] = true
+	defer delete(s.expanding, n.Name)
+	sql, prec, err := body.node(fn.Body)
+	s.aggregate = s.aggregate || body.aggregate
+	s.window = s.window || body.window
+	return sql, prec, err
+}
+
+// expression parses and renders a YAML level expression.
+func (s *scope) expression(e duql.Expression) (string, int, error) {
+	n, err := expr.FromDUQL(e)
+	if err != nil {
+		return "", 0, err
+	}
+	return s.node(n)
+}
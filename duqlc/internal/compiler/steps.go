@@ -0,0 +1,709 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// steps applies each step to the frame in turn. Errors name the step they
+// come from, using the same path as RawSQLUse.
+func (c *compiler) steps(f *frame, steps duql.Steps, path string) (*frame, error) {
+	// The steps of the query itself are planned for Result.Steps.
+	top := path == "steps" && c.nested == 0
+	for i, step := range steps {
+		p := fmt.Sprintf("%s[%d].%s", path, i, step.Type())
+		if top {
+			c.used, c.written = make(map[string]bool), ""
+		}
+		var err error
+		if f, err = c.step(f, step, p); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if top {
+			used := make([]string, 0, len(c.used))
+			for name := range c.used {
+				used = append(used, name)
+			}
+			sort.Strings(used)
+			c.plans = append(c.plans, plan{f: f, written: c.written, used: used})
+			c.used = nil
+		}
+	}
+	return f, nil
+}
+
+func (c *compiler) step(f *frame, step duql.Step, path string) (*frame, error) {
+	switch s := step.(type) {
+	case *duql.Filter:
+		return c.filter(f, s.Expression)
+	case *duql.Generate:
+		return c.generate(f, s.Expressions, nil)
+	case *duql.Select:
+		return c.selectColumns(f, s.Columns, nil)
+	case *duql.SelectNot:
+		return c.selectNot(f, s)
+	case *duql.Sort:
+		return c.sort(f, s.Columns)
+	case *duql.Take:
+		return c.take(f, s)
+	case *duql.Summarize:
+		return c.summarize(f, s.Aggregations, nil)
+	case *duql.Group:
+		return c.group(f, s, path)
+	case *duql.Join:
+		return c.join(f, s)
+	case *duql.Window:
+		return c.window(f, s, nil, path)
+	case *duql.Loop:
+		return c.loop(f, s, path)
+	case *duql.Distinct:
+		return c.distinct(f, s)
+	case *duql.Append:
+		return c.setOp(f, "UNION ALL", s.Dataset)
+	case *duql.Union:
+		return c.setOp(f, "UNION", s.Dataset)
+	case *duql.Intersect:
+		return c.setOp(f, "INTERSECT", s.Dataset)
+	case *duql.Except:
+		return c.setOp(f, "EXCEPT", s.Dataset)
+	}
+	return nil, fmt.Errorf("%s steps are not supported", step.Type())
+}
+
+func paren(sql string, prec, min int) string {
+	if prec < min {
+		return "(" + sql + ")"
+	}
+	return sql
+}
+
+func (c *compiler) filter(f *frame, e duql.Expression) (*frame, error) {
+	sc := c.scope(f)
+	sql, prec, err := sc.expression(e)
+	if err != nil {
+		return nil, err
+	}
+	windowed := sc.window || (!f.grouped && f.hasWindow())
+	if windowed && c.d.supports(Qualify) == Native && !f.limited && !f.distinct {
+		// Window functions are computed after WHERE, so a filter that follows
+		// them goes to QUALIFY.
+		f.qualify = append(f.qualify, paren(sql, prec, precAnd))
+		return f, nil
+	}
+	if f.limited || f.distinct || windowed {
+		// Filtering on a window function or after a take needs its own SELECT.
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+		sc = c.scope(f)
+		if sql, prec, err = sc.expression(e); err != nil {
+			return nil, err
+		}
+	}
+	if f.grouped {
+		f.having = append(f.having, paren(sql, prec, precAnd))
+	} else {
+		f.where = append(f.where, paren(sql, prec, precAnd))
+	}
+	return f, nil
+}
+
+func (c *compiler) generate(f *frame, exprs []duql.NamedExpression, o *over) (*frame, error) {
+	var err error
+	if f.distinct {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range exprs {
+		col, err := c.column(f, e, o)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		if f.noWrap {
+			// The recursive part of a loop must keep the columns of the rows
+			// before it, so it can only replace those, in place.
+			switch {
+			case f.star:
+				return nil, fmt.Errorf("%s: loop steps can only generate columns listed before the loop; select them first", e.Name)
+			case f.lookup(e.Name) == nil:
+				return nil, fmt.Errorf("%s: loop steps cannot add columns the rows before the loop do not have", e.Name)
+			}
+		}
+		if col.window && (f.limited || len(f.qualify) > 0) {
+			if f, err = c.wrap(f); err != nil {
+				return nil, err
+			}
+			if col, err = c.column(f, e, o); err != nil {
+				return nil, fmt.Errorf("%s: %w", e.Name, err)
+			}
+		}
+		f.set(col)
+	}
+	return f, nil
+}
+
+// column renders a named expression as an output column.
+func (c *compiler) column(f *frame, e duql.NamedExpression, o *over) (*column, error) {
+	sc := c.scope(f)
+	sc.over = o
+	n, err := expr.FromDUQL(e.Expression)
+	if err != nil {
+		return nil, err
+	}
+	sql, prec, err := sc.node(n)
+	if err != nil {
+		return nil, err
+	}
+	col := &column{name: e.Name, sql: sql, prec: prec, aggregate: sc.aggregate, window: sc.window}
+
+	if id, ok := n.(*expr.Ident); ok && e.Name == "" {
+		// A bare column reference keeps its name.
+		col.name = id.Parts[len(id.Parts)-1]
+		if col.name == "*" {
+			col.name = ""
+		}
+		col.plain = f.lookup(id.Name()) == nil || f.lookup(id.Name()).plain
+		if _, declared := c.exprs[id.Name()]; declared {
+			col.plain = false
+		}
+	}
+	if col.name == "" && !strings.HasSuffix(sql, "*") {
+		return nil, fmt.Errorf("computed column %s needs a name", sql)
+	}
+	return col, nil
+}
+
+func (c *compiler) selectColumns(f *frame, exprs []duql.NamedExpression, o *over) (*frame, error) {
+	var err error
+	if f.distinct {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	var cols []*column
+	for _, e := range exprs {
+		col, err := c.column(f, e, o)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, col)
+	}
+	f.star = false
+	f.exclude = nil
+	f.columns = cols
+	return f, nil
+}
+
+func (c *compiler) selectNot(f *frame, s *duql.SelectNot) (*frame, error) {
+	var err error
+	if f.distinct {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	names := s.Columns
+	if s.Column != "" {
+		names = []string{s.Column}
+	}
+	for _, name := range names {
+		found := false
+		for i, col := range f.columns {
+			if col.name == name {
+				f.columns = append(f.columns[:i:i], f.columns[i+1:]...)
+				found = true
+				break
+			}
+		}
+		switch {
+		case found:
+		case !f.star:
+			return nil, fmt.Errorf("unknown column %s", name)
+		case c.d.supports(ExcludeColumns) == Unsupported:
+			return nil, &UnsupportedError{
+				Capability: ExcludeColumns,
+				Target:     c.d.target,
+				Hint:       fmt.Sprintf("select the columns to keep instead of excluding %s", name),
+			}
+		default:
+			f.exclude = append(f.exclude, name)
+		}
+	}
+	return f, nil
+}
+
+// sortItems renders sort keys, noting which output column each refers to.
+func (c *compiler) sortItems(f *frame, cols []duql.SortColumn, alias bool) ([]sortItem, error) {
+	var items []sortItem
+	for _, col := range cols {
+		sc := c.scope(f)
+		n, err := expr.FromDUQL(col.Expression)
+		if err != nil {
+			return nil, err
+		}
+		sql, err := sc.render(n, precOr)
+		if err != nil {
+			return nil, err
+		}
+		item := sortItem{sql: sql, desc: col.Descending}
+		if id, ok := n.(*expr.Ident); ok && len(id.Parts) == 1 {
+			item.ref = id.Parts[0]
+			// The query's own ORDER BY can name a computed column by its alias.
+			if out := f.lookup(item.ref); alias && out != nil && !out.plain {
+				item.sql = c.d.quoteIdent(item.ref)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (c *compiler) sort(f *frame, cols []duql.SortColumn) (*frame, error) {
+	var err error
+	if f.limited {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	// Named keys add an output column and sort by it.
+	cols = append([]duql.SortColumn(nil), cols...)
+	for i, col := range cols {
+		if col.Name == "" {
+			continue
+		}
+		out, err := c.column(f, duql.NamedExpression{Name: col.Name, Expression: col.Expression}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", col.Name, err)
+		}
+		f.set(out)
+		cols[i].Expression = duql.Expression{Value: "`" + strings.ReplaceAll(col.Name, "`", "``") + "`"}
+	}
+	if f.sort, err = c.sortItems(f, cols, true); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *compiler) take(f *frame, t *duql.Take) (*frame, error) {
+	offset, limit, err := t.Bounds()
+	if err != nil {
+		return nil, err
+	}
+	if f.limited {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	f.limited = true
+	f.offset, f.limit = offset, limit
+	return f, nil
+}
+
+// summarize aggregates the frame, grouped by keys when given.
+func (c *compiler) summarize(f *frame, aggs []duql.NamedExpression, keys []*column) (*frame, error) {
+	var err error
+	if keys == nil && (f.grouped || f.limited || f.distinct || f.hasWindow()) {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+
+	cols := append([]*column(nil), keys...)
+	for _, e := range aggs {
+		sc := c.scope(f)
+		sc.aggregating = true
+		sql, prec, err := sc.expression(e.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		cols = append(cols, &column{name: e.Name, sql: sql, prec: prec, aggregate: true, window: sc.window})
+	}
+
+	f.groupBy = nil
+	var keep []sortItem
+	for _, k := range keys {
+		f.groupBy = append(f.groupBy, k.sql)
+		for _, s := range f.sort {
+			if s.ref == k.name {
+				keep = append(keep, s)
+			}
+		}
+	}
+	f.sort = keep
+	f.columns = cols
+	f.star = false
+	f.exclude = nil
+	f.grouped = true
+	return f, nil
+}
+
+func (c *compiler) group(f *frame, g *duql.Group, path string) (*frame, error) {
+	var err error
+	if f.grouped || f.limited || f.distinct || f.hasWindow() {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+
+	groupKeys := func(f *frame) ([]*column, error) {
+		var keys []*column
+		for _, by := range g.By {
+			col, err := c.column(f, duql.NamedExpression{Name: duql.KeyName(by), Expression: duql.Expression{Value: by}}, nil)
+			if err != nil {
+				return nil, fmt.Errorf("invalid group key %s: %w", by, err)
+			}
+			keys = append(keys, col)
+		}
+		return keys, nil
+	}
+	keys, err := groupKeys(f)
+	if err != nil {
+		return nil, err
+	}
+	o := &over{}
+	for _, k := range keys {
+		o.partition = append(o.partition, k.sql)
+	}
+
+	if len(g.Steps) == 0 {
+		return c.summarize(f, nil, keys)
+	}
+	for i, step := range g.Steps {
+		p := fmt.Sprintf("%s.steps[%d].%s", path, i, step.Type())
+		switch s := step.(type) {
+		case *duql.Summarize:
+			f, err = c.summarize(f, s.Aggregations, keys)
+		case *duql.Sort:
+			var items []sortItem
+			if items, err = c.sortItems(f, s.Columns, false); err == nil {
+				o.orderBy = orderBy(items)
+			}
+		case *duql.Take:
+			if f, err = c.takeGroup(f, s, o); err == nil {
+				if keys, err = groupKeys(f); err == nil {
+					o.partition = nil
+					for _, k := range keys {
+						o.partition = append(o.partition, k.sql)
+					}
+				}
+			}
+		case *duql.Filter:
+			f, err = c.filter(f, s.Expression)
+		case *duql.Generate:
+			f, err = c.generate(f, s.Expressions, o)
+		case *duql.Select:
+			f, err = c.selectColumns(f, s.Columns, o)
+		case *duql.Window:
+			f, err = c.window(f, s, o.partition, p)
+		default:
+			err = fmt.Errorf("%s steps are not supported inside group", step.Type())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return f, nil
+}
+
+// takeGroup keeps a range of rows from each group by numbering them.
+func (c *compiler) takeGroup(f *frame, t *duql.Take, o *over) (*frame, error) {
+	offset, limit, err := t.Bounds()
+	if err != nil {
+		return nil, err
+	}
+	rn := *o
+	rn.frame = ""
+	if c.d.supports(Qualify) == Native && !f.limited && !f.distinct {
+		sql := "ROW_NUMBER() " + rn.String()
+		if offset > 0 {
+			f.qualify = append(f.qualify, sql+" > "+strconv.Itoa(offset))
+		}
+		if limit >= 0 {
+			f.qualify = append(f.qualify, sql+" <= "+strconv.Itoa(offset+limit))
+		}
+		return f, nil
+	}
+	const rowNumber = "_row_number"
+	// The row number cannot be left out of the SELECT * the frame is
+	// wrapped into unless the target can exclude columns.
+	open := f.star
+	for _, col := range f.columns {
+		open = open || col.name == ""
+	}
+	if open && c.d.starExclude == "" {
+		return nil, &UnsupportedError{
+			Capability: ExcludeColumns,
+			Target:     c.d.target,
+			Hint:       "select the columns to keep before take, so the row number it filters on can be left out",
+		}
+	}
+	f.set(&column{name: rowNumber, sql: "ROW_NUMBER() " + rn.String(), prec: precAtom, window: true})
+	if f, err = c.wrap(f); err != nil {
+		return nil, err
+	}
+	ref := c.d.quoteIdent(rowNumber)
+	if offset > 0 {
+		f.where = append(f.where, ref+" > "+strconv.Itoa(offset))
+	}
+	if limit >= 0 {
+		f.where = append(f.where, ref+" <= "+strconv.Itoa(offset+limit))
+	}
+	if f.star {
+		f.exclude = append(f.exclude, rowNumber)
+		return f, nil
+	}
+	for i, col := range f.columns {
+		if col.name == rowNumber {
+			f.columns = append(f.columns[:i:i], f.columns[i+1:]...)
+			break
+		}
+	}
+	return f, nil
+}
+
+// frameClause spells the rows or range of a window step.
+func frameClause(w *duql.Window) (string, error) {
+	switch {
+	case w.Rolling > 0:
+		return fmt.Sprintf("ROWS BETWEEN %d PRECEDING AND CURRENT ROW", w.Rolling-1), nil
+	case w.Expanding:
+		return "ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW", nil
+	case w.Rows != "":
+		return frameBounds("ROWS", w.Rows)
+	case w.Range != "":
+		return frameBounds("RANGE", w.Range)
+	}
+	return "", nil
+}
+
+func frameBounds(unit, spec string) (string, error) {
+	start, end, ok := strings.Cut(spec, "..")
+	if !ok {
+		return "", fmt.Errorf("invalid window %s %q", strings.ToLower(unit), spec)
+	}
+	bound := func(s, unbounded string) (string, error) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return "UNBOUNDED " + unbounded, nil
+		}
+		n, err := strconv.Atoi(s)
+		switch {
+		case err != nil:
+			return "", fmt.Errorf("invalid window %s %q", strings.ToLower(unit), spec)
+		case n < 0:
+			return fmt.Sprintf("%d PRECEDING", -n), nil
+		case n > 0:
+			return fmt.Sprintf("%d FOLLOWING", n), nil
+		}
+		return "CURRENT ROW", nil
+	}
+	from, err := bound(start, "PRECEDING")
+	if err != nil {
+		return "", err
+	}
+	to, err := bound(end, "FOLLOWING")
+	if err != nil {
+		return "", err
+	}
+	return unit + " BETWEEN " + from + " AND " + to, nil
+}
+
+func (c *compiler) window(f *frame, w *duql.Window, partition []string, path string) (*frame, error) {
+	clause, err := frameClause(w)
+	if err != nil {
+		return nil, err
+	}
+	if f.grouped || f.limited || f.distinct || len(f.qualify) > 0 {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	o := &over{partition: partition, frame: clause}
+	for i, step := range w.Steps {
+		p := fmt.Sprintf("%s.steps[%d].%s", path, i, step.Type())
+		switch s := step.(type) {
+		case *duql.Sort:
+			var items []sortItem
+			if items, err = c.sortItems(f, s.Columns, false); err == nil {
+				o.orderBy = orderBy(items)
+			}
+		case *duql.Generate:
+			f, err = c.generate(f, s.Expressions, o)
+		case *duql.Select:
+			f, err = c.selectColumns(f, s.Columns, o)
+		default:
+			err = fmt.Errorf("%s steps are not supported inside window", step.Type())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	return f, nil
+}
+
+var joinKeywords = map[duql.JoinType]string{
+	duql.Inner: "JOIN",
+	duql.Left:  "LEFT JOIN",
+	duql.Right: "RIGHT JOIN",
+	duql.Full:  "FULL JOIN",
+}
+
+func (c *compiler) join(f *frame, j *duql.Join) (*frame, error) {
+	keyword, ok := joinKeywords[j.Retain]
+	if !ok {
+		return nil, fmt.Errorf("unknown join type %s", j.Retain)
+	}
+	if j.Retain == duql.Full {
+		if err := c.d.require(FullJoin); err != nil {
+			return nil, err
+		}
+	}
+	// Filters, columns and sort keys written before the join name columns
+	// unqualified, which become ambiguous once the joined dataset has
+	// columns of the same names, and a filter before a right or full join
+	// must not drop the right rows the join keeps; so they stay in a
+	// SELECT of their own.
+	written := len(f.where) > 0 || len(f.columns) > 0 || len(f.exclude) > 0 || len(f.sort) > 0
+	var err error
+	if f.grouped || f.limited || f.distinct || f.hasWindow() || written {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	from, ref, name, err := c.dataset(j.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	if _, taken := f.relations[name]; taken {
+		return nil, fmt.Errorf("%s is already part of the query; declare it under another name to join it again", name)
+	}
+	left := f.relations[f.primary]
+	f.relations[name] = ref
+
+	n, err := expr.FromDUQL(j.Where)
+	if err != nil {
+		return nil, err
+	}
+	var cond string
+	if u, ok := n.(*expr.Unary); ok && u.Op == "==" {
+		// `==id` compares the column of the same name on both sides.
+		id, ok := u.X.(*expr.Ident)
+		if !ok || len(id.Parts) != 1 {
+			return nil, fmt.Errorf("== must be followed by a column name")
+		}
+		col := c.d.quoteIdent(id.Parts[0])
+		cond = left + "." + col + " = " + ref + "." + col
+	} else if cond, err = c.scope(f).render(n, precOr); err != nil {
+		return nil, err
+	}
+
+	f.joins = append(f.joins, keyword+" "+from+" ON "+cond)
+	if !f.star {
+		f.columns = append(f.columns, &column{sql: ref + ".*", prec: precAtom})
+	}
+	return f, nil
+}
+
+// loop writes a recursive CTE whose first part is the frame so far and
+// whose recursive part applies the loop steps to the previous iteration.
+func (c *compiler) loop(f *frame, l *duql.Loop, path string) (*frame, error) {
+	if err := c.d.require(Loop); err != nil {
+		return nil, err
+	}
+	initial := c.d.printSelect(f.stmt(c.d, false))
+
+	name := c.tableName()
+	ref := c.d.quoteIdent(name)
+	body := newFrame(ref, ref, name)
+	for rel := range f.relations {
+		body.relations[rel] = ref
+	}
+	body.noWrap = true
+	listed := !f.star
+	for _, col := range f.columns {
+		listed = listed && col.name != ""
+	}
+	if listed {
+		// Listing the columns lets generate replace them in place rather
+		// than add them after *, which would make the parts of the UNION
+		// ALL differ in width.
+		body.star = false
+		for _, col := range f.columns {
+			body.columns = append(body.columns, &column{name: col.name, sql: c.d.quoteIdent(col.name), prec: precAtom, plain: true})
+		}
+	}
+	body, err := c.steps(body, l.Steps, path)
+	if err != nil {
+		return nil, err
+	}
+	c.ctes = append(c.ctes, cte{
+		name: name,
+		body: initial + "\nUNION ALL\n" + c.d.printSelect(body.stmt(c.d, false)),
+	})
+	c.recursive = true
+	f.table, c.written = name, name
+
+	nf := newFrame(ref, ref, name)
+	for rel := range f.relations {
+		nf.relations[rel] = ref
+	}
+	nf.primary = f.primary
+	nf.relations[f.primary] = ref
+	return nf, nil
+}
+
+func (c *compiler) distinct(f *frame, d *duql.Distinct) (*frame, error) {
+	if !d.Enabled {
+		return f, nil
+	}
+	var err error
+	if f.limited {
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	f.distinct = true
+	return f, nil
+}
+
+// setOp combines the frame with the rows of another dataset. Dialects that
+// default to ALL are told DISTINCT explicitly.
+func (c *compiler) setOp(f *frame, op string, ds duql.Dataset) (*frame, error) {
+	if f.noWrap {
+		return nil, fmt.Errorf("loop steps must fit in a single SELECT")
+	}
+	var err error
+	if f.limited {
+		// A LIMIT inside one side of a set operation needs its own SELECT.
+		if f, err = c.wrap(f); err != nil {
+			return nil, err
+		}
+	}
+	from, _, _, err := c.dataset(ds)
+	if err != nil {
+		return nil, err
+	}
+	if op != "UNION ALL" && c.d.setQuantifier != "" {
+		op += " " + c.d.setQuantifier
+	}
+	left := c.d.printSelect(f.stmt(c.d, false))
+	right := c.d.printSelect(&selectStmt{from: from})
+
+	name := c.tableName()
+	c.ctes = append(c.ctes, cte{name: name, body: left + "\n" + op + "\n" + right})
+	f.table, c.written = name, name
+
+	ref := c.d.quoteIdent(name)
+	nf := newFrame(ref, ref, name)
+	for rel := range f.relations {
+		nf.relations[rel] = ref
+	}
+	nf.primary = f.primary
+	nf.relations[f.primary] = ref
+	return nf, nil
+}
@@ -0,0 +1,32 @@
+package duql
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Append adds the rows of another dataset, keeping duplicates.
+type Append struct {
+	Dataset Dataset `yaml:"append" json:"append" mapstructure:"append"`
+}
+
+func (a *Append) Type() string {
+	return "append"
+}
+
+func (a *Append) Validate() error {
+	return validateSetDataset(a.Type(), a.Dataset)
+}
+
+func (a *Append) UnmarshalYAML(value *yaml.Node) error {
+	return value.Decode(&a.Dataset)
+}
+
+// validateSetDataset checks the dataset of a set operation step.
+func validateSetDataset(step string, d Dataset) error {
+	if d == (Dataset{}) {
+		return fmt.Errorf("%s requires a dataset", step)
+	}
+	return d.Validate()
+}
@@ -1,8 +1,23 @@
 package duql
 
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
 type Dataset struct {
 	Simple  string
 	Complex *DatasetComplex
+	// SQL is set when the dataset is a raw sql"""…""" query, either as the
+	// simple form or as the name of the advanced form.
+	SQL *RawSQL
+	// Query is set when the dataset has steps of its own: written inline
+	// as {dataset, steps}, or read from the DUQL file the dataset names
+	// when the query is loaded.
+	Query *Query
+	// File is the DUQL file Query was read from.
+	File string
 }
 
 type DatasetComplex struct {
@@ -25,15 +40,39 @@ func (d *Dataset) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var s string
 	if err := unmarshal(&s); err == nil {
 		d.Simple = s
+		if body, ok := ParseRawSQLString(s); ok {
+			d.SQL = &RawSQL{SQL: body}
+		}
 		return nil
 	}
 
+	// An object with a dataset of its own is an inline query.
+	var keys map[string]interface{}
+	if err := unmarshal(&keys); err == nil {
+		if _, ok := keys["dataset"]; ok {
+			for key := range keys {
+				if key != "dataset" && key != "steps" {
+					return fmt.Errorf("an inline dataset has only dataset and steps, not %s", key)
+				}
+			}
+			var q Query
+			if err := unmarshal(&q); err != nil {
+				return err
+			}
+			d.Query = &q
+			return nil
+		}
+	}
+
 	// If that fails, try to unmarshal as a complex object
 	var c DatasetComplex
 	if err := unmarshal(&c); err != nil {
 		return err
 	}
 	d.Complex = &c
+	if body, ok := ParseRawSQLString(c.Name); ok {
+		d.SQL = &RawSQL{SQL: body}
+	}
 	return nil
 }
 
@@ -42,5 +81,52 @@ func (d Dataset) MarshalYAML() (interface{}, error) {
 	if d.Simple != "" {
 		return d.Simple, nil
 	}
+	if d.Complex == nil && d.Query != nil {
+		return d.Query, nil
+	}
 	return d.Complex, nil
 }
+
+// QueryPath returns the DUQL file the dataset names, or "" when it names
+// a table, a data file or a declared pipeline.
+func (d Dataset) QueryPath() string {
+	source := d.Simple
+	if d.Complex != nil {
+		if d.Complex.Format != "" {
+			return ""
+		}
+		source = d.Complex.Name
+	}
+	if d.SQL != nil {
+		return ""
+	}
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".yml", ".yaml", ".duql":
+		return source
+	}
+	return ""
+}
+
+// Inline reports whether the dataset is a query written in place.
+func (d Dataset) Inline() bool {
+	return d.Query != nil && d.File == ""
+}
+
+// Validate checks the steps of an inline dataset.
+func (d Dataset) Validate() error {
+	if !d.Inline() {
+		return nil
+	}
+	if d.Query.Dataset == (Dataset{}) {
+		return fmt.Errorf("an inline dataset requires a dataset")
+	}
+	if err := d.Query.Dataset.Validate(); err != nil {
+		return err
+	}
+	for _, step := range d.Query.Steps {
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("invalid step: %w", err)
+		}
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,12 +12,19 @@ import (
 type Declare map[string]DeclareValue
 
 type DeclareValue struct {
-	Pipeline   *Steps                 `yaml:",inline,omitempty" json:"pipeline,omitempty" mapstructure:"pipeline,omitempty"`
+	Pipeline   *Pipeline              `yaml:",inline,omitempty" json:"pipeline,omitempty" mapstructure:"pipeline,omitempty"`
 	Expression *Expression            `yaml:",inline,omitempty" json:"expression,omitempty" mapstructure:"expression,omitempty"`
 	Tuple      map[string]interface{} `yaml:",inline,omitempty" json:"tuple,omitempty" mapstructure:"tuple,omitempty"`
 	Function   *FunctionDefinition    `yaml:",inline,omitempty" json:"function,omitempty" mapstructure:"function,omitempty"`
 }
 
+// Pipeline is a declared dataset with its own steps, usable by name as a
+// dataset elsewhere in the query.
+type Pipeline struct {
+	Dataset Dataset `yaml:"dataset" json:"dataset" mapstructure:"dataset"`
+	Steps   Steps   `yaml:"steps,omitempty" json:"steps,omitempty" mapstructure:"steps,omitempty"`
+}
+
 type FunctionDefinition struct {
 	Parameters []FunctionParameter `yaml:"parameters" json:"parameters" mapstructure:"parameters"`
 	Expression Expression          `yaml:"expression" json:"expression" mapstructure:"expression"`
@@ -28,40 +36,85 @@ type FunctionParameter struct {
 }
 
 func (d *Declare) UnmarshalYAML(value *yaml.Node) error {
-	var raw map[string]interface{}
-	if err := value.Decode(&raw); err != nil {
-		return err
+	if value.Kind != yaml.MappingNode {
+		return errors.New("declare must be an object")
 	}
 
 	*d = make(Declare)
-	for key, val := range raw {
+	for i := 0; i < len(value.Content); i += 2 {
+		key := value.Content[i].Value
 		if !isValidVariableName(key) {
 			return fmt.Errorf("invalid variable name: %s", key)
 		}
 
 		var declareValue DeclareValue
-		valBytes, err := yaml.Marshal(val)
-		if err != nil {
-			return err
+		if err := value.Content[i+1].Decode(&declareValue); err != nil {
+			return fmt.Errorf("invalid declaration %s: %w", key, err)
 		}
 
-		if err := yaml.Unmarshal(valBytes, &declareValue); err != nil {
+		(*d)[key] = declareValue
+	}
+
+	return nil
+}
+
+func (dv *DeclareValue) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		var expr Expression
+		if err := value.Decode(&expr); err != nil {
 			return err
 		}
+		dv.Expression = &expr
+		return nil
+	}
 
-		(*d)[key] = declareValue
+	keys := make(map[string]bool)
+	for i := 0; i < len(value.Content); i += 2 {
+		keys[value.Content[i].Value] = true
 	}
 
-	return nil
+	switch {
+	case keys["dataset"]:
+		dv.Pipeline = &Pipeline{}
+		return value.Decode(dv.Pipeline)
+	case keys["parameters"] && keys["expression"]:
+		dv.Function = &FunctionDefinition{}
+		return value.Decode(dv.Function)
+	case len(keys) == 1 && (keys["sql"] || keys["case"]):
+		dv.Expression = &Expression{}
+		return value.Decode(dv.Expression)
+	default:
+		return value.Decode(&dv.Tuple)
+	}
+}
+
+func (p *FunctionParameter) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		p.Name = value.Value
+		return nil
+	}
+	type rawParameter FunctionParameter
+	return value.Decode((*rawParameter)(p))
 }
 
 func isValidVariableName(name string) bool {
 	return regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`).MatchString(name)
 }
 
+// isQualifiedName reports whether name is a variable name, possibly under
+// the namespaces of imports, such as fin.fiscal_quarter.
+func isQualifiedName(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if !isValidVariableName(part) {
+			return false
+		}
+	}
+	return true
+}
+
 func (d *Declare) Validate() error {
 	for key, value := range *d {
-		if !isValidVariableName(key) {
+		if !isQualifiedName(key) {
 			return fmt.Errorf("invalid variable name: %s", key)
 		}
 		if err := value.Validate(); err != nil {
@@ -90,6 +143,23 @@ func (dv *DeclareValue) Validate() error {
 		return errors.New("declare value must be exactly one of: pipeline, expression, tuple, or function")
 	}
 
+	if dv.Pipeline != nil {
+		if err := dv.Pipeline.Dataset.Validate(); err != nil {
+			return fmt.Errorf("invalid pipeline dataset: %w", err)
+		}
+		for _, step := range dv.Pipeline.Steps {
+			if err := step.Validate(); err != nil {
+				return fmt.Errorf("invalid pipeline step: %w", err)
+			}
+		}
+	}
+
+	if dv.Expression != nil {
+		if err := dv.Expression.Validate(); err != nil {
+			return fmt.Errorf("invalid expression: %w", err)
+		}
+	}
+
 	if dv.Function != nil {
 		if len(dv.Function.Parameters) == 0 {
 			return errors.New("function must have at least one parameter")
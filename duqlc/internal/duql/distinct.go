@@ -0,0 +1,27 @@
+package duql
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Distinct removes duplicate rows.
+type Distinct struct {
+	Enabled bool `yaml:"distinct" json:"distinct" mapstructure:"distinct"`
+}
+
+func (d *Distinct) Type() string {
+	return "distinct"
+}
+
+func (d *Distinct) Validate() error {
+	return nil
+}
+
+func (d *Distinct) UnmarshalYAML(value *yaml.Node) error {
+	if err := value.Decode(&d.Enabled); err != nil {
+		return fmt.Errorf("distinct must be true or false")
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package duql
+
+import "gopkg.in/yaml.v3"
+
+// Except keeps the distinct rows that do not appear in another dataset.
+type Except struct {
+	Dataset Dataset `yaml:"except" json:"except" mapstructure:"except"`
+}
+
+func (e *Except) Type() string {
+	return "except"
+}
+
+func (e *Except) Validate() error {
+	return validateSetDataset(e.Type(), e.Dataset)
+}
+
+func (e *Except) UnmarshalYAML(value *yaml.Node) error {
+	return value.Decode(&e.Dataset)
+}
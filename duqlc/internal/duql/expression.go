@@ -3,23 +3,64 @@ package duql
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Expression struct {
-	Value interface{} // This can be a string, map, or slice
+	Value interface{} // This can be a string, scalar, *RawSQL, *Case, map, or slice
+}
+
+// NamedExpression is an expression bound to an output column name.
+type NamedExpression struct {
+	Name       string
+	Expression Expression
+}
+
+// Case is a case statement; the first branch whose condition holds
+// determines the result.
+type Case struct {
+	Branches []CaseBranch
+}
+
+type CaseBranch struct {
+	When Expression
+	Then Expression
 }
 
 func (e *Expression) UnmarshalYAML(value *yaml.Node) error {
 	switch value.Kind {
 	case yaml.ScalarNode:
-		return value.Decode(&e.Value)
+		if err := value.Decode(&e.Value); err != nil {
+			return err
+		}
+		if s, ok := e.Value.(string); ok {
+			if body, ok := ParseRawSQLString(s); ok {
+				e.Value = &RawSQL{SQL: body}
+			}
+		}
 	case yaml.MappingNode:
+		if len(value.Content) == 2 && value.Content[0].Value == "case" {
+			c, err := decodeCase(value.Content[1])
+			if err != nil {
+				return err
+			}
+			e.Value = c
+			return nil
+		}
 		m := make(map[string]interface{})
 		if err := value.Decode(&m); err != nil {
 			return err
 		}
+		if sql, ok := m["sql"]; ok && len(m) == 1 {
+			s, ok := sql.(string)
+			if !ok {
+				return errors.New("sql expression must be a string")
+			}
+			e.Value = &RawSQL{SQL: s}
+			return nil
+		}
 		e.Value = m
 	case yaml.SequenceNode:
 		var s []interface{}
@@ -33,17 +74,103 @@ func (e *Expression) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
+// decodeCase reads both the `- condition: result` and the
+// `- when: condition / then: result` forms of a case statement.
+func decodeCase(value *yaml.Node) (*Case, error) {
+	if value.Kind != yaml.SequenceNode || len(value.Content) == 0 {
+		return nil, errors.New("case must be a non-empty list of branches")
+	}
+	c := &Case{}
+	for _, item := range value.Content {
+		if item.Kind != yaml.MappingNode {
+			return nil, errors.New("each case branch must be an object")
+		}
+		var when, then *yaml.Node
+		switch {
+		case len(item.Content) == 4 && item.Content[0].Value == "when" && item.Content[2].Value == "then":
+			when, then = item.Content[1], item.Content[3]
+		case len(item.Content) == 4 && item.Content[0].Value == "then" && item.Content[2].Value == "when":
+			when, then = item.Content[3], item.Content[1]
+		case len(item.Content) == 2:
+			when = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item.Content[0].Value}
+			then = item.Content[1]
+		default:
+			return nil, errors.New("each case branch must be a single condition: result pair or a when/then pair")
+		}
+
+		var branch CaseBranch
+		if err := when.Decode(&branch.When); err != nil {
+			return nil, err
+		}
+		if err := then.Decode(&branch.Then); err != nil {
+			return nil, err
+		}
+		// A quoted result such as "Senior" is a string literal, not a column.
+		if then.Kind == yaml.ScalarNode && (then.Style == yaml.DoubleQuotedStyle || then.Style == yaml.SingleQuotedStyle) {
+			if _, raw := branch.Then.Value.(*RawSQL); !raw {
+				branch.Then.Value = quoteStringLiteral(then.Value)
+			}
+		}
+		c.Branches = append(c.Branches, branch)
+	}
+	return c, nil
+}
+
+// quoteStringLiteral writes s as a DUQL string literal.
+func quoteStringLiteral(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+// decodeNamedExpressions reads a mapping of names to expressions, keeping
+// the order in which they were written.
+func decodeNamedExpressions(value *yaml.Node) ([]NamedExpression, error) {
+	if value.Kind != yaml.MappingNode {
+		return nil, errors.New("expected an object of names to expressions")
+	}
+	exprs := make([]NamedExpression, 0, len(value.Content)/2)
+	for i := 0; i < len(value.Content); i += 2 {
+		var expr Expression
+		if err := value.Content[i+1].Decode(&expr); err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, NamedExpression{Name: value.Content[i].Value, Expression: expr})
+	}
+	return exprs, nil
+}
+
 func (e *Expression) Validate() error {
 	switch v := e.Value.(type) {
 	case string:
 		// Add any specific validation for string expressions
 		return nil
+	case *RawSQL:
+		if v.SQL == "" {
+			return errors.New("sql expression must not be empty")
+		}
+		return nil
+	case *Case:
+		if len(v.Branches) == 0 {
+			return errors.New("case must have at least one branch")
+		}
+		for _, b := range v.Branches {
+			if err := b.When.Validate(); err != nil {
+				return fmt.Errorf("invalid case condition: %w", err)
+			}
+			if err := b.Then.Validate(); err != nil {
+				return fmt.Errorf("invalid case result: %w", err)
+			}
+		}
+		return nil
 	case map[string]interface{}:
 		// Add any specific validation for map expressions
 		return nil
 	case []interface{}:
 		// Add any specific validation for slice expressions
 		return nil
+	case int, int64, uint64, float64, bool, nil:
+		return nil
 	default:
 		return fmt.Errorf("unsupported expression type: %T", v)
 	}
@@ -8,7 +8,7 @@ import (
 )
 
 type Generate struct {
-	Expressions map[string]Expression `yaml:"generate" json:"generate" mapstructure:"generate"`
+	Expressions []NamedExpression `yaml:"generate" json:"generate" mapstructure:"generate"`
 }
 
 func (g *Generate) Type() string {
@@ -19,19 +19,19 @@ func (g *Generate) Validate() error {
 	if len(g.Expressions) == 0 {
 		return errors.New("generate must contain at least one expression")
 	}
-	for name, expr := range g.Expressions {
-		if err := expr.Validate(); err != nil {
-			return fmt.Errorf("invalid expression for %s: %w", name, err)
+	for _, expr := range g.Expressions {
+		if err := expr.Expression.Validate(); err != nil {
+			return fmt.Errorf("invalid expression for %s: %w", expr.Name, err)
 		}
 	}
 	return nil
 }
 
 func (g *Generate) UnmarshalYAML(value *yaml.Node) error {
-	var raw map[string]Expression
-	if err := value.Decode(&raw); err != nil {
-		return err
+	exprs, err := decodeNamedExpressions(value)
+	if err != nil {
+		return fmt.Errorf("invalid generate specification: %w", err)
 	}
-	g.Expressions = raw
+	g.Expressions = exprs
 	return nil
 }
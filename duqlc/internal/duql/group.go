@@ -1,10 +1,17 @@
 package duql
 
-import "gopkg.in/yaml.v3"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
 
 type Group struct {
-	By    interface{} `yaml:"by" json:"by" mapstructure:"by"`
-	Steps []Step      `yaml:"steps,omitempty" json:"steps,omitempty" mapstructure:"steps,omitempty"`
+	By    []string `yaml:"by" json:"by" mapstructure:"by"`
+	Steps Steps    `yaml:"steps,omitempty" json:"steps,omitempty" mapstructure:"steps,omitempty"`
 }
 
 func (g *Group) Type() string {
@@ -12,19 +19,61 @@ func (g *Group) Type() string {
 }
 
 func (g *Group) Validate() error {
-	// Add validation logic here
+	if len(g.By) == 0 {
+		return fmt.Errorf("group must have at least one by column")
+	}
+	for _, step := range g.Steps {
+		if err := step.Validate(); err != nil {
+			return fmt.Errorf("invalid step in group: %w", err)
+		}
+	}
 	return nil
 }
 
 func (g *Group) UnmarshalYAML(value *yaml.Node) error {
 	var tmp struct {
-		By    interface{} `yaml:"by"`
-		Steps Steps       `yaml:"steps,omitempty"`
+		By        yaml.Node  `yaml:"by"`
+		Steps     Steps      `yaml:"steps,omitempty"`
+		Summarize *Summarize `yaml:"summarize,omitempty"`
 	}
 	if err := value.Decode(&tmp); err != nil {
 		return err
 	}
-	g.By = tmp.By
+	switch tmp.By.Kind {
+	case yaml.ScalarNode:
+		g.By = []string{tmp.By.Value}
+	case yaml.SequenceNode:
+		if err := tmp.By.Decode(&g.By); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("group by must be a column or a list of columns")
+	}
 	g.Steps = tmp.Steps
+	// `summarize` may be written directly on the group as a shorthand.
+	if tmp.Summarize != nil {
+		g.Steps = append(Steps{tmp.Summarize}, g.Steps...)
+	}
 	return nil
 }
+
+var columnRef = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// KeyName is the name of the column a group key is output as. It is
+// empty for a column, which keeps its own name; a computed key is named
+// by the words of its expression joined with underscores, so
+// year(order_date) is output as year_order_date.
+func KeyName(by string) string {
+	by = strings.TrimSpace(by)
+	if columnRef.MatchString(by) {
+		return ""
+	}
+	words := strings.FieldsFunc(strings.ToLower(by), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	name := strings.Trim(strings.Join(words, "_"), "_")
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "key_" + name
+	}
+	return name
+}
@@ -0,0 +1,23 @@
+package duql
+
+import "testing"
+
+func TestKeyName(t *testing.T) {
+	tests := []struct {
+		by, want string
+	}{
+		{"category", ""},
+		{"orders.region", ""},
+		{"year(order_date)", "year_order_date"},
+		{"date(sale_timestamp)", "date_sale_timestamp"},
+		{"amount > 100", "amount_100"},
+		{"Upper(Name)", "upper_name"},
+		{"1 + 1", "key_1_1"},
+		{"  region ", ""},
+	}
+	for _, tt := range tests {
+		if got := KeyName(tt.by); got != tt.want {
+			t.Errorf("KeyName(%q) = %q, want %q", tt.by, got, tt.want)
+		}
+	}
+}
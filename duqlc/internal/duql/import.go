@@ -0,0 +1,57 @@
+package duql
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Import loads the declarations of another DUQL file, which are then used
+// as <namespace>.<name>. Written as a plain path, the namespace is the name
+// of the file without its extensions.
+type Import struct {
+	Path string `yaml:"path" json:"path" mapstructure:"path"`
+	As   string `yaml:"as,omitempty" json:"as,omitempty" mapstructure:"as,omitempty"`
+}
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (i *Import) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		i.Path = s
+		return nil
+	}
+	type rawImport Import
+	return unmarshal((*rawImport)(i))
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (i Import) MarshalYAML() (interface{}, error) {
+	if i.As == "" {
+		return i.Path, nil
+	}
+	type rawImport Import
+	return rawImport(i), nil
+}
+
+// Namespace is the prefix the imported declarations are used with.
+func (i *Import) Namespace() string {
+	if i.As != "" {
+		return i.As
+	}
+	name := filepath.Base(i.Path)
+	for _, ext := range []string{".yaml", ".yml", ".duql", ".lib"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+func (i *Import) Validate() error {
+	if i.Path == "" {
+		return fmt.Errorf("import requires a path")
+	}
+	if ns := i.Namespace(); !isValidVariableName(ns) {
+		return fmt.Errorf("invalid namespace %s for %s; name one with as", ns, i.Path)
+	}
+	return nil
+}
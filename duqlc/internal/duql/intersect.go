@@ -0,0 +1,20 @@
+package duql
+
+import "gopkg.in/yaml.v3"
+
+// Intersect keeps the distinct rows that also appear in another dataset.
+type Intersect struct {
+	Dataset Dataset `yaml:"intersect" json:"intersect" mapstructure:"intersect"`
+}
+
+func (i *Intersect) Type() string {
+	return "intersect"
+}
+
+func (i *Intersect) Validate() error {
+	return validateSetDataset(i.Type(), i.Dataset)
+}
+
+func (i *Intersect) UnmarshalYAML(value *yaml.Node) error {
+	return value.Decode(&i.Dataset)
+}
@@ -1,4 +1,84 @@
 package duql
 
+import "fmt"
+
+// Into names the result of a query and says how it is kept. Written as a
+// plain name, the result is only named, as a common table expression
+// other queries can read.
 type Into struct {
+	Name string   `yaml:"name" json:"name" mapstructure:"name"`
+	Kind IntoKind `yaml:"kind,omitempty" json:"kind,omitempty" mapstructure:"kind,omitempty"`
+	Mode IntoMode `yaml:"mode,omitempty" json:"mode,omitempty" mapstructure:"mode,omitempty"`
+}
+
+type IntoKind string
+
+const (
+	IntoCTE       IntoKind = "cte"
+	IntoView      IntoKind = "view"
+	IntoTable     IntoKind = "table"
+	IntoTempTable IntoKind = "temp table"
+)
+
+type IntoMode string
+
+const (
+	// IntoCreate creates the view or table and fails if it exists.
+	IntoCreate          IntoMode = "create"
+	IntoReplace         IntoMode = "replace"
+	IntoAppend          IntoMode = "append"
+	IntoCreateIfMissing IntoMode = "create-if-missing"
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (i *Into) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		i.Name = s
+		return nil
+	}
+
+	type rawInto Into
+	return unmarshal((*rawInto)(i))
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (i Into) MarshalYAML() (interface{}, error) {
+	if i.Kind == "" && i.Mode == "" {
+		return i.Name, nil
+	}
+	type rawInto Into
+	return rawInto(i), nil
+}
+
+// Materialized reports whether the result is kept as a view or a table
+// rather than only named.
+func (i *Into) Materialized() bool {
+	return i != nil && i.Kind != "" && i.Kind != IntoCTE
+}
+
+func (i *Into) Validate() error {
+	if i.Name == "" {
+		return fmt.Errorf("into requires a name")
+	}
+	switch i.Kind {
+	case "", IntoCTE:
+		if i.Mode != "" {
+			return fmt.Errorf("into mode %s needs a kind of view, table or temp table", i.Mode)
+		}
+		return nil
+	case IntoView, IntoTable, IntoTempTable:
+	default:
+		return fmt.Errorf("unknown into kind %s, expected cte, view, table or temp table", i.Kind)
+	}
+	switch i.Mode {
+	case "", IntoCreate, IntoReplace, IntoCreateIfMissing:
+	case IntoAppend:
+		if i.Kind == IntoView {
+			return fmt.Errorf("cannot append to a view")
+		}
+	default:
+		return fmt.Errorf("unknown into mode %s, expected create, replace, append or create-if-missing", i.Mode)
+	}
+	return nil
 }
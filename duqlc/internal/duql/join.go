@@ -22,8 +22,7 @@ func (j *Join) Type() string {
 }
 
 func (j *Join) Validate() error {
-	// Add validation logic here
-	return nil
+	return j.Dataset.Validate()
 }
 
 func (j *Join) UnmarshalYAML(value *yaml.Node) error {
@@ -0,0 +1,104 @@
+package duql
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Params declares the runtime parameters of a query, used in expressions
+// as $name and bound when the compiled SQL runs. They are kept in the
+// order written.
+type Params []Param
+
+// Param is a declared runtime parameter. Written as a plain value, that
+// value is its type.
+type Param struct {
+	Name        string    `yaml:"-" json:"name" mapstructure:"name"`
+	Type        ParamType `yaml:"type" json:"type" mapstructure:"type"`
+	Description string    `yaml:"description,omitempty" json:"description,omitempty" mapstructure:"description,omitempty"`
+}
+
+type ParamType string
+
+const (
+	ParamString    ParamType = "string"
+	ParamInteger   ParamType = "integer"
+	ParamNumber    ParamType = "number"
+	ParamBoolean   ParamType = "boolean"
+	ParamDate      ParamType = "date"
+	ParamTimestamp ParamType = "timestamp"
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (p *Params) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("params must be an object of parameter names")
+	}
+	*p = make(Params, 0, len(value.Content)/2)
+	for i := 0; i < len(value.Content); i += 2 {
+		param := Param{Name: value.Content[i].Value}
+		def := value.Content[i+1]
+		if def.Kind == yaml.ScalarNode {
+			param.Type = ParamType(def.Value)
+		} else {
+			type rawParam Param
+			if err := def.Decode((*rawParam)(&param)); err != nil {
+				return fmt.Errorf("%s: %w", param.Name, err)
+			}
+		}
+		*p = append(*p, param)
+	}
+	return nil
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (p Params) MarshalYAML() (interface{}, error) {
+	n := &yaml.Node{Kind: yaml.MappingNode}
+	for _, param := range p {
+		var value yaml.Node
+		var err error
+		if param.Description == "" {
+			err = value.Encode(string(param.Type))
+		} else {
+			type rawParam Param
+			err = value.Encode(rawParam(param))
+		}
+		if err != nil {
+			return nil, err
+		}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: param.Name}, &value)
+	}
+	return n, nil
+}
+
+// Lookup returns the parameter named name, or nil.
+func (p Params) Lookup(name string) *Param {
+	for i := range p {
+		if p[i].Name == name {
+			return &p[i]
+		}
+	}
+	return nil
+}
+
+func (p Params) Validate() error {
+	seen := make(map[string]bool)
+	for _, param := range p {
+		if !isValidVariableName(param.Name) {
+			return fmt.Errorf("invalid parameter name: %s", param.Name)
+		}
+		if seen[param.Name] {
+			return fmt.Errorf("parameter %s is declared twice", param.Name)
+		}
+		seen[param.Name] = true
+		switch param.Type {
+		case ParamString, ParamInteger, ParamNumber, ParamBoolean, ParamDate, ParamTimestamp:
+		case "":
+			return fmt.Errorf("parameter %s requires a type", param.Name)
+		default:
+			return fmt.Errorf("unknown type %s for parameter %s, expected string, integer, number, boolean, date or timestamp", param.Type, param.Name)
+		}
+	}
+	return nil
+}
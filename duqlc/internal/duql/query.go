@@ -8,66 +8,96 @@ import (
 
 type Query struct {
 	Settings *Settings `yaml:"settings,omitempty" json:"settings,omitempty" mapstructure:"settings,omitempty"`
-	Declare  Declare   `yaml:"declare,omitempty" json:"declare,omitempty" mapstructure:"declare,omitempty"`
-	Dataset  Dataset   `yaml:"dataset" json:"dataset" mapstructure:"dataset"`
-	Steps    Steps     `yaml:"steps,omitempty" json:"steps,omitempty" mapstructure:"steps,omitempty"`
-	Into     string    `yaml:"into,omitempty" json:"into,omitempty" mapstructure:"into,omitempty"`
+	// Vars declares the ${name} variables used in the file, which the
+	// loader has already replaced.
+	Vars Vars `yaml:"vars,omitempty" json:"vars,omitempty" mapstructure:"vars,omitempty"`
+	// Params declares the $name parameters bound when the SQL runs.
+	Params Params `yaml:"params,omitempty" json:"params,omitempty" mapstructure:"params,omitempty"`
+	// Import lists the files whose declarations the query uses. They are
+	// merged into Declare under their namespace when the query is loaded.
+	Import  []Import `yaml:"import,omitempty" json:"import,omitempty" mapstructure:"import,omitempty"`
+	Declare Declare  `yaml:"declare,omitempty" json:"declare,omitempty" mapstructure:"declare,omitempty"`
+	Dataset Dataset  `yaml:"dataset" json:"dataset" mapstructure:"dataset"`
+	Steps   Steps    `yaml:"steps,omitempty" json:"steps,omitempty" mapstructure:"steps,omitempty"`
+	Into    *Into    `yaml:"into,omitempty" json:"into,omitempty" mapstructure:"into,omitempty"`
 }
 
-type Steps []Step
-
-func (s *Steps) UnmarshalYAML(value *yaml.Node) error {
-	var rawSteps []map[string]interface{}
-	if err := value.Decode(&rawSteps); err != nil {
+func (q *Query) UnmarshalYAML(value *yaml.Node) error {
+	type rawQuery Query
+	if err := value.Decode((*rawQuery)(q)); err != nil {
 		return err
 	}
+	q.recordRawSQLDialect()
+	return nil
+}
 
-	*s = make(Steps, len(rawSteps))
-	for i, rawStep := range rawSteps {
-		if len(rawStep) != 1 {
-			return fmt.Errorf("each step must be a single-key object")
-		}
+type Steps []Step
 
-		for stepType, stepValue := range rawStep {
-			var step Step
-			switch stepType {
-			case "filter":
-				step = &Filter{}
-			case "join":
-				step = &Join{}
-			case "group":
-				step = &Group{}
-			case "generate":
-				step = &Generate{}
-			case "sort":
-				step = &Sort{}
-			case "take":
-				step = &Take{}
-			case "window":
-				step = &Window{}
-			case "select":
-				step = &Select{}
-			case "select!":
-				step = &SelectNot{}
-			case "loop":
-				step = &Loop{}
-			case "summarize":
-				step = &Summarize{}
-			default:
-				return fmt.Errorf("unknown step type: %s", stepType)
+func (s *Steps) UnmarshalYAML(value *yaml.Node) error {
+	// Steps are usually a list of single-key objects, but a plain object of
+	// steps is accepted too, in the order written.
+	var pairs []*yaml.Node
+	switch value.Kind {
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if item.Kind != yaml.MappingNode || len(item.Content) != 2 {
+				return fmt.Errorf("each step must be a single-key object")
 			}
+			pairs = append(pairs, item.Content...)
+		}
+	case yaml.MappingNode:
+		pairs = value.Content
+	default:
+		return fmt.Errorf("steps must be a list of steps")
+	}
 
-			valueBytes, err := yaml.Marshal(stepValue)
-			if err != nil {
-				return err
-			}
+	*s = make(Steps, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		stepType := pairs[i].Value
 
-			if err := yaml.Unmarshal(valueBytes, step); err != nil {
-				return err
-			}
+		var step Step
+		switch stepType {
+		case "filter":
+			step = &Filter{}
+		case "join":
+			step = &Join{}
+		case "group":
+			step = &Group{}
+		case "generate":
+			step = &Generate{}
+		case "sort":
+			step = &Sort{}
+		case "take":
+			step = &Take{}
+		case "window":
+			step = &Window{}
+		case "select":
+			step = &Select{}
+		case "select!":
+			step = &SelectNot{}
+		case "loop":
+			step = &Loop{}
+		case "summarize":
+			step = &Summarize{}
+		case "append":
+			step = &Append{}
+		case "union":
+			step = &Union{}
+		case "intersect":
+			step = &Intersect{}
+		case "except":
+			step = &Except{}
+		case "distinct":
+			step = &Distinct{}
+		default:
+			return fmt.Errorf("unknown step type: %s", stepType)
+		}
 
-			(*s)[i] = step
+		if err := pairs[i+1].Decode(step); err != nil {
+			return fmt.Errorf("invalid %s step: %w", stepType, err)
 		}
+
+		*s = append(*s, step)
 	}
 
 	return nil
@@ -77,6 +107,27 @@ func (q *Query) Validate() error {
 	if q.Dataset == (Dataset{}) {
 		return fmt.Errorf("dataset is required")
 	}
+	if err := q.Dataset.Validate(); err != nil {
+		return fmt.Errorf("invalid dataset: %w", err)
+	}
+
+	if err := q.Vars.Validate(); err != nil {
+		return fmt.Errorf("invalid vars: %w", err)
+	}
+	if err := q.Params.Validate(); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, imp := range q.Import {
+		if err := imp.Validate(); err != nil {
+			return fmt.Errorf("invalid import: %w", err)
+		}
+		if seen[imp.Namespace()] {
+			return fmt.Errorf("invalid import: namespace %s is imported twice", imp.Namespace())
+		}
+		seen[imp.Namespace()] = true
+	}
 
 	if q.Declare != nil {
 		if err := q.Declare.Validate(); err != nil {
@@ -92,5 +143,17 @@ func (q *Query) Validate() error {
 		}
 	}
 
+	if q.Into != nil {
+		if err := q.Into.Validate(); err != nil {
+			return fmt.Errorf("invalid into: %w", err)
+		}
+	}
+
+	if q.Settings != nil && q.Settings.Strict {
+		if uses := q.RawSQL(); len(uses) > 0 {
+			return fmt.Errorf("raw SQL is not allowed in strict mode: %s", uses[0].Path)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,270 @@
+package duql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RawSQL is the escape hatch for SQL that DUQL passes through verbatim,
+// written either as a `sql:` object or as a sql"""…""" string.
+type RawSQL struct {
+	SQL string
+	// Dialect is the settings.target the query declared when it was parsed,
+	// so the compiler can tell when the SQL is being compiled for another engine.
+	Dialect TargetDialect
+}
+
+// RawSQLUse is a raw SQL fragment together with where it appears in the query.
+type RawSQLUse struct {
+	Path string
+	SQL  *RawSQL
+}
+
+// ParseRawSQLString unwraps a sql"…", sql'…' or triple-quoted sql"""…""" string.
+// It reports false when s is not entirely a raw SQL literal.
+func ParseRawSQLString(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "sql") {
+		return "", false
+	}
+	body := s[3:]
+	for _, quote := range []string{`"""`, `'''`, `"`, `'`} {
+		if len(body) >= 2*len(quote) && strings.HasPrefix(body, quote) && strings.HasSuffix(body, quote) {
+			inner := body[len(quote) : len(body)-len(quote)]
+			if len(quote) == 1 && strings.Contains(inner, quote) {
+				return "", false
+			}
+			return inner, true
+		}
+	}
+	return "", false
+}
+
+// containsRawSQL reports whether an inline expression embeds a sql"…"
+// literal. Strings and `quoted` names are skipped, so 'sql' is only text,
+// but the expressions of f-strings are looked at.
+func containsRawSQL(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '`':
+			end := strings.IndexByte(s[i+1:], '`')
+			if end < 0 {
+				return false
+			}
+			i += end + 1
+		case c == '\'' || c == '"':
+			_, end := skipQuoted(s, i)
+			i = end - 1
+		case isWordChar(c):
+			end := i
+			for end < len(s) && isWordChar(s[end]) {
+				end++
+			}
+			word := s[i:end]
+			i = end - 1
+			if end == len(s) || (s[end] != '\'' && s[end] != '"') {
+				continue
+			}
+			switch word {
+			case "sql":
+				return true
+			case "f":
+				body, after := skipQuoted(s, end)
+				if containsRawSQL(body) {
+					return true
+				}
+				i = after - 1
+			}
+		}
+	}
+	return false
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// skipQuoted returns the body of the string starting at s[i], which may be
+// triple-quoted, and the index just past it.
+func skipQuoted(s string, i int) (string, int) {
+	q := s[i]
+	if triple := strings.Repeat(string(q), 3); strings.HasPrefix(s[i:], triple) {
+		end := strings.Index(s[i+3:], triple)
+		if end < 0 {
+			return s[i+3:], len(s)
+		}
+		return s[i+3 : i+3+end], i + 6 + end
+	}
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case q:
+			return s[i+1 : j], j + 1
+		}
+	}
+	return s[i+1:], len(s)
+}
+
+func (r *RawSQL) MarshalYAML() (interface{}, error) {
+	return map[string]string{"sql": r.SQL}, nil
+}
+
+// RawSQL returns every raw SQL escape hatch used by the query, including
+// those inside declarations and nested steps.
+func (q *Query) RawSQL() []RawSQLUse {
+	var uses []RawSQLUse
+	dialect := q.target()
+
+	add := func(path string, r *RawSQL) {
+		uses = append(uses, RawSQLUse{Path: path, SQL: r})
+	}
+	addString := func(path, s string) {
+		if containsRawSQL(s) {
+			if body, ok := ParseRawSQLString(s); ok {
+				s = body
+			}
+			add(path, &RawSQL{SQL: s, Dialect: dialect})
+		}
+	}
+
+	var walkExpr func(path string, v interface{})
+	walkExpr = func(path string, v interface{}) {
+		switch e := v.(type) {
+		case *RawSQL:
+			add(path, e)
+		case string:
+			addString(path, e)
+		case Expression:
+			walkExpr(path, e.Value)
+		case *Expression:
+			if e != nil {
+				walkExpr(path, e.Value)
+			}
+		case *Case:
+			for i, b := range e.Branches {
+				walkExpr(fmt.Sprintf("%s.case[%d]", path, i), b.When)
+				walkExpr(fmt.Sprintf("%s.case[%d]", path, i), b.Then)
+			}
+		case map[string]interface{}:
+			if s, ok := e["sql"].(string); ok && len(e) == 1 {
+				add(path, &RawSQL{SQL: s, Dialect: dialect})
+				return
+			}
+			for k, item := range e {
+				walkExpr(path+"."+k, item)
+			}
+		case []interface{}:
+			for i, item := range e {
+				walkExpr(fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		}
+	}
+
+	var walkSteps func(path string, steps []Step)
+	var walkDataset func(path string, d Dataset)
+	walkDataset = func(path string, d Dataset) {
+		if d.SQL != nil {
+			add(path, d.SQL)
+		}
+		if d.Query != nil {
+			if d.File != "" {
+				path += "(" + d.File + ")"
+			}
+			walkDataset(path+".dataset", d.Query.Dataset)
+			walkSteps(path+".steps", d.Query.Steps)
+		}
+	}
+
+	walkSteps = func(path string, steps []Step) {
+		for i, step := range steps {
+			p := fmt.Sprintf("%s[%d].%s", path, i, step.Type())
+			switch s := step.(type) {
+			case *Filter:
+				walkExpr(p, s.Expression)
+			case *Generate:
+				for _, expr := range s.Expressions {
+					walkExpr(p+"."+expr.Name, expr.Expression)
+				}
+			case *Summarize:
+				for _, expr := range s.Aggregations {
+					walkExpr(p+"."+expr.Name, expr.Expression)
+				}
+			case *Group:
+				walkSteps(p+".steps", s.Steps)
+			case *Join:
+				walkDataset(p+".dataset", s.Dataset)
+				walkExpr(p+".where", s.Where)
+			case *Select:
+				for _, c := range s.Columns {
+					walkExpr(p, c.Expression)
+				}
+			case *Sort:
+				for _, c := range s.Columns {
+					walkExpr(p, c.Expression)
+				}
+			case *Window:
+				walkSteps(p+".steps", s.Steps)
+			case *Loop:
+				walkSteps(p, s.Steps)
+			case *Append:
+				walkDataset(p, s.Dataset)
+			case *Union:
+				walkDataset(p, s.Dataset)
+			case *Intersect:
+				walkDataset(p, s.Dataset)
+			case *Except:
+				walkDataset(p, s.Dataset)
+			}
+		}
+	}
+
+	walkDataset("dataset", q.Dataset)
+	for name, value := range q.Declare {
+		p := "declare." + name
+		if value.Pipeline != nil {
+			walkDataset(p+".dataset", value.Pipeline.Dataset)
+			walkSteps(p+".steps", value.Pipeline.Steps)
+		}
+		if value.Expression != nil {
+			walkExpr(p, value.Expression)
+		}
+		if value.Function != nil {
+			walkExpr(p+".expression", value.Function.Expression)
+		}
+	}
+	walkSteps("steps", q.Steps)
+
+	return uses
+}
+
+// RawSQLWarnings describes every raw SQL fragment that was written for a
+// different dialect than the one the query is being compiled for.
+func (q *Query) RawSQLWarnings(target TargetDialect) []string {
+	var warnings []string
+	for _, use := range q.RawSQL() {
+		written := use.SQL.Dialect
+		if written == "" {
+			written = Generic
+		}
+		if written != target {
+			warnings = append(warnings, fmt.Sprintf("%s: raw SQL written for %s is passed through unchanged to %s", use.Path, written, target))
+		}
+	}
+	return warnings
+}
+
+// recordRawSQLDialect stamps every raw SQL node with the query's target.
+func (q *Query) recordRawSQLDialect() {
+	dialect := q.target()
+	for _, use := range q.RawSQL() {
+		use.SQL.Dialect = dialect
+	}
+}
+
+func (q *Query) target() TargetDialect {
+	if q.Settings == nil {
+		return ""
+	}
+	return q.Settings.Target
+}
@@ -0,0 +1,113 @@
+package duql
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parse(t *testing.T, src string) *Query {
+	t.Helper()
+	var q Query
+	if err := yaml.Unmarshal([]byte(src), &q); err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	return &q
+}
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "dataset",
+			src:  `dataset: sql"""SELECT * FROM orders"""`,
+			want: "raw SQL is not allowed in strict mode: dataset",
+		},
+		{
+			name: "filter string",
+			src:  "dataset: orders\nsteps:\n  - filter: amount > sql'1'",
+			want: "raw SQL is not allowed in strict mode: steps[0].filter",
+		},
+		{
+			name: "generate object",
+			src:  "dataset: orders\nsteps:\n  - generate:\n      total: {sql: amount * 2}",
+			want: "raw SQL is not allowed in strict mode: steps[0].generate.total",
+		},
+		{
+			name: "inside group",
+			src:  "dataset: orders\nsteps:\n  - group:\n      by: [status]\n      steps:\n        - summarize: {n: sql'COUNT(*)'}",
+			want: "raw SQL is not allowed in strict mode: steps[0].group.steps[0].summarize.n",
+		},
+		{
+			name: "inline join dataset",
+			src:  "dataset: orders\nsteps:\n  - join:\n      dataset: {dataset: \"sql'SELECT 1 AS id'\", steps: [{select: [id]}]}\n      where: ==id",
+			want: "raw SQL is not allowed in strict mode: steps[0].join.dataset.dataset",
+		},
+		{
+			name: "declared expression",
+			src:  "declare:\n  big: sql'amount > 100'\ndataset: orders\nsteps:\n  - filter: big",
+			want: "raw SQL is not allowed in strict mode: declare.big",
+		},
+		{
+			name: "without raw SQL",
+			src:  "dataset: orders\nsteps:\n  - filter: note == 'sql'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := parse(t, "settings: {strict: true}\n"+tt.src)
+			err := q.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || err.Error() != tt.want):
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+
+			// Without strict, the same query is valid.
+			if err := parse(t, tt.src).Validate(); err != nil {
+				t.Errorf("without strict: %v", err)
+			}
+		})
+	}
+}
+
+func TestRawSQLWarnings(t *testing.T) {
+	q := parse(t, "settings: {target: sql.postgres}\ndataset: orders\nsteps:\n  - filter: sql'amount::int > 1'")
+	if got := q.RawSQLWarnings(Postgres); len(got) > 0 {
+		t.Errorf("got warnings %q for the target the SQL was written for", got)
+	}
+	want := []string{"steps[0].filter: raw SQL written for sql.postgres is passed through unchanged to sql.mysql"}
+	if got := q.RawSQLWarnings(MySQL); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestContainsRawSQL(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`sql'NOW()'`, true},
+		{`amount > sql"1"`, true},
+		{`sql"""SELECT 1"""`, true},
+		{`f"{sql'NOW()'} ago"`, true},
+		{`note == 'sql'`, false},
+		{`note == "use sql'x'"`, false},
+		{`note == """no sql'here'"""`, false},
+		{"`sql`'x'", false},
+		{`mysql'x'`, false},
+		{`t.sql'x'`, false},
+		{`f"{name} uses sql"`, false},
+		{`sql == 1`, false},
+	}
+	for _, tt := range tests {
+		if got := containsRawSQL(tt.expr); got != tt.want {
+			t.Errorf("containsRawSQL(%s) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
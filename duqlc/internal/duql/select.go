@@ -6,9 +6,10 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Select lists the output columns. Plain column references have an empty
+// Name; renamed or computed columns carry the output name.
 type Select struct {
-	Column  string   `yaml:"column" json:"column" mapstructure:"column"`
-	Columns []string `yaml:",inline" json:",inline" mapstructure:",squash"`
+	Columns []NamedExpression `yaml:",inline" json:",inline" mapstructure:",squash"`
 }
 
 type SelectNot struct {
@@ -21,7 +22,14 @@ func (s *Select) Type() string {
 }
 
 func (s *Select) Validate() error {
-	// Add validation logic here
+	if len(s.Columns) == 0 {
+		return fmt.Errorf("select must contain at least one column")
+	}
+	for _, col := range s.Columns {
+		if err := col.Expression.Validate(); err != nil {
+			return fmt.Errorf("invalid select column %s: %w", col.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -35,18 +43,37 @@ func (s *SelectNot) Validate() error {
 }
 
 func (s *Select) UnmarshalYAML(value *yaml.Node) error {
-	var tmp interface{}
-	if err := value.Decode(&tmp); err != nil {
-		return err
-	}
-
-	switch v := tmp.(type) {
-	case string:
-		s.Column = v
-	case []interface{}:
-		s.Columns = make([]string, len(v))
-		for i, col := range v {
-			s.Columns[i] = col.(string)
+	switch value.Kind {
+	case yaml.ScalarNode:
+		var expr Expression
+		if err := value.Decode(&expr); err != nil {
+			return err
+		}
+		s.Columns = []NamedExpression{{Expression: expr}}
+	case yaml.MappingNode:
+		cols, err := decodeNamedExpressions(value)
+		if err != nil {
+			return err
+		}
+		s.Columns = cols
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			switch item.Kind {
+			case yaml.ScalarNode:
+				var expr Expression
+				if err := item.Decode(&expr); err != nil {
+					return err
+				}
+				s.Columns = append(s.Columns, NamedExpression{Expression: expr})
+			case yaml.MappingNode:
+				cols, err := decodeNamedExpressions(item)
+				if err != nil {
+					return err
+				}
+				s.Columns = append(s.Columns, cols...)
+			default:
+				return fmt.Errorf("invalid select specification")
+			}
 		}
 	default:
 		return fmt.Errorf("invalid select specification")
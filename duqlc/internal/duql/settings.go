@@ -1,18 +1,41 @@
 package duql
 
+import "strings"
+
 type Settings struct {
 	Version string        `yaml:"version,omitempty" json:"version,omitempty" mapstructure:"version,omitempty"`
 	Target  TargetDialect `yaml:"target,omitempty" json:"target,omitempty" mapstructure:"target,omitempty"`
+	// Strict forbids raw SQL escape hatches, for query libraries that must
+	// stay portable and reviewable.
+	Strict bool `yaml:"strict,omitempty" json:"strict,omitempty" mapstructure:"strict,omitempty"`
+	// Catalog is a YAML or JSON file, a directory or file of SQL DDL, or a
+	// SQLite database describing the tables the query reads, relative to the
+	// query file. The validator reports tables and columns it does not list.
+	Catalog string `yaml:"catalog,omitempty" json:"catalog,omitempty" mapstructure:"catalog,omitempty"`
 }
 
 type TargetDialect string
 
 const (
+	BigQuery   TargetDialect = "sql.bigquery"
 	ClickHouse TargetDialect = "sql.clickhouse"
 	DuckDB     TargetDialect = "sql.duckdb"
 	Generic    TargetDialect = "sql.generic"
 	GlareDB    TargetDialect = "sql.glaredb"
+	MSSQL      TargetDialect = "sql.mssql"
 	MySQL      TargetDialect = "sql.mysql"
 	Postgres   TargetDialect = "sql.postgres"
+	Snowflake  TargetDialect = "sql.snowflake"
 	SQLite     TargetDialect = "sql.sqlite"
+	Trino      TargetDialect = "sql.trino"
 )
+
+// ParseTargetDialect reads a target as written on the command line, where
+// the sql. prefix may be left out.
+func ParseTargetDialect(name string) TargetDialect {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name != "" && !strings.Contains(name, ".") {
+		name = "sql." + name
+	}
+	return TargetDialect(name)
+}
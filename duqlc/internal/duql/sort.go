@@ -2,13 +2,21 @@ package duql
 
 import (
 	"fmt"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Sort struct {
-	Column  string   `yaml:"column" json:"column" mapstructure:"column"`
-	Columns []string `yaml:",inline" json:",inline" mapstructure:",squash"`
+	Columns []SortColumn `yaml:",inline" json:",inline" mapstructure:",squash"`
+}
+
+// SortColumn is one sort key. Name is set when the key was given an output
+// column name using the object form of sort.
+type SortColumn struct {
+	Name       string
+	Expression Expression
+	Descending bool
 }
 
 func (s *Sort) Type() string {
@@ -16,26 +24,54 @@ func (s *Sort) Type() string {
 }
 
 func (s *Sort) Validate() error {
-	// Add validation logic here
+	if len(s.Columns) == 0 {
+		return fmt.Errorf("sort must contain at least one column")
+	}
 	return nil
 }
 
 func (s *Sort) UnmarshalYAML(value *yaml.Node) error {
-	var tmp interface{}
-	if err := value.Decode(&tmp); err != nil {
-		return err
-	}
-
-	switch v := tmp.(type) {
-	case string:
-		s.Column = v
-	case []interface{}:
-		s.Columns = make([]string, len(v))
-		for i, col := range v {
-			s.Columns[i] = col.(string)
+	switch value.Kind {
+	case yaml.ScalarNode:
+		s.Columns = []SortColumn{newSortColumn("", value.Value)}
+	case yaml.SequenceNode:
+		for _, item := range value.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("invalid sort specification")
+			}
+			s.Columns = append(s.Columns, newSortColumn("", item.Value))
+		}
+	case yaml.MappingNode:
+		exprs, err := decodeNamedExpressions(value)
+		if err != nil {
+			return err
+		}
+		for _, e := range exprs {
+			col := SortColumn{Name: e.Name, Expression: e.Expression}
+			if str, ok := e.Expression.Value.(string); ok {
+				col = newSortColumn(e.Name, str)
+			}
+			s.Columns = append(s.Columns, col)
 		}
 	default:
 		return fmt.Errorf("invalid sort specification")
 	}
 	return nil
 }
+
+// newSortColumn reads the leading '-' that marks a descending key.
+func newSortColumn(name, key string) SortColumn {
+	col := SortColumn{Name: name}
+	key = strings.TrimSpace(key)
+	if strings.HasPrefix(key, "-") {
+		col.Descending = true
+		key = strings.TrimSpace(key[1:])
+	} else if strings.HasPrefix(key, "+") {
+		key = strings.TrimSpace(key[1:])
+	}
+	col.Expression.Value = key
+	if body, ok := ParseRawSQLString(key); ok {
+		col.Expression.Value = &RawSQL{SQL: body}
+	}
+	return col
+}
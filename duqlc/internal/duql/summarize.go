@@ -9,28 +9,15 @@ import (
 )
 
 type Summarize struct {
-	Aggregations map[string]Expression `yaml:"summarize"`
+	Aggregations []NamedExpression `yaml:"summarize"`
 }
 
 func (s *Summarize) UnmarshalYAML(value *yaml.Node) error {
-	var raw map[string]interface{}
-	if err := value.Decode(&raw); err != nil {
-		return err
+	aggs, err := decodeNamedExpressions(value)
+	if err != nil {
+		return fmt.Errorf("invalid summarize specification: %w", err)
 	}
-
-	s.Aggregations = make(map[string]Expression)
-	for key, val := range raw {
-		expr := Expression{}
-		valBytes, err := yaml.Marshal(val)
-		if err != nil {
-			return err
-		}
-		if err := yaml.Unmarshal(valBytes, &expr); err != nil {
-			return err
-		}
-		s.Aggregations[key] = expr
-	}
-
+	s.Aggregations = aggs
 	return nil
 }
 
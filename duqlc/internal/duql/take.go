@@ -2,6 +2,8 @@ package duql
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -20,6 +22,41 @@ func (t *Take) Validate() error {
 	return nil
 }
 
+// Bounds converts the take to an offset and a limit, where a limit of -1
+// means no limit. Ranges are 1-indexed and inclusive.
+func (t *Take) Bounds() (int, int, error) {
+	if t.Range == "" {
+		if t.Number < 0 {
+			return 0, 0, fmt.Errorf("take must not be negative")
+		}
+		return 0, t.Number, nil
+	}
+	start, end, ok := strings.Cut(t.Range, "..")
+	if !ok {
+		n, err := strconv.Atoi(strings.TrimSpace(t.Range))
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("invalid take range %q", t.Range)
+		}
+		return 0, n, nil
+	}
+	from, to := 1, -1
+	var err error
+	if start = strings.TrimSpace(start); start != "" {
+		if from, err = strconv.Atoi(start); err != nil || from < 1 {
+			return 0, 0, fmt.Errorf("invalid take range %q", t.Range)
+		}
+	}
+	if end = strings.TrimSpace(end); end != "" {
+		if to, err = strconv.Atoi(end); err != nil || to < from-1 {
+			return 0, 0, fmt.Errorf("invalid take range %q", t.Range)
+		}
+	}
+	if to < 0 {
+		return from - 1, -1, nil
+	}
+	return from - 1, to - from + 1, nil
+}
+
 func (t *Take) UnmarshalYAML(value *yaml.Node) error {
 	var tmp interface{}
 	if err := value.Decode(&tmp); err != nil {
@@ -0,0 +1,20 @@
+package duql
+
+import "gopkg.in/yaml.v3"
+
+// Union adds the rows of another dataset, removing duplicate rows.
+type Union struct {
+	Dataset Dataset `yaml:"union" json:"union" mapstructure:"union"`
+}
+
+func (u *Union) Type() string {
+	return "union"
+}
+
+func (u *Union) Validate() error {
+	return validateSetDataset(u.Type(), u.Dataset)
+}
+
+func (u *Union) UnmarshalYAML(value *yaml.Node) error {
+	return value.Decode(&u.Dataset)
+}
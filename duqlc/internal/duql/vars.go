@@ -0,0 +1,130 @@
+package duql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Vars declares the ${name} variables of a query. They are replaced in the
+// text of the file when it is loaded, before anything else reads it.
+type Vars map[string]Var
+
+// Var is a declared variable. Written as a plain value, that value is the
+// default and its YAML type the type of the variable.
+type Var struct {
+	Type    VarType `yaml:"type,omitempty" json:"type,omitempty" mapstructure:"type,omitempty"`
+	Default *string `yaml:"default,omitempty" json:"default,omitempty" mapstructure:"default,omitempty"`
+	// Values, when set, are the only values the variable may take.
+	Values      []string `yaml:"values,omitempty" json:"values,omitempty" mapstructure:"values,omitempty"`
+	Description string   `yaml:"description,omitempty" json:"description,omitempty" mapstructure:"description,omitempty"`
+}
+
+type VarType string
+
+const (
+	VarString  VarType = "string"
+	VarInteger VarType = "integer"
+	VarNumber  VarType = "number"
+	VarBoolean VarType = "boolean"
+	VarDate    VarType = "date"
+)
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (v *Var) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		s := value.Value
+		v.Default = &s
+		switch value.ShortTag() {
+		case "!!int":
+			v.Type = VarInteger
+		case "!!float":
+			v.Type = VarNumber
+		case "!!bool":
+			v.Type = VarBoolean
+		default:
+			v.Type = VarString
+		}
+		return nil
+	}
+	type rawVar Var
+	return value.Decode((*rawVar)(v))
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (v Var) MarshalYAML() (interface{}, error) {
+	if v.Default != nil && len(v.Values) == 0 && v.Description == "" && (v.Type == "" || v.Type == VarString) {
+		return *v.Default, nil
+	}
+	type rawVar Var
+	return rawVar(v), nil
+}
+
+func (v *Var) Validate() error {
+	switch v.Type {
+	case "", VarString, VarInteger, VarNumber, VarBoolean, VarDate:
+	default:
+		return fmt.Errorf("unknown type %s, expected string, integer, number, boolean or date", v.Type)
+	}
+	for _, value := range v.Values {
+		if err := v.checkType(value); err != nil {
+			return err
+		}
+	}
+	if v.Default != nil {
+		if err := v.Check(*v.Default); err != nil {
+			return fmt.Errorf("invalid default: %w", err)
+		}
+	}
+	return nil
+}
+
+// Check reports whether value is of the type of the variable and one of
+// its values.
+func (v *Var) Check(value string) error {
+	if err := v.checkType(value); err != nil {
+		return err
+	}
+	if len(v.Values) == 0 {
+		return nil
+	}
+	for _, allowed := range v.Values {
+		if value == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not one of %s", value, strings.Join(v.Values, ", "))
+}
+
+func (v *Var) checkType(value string) error {
+	var err error
+	switch v.Type {
+	case VarInteger:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case VarNumber:
+		_, err = strconv.ParseFloat(value, 64)
+	case VarBoolean:
+		_, err = strconv.ParseBool(value)
+	case VarDate:
+		_, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", value, v.Type)
+	}
+	return nil
+}
+
+func (v Vars) Validate() error {
+	for name, value := range v {
+		if !isValidVariableName(name) {
+			return fmt.Errorf("invalid variable name: %s", name)
+		}
+		if err := value.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -7,7 +7,7 @@ type Window struct {
 	Range     string `yaml:"range,omitempty" json:"range,omitempty" mapstructure:"range,omitempty"`
 	Expanding bool   `yaml:"expanding,omitempty" json:"expanding,omitempty" mapstructure:"expanding,omitempty"`
 	Rolling   int    `yaml:"rolling,omitempty" json:"rolling,omitempty" mapstructure:"rolling,omitempty"`
-	Steps     []Step `yaml:"steps" json:"steps" mapstructure:"steps"`
+	Steps     Steps  `yaml:"steps" json:"steps" mapstructure:"steps"`
 }
 
 func (w *Window) Type() string {
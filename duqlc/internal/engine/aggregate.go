@@ -0,0 +1,250 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// aggregate is an aggregate function of a summarize.
+type aggregate struct {
+	name string
+	// arg is nil for count without an argument, which counts rows.
+	arg evalFn
+}
+
+// accumulator folds the non-NULL values of an aggregate.
+type accumulator interface {
+	add(v any) error
+	result() any
+}
+
+func newAccumulator(name string) accumulator {
+	switch name {
+	case "sum":
+		return &sum{}
+	case "avg", "average":
+		return &average{}
+	case "min":
+		return &extreme{sign: -1}
+	case "max":
+		return &extreme{sign: 1}
+	case "count_distinct":
+		return &countDistinct{seen: make(map[string]bool)}
+	case "stddev":
+		return &stddev{}
+	case "median":
+		return &median{}
+	case "any":
+		return &boolean{any: true}
+	case "every":
+		return &boolean{}
+	}
+	return &count{}
+}
+
+// folder computes the aggregates of a summarize over the rows of a group.
+type folder struct {
+	aggs []*aggregate
+	accs []accumulator
+}
+
+func newFolder(aggs []*aggregate) *folder {
+	f := &folder{aggs: aggs, accs: make([]accumulator, len(aggs))}
+	for i, a := range aggs {
+		f.accs[i] = newAccumulator(a.name)
+	}
+	return f
+}
+
+func (f *folder) add(e *env) error {
+	for i, a := range f.aggs {
+		var v any = true
+		if a.arg != nil {
+			var err error
+			if v, err = a.arg(e); err != nil {
+				return err
+			}
+		}
+		if v == nil {
+			continue
+		}
+		if err := f.accs[i].add(v); err != nil {
+			return fmt.Errorf("%s: %w", a.name, err)
+		}
+	}
+	return nil
+}
+
+func (f *folder) results() []any {
+	values := make([]any, len(f.accs))
+	for i, acc := range f.accs {
+		values[i] = acc.result()
+	}
+	return values
+}
+
+type count struct{ n int64 }
+
+func (c *count) add(any) error { c.n++; return nil }
+func (c *count) result() any   { return c.n }
+
+type countDistinct struct {
+	seen map[string]bool
+	b    strings.Builder
+}
+
+func (c *countDistinct) add(v any) error {
+	c.b.Reset()
+	key(&c.b, v)
+	c.seen[c.b.String()] = true
+	return nil
+}
+
+func (c *countDistinct) result() any { return int64(len(c.seen)) }
+
+// sum adds integers as integers until it meets a fraction.
+type sum struct {
+	seen, fraction bool
+	i              int64
+	f              float64
+}
+
+func (s *sum) add(v any) error {
+	s.seen = true
+	switch v := v.(type) {
+	case int64:
+		s.i += v
+	case float64:
+		s.fraction = true
+		s.f += v
+	default:
+		return fmt.Errorf("expected numbers, got %s", typeName(v))
+	}
+	return nil
+}
+
+func (s *sum) result() any {
+	switch {
+	case !s.seen:
+		return nil
+	case s.fraction:
+		return s.f + float64(s.i)
+	}
+	return s.i
+}
+
+type average struct {
+	sum float64
+	n   int64
+}
+
+func (a *average) add(v any) error {
+	x, ok := number(v)
+	if !ok {
+		return fmt.Errorf("expected numbers, got %s", typeName(v))
+	}
+	a.sum += x
+	a.n++
+	return nil
+}
+
+func (a *average) result() any {
+	if a.n == 0 {
+		return nil
+	}
+	return a.sum / float64(a.n)
+}
+
+// extreme keeps the least value when sign is -1 and the greatest when 1.
+type extreme struct {
+	sign int
+	v    any
+}
+
+func (e *extreme) add(v any) error {
+	if e.v == nil || compare(v, e.v)*e.sign > 0 {
+		e.v = v
+	}
+	return nil
+}
+
+func (e *extreme) result() any { return e.v }
+
+// stddev is the sample standard deviation, computed with Welford's
+// method.
+type stddev struct {
+	n        int64
+	mean, m2 float64
+}
+
+func (s *stddev) add(v any) error {
+	x, ok := number(v)
+	if !ok {
+		return fmt.Errorf("expected numbers, got %s", typeName(v))
+	}
+	s.n++
+	delta := x - s.mean
+	s.mean += delta / float64(s.n)
+	s.m2 += delta * (x - s.mean)
+	return nil
+}
+
+func (s *stddev) result() any {
+	if s.n < 2 {
+		return nil
+	}
+	return math.Sqrt(s.m2 / float64(s.n-1))
+}
+
+type median struct{ values []float64 }
+
+func (m *median) add(v any) error {
+	x, ok := number(v)
+	if !ok {
+		return fmt.Errorf("expected numbers, got %s", typeName(v))
+	}
+	m.values = append(m.values, x)
+	return nil
+}
+
+func (m *median) result() any {
+	n := len(m.values)
+	if n == 0 {
+		return nil
+	}
+	sorted := slices.Clone(m.values)
+	slices.Sort(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// boolean is any when any is set, and every otherwise.
+type boolean struct {
+	any, seen, v bool
+}
+
+func (b *boolean) add(v any) error {
+	x, ok := v.(bool)
+	if !ok {
+		return fmt.Errorf("expected booleans, got %s", typeName(v))
+	}
+	if !b.seen {
+		b.seen, b.v = true, x
+	} else if b.any {
+		b.v = b.v || x
+	} else {
+		b.v = b.v && x
+	}
+	return nil
+}
+
+func (b *boolean) result() any {
+	if !b.seen {
+		return nil
+	}
+	return b.v
+}
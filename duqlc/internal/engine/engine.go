@@ -0,0 +1,337 @@
+// Package engine runs queries on CSV and newline-delimited JSON files in
+// memory, without a database. Rows stream through the steps of a query;
+// sorts and groups hold rows until they outgrow Options.MemoryLimit and
+// then spill them to temporary files, so files larger than memory can be
+// sorted and grouped. Window steps and the right side of joins are held in
+// memory.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// DefaultMemoryLimit is how many bytes of rows a sort or a group holds
+// before spilling unless Options.MemoryLimit says otherwise.
+const DefaultMemoryLimit = 256 << 20
+
+// Options configure a run.
+type Options struct {
+	// Params are the values of the $name parameters of the query.
+	Params map[string]any
+	// MemoryLimit is roughly how many bytes of rows each sort or group
+	// holds before writing them to disk.
+	MemoryLimit int64
+	// TempDir is where spilled rows are written, by default the directory
+	// of os.TempDir.
+	TempDir string
+	// Dir is the directory of the query file. Data files are looked up in
+	// the working directory first, then in Dir.
+	Dir string
+}
+
+// errDatabase is the hint of errors about what only a database can run.
+const errDatabase = "run the query on a database with --db or --profile"
+
+// engine runs one query, with the declarations of that query.
+type engine struct {
+	ctx  context.Context
+	opts Options
+	q    *duql.Query
+	dir  string
+	// now is the time current_date and now return, the same throughout
+	// the run.
+	now time.Time
+
+	exprs     map[string]expr.Node
+	funcs     map[string]*expr.Lambda
+	tuples    map[string]map[string]expr.Node
+	pipelines map[string]*duql.Pipeline
+	// running holds the declared pipelines and DUQL files being read, to
+	// catch those that read themselves.
+	running map[string]bool
+}
+
+// Run starts running q. Rows are read from the files and pass through the
+// steps as the returned Rows are read, so they must be closed.
+func Run(ctx context.Context, q *duql.Query, opts Options) (*Rows, error) {
+	if q.Into != nil {
+		return nil, fmt.Errorf("into writes to a database table; %s", errDatabase)
+	}
+	if opts.MemoryLimit <= 0 {
+		opts.MemoryLimit = DefaultMemoryLimit
+	}
+	if opts.TempDir == "" {
+		opts.TempDir = os.TempDir()
+	}
+	en, err := newEngine(ctx, q, opts, opts.Dir, time.Now(), make(map[string]bool))
+	if err != nil {
+		return nil, err
+	}
+	rel, err := en.pipeline(q.Dataset, q.Steps, "steps")
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{columns: rel.schema.names(), it: rel.rows, ctx: ctx}, nil
+}
+
+func newEngine(ctx context.Context, q *duql.Query, opts Options, dir string, now time.Time, running map[string]bool) (*engine, error) {
+	en := &engine{
+		ctx:       ctx,
+		opts:      opts,
+		q:         q,
+		dir:       dir,
+		now:       now,
+		exprs:     make(map[string]expr.Node),
+		funcs:     make(map[string]*expr.Lambda),
+		tuples:    make(map[string]map[string]expr.Node),
+		pipelines: make(map[string]*duql.Pipeline),
+		running:   running,
+	}
+	if err := en.declare(); err != nil {
+		return nil, err
+	}
+	return en, nil
+}
+
+// declare parses the declare section, as the compiler does.
+func (en *engine) declare() error {
+	for name, value := range en.q.Declare {
+		switch {
+		case value.Pipeline != nil:
+			en.pipelines[name] = value.Pipeline
+		case value.Function != nil:
+			fn := &expr.Lambda{}
+			for _, p := range value.Function.Parameters {
+				param := expr.LambdaParam{Name: p.Name}
+				if p.Default != nil {
+					n, err := expr.FromDUQL(duql.Expression{Value: p.Default})
+					if err != nil {
+						return fmt.Errorf("declare.%s: invalid default for %s: %w", name, p.Name, err)
+					}
+					param.Default = n
+				}
+				fn.Params = append(fn.Params, param)
+			}
+			body, err := expr.FromDUQL(value.Function.Expression)
+			if err != nil {
+				return fmt.Errorf("declare.%s: %w", name, err)
+			}
+			fn.Body = body
+			en.funcs[name] = fn
+		case value.Expression != nil:
+			n, err := expr.FromDUQL(*value.Expression)
+			if err != nil {
+				return fmt.Errorf("declare.%s: %w", name, err)
+			}
+			if fn, ok := n.(*expr.Lambda); ok {
+				en.funcs[name] = fn
+			} else {
+				en.exprs[name] = n
+			}
+		case value.Tuple != nil:
+			fields := make(map[string]expr.Node)
+			for key, v := range value.Tuple {
+				n, err := expr.FromDUQL(duql.Expression{Value: v})
+				if err != nil {
+					return fmt.Errorf("declare.%s.%s: %w", name, key, err)
+				}
+				fields[key] = n
+			}
+			en.tuples[name] = fields
+		}
+	}
+	return nil
+}
+
+// pipeline reads a dataset and applies steps to it.
+func (en *engine) pipeline(ds duql.Dataset, steps duql.Steps, path string) (*relation, error) {
+	rel, err := en.dataset(ds)
+	if err != nil {
+		return nil, fmt.Errorf("%sdataset: %w", strings.TrimSuffix(path, "steps"), err)
+	}
+	return en.steps(rel, steps, path)
+}
+
+// dataset opens the rows of a dataset: a data file, a declared pipeline,
+// or a query of its own.
+func (en *engine) dataset(ds duql.Dataset) (*relation, error) {
+	if ds.SQL != nil {
+		return nil, fmt.Errorf("raw SQL datasets need a database; %s", errDatabase)
+	}
+	if ds.Query != nil {
+		return en.subquery(ds)
+	}
+	if path := ds.QueryPath(); path != "" {
+		return nil, fmt.Errorf("%s is a DUQL file; load the query to read it", path)
+	}
+
+	source := ds.Simple
+	var format duql.DataFormat
+	if ds.Complex != nil {
+		source, format = ds.Complex.Name, ds.Complex.Format
+	}
+	if source == "" {
+		return nil, fmt.Errorf("dataset is required")
+	}
+
+	if p, ok := en.pipelines[source]; ok {
+		key := "declare." + source
+		if en.running[key] {
+			return nil, fmt.Errorf("declare.%s: pipeline refers to itself", source)
+		}
+		en.running[key] = true
+		defer delete(en.running, key)
+		rel, err := en.pipeline(p.Dataset, p.Steps, "declare."+source+".steps")
+		if err != nil {
+			return nil, err
+		}
+		// Columns of an imported pipeline are qualified with its name
+		// without the namespace.
+		return rel.as(source[strings.LastIndex(source, ".")+1:]), nil
+	}
+
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(source)) {
+		case ".csv":
+			format = duql.CSV
+		case ".json", ".ndjson", ".jsonl":
+			format = duql.JSON
+		case ".parquet":
+			format = duql.Parquet
+		default:
+			format = duql.Table
+		}
+	}
+	base := filepath.Base(source)
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	switch format {
+	case duql.CSV:
+		return en.readCSV(en.path(source), name)
+	case duql.JSON:
+		return en.readJSON(en.path(source), name)
+	case duql.Parquet:
+		return nil, fmt.Errorf("%s: parquet files cannot be read without a database; %s", source, errDatabase)
+	}
+	return nil, fmt.Errorf("%s is a table; %s, or read a CSV or NDJSON file", source, errDatabase)
+}
+
+// path finds a data file in the working directory, or else next to the
+// query.
+func (en *engine) path(source string) string {
+	if filepath.IsAbs(source) || en.dir == "" {
+		return source
+	}
+	if _, err := os.Stat(source); errors.Is(err, os.ErrNotExist) {
+		if alt := filepath.Join(en.dir, source); alt != source {
+			if _, err := os.Stat(alt); err == nil {
+				return alt
+			}
+		}
+	}
+	return source
+}
+
+// subquery runs a dataset with steps of its own: inline, with the
+// declarations of the query, or read from a DUQL file, with its own.
+func (en *engine) subquery(ds duql.Dataset) (*relation, error) {
+	q := ds.Query
+	if ds.Inline() {
+		return en.pipeline(q.Dataset, q.Steps, "steps")
+	}
+	if en.running[ds.File] {
+		return nil, fmt.Errorf("%s reads itself", ds.File)
+	}
+	en.running[ds.File] = true
+	defer delete(en.running, ds.File)
+	sub, err := newEngine(en.ctx, q, en.opts, filepath.Dir(ds.File), en.now, en.running)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ds.File, err)
+	}
+	rel, err := sub.pipeline(q.Dataset, q.Steps, "steps")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ds.File, err)
+	}
+	name := filepath.Base(ds.File)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, filepath.Ext(name)), ".duql")
+	return rel.as(name), nil
+}
+
+// Rows are the rows of a query, read as they are asked for.
+type Rows struct {
+	columns []string
+	it      iterator
+	ctx     context.Context
+	row     []any
+	err     error
+	done    bool
+}
+
+// Columns returns the names of the columns.
+func (r *Rows) Columns() ([]string, error) {
+	return r.columns, nil
+}
+
+// Next reads the next row, reporting false at the end or on an error.
+func (r *Rows) Next() bool {
+	if r.done {
+		return false
+	}
+	if err := r.ctx.Err(); err != nil {
+		r.err = err
+	} else {
+		r.row, r.err = r.it.next()
+	}
+	if r.err != nil {
+		if r.err == io.EOF {
+			r.err = nil
+		}
+		r.Close()
+		return false
+	}
+	return true
+}
+
+// Scan copies the values of the row into dest, which must be *any.
+// Values are nil, int64, float64, string, bool or time.Time; intervals
+// are written as text.
+func (r *Rows) Scan(dest ...any) error {
+	if len(dest) != len(r.row) {
+		return fmt.Errorf("expected %d destinations, got %d", len(r.row), len(dest))
+	}
+	for i, d := range dest {
+		p, ok := d.(*any)
+		if !ok {
+			return fmt.Errorf("destination %d is %T, expected *any", i, d)
+		}
+		if v, ok := r.row[i].(interval); ok {
+			*p = v.String()
+		} else {
+			*p = r.row[i]
+		}
+	}
+	return nil
+}
+
+// Err returns the error that stopped Next, if any.
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close stops reading and removes the temporary files of the query.
+func (r *Rows) Close() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	return r.it.close()
+}
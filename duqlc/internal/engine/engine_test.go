@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	duql "github.com/theduql/duql/internal/duql"
+)
+
+// run runs src with its data files in dir and returns the rows as text.
+func run(t *testing.T, src, dir string, opts Options) ([]string, error) {
+	t.Helper()
+	var q duql.Query
+	if err := yaml.Unmarshal([]byte(src), &q); err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	opts.Dir = dir
+	rows, err := Run(context.Background(), &q, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols, _ := rows.Columns()
+	out := []string{strings.Join(cols, ",")}
+	for rows.Next() {
+		values := make([]any, len(cols))
+		dest := make([]any, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatal(err)
+		}
+		var fields []string
+		for _, v := range values {
+			fields = append(fields, fmt.Sprint(v))
+		}
+		out = append(out, strings.Join(fields, ","))
+	}
+	return out, rows.Err()
+}
+
+func writeFile(t *testing.T, dir, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "sales.csv", `id,region,amount
+1,north,10
+2,south,5.5
+3,north,
+4,east,7
+5,south,20
+`)
+	writeFile(t, dir, "regions.json", `{"region": "north", "manager": "ada"}
+{"region": "south", "manager": "alan"}
+`)
+	tests := []struct {
+		name   string
+		src    string
+		params map[string]any
+		want   []string
+	}{
+		{
+			name: "filter and sort",
+			src: `
+dataset: sales.csv
+steps:
+  - filter: amount > 6
+  - sort: -amount
+  - select: [id, amount]`,
+			want: []string{"id,amount", "5,20", "1,10", "4,7"},
+		},
+		{
+			name: "group and summarize",
+			src: `
+dataset: sales.csv
+steps:
+  - group:
+      by: [region]
+      steps:
+        - summarize: {n: count id, total: sum amount}
+  - sort: region`,
+			want: []string{"region,n,total", "east,1,7", "north,2,10", "south,2,25.5"},
+		},
+		{
+			name: "computed group key",
+			src: `
+dataset: sales.csv
+steps:
+  - group:
+      by: [amount > 6]
+      summarize: {n: count id}
+  - sort: amount_6`,
+			want: []string{"amount_6,n", "<nil>,1", "false,1", "true,3"},
+		},
+		{
+			name: "text concatenation",
+			src: `
+dataset: sales.csv
+steps:
+  - filter: id < 3
+  - select: {label: region + ' ' + id}`,
+			want: []string{"label", "north 1", "south 2"},
+		},
+		{
+			name: "join",
+			src: `
+dataset: sales.csv
+steps:
+  - join: {dataset: regions.json, where: sales.region == regions.region}
+  - sort: id
+  - select: [id, manager]`,
+			want: []string{"id,manager", "1,ada", "2,alan", "3,ada", "5,alan"},
+		},
+		{
+			name: "params",
+			src: `
+params:
+  region: string
+dataset: sales.csv
+steps:
+  - filter: region == $region
+  - select: [id]`,
+			params: map[string]any{"region": "south"},
+			want:   []string{"id", "2", "5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, tt.src, dir, Options{Params: tt.params})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunSpilled sorts and groups a file larger than the memory limit, and
+// checks the rows match those sorted in memory and no spilled files are
+// left.
+func TestRunSpilled(t *testing.T) {
+	dir := t.TempDir()
+	var b strings.Builder
+	b.WriteString("id,key,name\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&b, "%d,%d,name %d\n", i, i*7919%50, i)
+	}
+	writeFile(t, dir, "big.csv", b.String())
+
+	for _, src := range []string{`
+dataset: big.csv
+steps:
+  - sort: [key, -name]`, `
+dataset: big.csv
+steps:
+  - group:
+      by: [key]
+      steps:
+        - summarize: {n: count id, first: min id}`, `
+dataset: big.csv
+steps:
+  - group:
+      by: [key]
+      steps:
+        - sort: -id
+        - take: 2`} {
+		want, err := run(t, src, dir, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmp := t.TempDir()
+		got, err := run(t, src, dir, Options{MemoryLimit: 4 << 10, TempDir: tmp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s\nspilled rows differ from those sorted in memory", src)
+		}
+		if files, _ := os.ReadDir(tmp); len(files) > 0 {
+			t.Errorf("%s\n%d spilled files are left", src, len(files))
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "t.csv", "a\n1\n")
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"into", "dataset: t.csv\ninto: out", "into writes to a database table"},
+		{"table", "dataset: orders", "orders is a table"},
+		{"parquet", "dataset: t.parquet", "parquet files cannot be read without a database"},
+		{"missing file", "dataset: missing.csv", "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(t, tt.src, dir, Options{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,737 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// env is what an expression is evaluated on.
+type env struct {
+	row []any
+	// part is the partition the row belongs to and i its position, for
+	// window functions; part is nil while rows stream.
+	part *partition
+	i    int
+	// aggs are the aggregates of the group being summarized.
+	aggs []any
+}
+
+// evalFn is a compiled expression.
+type evalFn func(e *env) (any, error)
+
+func constant(v any) evalFn {
+	return func(*env) (any, error) { return v, nil }
+}
+
+// scope resolves names while compiling one expression, as the scope of the
+// compiler does while rendering one.
+type scope struct {
+	en     *engine
+	schema *schema
+	// params are the arguments of the function being expanded.
+	params map[string]evalFn
+	// over is set inside window and group steps; aggs is set inside
+	// summarize, where aggregates are not window functions but collect
+	// into the list.
+	over *over
+	aggs *[]*aggregate
+	// sorted is the sort of the rows, which window functions are ordered
+	// by outside window and group steps.
+	sorted []duql.SortColumn
+
+	// window reports whether the compiled expression needs the partition
+	// of its row.
+	window bool
+
+	expanding map[string]bool
+}
+
+func (en *engine) scope(s *schema) *scope {
+	return &scope{en: en, schema: s, expanding: make(map[string]bool)}
+}
+
+// expression parses and compiles a YAML level expression.
+func (s *scope) expression(e duql.Expression) (evalFn, error) {
+	n, err := expr.FromDUQL(e)
+	if err != nil {
+		return nil, err
+	}
+	return s.node(n)
+}
+
+func errorAt(n expr.Node, err error) error {
+	if _, ok := err.(*expr.Error); ok {
+		return err
+	}
+	return &expr.Error{Pos: n.Pos(), Msg: err.Error()}
+}
+
+func (s *scope) node(n expr.Node) (evalFn, error) {
+	switch n := n.(type) {
+	case *expr.Ident:
+		return s.ident(n)
+	case *expr.Number:
+		return s.number(n)
+	case *expr.String:
+		return constant(n.Value), nil
+	case *expr.Bool:
+		return constant(n.Value), nil
+	case *expr.Null:
+		return constant(nil), nil
+	case *expr.Date:
+		return s.date(n)
+	case *expr.Interval:
+		iv, err := parseInterval(n.Text)
+		if err != nil {
+			return nil, errorAt(n, err)
+		}
+		return constant(iv), nil
+	case *expr.Param:
+		return s.param(n)
+	case *expr.RawSQL:
+		return nil, errorAt(n, fmt.Errorf("raw SQL needs a database; %s", errDatabase))
+	case *expr.FString:
+		return s.fstring(n)
+	case *expr.Unary:
+		return s.unary(n)
+	case *expr.Binary:
+		return s.binary(n)
+	case *expr.Case:
+		return s.caseExpr(n)
+	case *expr.Call:
+		return s.call(n)
+	case *expr.Range:
+		return nil, errorAt(n, fmt.Errorf("a range can only be used with in or between"))
+	case *expr.Array:
+		return nil, errorAt(n, fmt.Errorf("a list can only be used with in"))
+	case *expr.Lambda:
+		return nil, errorAt(n, fmt.Errorf("a function can only be declared, not used as a value"))
+	case *expr.NamedArg:
+		return nil, errorAt(n, fmt.Errorf("unexpected named argument %s", n.Name))
+	}
+	return nil, fmt.Errorf("unsupported expression %T", n)
+}
+
+func (s *scope) number(n *expr.Number) (evalFn, error) {
+	text := strings.ReplaceAll(n.Text, "_", "")
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return constant(i), nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, errorAt(n, fmt.Errorf("invalid number %s", n.Text))
+	}
+	return constant(f), nil
+}
+
+func (s *scope) column(i int) evalFn {
+	return func(e *env) (any, error) { return e.row[i], nil }
+}
+
+func (s *scope) ident(n *expr.Ident) (evalFn, error) {
+	if len(n.Parts) == 1 {
+		name := n.Parts[0]
+		if p, ok := s.params[name]; ok {
+			return p, nil
+		}
+		i, err := s.schema.lookup(n.Parts)
+		if err != nil {
+			return nil, errorAt(n, err)
+		}
+		if i >= 0 {
+			return s.column(i), nil
+		}
+		if decl, ok := s.en.exprs[name]; ok {
+			return s.declared(n, name, decl)
+		}
+		return nil, errorAt(n, s.schema.unknown(name))
+	}
+
+	// Imported declarations are named <namespace>.<name>.
+	if decl, ok := s.en.exprs[n.Name()]; ok {
+		return s.declared(n, n.Name(), decl)
+	}
+	last := len(n.Parts) - 1
+	if tuple, ok := s.en.tuples[strings.Join(n.Parts[:last], ".")]; ok {
+		name := strings.Join(n.Parts[:last], ".")
+		if v, ok := tuple[n.Parts[last]]; ok {
+			return s.node(v)
+		}
+		return nil, errorAt(n, fmt.Errorf("%s has no field %s", name, n.Parts[last]))
+	}
+	rel, rest := n.Parts[0], n.Parts[1:]
+	for _, imp := range s.en.q.Import {
+		if imp.Namespace() == rel {
+			return nil, errorAt(n, fmt.Errorf("%s declares no %s", imp.Path, strings.Join(rest, ".")))
+		}
+	}
+	i, err := s.schema.lookup(n.Parts)
+	if err != nil {
+		return nil, errorAt(n, err)
+	}
+	if i < 0 {
+		return nil, errorAt(n, s.schema.unknown(n.Name()))
+	}
+	return s.column(i), nil
+}
+
+// declared compiles the declared expression decl where n refers to it.
+func (s *scope) declared(n *expr.Ident, name string, decl expr.Node) (evalFn, error) {
+	if s.expanding[name] {
+		return nil, errorAt(n, fmt.Errorf("%s is declared in terms of itself", name))
+	}
+	s.expanding[name] = true
+	defer delete(s.expanding, name)
+	return s.node(decl)
+}
+
+func (s *scope) date(n *expr.Date) (evalFn, error) {
+	if !strings.Contains(n.Text, "-") {
+		return nil, errorAt(n, fmt.Errorf("time literals such as @%s cannot run without a database; write a timestamp", n.Text))
+	}
+	t, ok := parseTime(n.Text)
+	if !ok {
+		return nil, errorAt(n, fmt.Errorf("invalid date @%s", n.Text))
+	}
+	return constant(t), nil
+}
+
+func (s *scope) param(n *expr.Param) (evalFn, error) {
+	p := s.en.q.Params.Lookup(n.Name)
+	if p == nil {
+		return nil, errorAt(n, fmt.Errorf("unknown parameter $%s; declare it in params", n.Name))
+	}
+	v, ok := s.en.opts.Params[p.Name]
+	if !ok {
+		return nil, errorAt(n, fmt.Errorf("missing value for parameter %s; set it with --param %s=…", p.Name, p.Name))
+	}
+	if text, ok := v.(string); ok && (p.Type == duql.ParamDate || p.Type == duql.ParamTimestamp) {
+		if t, ok := parseTime(text); ok {
+			v = t
+		}
+	}
+	return constant(v), nil
+}
+
+// compile compiles each node.
+func (s *scope) compile(nodes []expr.Node) ([]evalFn, error) {
+	fns := make([]evalFn, len(nodes))
+	for i, n := range nodes {
+		fn, err := s.node(n)
+		if err != nil {
+			return nil, err
+		}
+		fns[i] = fn
+	}
+	return fns, nil
+}
+
+// fstring joins its parts as text; like ||, a NULL part makes it NULL.
+func (s *scope) fstring(n *expr.FString) (evalFn, error) {
+	parts, err := s.compile(n.Parts)
+	if err != nil {
+		return nil, err
+	}
+	return func(e *env) (any, error) {
+		var b strings.Builder
+		for _, p := range parts {
+			v, err := p(e)
+			if err != nil || v == nil {
+				return nil, err
+			}
+			b.WriteString(text(v))
+		}
+		return b.String(), nil
+	}, nil
+}
+
+func (s *scope) unary(n *expr.Unary) (evalFn, error) {
+	if n.Op == "==" {
+		return nil, errorAt(n, fmt.Errorf("==%s can only be used as a join condition", exprName(n.X)))
+	}
+	x, err := s.node(n.X)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case "-":
+		return func(e *env) (any, error) {
+			v, err := x(e)
+			if err != nil {
+				return nil, err
+			}
+			switch v := v.(type) {
+			case nil:
+				return nil, nil
+			case int64:
+				return -v, nil
+			case float64:
+				return -v, nil
+			case interval:
+				return interval{-v.months, -v.days, -v.d}, nil
+			}
+			return nil, errorAt(n, fmt.Errorf("cannot negate %s", typeName(v)))
+		}, nil
+	case "!":
+		return func(e *env) (any, error) {
+			v, err := x(e)
+			if err != nil {
+				return nil, err
+			}
+			b, known, err := truth(v)
+			if err != nil {
+				return nil, errorAt(n, err)
+			}
+			if !known {
+				return nil, nil
+			}
+			return !b, nil
+		}, nil
+	}
+	return nil, errorAt(n, fmt.Errorf("unsupported operator %s", n.Op))
+}
+
+func exprName(n expr.Node) string {
+	if id, ok := n.(*expr.Ident); ok {
+		return id.Name()
+	}
+	return "…"
+}
+
+func (s *scope) binary(n *expr.Binary) (evalFn, error) {
+	switch n.Op {
+	case "in", "between":
+		return s.in(n)
+	case "==", "!=":
+		if _, ok := n.Y.(*expr.Null); ok {
+			return s.isNull(n.X, n.Op == "!=")
+		}
+		if _, ok := n.X.(*expr.Null); ok {
+			return s.isNull(n.Y, n.Op == "!=")
+		}
+	}
+	if call, ok := s.rankBy(n); ok {
+		return s.call(call)
+	}
+	if parts := expr.Concat(n); parts != nil {
+		return s.fstring(&expr.FString{Parts: parts, At: n.At})
+	}
+
+	x, err := s.node(n.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := s.node(n.Y)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case "&&", "||":
+		return logical(n, x, y), nil
+	case "??":
+		return func(e *env) (any, error) {
+			v, err := x(e)
+			if err != nil || v != nil {
+				return v, err
+			}
+			return y(e)
+		}, nil
+	case "~=":
+		return s.match(n, x, y), nil
+	}
+	op, ok := binaryOps[n.Op]
+	if !ok {
+		return nil, errorAt(n, fmt.Errorf("unsupported operator %s", n.Op))
+	}
+	return func(e *env) (any, error) {
+		a, err := x(e)
+		if err != nil {
+			return nil, err
+		}
+		b, err := y(e)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil || b == nil {
+			return nil, nil
+		}
+		v, err := op(a, b)
+		if err != nil {
+			return nil, errorAt(n, err)
+		}
+		return v, nil
+	}, nil
+}
+
+// logical evaluates && and || with the three-valued logic of SQL, where
+// NULL is unknown.
+func logical(n *expr.Binary, x, y evalFn) evalFn {
+	and := n.Op == "&&"
+	return func(e *env) (any, error) {
+		a, err := x(e)
+		if err != nil {
+			return nil, err
+		}
+		av, aKnown, err := truth(a)
+		if err != nil {
+			return nil, errorAt(n, err)
+		}
+		if aKnown && av != and {
+			// false && y and true || y whatever y is.
+			return av, nil
+		}
+		b, err := y(e)
+		if err != nil {
+			return nil, err
+		}
+		bv, bKnown, err := truth(b)
+		if err != nil {
+			return nil, errorAt(n, err)
+		}
+		switch {
+		case bKnown && bv != and:
+			return bv, nil
+		case aKnown && bKnown:
+			return and, nil
+		}
+		return nil, nil
+	}
+}
+
+var binaryOps = map[string]func(a, b any) (any, error){
+	"==": comparison(func(c int) bool { return c == 0 }),
+	"!=": comparison(func(c int) bool { return c != 0 }),
+	"<":  comparison(func(c int) bool { return c < 0 }),
+	"<=": comparison(func(c int) bool { return c <= 0 }),
+	">":  comparison(func(c int) bool { return c > 0 }),
+	">=": comparison(func(c int) bool { return c >= 0 }),
+	"+":  func(a, b any) (any, error) { return arithmetic("+", a, b) },
+	"-":  func(a, b any) (any, error) { return arithmetic("-", a, b) },
+	"*":  func(a, b any) (any, error) { return arithmetic("*", a, b) },
+	"/":  func(a, b any) (any, error) { return arithmetic("/", a, b) },
+	"%":  func(a, b any) (any, error) { return arithmetic("%", a, b) },
+	"//": func(a, b any) (any, error) { return arithmetic("//", a, b) },
+	"^":  func(a, b any) (any, error) { return arithmetic("^", a, b) },
+}
+
+func comparison(holds func(int) bool) func(a, b any) (any, error) {
+	return func(a, b any) (any, error) {
+		return holds(compare(a, b)), nil
+	}
+}
+
+// arithmetic applies an arithmetic operator to two non-NULL values.
+// Integers stay integers except under / and ^; dividing by zero gives
+// NULL. Intervals can be added to and subtracted from times.
+func arithmetic(op string, a, b any) (any, error) {
+	a, b = coerce(a, b)
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			case "%":
+				if y == 0 {
+					return nil, nil
+				}
+				return x % y, nil
+			case "//":
+				if y == 0 {
+					return nil, nil
+				}
+				q := x / y
+				if (x%y != 0) && ((x < 0) != (y < 0)) {
+					q--
+				}
+				return q, nil
+			}
+		}
+	}
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch op {
+			case "+":
+				return x + y, nil
+			case "-":
+				return x - y, nil
+			case "*":
+				return x * y, nil
+			case "/":
+				if y == 0 {
+					return nil, nil
+				}
+				return x / y, nil
+			case "%":
+				if y == 0 {
+					return nil, nil
+				}
+				return math.Mod(x, y), nil
+			case "//":
+				if y == 0 {
+					return nil, nil
+				}
+				return math.Floor(x / y), nil
+			case "^":
+				return math.Pow(x, y), nil
+			}
+		}
+	}
+	switch x := a.(type) {
+	case time.Time:
+		switch y := b.(type) {
+		case interval:
+			switch op {
+			case "+":
+				return y.add(x, 1), nil
+			case "-":
+				return y.add(x, -1), nil
+			}
+		case time.Time:
+			if op == "-" {
+				return interval{d: x.Sub(y)}, nil
+			}
+		}
+	case interval:
+		switch y := b.(type) {
+		case time.Time:
+			if op == "+" {
+				return x.add(y, 1), nil
+			}
+		case interval:
+			switch op {
+			case "+":
+				return interval{x.months + y.months, x.days + y.days, x.d + y.d}, nil
+			case "-":
+				return interval{x.months - y.months, x.days - y.days, x.d - y.d}, nil
+			}
+		}
+	}
+	if _, ok := a.(string); ok && op == "+" {
+		return nil, fmt.Errorf("cannot add text; join text with an f-string such as f\"{a}{b}\"")
+	}
+	return nil, fmt.Errorf("cannot apply %s to %s and %s", op, typeName(a), typeName(b))
+}
+
+// match evaluates `x ~= pattern`, compiling each pattern once.
+func (s *scope) match(n *expr.Binary, x, y evalFn) evalFn {
+	patterns := make(map[string]*regexp.Regexp)
+	return func(e *env) (any, error) {
+		a, err := x(e)
+		if err != nil {
+			return nil, err
+		}
+		b, err := y(e)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil || b == nil {
+			return nil, nil
+		}
+		pattern := text(b)
+		re, ok := patterns[pattern]
+		if !ok {
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, errorAt(n, err)
+			}
+			patterns[pattern] = re
+		}
+		return re.MatchString(text(a)), nil
+	}
+}
+
+func (s *scope) isNull(x expr.Node, not bool) (evalFn, error) {
+	fn, err := s.node(x)
+	if err != nil {
+		return nil, err
+	}
+	return func(e *env) (any, error) {
+		v, err := fn(e)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != not, nil
+	}, nil
+}
+
+// in evaluates `x in [a, b]` and `x in a..b`.
+func (s *scope) in(n *expr.Binary) (evalFn, error) {
+	x, err := s.node(n.X)
+	if err != nil {
+		return nil, err
+	}
+	switch y := n.Y.(type) {
+	case *expr.Array:
+		items, err := s.compile(y.Items)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) (any, error) {
+			v, err := x(e)
+			if err != nil || v == nil {
+				return nil, err
+			}
+			unknown := false
+			for _, item := range items {
+				w, err := item(e)
+				if err != nil {
+					return nil, err
+				}
+				if w == nil {
+					unknown = true
+				} else if compare(v, w) == 0 {
+					return true, nil
+				}
+			}
+			if unknown {
+				return nil, nil
+			}
+			return false, nil
+		}, nil
+	case *expr.Range:
+		var bounds [2]evalFn
+		for i, b := range []expr.Node{y.Start, y.End} {
+			if b == nil {
+				continue
+			}
+			if bounds[i], err = s.node(b); err != nil {
+				return nil, err
+			}
+		}
+		return func(e *env) (any, error) {
+			v, err := x(e)
+			if err != nil || v == nil {
+				return nil, err
+			}
+			for i, bound := range bounds {
+				if bound == nil {
+					continue
+				}
+				b, err := bound(e)
+				if err != nil || b == nil {
+					return nil, err
+				}
+				if c := compare(v, b); i == 0 && c < 0 || i == 1 && c > 0 {
+					return false, nil
+				}
+			}
+			return true, nil
+		}, nil
+	}
+	return nil, errorAt(n.Y, fmt.Errorf("%s expects a list or a range", n.Op))
+}
+
+func (s *scope) caseExpr(n *expr.Case) (evalFn, error) {
+	type branch struct{ cond, value evalFn }
+	var branches []branch
+	for _, w := range n.Whens {
+		cond, err := s.node(w.Cond)
+		if err != nil {
+			return nil, err
+		}
+		value, err := s.node(w.Value)
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, branch{cond, value})
+	}
+	els := constant(nil)
+	if n.Else != nil {
+		var err error
+		if els, err = s.node(n.Else); err != nil {
+			return nil, err
+		}
+	}
+	return func(e *env) (any, error) {
+		for _, b := range branches {
+			v, err := b.cond(e)
+			if err != nil {
+				return nil, err
+			}
+			holds, _, err := truth(v)
+			if err != nil {
+				return nil, errorAt(n, err)
+			}
+			if holds {
+				return b.value(e)
+			}
+		}
+		return els(e)
+	}, nil
+}
+
+// lambda expands a declared function, binding positional arguments to the
+// parameters without defaults and named arguments by name.
+func (s *scope) lambda(n *expr.Call, fn *expr.Lambda) (evalFn, error) {
+	if s.expanding[n.Name] {
+		return nil, errorAt(n, fmt.Errorf("%s is declared in terms of itself", n.Name))
+	}
+
+	params := make(map[string]evalFn)
+	var positional []string
+	defaults := make(map[string]expr.Node)
+	for _, p := range fn.Params {
+		if p.Default != nil {
+			defaults[p.Name] = p.Default
+		} else {
+			positional = append(positional, p.Name)
+		}
+	}
+
+	bind := func(name string, arg expr.Node) error {
+		f, err := s.node(arg)
+		if err != nil {
+			return err
+		}
+		params[name] = f
+		return nil
+	}
+
+	i := 0
+	for _, a := range n.Args {
+		if named, ok := a.(*expr.NamedArg); ok {
+			if _, ok := defaults[named.Name]; !ok {
+				return nil, errorAt(a, fmt.Errorf("%s has no parameter %s with a default", n.Name, named.Name))
+			}
+			if err := bind(named.Name, named.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if i >= len(positional) {
+			return nil, errorAt(n, fmt.Errorf("%s expects %d arguments, got %d", n.Name, len(positional), i+1))
+		}
+		if err := bind(positional[i], a); err != nil {
+			return nil, err
+		}
+		i++
+	}
+	if i < len(positional) {
+		return nil, errorAt(n, fmt.Errorf("%s expects %d arguments, got %d", n.Name, len(positional), i))
+	}
+	for name, d := range defaults {
+		if _, ok := params[name]; !ok {
+			if err := bind(name, d); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	body := *s
+	body.params = params
+	s.expanding[n.Name] = true
+	defer delete(s.expanding, n.Name)
+	f, err := body.node(fn.Body)
+	s.window = s.window || body.window
+	return f, err
+}
@@ -0,0 +1,293 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/theduql/duql/internal/expr"
+)
+
+type funcKind int
+
+const (
+	scalarFunc funcKind = iota
+	aggregateFunc
+	windowFunc
+)
+
+// function is a standard library function. Arguments come in the order
+// they are written in DUQL, so a piped value is the last one; NULL
+// arguments give NULL unless nulls is set.
+type function struct {
+	kind  funcKind
+	arity int
+	nulls bool
+	eval  func(en *engine, args []any) (any, error)
+}
+
+// stdlib holds the functions of the compiler's standard library that run
+// without a database. Aggregates and window functions are computed by
+// aggregate and windowCall.
+var stdlib = map[string]*function{
+	"sum":            {kind: aggregateFunc, arity: 1},
+	"avg":            {kind: aggregateFunc, arity: 1},
+	"average":        {kind: aggregateFunc, arity: 1},
+	"min":            {kind: aggregateFunc, arity: 1},
+	"max":            {kind: aggregateFunc, arity: 1},
+	"count":          {kind: aggregateFunc, arity: 1},
+	"count_distinct": {kind: aggregateFunc, arity: 1},
+	"stddev":         {kind: aggregateFunc, arity: 1},
+	"median":         {kind: aggregateFunc, arity: 1},
+	"any":            {kind: aggregateFunc, arity: 1},
+	"every":          {kind: aggregateFunc, arity: 1},
+
+	"row_number":   {kind: windowFunc},
+	"rank":         {kind: windowFunc},
+	"dense_rank":   {kind: windowFunc},
+	"percent_rank": {kind: windowFunc},
+	"cume_dist":    {kind: windowFunc},
+	"lag":          {kind: windowFunc, arity: 1},
+	"lead":         {kind: windowFunc, arity: 1},
+	"first":        {kind: windowFunc, arity: 1},
+	"last":         {kind: windowFunc, arity: 1},
+
+	"coalesce": {arity: -1, nulls: true, eval: func(_ *engine, args []any) (any, error) {
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	}},
+	"is_null": {arity: 1, nulls: true, eval: func(_ *engine, args []any) (any, error) {
+		return args[0] == nil, nil
+	}},
+	"current_date": {eval: func(en *engine, _ []any) (any, error) {
+		y, m, d := en.now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+	}},
+	"current_timestamp": {eval: func(en *engine, _ []any) (any, error) { return en.now, nil }},
+	"now":               {eval: func(en *engine, _ []any) (any, error) { return en.now, nil }},
+	"lower":             textFunc(strings.ToLower),
+	"upper":             textFunc(strings.ToUpper),
+	"year":              datePart(func(t time.Time) int { return t.Year() }),
+	"month":             datePart(func(t time.Time) int { return int(t.Month()) }),
+	"day":               datePart(func(t time.Time) int { return t.Day() }),
+
+	"text.lower": textFunc(strings.ToLower),
+	"text.upper": textFunc(strings.ToUpper),
+	"text.trim":  textFunc(strings.TrimSpace),
+	"text.ltrim": textFunc(func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) }),
+	"text.rtrim": textFunc(func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) }),
+	"text.length": {arity: 1, eval: func(_ *engine, args []any) (any, error) {
+		return int64(utf8.RuneCountInString(text(args[0]))), nil
+	}},
+	"text.starts_with": {arity: 2, eval: func(_ *engine, args []any) (any, error) {
+		return strings.HasPrefix(text(args[1]), text(args[0])), nil
+	}},
+	"text.ends_with": {arity: 2, eval: func(_ *engine, args []any) (any, error) {
+		return strings.HasSuffix(text(args[1]), text(args[0])), nil
+	}},
+	"text.contains": {arity: 2, eval: func(_ *engine, args []any) (any, error) {
+		return strings.Contains(text(args[1]), text(args[0])), nil
+	}},
+	"text.equals": {arity: 2, eval: func(_ *engine, args []any) (any, error) {
+		return text(args[1]) == text(args[0]), nil
+	}},
+	"text.replace": {arity: 3, eval: func(_ *engine, args []any) (any, error) {
+		return strings.ReplaceAll(text(args[2]), text(args[0]), text(args[1])), nil
+	}},
+	"text.extract": {arity: 3, eval: func(_ *engine, args []any) (any, error) {
+		start, ok1 := args[0].(int64)
+		length, ok2 := args[1].(int64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("text.extract expects an integer start and length")
+		}
+		// Like SUBSTRING, positions count characters from 1.
+		runes := []rune(text(args[2]))
+		from, to := start-1, start-1+length
+		from = max(from, 0)
+		to = min(to, int64(len(runes)))
+		if from >= to {
+			return "", nil
+		}
+		return string(runes[from:to]), nil
+	}},
+
+	"math.abs":   mathFunc(math.Abs),
+	"math.floor": mathFunc(math.Floor),
+	"math.ceil":  mathFunc(math.Ceil),
+	"math.sqrt":  mathFunc(math.Sqrt),
+	"math.exp":   mathFunc(math.Exp),
+	"math.ln":    mathFunc(math.Log),
+	"math.log10": mathFunc(math.Log10),
+	"math.round": {arity: 2, eval: func(_ *engine, args []any) (any, error) {
+		digits, ok := args[0].(int64)
+		x, isNumber := number(args[1])
+		if !ok || !isNumber {
+			return nil, fmt.Errorf("math.round expects a number of digits and a number")
+		}
+		scale := math.Pow(10, float64(digits))
+		return math.Round(x*scale) / scale, nil
+	}},
+	"math.pow": {arity: 2, eval: func(_ *engine, args []any) (any, error) {
+		return arithmetic("^", args[1], args[0])
+	}},
+	"math.pi": {eval: func(*engine, []any) (any, error) { return math.Pi, nil }},
+
+	"date.year":  datePart(func(t time.Time) int { return t.Year() }),
+	"date.month": datePart(func(t time.Time) int { return int(t.Month()) }),
+	"date.day":   datePart(func(t time.Time) int { return t.Day() }),
+	"date.to_text": {arity: 2, eval: func(_ *engine, args []any) (any, error) {
+		t, err := timeArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return strftime(text(args[0]), t), nil
+	}},
+}
+
+func textFunc(fn func(string) string) *function {
+	return &function{arity: 1, eval: func(_ *engine, args []any) (any, error) {
+		return fn(text(args[0])), nil
+	}}
+}
+
+func mathFunc(fn func(float64) float64) *function {
+	return &function{arity: 1, eval: func(_ *engine, args []any) (any, error) {
+		x, ok := number(args[0])
+		if !ok {
+			return nil, fmt.Errorf("expected a number, got %s", typeName(args[0]))
+		}
+		return fn(x), nil
+	}}
+}
+
+func datePart(fn func(time.Time) int) *function {
+	return &function{arity: 1, eval: func(_ *engine, args []any) (any, error) {
+		t, err := timeArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return int64(fn(t)), nil
+	}}
+}
+
+// timeArg reads a date or timestamp argument, given as a time or as text.
+func timeArg(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		if t, ok := parseTime(v); ok {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expected a date or timestamp, got %s", typeName(v))
+}
+
+// strftime formats t with the % directives of strftime.
+func strftime(format string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'B':
+			b.WriteString(t.Month().String())
+		case 'b':
+			b.WriteString(t.Month().String()[:3])
+		case 'A':
+			b.WriteString(t.Weekday().String())
+		case 'a':
+			b.WriteString(t.Weekday().String()[:3])
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+func (s *scope) call(n *expr.Call) (evalFn, error) {
+	if fn, ok := s.en.funcs[n.Name]; ok {
+		return s.lambda(n, fn)
+	}
+	fn, ok := stdlib[n.Name]
+	if !ok {
+		if strings.Contains(n.Name, ".") {
+			return nil, errorAt(n, fmt.Errorf("unknown function %s", n.Name))
+		}
+		return nil, errorAt(n, fmt.Errorf("%s is not a DUQL function, so only a database can run it; %s", n.Name, errDatabase))
+	}
+	if fn.kind != scalarFunc {
+		return s.windowCall(n, fn)
+	}
+	if fn.arity >= 0 && len(n.Args) != fn.arity {
+		return nil, errorAt(n, fmt.Errorf("%s expects %d arguments, got %d", n.Name, fn.arity, len(n.Args)))
+	}
+	args, err := s.compile(n.Args)
+	if err != nil {
+		return nil, err
+	}
+	return func(e *env) (any, error) {
+		values := make([]any, len(args))
+		for i, a := range args {
+			v, err := a(e)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil && !fn.nulls {
+				return nil, nil
+			}
+			values[i] = v
+		}
+		v, err := fn.eval(s.en, values)
+		if err != nil {
+			return nil, errorAt(n, fmt.Errorf("%s: %w", n.Name, err))
+		}
+		return v, nil
+	}, nil
+}
+
+// rankBy reads `rank -amount` as ranking by amount descending rather than
+// as a subtraction, when rank is a ranking function and not a column.
+func (s *scope) rankBy(n *expr.Binary) (*expr.Call, bool) {
+	id, ok := n.X.(*expr.Ident)
+	if !ok || n.Op != "-" || len(id.Parts) != 1 {
+		return nil, false
+	}
+	name := id.Parts[0]
+	fn, ok := stdlib[name]
+	if !ok || fn.kind != windowFunc || fn.arity != 0 || s.params[name] != nil {
+		return nil, false
+	}
+	if i, _ := s.schema.lookup(id.Parts); i >= 0 {
+		return nil, false
+	}
+	arg := &expr.Unary{Op: "-", X: n.Y, At: n.At}
+	return &expr.Call{Name: name, Args: []expr.Node{arg}, At: id.At}, true
+}
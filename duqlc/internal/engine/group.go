@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+
+	duql "github.com/theduql/duql/internal/duql"
+)
+
+// group runs the steps of a group step on each group. Rows are sorted by
+// their keys, spilling to disk when they outgrow memory, and the groups
+// are then read one at a time. A summarize as the first step folds the
+// rows of a group as they are read instead of holding them.
+func (en *engine) group(rel *relation, g *duql.Group, path string) (*relation, error) {
+	var cols []column
+	var keys []sortKey
+	var sorted []duql.SortColumn
+	for _, by := range g.By {
+		sc := en.scope(rel.schema)
+		s, op, err := selectOp(sc, []duql.NamedExpression{{Name: duql.KeyName(by), Expression: duql.Expression{Value: by}}})
+		if err == nil && sc.window {
+			err = fmt.Errorf("window functions cannot be group keys")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid group key %s: %w", by, err)
+		}
+		col := s.cols[0]
+		// Groups come out in the direction of an earlier sort by the key.
+		desc := false
+		for _, item := range rel.sorted {
+			if item.Name == col.name || item.Expression.Value == any(col.name) {
+				desc = item.Descending
+			}
+		}
+		cols = append(cols, col)
+		keys = append(keys, sortKey{desc: desc, fn: func(e *env) (any, error) {
+			row, _, err := op(e)
+			if err != nil {
+				return nil, err
+			}
+			return row[0], nil
+		}})
+		sorted = append(sorted, duql.SortColumn{Expression: duql.Expression{Value: col.name}, Descending: desc})
+	}
+
+	gr := &grouper{keys: keys}
+	s := rel.schema
+	if len(g.Steps) == 0 {
+		// A group without steps lists its keys.
+		var err error
+		if s, gr.fold, err = en.summary(s, nil, cols); err != nil {
+			return nil, err
+		}
+	}
+	o := &over{}
+	var stages []stage
+	for i, step := range g.Steps {
+		p := fmt.Sprintf("%s.steps[%d].%s", path, i, step.Type())
+		var st stage
+		var err error
+		switch step := step.(type) {
+		case *duql.Summarize:
+			var sum *summary
+			if s, sum, err = en.summary(s, step.Aggregations, cols); err == nil {
+				if i == 0 {
+					gr.fold = sum
+				} else {
+					st = summarizeStage(sum)
+				}
+			}
+		case *duql.Sort:
+			o.order, err = en.sortKeys(s, step.Columns)
+		case *duql.Take:
+			st, err = takeStage(step, o.order)
+		case *duql.Filter:
+			sc := en.scope(s)
+			sc.over = o
+			var op rowOp
+			if op, err = filterOp(sc, step.Expression); err == nil {
+				st = applyStage(op)
+			}
+		case *duql.Generate:
+			st, s, err = en.generateStage(s, step.Expressions, o)
+		case *duql.Select:
+			st, s, err = en.selectStage(s, step.Columns, o)
+		case *duql.Window:
+			st, s, err = en.windowStage(s, step, p)
+		default:
+			err = fmt.Errorf("%s steps are not supported inside group", step.Type())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if st != nil {
+			stages = append(stages, st)
+		}
+	}
+	gr.stage = chain(stages)
+	gr.rows = en.sorted(rel.rows, keys)
+	return &relation{schema: s, rows: gr, sorted: sorted}, nil
+}
+
+// summarizeStage aggregates a group into one row. Unlike a summarize of
+// every row, a group left empty by a filter gives no row.
+func summarizeStage(sum *summary) stage {
+	return func(p *partition) error {
+		if len(p.rows) == 0 {
+			return nil
+		}
+		f := sum.folder()
+		for i, row := range p.rows {
+			if err := f.add(&env{row: row, part: p, i: i}); err != nil {
+				return err
+			}
+		}
+		row, err := sum.row(p.keys, p.rows[0], f)
+		if err != nil {
+			return err
+		}
+		p.set([][]any{row})
+		return nil
+	}
+}
+
+// takeStage keeps a range of the rows of each group, in the order of the
+// sort before it.
+func takeStage(t *duql.Take, order []sortKey) (stage, error) {
+	offset, limit, err := t.Bounds()
+	if err != nil {
+		return nil, err
+	}
+	return func(p *partition) error {
+		if err := p.sort(order); err != nil {
+			return err
+		}
+		rows := p.rows[min(offset, len(p.rows)):]
+		if limit >= 0 && limit < len(rows) {
+			rows = rows[:limit]
+		}
+		p.set(rows)
+		return nil
+	}, nil
+}
+
+// grouper yields the rows of each group of rows sorted by their keys after
+// the steps of the group.
+type grouper struct {
+	rows  iterator
+	keys  []sortKey
+	fold  *summary
+	stage stage
+
+	// row is the first row of the next group and values its keys; row is
+	// nil once every row is read.
+	row, values []any
+	started     bool
+	out         sliceIterator
+}
+
+func (g *grouper) next() ([]any, error) {
+	for {
+		if row, err := g.out.next(); err != io.EOF {
+			return row, err
+		}
+		p, err := g.group()
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, io.EOF
+		}
+		if err := g.stage(p); err != nil {
+			return nil, err
+		}
+		g.out = sliceIterator{rows: p.rows}
+	}
+}
+
+func (g *grouper) close() error {
+	g.out = sliceIterator{}
+	return g.rows.close()
+}
+
+// read reads the next row and its keys.
+func (g *grouper) read() error {
+	row, err := g.rows.next()
+	if err == io.EOF {
+		g.row, g.values = nil, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	values, err := evalKeys(g.keys, &env{row: row})
+	if err != nil {
+		return err
+	}
+	g.row, g.values = row, values
+	return nil
+}
+
+// group reads the next group, returning nil after the last.
+func (g *grouper) group() (*partition, error) {
+	if !g.started {
+		g.started = true
+		if err := g.read(); err != nil {
+			return nil, err
+		}
+	}
+	if g.row == nil {
+		return nil, nil
+	}
+	keys, first := g.values, g.row
+	var f *folder
+	if g.fold != nil {
+		f = g.fold.folder()
+	}
+	var rows [][]any
+	for g.row != nil && compareKeys(g.values, keys, g.keys) == 0 {
+		if f != nil {
+			if err := f.add(&env{row: g.row}); err != nil {
+				return nil, err
+			}
+		} else {
+			rows = append(rows, g.row)
+		}
+		if err := g.read(); err != nil {
+			return nil, err
+		}
+	}
+	if f != nil {
+		row, err := g.fold.row(keys, first, f)
+		if err != nil {
+			return nil, err
+		}
+		rows = [][]any{row}
+	}
+	p := newPartition(rows)
+	p.keys = keys
+	return p, nil
+}
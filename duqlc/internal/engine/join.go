@@ -0,0 +1,247 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// join joins the rows of another dataset, which are held in memory, to
+// the rows of the relation as they stream. Conditions that compare
+// columns of both sides with == look the matching rows up by those
+// columns; other conditions are tried on every pair of rows.
+func (en *engine) join(rel *relation, j *duql.Join) (*relation, error) {
+	switch j.Retain {
+	case duql.Inner, duql.Left, duql.Right, duql.Full:
+	default:
+		return nil, fmt.Errorf("unknown join type %s", j.Retain)
+	}
+	n, err := expr.FromDUQL(j.Where)
+	if err != nil {
+		return nil, err
+	}
+	right, err := en.dataset(j.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	name := right.schema.primary
+	if rel.schema.hasRel(name) {
+		right.rows.close()
+		return nil, fmt.Errorf("%s is already part of the query; declare it under another name to join it again", name)
+	}
+	rows, err := collect(right.rows)
+	if cerr := right.rows.close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	left := rel.schema
+	s := left.derive()
+	s.rels = append(append([]string(nil), left.rels...), name)
+	s.cols = append(append(s.cols, left.cols...), right.schema.cols...)
+	width := len(left.cols)
+
+	jn := &joiner{left: rel.rows, right: rows, width: width, rightWidth: len(right.schema.cols), retain: j.Retain}
+	if u, ok := n.(*expr.Unary); ok && u.Op == "==" {
+		// `==id` compares the column of the same name on both sides.
+		id, ok := u.X.(*expr.Ident)
+		if !ok || len(id.Parts) != 1 {
+			return nil, fmt.Errorf("== must be followed by a column name")
+		}
+		l, err := left.lookup([]string{left.primary, id.Parts[0]})
+		if err == nil && l < 0 {
+			l, err = left.lookup(id.Parts)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if l < 0 {
+			return nil, left.unknown(id.Parts[0])
+		}
+		r, err := right.schema.lookup(id.Parts)
+		if err != nil {
+			return nil, err
+		}
+		if r < 0 {
+			return nil, right.schema.unknown(id.Parts[0])
+		}
+		jn.leftKeys, jn.rightKeys = []int{l}, []int{r}
+		jn.cond = func(e *env) (any, error) {
+			return binaryOps["=="](e.row[l], e.row[width+r])
+		}
+	} else {
+		sc := en.scope(s)
+		if jn.cond, err = sc.node(n); err != nil {
+			return nil, err
+		}
+		if sc.window {
+			return nil, fmt.Errorf("join conditions cannot use aggregates or window functions")
+		}
+		jn.equalities(sc, n)
+	}
+	jn.index()
+	return &relation{schema: s, rows: jn, sorted: rel.sorted}, nil
+}
+
+// joiner yields the joined rows for each row of the left side, then the
+// unmatched rows of the right side for right and full joins.
+type joiner struct {
+	left              iterator
+	right             [][]any
+	width, rightWidth int
+	retain            duql.JoinType
+	cond              evalFn
+
+	// leftKeys and rightKeys are the columns compared with == on each
+	// side, and lookup the right rows by the values of rightKeys.
+	leftKeys, rightKeys []int
+	lookup              map[string][]int
+
+	matched []bool
+	out     [][]any
+	done    bool
+	b       strings.Builder
+}
+
+// equalities finds the columns of both sides compared with == in the
+// conjuncts of the condition.
+func (j *joiner) equalities(sc *scope, n expr.Node) {
+	b, ok := n.(*expr.Binary)
+	if !ok {
+		return
+	}
+	if b.Op == "&&" {
+		j.equalities(sc, b.X)
+		j.equalities(sc, b.Y)
+		return
+	}
+	if b.Op != "==" {
+		return
+	}
+	x, y := j.side(sc, b.X), j.side(sc, b.Y)
+	if x > y {
+		x, y = y, x
+	}
+	if x >= 0 && x < j.width && y >= j.width {
+		j.leftKeys = append(j.leftKeys, x)
+		j.rightKeys = append(j.rightKeys, y-j.width)
+	}
+}
+
+// side returns the column of a plain column reference, or -1.
+func (j *joiner) side(sc *scope, n expr.Node) int {
+	id, ok := n.(*expr.Ident)
+	if !ok || sc.en.exprs[id.Name()] != nil {
+		return -1
+	}
+	i, err := sc.schema.lookup(id.Parts)
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+func (j *joiner) index() {
+	j.matched = make([]bool, len(j.right))
+	if len(j.rightKeys) == 0 {
+		return
+	}
+	j.lookup = make(map[string][]int)
+	for i, row := range j.right {
+		if k, ok := j.key(row, j.rightKeys); ok {
+			j.lookup[k] = append(j.lookup[k], i)
+		}
+	}
+}
+
+// key writes the values of cols, reporting false when one is NULL, as
+// NULL equals nothing.
+func (j *joiner) key(row []any, cols []int) (string, bool) {
+	j.b.Reset()
+	for _, c := range cols {
+		if row[c] == nil {
+			return "", false
+		}
+		key(&j.b, row[c])
+	}
+	return j.b.String(), true
+}
+
+func (j *joiner) next() ([]any, error) {
+	for len(j.out) == 0 {
+		if j.done {
+			return nil, io.EOF
+		}
+		if err := j.read(); err != nil {
+			return nil, err
+		}
+	}
+	row := j.out[0]
+	j.out = j.out[1:]
+	return row, nil
+}
+
+// read joins the next row of the left side.
+func (j *joiner) read() error {
+	l, err := j.left.next()
+	if err == io.EOF {
+		j.done = true
+		if j.retain == duql.Right || j.retain == duql.Full {
+			for i, r := range j.right {
+				if !j.matched[i] {
+					j.out = append(j.out, append(make([]any, j.width), r...))
+				}
+			}
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	try := func(i int) error {
+		row := make([]any, 0, j.width+j.rightWidth)
+		row = append(append(row, l...), j.right[i]...)
+		v, err := j.cond(&env{row: row})
+		if err != nil {
+			return err
+		}
+		holds, _, err := truth(v)
+		if err != nil {
+			return fmt.Errorf("join: %w", err)
+		}
+		if holds {
+			j.out = append(j.out, row)
+			j.matched[i] = true
+		}
+		return nil
+	}
+	if j.lookup != nil {
+		if k, ok := j.key(l, j.leftKeys); ok {
+			for _, i := range j.lookup[k] {
+				if err := try(i); err != nil {
+					return err
+				}
+			}
+		}
+	} else {
+		for i := range j.right {
+			if err := try(i); err != nil {
+				return err
+			}
+		}
+	}
+	if len(j.out) == 0 && (j.retain == duql.Left || j.retain == duql.Full) {
+		j.out = append(j.out, append(l, make([]any, j.rightWidth)...))
+	}
+	return nil
+}
+
+func (j *joiner) close() error {
+	j.right, j.out = nil, nil
+	return j.left.close()
+}
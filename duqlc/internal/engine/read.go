@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// checkEvery is how many rows are read between checks that the run has
+// not been canceled.
+const checkEvery = 1024
+
+// readCSV reads a CSV file whose first record names the columns. Fields
+// are read as the values they spell, as infer does.
+func (en *engine) readCSV(path, name string) (*relation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bufio.NewReader(f))
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return &relation{schema: newSchema(name, nil), rows: &sliceIterator{}}, f.Close()
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	names := make([]string, len(header))
+	for i, h := range header {
+		if i == 0 {
+			h = strings.TrimPrefix(h, "\ufeff")
+		}
+		names[i] = strings.TrimSpace(h)
+	}
+	n := 0
+	it := &fileIterator{f: f, fn: func() ([]any, error) {
+		record, err := r.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if n++; n%checkEvery == 0 {
+			if err := en.ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		row := make([]any, len(record))
+		for i, field := range record {
+			row[i] = infer(field)
+		}
+		return row, nil
+	}}
+	return &relation{schema: newSchema(name, names), rows: it}, nil
+}
+
+// readJSON reads a file of JSON objects, one after another as in
+// newline-delimited JSON, or in an array. The file is read twice: first
+// for the keys of every object, which are the columns in the order they
+// first appear, and then for the rows.
+func (en *engine) readJSON(path, name string) (*relation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	cols := make(map[string]int)
+	r := newJSONReader(f)
+	for n := 1; ; n++ {
+		keys, _, err := r.object()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for _, k := range keys {
+			if _, ok := cols[k]; !ok {
+				cols[k] = len(names)
+				names = append(names, k)
+			}
+		}
+		if n%checkEvery == 0 {
+			if err := en.ctx.Err(); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	r = newJSONReader(f)
+	n := 0
+	it := &fileIterator{f: f, fn: func() ([]any, error) {
+		keys, values, err := r.object()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if n++; n%checkEvery == 0 {
+			if err := en.ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		row := make([]any, len(names))
+		for _, k := range keys {
+			v, err := jsonValue(values[k])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, k, err)
+			}
+			row[cols[k]] = v
+		}
+		return row, nil
+	}}
+	return &relation{schema: newSchema(name, names), rows: it}, nil
+}
+
+// jsonReader reads the objects of a JSON file one at a time.
+type jsonReader struct {
+	dec *json.Decoder
+	// started is set once the first token is read, and array when it
+	// opened an array; open is set when the brace of the next object is
+	// read already.
+	started, array, open bool
+}
+
+func newJSONReader(r io.Reader) *jsonReader {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber()
+	return &jsonReader{dec: dec}
+}
+
+// object reads the next object, returning its keys in order and its
+// values, or io.EOF after the last.
+func (r *jsonReader) object() ([]string, map[string]any, error) {
+	if !r.started {
+		r.started = true
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch tok {
+		case json.Delim('['):
+			r.array = true
+		case json.Delim('{'):
+			r.open = true
+		default:
+			return nil, nil, fmt.Errorf("expected JSON objects, got %v", tok)
+		}
+	}
+	if !r.open {
+		if r.array && !r.dec.More() {
+			return nil, nil, io.EOF
+		}
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		if tok != json.Delim('{') {
+			return nil, nil, fmt.Errorf("expected JSON objects, got %v", tok)
+		}
+	}
+	r.open = false
+	var keys []string
+	values := make(map[string]any)
+	for r.dec.More() {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, nil, unexpected(err)
+		}
+		k, _ := tok.(string)
+		var v any
+		if err := r.dec.Decode(&v); err != nil {
+			return nil, nil, unexpected(err)
+		}
+		if _, ok := values[k]; !ok {
+			keys = append(keys, k)
+		}
+		values[k] = v
+	}
+	if _, err := r.dec.Token(); err != nil {
+		return nil, nil, unexpected(err)
+	}
+	return keys, values, nil
+}
+
+// unexpected reports the end of the file inside an object as an error.
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// fileIterator yields the rows read from a file, closing it when closed.
+type fileIterator struct {
+	f  *os.File
+	fn func() ([]any, error)
+}
+
+func (it *fileIterator) next() ([]any, error) {
+	return it.fn()
+}
+
+func (it *fileIterator) close() error {
+	return it.f.Close()
+}
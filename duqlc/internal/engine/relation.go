@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	duql "github.com/theduql/duql/internal/duql"
+)
+
+// iterator yields rows one at a time, returning io.EOF after the last.
+type iterator interface {
+	next() ([]any, error)
+	close() error
+}
+
+// relation is the rows at some point of a pipeline.
+type relation struct {
+	schema *schema
+	rows   iterator
+	// sorted is the sort the rows are in, which window functions outside
+	// a window step are ordered by.
+	sorted []duql.SortColumn
+}
+
+// as names the relation, so that its columns are qualified with name.
+func (r *relation) as(name string) *relation {
+	s := &schema{primary: name, rels: []string{name}}
+	for _, c := range r.schema.cols {
+		s.cols = append(s.cols, column{rel: name, name: c.name})
+	}
+	return &relation{schema: s, rows: r.rows, sorted: r.sorted}
+}
+
+// column is a column of a relation and the dataset it can be qualified
+// with.
+type column struct {
+	rel, name string
+}
+
+// schema lists the columns of the rows of a relation.
+type schema struct {
+	cols []column
+	// primary is the dataset the pipeline started from, which computed
+	// columns are qualified with.
+	primary string
+	// rels are the datasets columns can be qualified with.
+	rels []string
+}
+
+func newSchema(name string, names []string) *schema {
+	s := &schema{primary: name, rels: []string{name}}
+	for _, n := range names {
+		s.cols = append(s.cols, column{rel: name, name: n})
+	}
+	return s
+}
+
+// derive returns an empty schema with the datasets of s.
+func (s *schema) derive() *schema {
+	return &schema{primary: s.primary, rels: s.rels}
+}
+
+func (s *schema) names() []string {
+	names := make([]string, len(s.cols))
+	for i, c := range s.cols {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (s *schema) hasRel(name string) bool {
+	for _, r := range s.rels {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup finds the column named by an identifier, plain or qualified with
+// a dataset, returning -1 when there is none.
+func (s *schema) lookup(parts []string) (int, error) {
+	var rel, name string
+	switch len(parts) {
+	case 1:
+		name = parts[0]
+	case 2:
+		rel, name = parts[0], parts[1]
+		if !s.hasRel(rel) {
+			return -1, nil
+		}
+	default:
+		return -1, nil
+	}
+	found := -1
+	for _, qualified := range []bool{true, false} {
+		if qualified && rel == "" {
+			continue
+		}
+		for i, c := range s.cols {
+			if c.name != name || qualified && c.rel != rel {
+				continue
+			}
+			if found >= 0 {
+				return -1, fmt.Errorf("column %s is ambiguous; qualify it as %s.%s or %s.%s", name, s.cols[found].rel, name, c.rel, name)
+			}
+			found = i
+		}
+		if found >= 0 {
+			break
+		}
+	}
+	return found, nil
+}
+
+// unknown is the error for a column that is not in the schema.
+func (s *schema) unknown(name string) error {
+	if len(s.cols) == 0 {
+		return fmt.Errorf("unknown column %s", name)
+	}
+	return fmt.Errorf("unknown column %s, expected one of %s", name, strings.Join(s.names(), ", "))
+}
+
+// set adds a column, replacing an earlier one of the same name, and
+// returns its index.
+func (s *schema) set(name string) int {
+	for i, c := range s.cols {
+		if c.name == name {
+			s.cols[i] = column{rel: s.primary, name: name}
+			return i
+		}
+	}
+	s.cols = append(s.cols, column{rel: s.primary, name: name})
+	return len(s.cols) - 1
+}
+
+func (s *schema) clone() *schema {
+	c := s.derive()
+	c.cols = append([]column(nil), s.cols...)
+	return c
+}
+
+// sliceIterator yields rows held in memory.
+type sliceIterator struct {
+	rows [][]any
+	i    int
+}
+
+func (it *sliceIterator) next() ([]any, error) {
+	if it.i == len(it.rows) {
+		return nil, io.EOF
+	}
+	row := it.rows[it.i]
+	it.rows[it.i] = nil
+	it.i++
+	return row, nil
+}
+
+func (it *sliceIterator) close() error {
+	it.rows = nil
+	return nil
+}
+
+// funcIterator yields the rows of a function, closing the iterators it
+// reads from when closed.
+type funcIterator struct {
+	fn   func() ([]any, error)
+	from []iterator
+}
+
+func (it *funcIterator) next() ([]any, error) {
+	return it.fn()
+}
+
+func (it *funcIterator) close() error {
+	var first error
+	for _, from := range it.from {
+		if err := from.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// collect reads every row of it.
+func collect(it iterator) ([][]any, error) {
+	var rows [][]any
+	for {
+		row, err := it.next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
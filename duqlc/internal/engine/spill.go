@@ -0,0 +1,309 @@
+package engine
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"time"
+)
+
+// sorter sorts rows, keeping the order of equal rows. Rows are held in
+// memory until they outgrow the limit, and then written to a temporary
+// file as a sorted run; the runs are merged as the rows are read back.
+type sorter struct {
+	cmp   func(a, b []any) int
+	limit int64
+	dir   string
+
+	rows [][]any
+	size int64
+	runs []*os.File
+}
+
+func (en *engine) sorter(cmp func(a, b []any) int) *sorter {
+	return &sorter{cmp: cmp, limit: en.opts.MemoryLimit, dir: en.opts.TempDir}
+}
+
+func (s *sorter) add(row []any) error {
+	s.rows = append(s.rows, row)
+	s.size += rowSize(row)
+	if s.size > s.limit {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the rows held in memory to a new run.
+func (s *sorter) spill() error {
+	slices.SortStableFunc(s.rows, s.cmp)
+	f, err := os.CreateTemp(s.dir, "duql-sort-*")
+	if err != nil {
+		return fmt.Errorf("spilling rows to disk: %w", err)
+	}
+	s.runs = append(s.runs, f)
+	w := bufio.NewWriter(f)
+	var buf []byte
+	for _, row := range s.rows {
+		if buf, err = encodeRow(buf[:0], row); err != nil {
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return fmt.Errorf("spilling rows to disk: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("spilling rows to disk: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("spilling rows to disk: %w", err)
+	}
+	s.rows, s.size = nil, 0
+	return nil
+}
+
+// iterator yields the rows in order. It takes over the runs, which are
+// removed when it is closed.
+func (s *sorter) iterator() (iterator, error) {
+	slices.SortStableFunc(s.rows, s.cmp)
+	if len(s.runs) == 0 {
+		return &sliceIterator{rows: s.rows}, nil
+	}
+	m := &merger{runs: s.runs}
+	m.heap.cmp = s.cmp
+	s.runs = nil
+	for _, f := range m.runs {
+		r := bufio.NewReader(f)
+		m.srcs = append(m.srcs, func() ([]any, error) { return decodeRow(r) })
+	}
+	// The rows still in memory came last, so they are the last run.
+	mem := &sliceIterator{rows: s.rows}
+	m.srcs = append(m.srcs, mem.next)
+	s.rows = nil
+	for i, src := range m.srcs {
+		row, err := src()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		m.heap.items = append(m.heap.items, mergeItem{row: row, src: i})
+	}
+	heap.Init(&m.heap)
+	return m, nil
+}
+
+// close removes the runs of a sorter whose rows are not read.
+func (s *sorter) close() error {
+	s.rows = nil
+	return removeRuns(s.runs)
+}
+
+func removeRuns(runs []*os.File) error {
+	var errs []error
+	for _, f := range runs {
+		errs = append(errs, f.Close(), os.Remove(f.Name()))
+	}
+	return errors.Join(errs...)
+}
+
+// merger merges sorted runs. Equal rows come from the earlier run first,
+// so the merge is stable.
+type merger struct {
+	srcs []func() ([]any, error)
+	heap mergeHeap
+	runs []*os.File
+}
+
+func (m *merger) next() ([]any, error) {
+	if len(m.heap.items) == 0 {
+		return nil, io.EOF
+	}
+	top := m.heap.items[0]
+	row, err := m.srcs[top.src]()
+	switch {
+	case err == io.EOF:
+		heap.Pop(&m.heap)
+	case err != nil:
+		return nil, err
+	default:
+		m.heap.items[0].row = row
+		heap.Fix(&m.heap, 0)
+	}
+	return top.row, nil
+}
+
+func (m *merger) close() error {
+	m.heap.items = nil
+	runs := m.runs
+	m.runs = nil
+	return removeRuns(runs)
+}
+
+type mergeItem struct {
+	row []any
+	src int
+}
+
+type mergeHeap struct {
+	cmp   func(a, b []any) int
+	items []mergeItem
+}
+
+func (h *mergeHeap) Len() int { return len(h.items) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	if c := h.cmp(h.items[i].row, h.items[j].row); c != 0 {
+		return c < 0
+	}
+	return h.items[i].src < h.items[j].src
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *mergeHeap) Push(x any)    { h.items = append(h.items, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+// rowSize estimates the bytes of memory a row takes.
+func rowSize(row []any) int64 {
+	size := int64(24 + 16*len(row))
+	for _, v := range row {
+		switch v := v.(type) {
+		case string:
+			size += int64(len(v))
+		case time.Time:
+			size += 24
+		case interval:
+			size += 24
+		}
+	}
+	return size
+}
+
+// Tags of the values of spilled rows.
+const (
+	tagNull byte = iota
+	tagInt
+	tagFloat
+	tagString
+	tagTrue
+	tagFalse
+	tagTime
+	tagInterval
+)
+
+// encodeRow appends the spilled form of row to b: the number of values,
+// then each value as a tag and its bytes.
+func encodeRow(b []byte, row []any) ([]byte, error) {
+	b = binary.AppendUvarint(b, uint64(len(row)))
+	for _, v := range row {
+		switch v := v.(type) {
+		case nil:
+			b = append(b, tagNull)
+		case int64:
+			b = binary.AppendVarint(append(b, tagInt), v)
+		case float64:
+			b = binary.LittleEndian.AppendUint64(append(b, tagFloat), math.Float64bits(v))
+		case string:
+			b = binary.AppendUvarint(append(b, tagString), uint64(len(v)))
+			b = append(b, v...)
+		case bool:
+			if v {
+				b = append(b, tagTrue)
+			} else {
+				b = append(b, tagFalse)
+			}
+		case time.Time:
+			data, err := v.MarshalBinary()
+			if err != nil {
+				return nil, fmt.Errorf("spilling rows to disk: %w", err)
+			}
+			b = binary.AppendUvarint(append(b, tagTime), uint64(len(data)))
+			b = append(b, data...)
+		case interval:
+			b = binary.AppendVarint(append(b, tagInterval), int64(v.months))
+			b = binary.AppendVarint(b, int64(v.days))
+			b = binary.AppendVarint(b, int64(v.d))
+		default:
+			return nil, fmt.Errorf("spilling rows to disk: unexpected %T value", v)
+		}
+	}
+	return b, nil
+}
+
+// decodeRow reads a row written by encodeRow, returning io.EOF at the end
+// of the run.
+func decodeRow(r *bufio.Reader) ([]any, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	row := make([]any, n)
+	for i := range row {
+		if row[i], err = decodeValue(r); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("reading spilled rows: %w", err)
+		}
+	}
+	return row, nil
+}
+
+func decodeValue(r *bufio.Reader) (any, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagNull:
+		return nil, nil
+	case tagInt:
+		return binary.ReadVarint(r)
+	case tagFloat:
+		var buf [8]byte
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), nil
+	case tagString, tagTime:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if tag == tagString {
+			return string(buf), nil
+		}
+		var t time.Time
+		err = t.UnmarshalBinary(buf)
+		return t, err
+	case tagTrue:
+		return true, nil
+	case tagFalse:
+		return false, nil
+	case tagInterval:
+		var parts [3]int64
+		for i := range parts {
+			if parts[i], err = binary.ReadVarint(r); err != nil {
+				return nil, err
+			}
+		}
+		return interval{months: int(parts[0]), days: int(parts[1]), d: time.Duration(parts[2])}, nil
+	}
+	return nil, fmt.Errorf("unknown tag %d", tag)
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeRow(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 0, 500, time.FixedZone("CET", 3600))
+	rows := [][]any{
+		{},
+		{nil, int64(-42), 3.25, "", "héllo", true, false},
+		{at, interval{months: 1, days: -2, d: 90 * time.Minute}, int64(1 << 40)},
+	}
+	var buf []byte
+	for _, row := range rows {
+		var err error
+		if buf, err = encodeRow(buf, row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := bufio.NewReader(bytes.NewReader(buf))
+	for _, want := range rows {
+		got, err := decodeRow(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		for i := range want {
+			if w, ok := want[i].(time.Time); ok {
+				if g, ok := got[i].(time.Time); !ok || !g.Equal(w) {
+					t.Errorf("value %d: got %v, want %v", i, got[i], w)
+				}
+			} else if !reflect.DeepEqual(got[i], want[i]) {
+				t.Errorf("value %d: got %#v, want %#v", i, got[i], want[i])
+			}
+		}
+	}
+	if _, err := decodeRow(r); err != io.EOF {
+		t.Errorf("got %v at the end, want io.EOF", err)
+	}
+
+	if _, err := encodeRow(nil, []any{[]int{1}}); err == nil {
+		t.Error("encoded a value the engine never makes")
+	}
+	truncated, _ := encodeRow(nil, []any{"hello"})
+	if _, err := decodeRow(bufio.NewReader(bytes.NewReader(truncated[:4]))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v for a truncated row, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestSorter(t *testing.T) {
+	// Rows are sorted by their first value; the second is their place in
+	// the input, to check equal rows keep it.
+	byKey := func(a, b []any) int { return cmp(a[0].(int64), b[0].(int64)) }
+	var input [][]any
+	for i := 0; i < 100; i++ {
+		input = append(input, []any{int64(i * 37 % 10), int64(i)})
+	}
+	tests := []struct {
+		name  string
+		limit int64
+		runs  bool
+	}{
+		{"in memory", 1 << 20, false},
+		{"spilled", 500, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := &sorter{cmp: byKey, limit: tt.limit, dir: dir}
+			for _, row := range input {
+				if err := s.add(row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := len(s.runs) > 0; got != tt.runs {
+				t.Fatalf("spilled %d runs", len(s.runs))
+			}
+			it, err := s.iterator()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got [][]any
+			for {
+				row, err := it.next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, row)
+			}
+			if len(got) != len(input) {
+				t.Fatalf("got %d rows, want %d", len(got), len(input))
+			}
+			for i := 1; i < len(got); i++ {
+				if c := byKey(got[i-1], got[i]); c > 0 || c == 0 && got[i-1][1].(int64) > got[i][1].(int64) {
+					t.Fatalf("rows %d and %d are out of order: %v, %v", i-1, i, got[i-1], got[i])
+				}
+			}
+			if err := it.close(); err != nil {
+				t.Fatal(err)
+			}
+			if files, _ := os.ReadDir(dir); len(files) > 0 {
+				t.Errorf("%d spilled files are left", len(files))
+			}
+		})
+	}
+}
+
+func TestSorterClose(t *testing.T) {
+	dir := t.TempDir()
+	s := &sorter{cmp: func(a, b []any) int { return 0 }, limit: 1, dir: dir}
+	for i := 0; i < 3; i++ {
+		if err := s.add([]any{int64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 3 {
+		t.Fatalf("got %d spilled files, want 3", len(files))
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) > 0 {
+		t.Errorf("%d spilled files are left", len(files))
+	}
+}
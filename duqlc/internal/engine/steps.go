@@ -0,0 +1,577 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// steps applies each step to the relation in turn. Errors name the step
+// they come from, as those of the compiler do.
+func (en *engine) steps(rel *relation, steps duql.Steps, path string) (*relation, error) {
+	for i, step := range steps {
+		p := fmt.Sprintf("%s[%d].%s", path, i, step.Type())
+		next, err := en.step(rel, step, p)
+		if err != nil {
+			rel.rows.close()
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		rel = next
+	}
+	return rel, nil
+}
+
+func (en *engine) step(rel *relation, step duql.Step, path string) (*relation, error) {
+	switch s := step.(type) {
+	case *duql.Filter:
+		return en.filter(rel, s.Expression)
+	case *duql.Generate:
+		return en.generate(rel, s.Expressions)
+	case *duql.Select:
+		return en.selectColumns(rel, s.Columns)
+	case *duql.SelectNot:
+		return en.selectNot(rel, s)
+	case *duql.Sort:
+		return en.sort(rel, s.Columns)
+	case *duql.Take:
+		return en.take(rel, s)
+	case *duql.Summarize:
+		return en.summarize(rel, s.Aggregations)
+	case *duql.Group:
+		return en.group(rel, s, path)
+	case *duql.Join:
+		return en.join(rel, s)
+	case *duql.Window:
+		return en.window(rel, s, path)
+	}
+	return nil, fmt.Errorf("%s steps need a database; %s", step.Type(), errDatabase)
+}
+
+// rowOp computes the output row for the row of an env, or drops the row
+// when keep is false.
+type rowOp func(e *env) (row []any, keep bool, err error)
+
+// stage is a step compiled for the rows of one partition: a group, or
+// every row for a window step.
+type stage func(p *partition) error
+
+// apply applies op to every row of the partition.
+func (p *partition) apply(op rowOp) error {
+	rows := make([][]any, 0, len(p.rows))
+	for i, row := range p.rows {
+		out, keep, err := op(&env{row: row, part: p, i: i})
+		if err != nil {
+			return err
+		}
+		if keep {
+			rows = append(rows, out)
+		}
+	}
+	p.set(rows)
+	return nil
+}
+
+func applyStage(op rowOp) stage {
+	return func(p *partition) error { return p.apply(op) }
+}
+
+// mapRows applies op to the rows of rel. Rows stream through op unless
+// it needs a window, in which case they are read into one partition.
+func (en *engine) mapRows(rel *relation, s *schema, window bool, op rowOp) *relation {
+	out := &relation{schema: s, sorted: rel.sorted}
+	if window {
+		out.rows = en.partitioned(rel.rows, applyStage(op))
+		return out
+	}
+	out.rows = &funcIterator{from: []iterator{rel.rows}, fn: func() ([]any, error) {
+		for {
+			row, err := rel.rows.next()
+			if err != nil {
+				return nil, err
+			}
+			out, keep, err := op(&env{row: row})
+			if err != nil {
+				return nil, err
+			}
+			if keep {
+				return out, nil
+			}
+		}
+	}}
+	return out
+}
+
+// partitioned reads every row of it into one partition, applies st to it
+// and yields the result.
+func (en *engine) partitioned(it iterator, st stage) iterator {
+	return &lazy{from: it, build: func() (iterator, error) {
+		rows, err := collect(it)
+		if err != nil {
+			return nil, err
+		}
+		p := newPartition(rows)
+		if err := st(p); err != nil {
+			return nil, err
+		}
+		return &sliceIterator{rows: p.rows}, nil
+	}}
+}
+
+// lazy builds its iterator when the first row is asked for, so that
+// nothing is read before then.
+type lazy struct {
+	from  iterator
+	build func() (iterator, error)
+	it    iterator
+}
+
+func (l *lazy) next() ([]any, error) {
+	if l.it == nil {
+		it, err := l.build()
+		if err != nil {
+			return nil, err
+		}
+		l.it = it
+	}
+	return l.it.next()
+}
+
+func (l *lazy) close() error {
+	err := l.from.close()
+	if l.it != nil {
+		if err2 := l.it.close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+func (en *engine) filter(rel *relation, e duql.Expression) (*relation, error) {
+	sc := en.scope(rel.schema)
+	sc.sorted = rel.sorted
+	op, err := filterOp(sc, e)
+	if err != nil {
+		return nil, err
+	}
+	return en.mapRows(rel, rel.schema, sc.window, op), nil
+}
+
+func filterOp(sc *scope, e duql.Expression) (rowOp, error) {
+	fn, err := sc.expression(e)
+	if err != nil {
+		return nil, err
+	}
+	return func(e *env) ([]any, bool, error) {
+		v, err := fn(e)
+		if err != nil {
+			return nil, false, err
+		}
+		holds, _, err := truth(v)
+		if err != nil {
+			return nil, false, fmt.Errorf("filter: %w", err)
+		}
+		return e.row, holds, nil
+	}, nil
+}
+
+// generate adds one column at a time, so each expression can use the
+// columns before it.
+func (en *engine) generate(rel *relation, exprs []duql.NamedExpression) (*relation, error) {
+	for _, e := range exprs {
+		sc := en.scope(rel.schema)
+		sc.sorted = rel.sorted
+		s, op, err := generateOp(sc, e)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		rel = en.mapRows(rel, s, sc.window, op)
+	}
+	return rel, nil
+}
+
+// generateOp compiles a generated column, returning the schema with it.
+func generateOp(sc *scope, e duql.NamedExpression) (*schema, rowOp, error) {
+	fn, err := sc.expression(e.Expression)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := sc.schema.clone()
+	i := s.set(e.Name)
+	width := len(s.cols)
+	return s, func(e *env) ([]any, bool, error) {
+		v, err := fn(e)
+		if err != nil {
+			return nil, false, err
+		}
+		row := make([]any, width)
+		copy(row, e.row)
+		row[i] = v
+		return row, true, nil
+	}, nil
+}
+
+func (en *engine) selectColumns(rel *relation, exprs []duql.NamedExpression) (*relation, error) {
+	sc := en.scope(rel.schema)
+	sc.sorted = rel.sorted
+	s, op, err := selectOp(sc, exprs)
+	if err != nil {
+		return nil, err
+	}
+	return en.mapRows(rel, s, sc.window, op), nil
+}
+
+// selectOp compiles the columns of a select, expanding * and dataset.*.
+func selectOp(sc *scope, exprs []duql.NamedExpression) (*schema, rowOp, error) {
+	in := sc.schema
+	s := in.derive()
+	var fns []evalFn
+	for _, e := range exprs {
+		n, err := expr.FromDUQL(e.Expression)
+		if err != nil {
+			return nil, nil, err
+		}
+		id, plain := n.(*expr.Ident)
+		if plain && e.Name == "" && id.Parts[len(id.Parts)-1] == "*" {
+			rel := strings.Join(id.Parts[:len(id.Parts)-1], ".")
+			if rel != "" && !in.hasRel(rel) {
+				return nil, nil, errorAt(n, fmt.Errorf("unknown dataset %s", rel))
+			}
+			for i, c := range in.cols {
+				if rel == "" || c.rel == rel {
+					s.cols = append(s.cols, c)
+					fns = append(fns, sc.column(i))
+				}
+			}
+			continue
+		}
+		fn, err := sc.node(n)
+		if err != nil {
+			return nil, nil, err
+		}
+		col := column{rel: in.primary, name: e.Name}
+		if plain && e.Name == "" {
+			// A bare column reference keeps its name and dataset.
+			col.name = id.Parts[len(id.Parts)-1]
+			if i, _ := in.lookup(id.Parts); i >= 0 {
+				col.rel = in.cols[i].rel
+			}
+		}
+		if col.name == "" {
+			return nil, nil, fmt.Errorf("computed column %v needs a name", e.Expression.Value)
+		}
+		s.cols = append(s.cols, col)
+		fns = append(fns, fn)
+	}
+	return s, func(e *env) ([]any, bool, error) {
+		row := make([]any, len(fns))
+		for i, fn := range fns {
+			v, err := fn(e)
+			if err != nil {
+				return nil, false, err
+			}
+			row[i] = v
+		}
+		return row, true, nil
+	}, nil
+}
+
+func (en *engine) selectNot(rel *relation, sn *duql.SelectNot) (*relation, error) {
+	names := sn.Columns
+	if sn.Column != "" {
+		names = []string{sn.Column}
+	}
+	drop := make(map[int]bool)
+	for _, name := range names {
+		i, err := rel.schema.lookup(strings.Split(name, "."))
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %s", name)
+		}
+		drop[i] = true
+	}
+	s := rel.schema.derive()
+	var keep []int
+	for i, c := range rel.schema.cols {
+		if !drop[i] {
+			s.cols = append(s.cols, c)
+			keep = append(keep, i)
+		}
+	}
+	return en.mapRows(rel, s, false, func(e *env) ([]any, bool, error) {
+		row := make([]any, len(keep))
+		for i, k := range keep {
+			row[i] = e.row[k]
+		}
+		return row, true, nil
+	}), nil
+}
+
+// sortKeys compiles the keys of a sort.
+func (en *engine) sortKeys(s *schema, cols []duql.SortColumn) ([]sortKey, error) {
+	keys := make([]sortKey, len(cols))
+	for i, col := range cols {
+		sc := en.scope(s)
+		fn, err := sc.expression(col.Expression)
+		if err != nil {
+			return nil, err
+		}
+		if sc.window {
+			return nil, fmt.Errorf("sort keys cannot use window functions; generate them as a column first")
+		}
+		keys[i] = sortKey{fn: fn, desc: col.Descending}
+	}
+	return keys, nil
+}
+
+func (en *engine) sort(rel *relation, cols []duql.SortColumn) (*relation, error) {
+	// Named keys add an output column and sort by it.
+	cols = append([]duql.SortColumn(nil), cols...)
+	for i, col := range cols {
+		if col.Name == "" {
+			continue
+		}
+		var err error
+		if rel, err = en.generate(rel, []duql.NamedExpression{{Name: col.Name, Expression: col.Expression}}); err != nil {
+			return nil, err
+		}
+		cols[i].Expression = duql.Expression{Value: "`" + strings.ReplaceAll(col.Name, "`", "``") + "`"}
+	}
+	keys, err := en.sortKeys(rel.schema, cols)
+	if err != nil {
+		return nil, err
+	}
+	return &relation{schema: rel.schema, rows: en.sorted(rel.rows, keys), sorted: cols}, nil
+}
+
+// sorted sorts the rows of it by keys, spilling to disk when they do not
+// fit in memory. Rows with equal keys keep their order.
+func (en *engine) sorted(it iterator, keys []sortKey) iterator {
+	return &lazy{from: it, build: func() (iterator, error) {
+		var width int
+		st := en.sorter(func(a, b []any) int {
+			return compareKeys(a[width:], b[width:], keys)
+		})
+		for {
+			row, err := it.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				st.close()
+				return nil, err
+			}
+			width = len(row)
+			values, err := evalKeys(keys, &env{row: row})
+			if err != nil {
+				st.close()
+				return nil, err
+			}
+			if err := st.add(append(row, values...)); err != nil {
+				st.close()
+				return nil, err
+			}
+		}
+		sorted, err := st.iterator()
+		if err != nil {
+			return nil, err
+		}
+		return &funcIterator{from: []iterator{sorted}, fn: func() ([]any, error) {
+			row, err := sorted.next()
+			if err != nil {
+				return nil, err
+			}
+			return row[:width], nil
+		}}, nil
+	}}
+}
+
+func (en *engine) take(rel *relation, t *duql.Take) (*relation, error) {
+	offset, limit, err := t.Bounds()
+	if err != nil {
+		return nil, err
+	}
+	skipped, taken := 0, 0
+	out := &relation{schema: rel.schema, sorted: rel.sorted}
+	out.rows = &funcIterator{from: []iterator{rel.rows}, fn: func() ([]any, error) {
+		for skipped < offset {
+			if _, err := rel.rows.next(); err != nil {
+				return nil, err
+			}
+			skipped++
+		}
+		if limit >= 0 && taken == limit {
+			return nil, io.EOF
+		}
+		taken++
+		return rel.rows.next()
+	}}
+	return out, nil
+}
+
+// summarize aggregates every row into one, as SQL does without GROUP BY,
+// so that counting no rows gives a row with 0.
+func (en *engine) summarize(rel *relation, aggs []duql.NamedExpression) (*relation, error) {
+	s, compute, err := en.summary(rel.schema, aggs, nil)
+	if err != nil {
+		return nil, err
+	}
+	done := false
+	out := &relation{schema: s}
+	out.rows = &funcIterator{from: []iterator{rel.rows}, fn: func() ([]any, error) {
+		if done {
+			return nil, io.EOF
+		}
+		done = true
+		f := compute.folder()
+		var first []any
+		for {
+			row, err := rel.rows.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if first == nil {
+				first = row
+			}
+			if err := f.add(&env{row: row}); err != nil {
+				return nil, err
+			}
+		}
+		if first == nil {
+			first = make([]any, len(rel.schema.cols))
+		}
+		return compute.row(nil, first, f)
+	}}
+	return out, nil
+}
+
+// summary is a compiled summarize: the aggregates to fold over the rows of
+// a group and the output columns computed from them.
+type summary struct {
+	aggs []*aggregate
+	cols []evalFn
+}
+
+func (s *summary) folder() *folder {
+	return newFolder(s.aggs)
+}
+
+// row computes the output row of a group from its keys, its first row and
+// its aggregates.
+func (s *summary) row(keys, first []any, f *folder) ([]any, error) {
+	e := &env{row: first, aggs: f.results()}
+	row := append([]any(nil), keys...)
+	for _, col := range s.cols {
+		v, err := col(e)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, v)
+	}
+	return row, nil
+}
+
+// summary compiles the aggregations of a summarize over rows of schema in,
+// returning the schema of the key columns followed by the aggregations.
+func (en *engine) summary(in *schema, aggs []duql.NamedExpression, keys []column) (*schema, *summary, error) {
+	out := in.derive()
+	out.cols = append(out.cols, keys...)
+	sum := &summary{}
+	for _, e := range aggs {
+		sc := en.scope(in)
+		sc.aggs = &sum.aggs
+		fn, err := sc.expression(e.Expression)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		if sc.window {
+			return nil, nil, fmt.Errorf("%s: window functions cannot be used in summarize", e.Name)
+		}
+		sum.cols = append(sum.cols, fn)
+		out.cols = append(out.cols, column{rel: in.primary, name: e.Name})
+	}
+	return out, sum, nil
+}
+
+func (en *engine) window(rel *relation, w *duql.Window, path string) (*relation, error) {
+	st, s, err := en.windowStage(rel.schema, w, path)
+	if err != nil {
+		return nil, err
+	}
+	return &relation{schema: s, rows: en.partitioned(rel.rows, st), sorted: rel.sorted}, nil
+}
+
+// windowStage compiles the steps of a window step for a partition.
+func (en *engine) windowStage(in *schema, w *duql.Window, path string) (stage, *schema, error) {
+	fr, err := windowFrame(w)
+	if err != nil {
+		return nil, nil, err
+	}
+	o := &over{frame: fr}
+	s := in
+	var stages []stage
+	for i, step := range w.Steps {
+		p := fmt.Sprintf("%s.steps[%d].%s", path, i, step.Type())
+		var st stage
+		switch step := step.(type) {
+		case *duql.Sort:
+			o.order, err = en.sortKeys(s, step.Columns)
+		case *duql.Generate:
+			st, s, err = en.generateStage(s, step.Expressions, o)
+		case *duql.Select:
+			st, s, err = en.selectStage(s, step.Columns, o)
+		default:
+			err = fmt.Errorf("%s steps are not supported inside window", step.Type())
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", p, err)
+		}
+		if st != nil {
+			stages = append(stages, st)
+		}
+	}
+	return chain(stages), s, nil
+}
+
+func chain(stages []stage) stage {
+	return func(p *partition) error {
+		for _, st := range stages {
+			if err := st(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (en *engine) generateStage(s *schema, exprs []duql.NamedExpression, o *over) (stage, *schema, error) {
+	var stages []stage
+	for _, e := range exprs {
+		sc := en.scope(s)
+		sc.over = o
+		out, op, err := generateOp(sc, e)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", e.Name, err)
+		}
+		stages = append(stages, applyStage(op))
+		s = out
+	}
+	return chain(stages), s, nil
+}
+
+func (en *engine) selectStage(s *schema, exprs []duql.NamedExpression, o *over) (stage, *schema, error) {
+	sc := en.scope(s)
+	sc.over = o
+	out, op, err := selectOp(sc, exprs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return applyStage(op), out, nil
+}
@@ -0,0 +1,374 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values are nil for NULL, int64, float64, string, bool, time.Time or
+// interval.
+
+// interval is the value of an `interval '30 days'` literal.
+type interval struct {
+	months, days int
+	d            time.Duration
+}
+
+func (i interval) String() string {
+	var parts []string
+	if i.months != 0 {
+		parts = append(parts, fmt.Sprintf("%d months", i.months))
+	}
+	if i.days != 0 {
+		parts = append(parts, fmt.Sprintf("%d days", i.days))
+	}
+	if i.d != 0 || len(parts) == 0 {
+		parts = append(parts, i.d.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// add adds n times the interval to t.
+func (i interval) add(t time.Time, n int) time.Time {
+	return t.AddDate(0, n*i.months, n*i.days).Add(time.Duration(n) * i.d)
+}
+
+var intervalUnits = map[string]interval{
+	"second":  {d: time.Second},
+	"minute":  {d: time.Minute},
+	"hour":    {d: time.Hour},
+	"day":     {days: 1},
+	"week":    {days: 7},
+	"month":   {months: 1},
+	"quarter": {months: 3},
+	"year":    {months: 12},
+}
+
+// parseInterval reads the text of an interval literal such as "30 days"
+// or "1 year 2 months".
+func parseInterval(text string) (interval, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return interval{}, fmt.Errorf("interval %q must be a whole number followed by a unit", text)
+	}
+	var sum interval
+	for i := 0; i < len(fields); i += 2 {
+		n, err := strconv.Atoi(fields[i])
+		unit, ok := intervalUnits[strings.TrimSuffix(strings.ToLower(fields[i+1]), "s")]
+		if err != nil || !ok {
+			return interval{}, fmt.Errorf("interval %q must be a whole number followed by a unit", text)
+		}
+		sum.months += n * unit.months
+		sum.days += n * unit.days
+		sum.d += time.Duration(n) * unit.d
+	}
+	return sum, nil
+}
+
+var (
+	integerText = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)$`)
+	floatText   = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?$`)
+)
+
+// timeLayouts are the forms of dates and timestamps read from files and
+// compared with strings.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	time.DateOnly,
+}
+
+// parseTime reads s as a date or a timestamp.
+func parseTime(s string) (time.Time, bool) {
+	// Every layout starts with a four digit year and a dash.
+	if len(s) < 10 || s[4] != '-' {
+		return time.Time{}, false
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// infer reads a field of a CSV file as the value it spells: NULL when
+// empty, then a number, a boolean, a date or timestamp, or else text.
+// Integers with leading zeros, such as postal codes, stay text.
+func infer(s string) any {
+	switch {
+	case s == "":
+		return nil
+	case integerText.MatchString(s):
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case strings.ContainsAny(s, ".eE") && floatText.MatchString(s):
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case s == "true" || s == "TRUE" || s == "True":
+		return true
+	case s == "false" || s == "FALSE" || s == "False":
+		return false
+	}
+	if t, ok := parseTime(s); ok {
+		return t
+	}
+	return s
+}
+
+// jsonValue converts a value decoded from JSON, with numbers as
+// json.Number. Strings that spell timestamps become times; objects and
+// arrays stay as JSON text.
+func jsonValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool:
+		return v, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case string:
+		if t, ok := parseTime(v); ok {
+			return t, nil
+		}
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// typeName names the type of a value in errors.
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "text"
+	case bool:
+		return "boolean"
+	case time.Time:
+		return "timestamp"
+	case interval:
+		return "interval"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// number returns v as a float when it is a number.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// rank orders values of different types that cannot be compared, as
+// SQLite does: NULL, then booleans, numbers, times, intervals and text.
+func rank(v any) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case int64, float64:
+		return 2
+	case time.Time:
+		return 3
+	case interval:
+		return 4
+	}
+	return 5
+}
+
+// coerce converts text compared with a number or a time to a number or a
+// time, so that values read from files compare with literals and params
+// whichever way they were typed.
+func coerce(a, b any) (any, any) {
+	s, ok := a.(string)
+	if !ok {
+		if _, ok := b.(string); ok {
+			b, a = coerce(b, a)
+		}
+		return a, b
+	}
+	switch b.(type) {
+	case int64, float64:
+		if v := infer(strings.TrimSpace(s)); rank(v) == 2 {
+			return v, b
+		}
+	case time.Time:
+		if t, ok := parseTime(strings.TrimSpace(s)); ok {
+			return t, b
+		}
+	}
+	return a, b
+}
+
+// compare orders two non-NULL values, comparing across types only where
+// coerce can convert one to the other.
+func compare(a, b any) int {
+	a, b = coerce(a, b)
+	if x, ok := a.(int64); ok {
+		if y, ok := b.(int64); ok {
+			return cmp(x, y)
+		}
+	}
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			return cmpFloat(x, y)
+		}
+	}
+	if ra, rb := rank(a), rank(b); ra != rb {
+		return cmp(ra, rb)
+	}
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case time.Time:
+		return x.Compare(b.(time.Time))
+	case interval:
+		y := b.(interval)
+		if c := cmp(x.months, y.months); c != 0 {
+			return c
+		}
+		if c := cmp(x.days, y.days); c != 0 {
+			return c
+		}
+		return cmp(x.d, y.d)
+	}
+	return 0
+}
+
+func cmp[T int | int64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case math.IsNaN(a) && !math.IsNaN(b):
+		return -1
+	case !math.IsNaN(a) && math.IsNaN(b):
+		return 1
+	}
+	return 0
+}
+
+// order orders any two values for sorting, with NULL first.
+func order(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return compare(a, b)
+}
+
+// key writes v so that values equal under compare, such as 2 and 2.0,
+// are written the same, for grouping, joining and counting distinct
+// values.
+func key(b *strings.Builder, v any) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("n")
+	case int64:
+		b.WriteString("i")
+		b.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			b.WriteString("i")
+			b.WriteString(strconv.FormatInt(int64(v), 10))
+		} else {
+			b.WriteString("f")
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case string:
+		b.WriteString("s")
+		b.WriteString(strconv.Itoa(len(v)))
+		b.WriteString(":")
+		b.WriteString(v)
+	case bool:
+		if v {
+			b.WriteString("t")
+		} else {
+			b.WriteString("F")
+		}
+	case time.Time:
+		b.WriteString("d")
+		b.WriteString(strconv.FormatInt(v.UnixNano(), 10))
+	case interval:
+		fmt.Fprintf(b, "v%d,%d,%d", v.months, v.days, v.d)
+	}
+	b.WriteString(";")
+}
+
+// truth reads v as a condition, where NULL is unknown.
+func truth(v any) (value, known bool, err error) {
+	switch v := v.(type) {
+	case nil:
+		return false, false, nil
+	case bool:
+		return v, true, nil
+	}
+	return false, false, fmt.Errorf("expected a boolean condition, got %s", typeName(v))
+}
+
+// text converts v to text for concatenation and text functions.
+func text(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.Equal(v.Truncate(24*time.Hour)) && v.Location() == time.UTC {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
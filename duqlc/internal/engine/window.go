@@ -0,0 +1,472 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// over is the window aggregates and window functions are computed over
+// inside window and group steps. The partition is the rows the step hands
+// to the expressions.
+type over struct {
+	order []sortKey
+	frame frame
+}
+
+type sortKey struct {
+	fn   evalFn
+	desc bool
+}
+
+// frame is the rows or range of a window step; the zero frame is the
+// default one, from the start of the partition to the last peer of the
+// row when the window is ordered, and the whole partition otherwise.
+type frame struct {
+	unit       string
+	start, end int
+	// from and to are unset for unbounded starts and ends.
+	from, to bool
+}
+
+// windowFrame reads the frame of a window step.
+func windowFrame(w *duql.Window) (frame, error) {
+	switch {
+	case w.Rolling > 0:
+		return frame{unit: "rows", start: 1 - w.Rolling, from: true, to: true}, nil
+	case w.Expanding:
+		return frame{unit: "rows", to: true}, nil
+	case w.Rows != "":
+		return frameBounds("rows", w.Rows)
+	case w.Range != "":
+		return frameBounds("range", w.Range)
+	}
+	return frame{}, nil
+}
+
+func frameBounds(unit, spec string) (frame, error) {
+	start, end, ok := strings.Cut(spec, "..")
+	if !ok {
+		return frame{}, fmt.Errorf("invalid window %s %q", unit, spec)
+	}
+	f := frame{unit: unit}
+	bound := func(s string, n *int, set *bool) error {
+		if s = strings.TrimSpace(s); s == "" {
+			return nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid window %s %q", unit, spec)
+		}
+		*n, *set = v, true
+		return nil
+	}
+	if err := bound(start, &f.start, &f.from); err != nil {
+		return frame{}, err
+	}
+	if err := bound(end, &f.end, &f.to); err != nil {
+		return frame{}, err
+	}
+	return f, nil
+}
+
+// partition is the rows a window function is computed over, with the
+// values of each window function computed so far.
+type partition struct {
+	rows   [][]any
+	values map[*windowCall][]any
+	// keys are the values of the group keys inside group steps.
+	keys []any
+}
+
+func newPartition(rows [][]any) *partition {
+	return &partition{rows: rows, values: make(map[*windowCall][]any)}
+}
+
+// set replaces the rows, forgetting the values computed over the old ones.
+func (p *partition) set(rows [][]any) {
+	p.rows = rows
+	clear(p.values)
+}
+
+func (p *partition) value(w *windowCall, i int) (any, error) {
+	values, ok := p.values[w]
+	if !ok {
+		var err error
+		if values, err = w.compute(p); err != nil {
+			return nil, err
+		}
+		p.values[w] = values
+	}
+	return values[i], nil
+}
+
+// sort orders the rows of the partition by keys, keeping the order of
+// rows with equal keys.
+func (p *partition) sort(keys []sortKey) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	type keyed struct {
+		row  []any
+		keys []any
+	}
+	rows := make([]keyed, len(p.rows))
+	for i, row := range p.rows {
+		values, err := evalKeys(keys, &env{row: row, part: p, i: i})
+		if err != nil {
+			return err
+		}
+		rows[i] = keyed{row, values}
+	}
+	slices.SortStableFunc(rows, func(a, b keyed) int { return compareKeys(a.keys, b.keys, keys) })
+	sorted := make([][]any, len(rows))
+	for i, r := range rows {
+		sorted[i] = r.row
+	}
+	p.set(sorted)
+	return nil
+}
+
+func evalKeys(keys []sortKey, e *env) ([]any, error) {
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		v, err := k.fn(e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func compareKeys(a, b []any, keys []sortKey) int {
+	for i, k := range keys {
+		c := order(a[i], b[i])
+		if k.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// windowCall is an aggregate or window function computed over a window.
+type windowCall struct {
+	n    *expr.Call
+	kind funcKind
+	// arg is nil for ranking functions and for count without an argument.
+	arg   evalFn
+	order []sortKey
+	frame frame
+}
+
+// windowCall compiles an aggregate or window function: an aggregate of the
+// summarize being compiled, or a function over the partition of the row.
+func (s *scope) windowCall(n *expr.Call, fn *function) (evalFn, error) {
+	// A `this` argument stands for the row and is dropped.
+	var args []expr.Node
+	for _, a := range n.Args {
+		if id, ok := a.(*expr.Ident); ok && id.Name() == "this" {
+			continue
+		}
+		args = append(args, a)
+	}
+	var explicit []sortKey
+	if fn.arity == 0 && len(args) > 0 {
+		// The arguments of a ranking function are the order of its window.
+		for _, a := range args {
+			desc := false
+			if u, ok := a.(*expr.Unary); ok && u.Op == "-" {
+				a, desc = u.X, true
+			}
+			key, err := s.node(a)
+			if err != nil {
+				return nil, err
+			}
+			explicit = append(explicit, sortKey{fn: key, desc: desc})
+		}
+		args = nil
+	}
+	countRows := n.Name == "count" && len(args) == 0
+	if !countRows && len(args) != fn.arity {
+		return nil, errorAt(n, fmt.Errorf("%s expects %d arguments, got %d", n.Name, fn.arity, len(args)))
+	}
+
+	var arg evalFn
+	if len(args) == 1 {
+		inner := *s
+		inner.aggs = nil
+		inner.window = false
+		var err error
+		if arg, err = inner.node(args[0]); err != nil {
+			return nil, err
+		}
+		if inner.window && s.aggs != nil {
+			return nil, errorAt(n, fmt.Errorf("%s cannot take an aggregate or a window function", n.Name))
+		}
+		s.window = s.window || inner.window
+	}
+
+	if fn.kind == aggregateFunc && s.aggs != nil {
+		i := len(*s.aggs)
+		*s.aggs = append(*s.aggs, &aggregate{name: n.Name, arg: arg})
+		return func(e *env) (any, error) { return e.aggs[i], nil }, nil
+	}
+
+	s.window = true
+	w := &windowCall{n: n, kind: fn.kind, arg: arg}
+	if s.over != nil {
+		w.order, w.frame = s.over.order, s.over.frame
+	}
+	switch {
+	case explicit != nil:
+		w.order = explicit
+	case s.over == nil && fn.kind == windowFunc:
+		w.order = s.defaultOrder()
+	}
+	if fn.kind == windowFunc {
+		// Ranking functions ignore the frame, as they do in SQL.
+		w.frame = frame{}
+	}
+	return func(e *env) (any, error) {
+		if e.part == nil {
+			return nil, errorAt(n, fmt.Errorf("%s needs a window", n.Name))
+		}
+		return e.part.value(w, e.i)
+	}, nil
+}
+
+// defaultOrder compiles the sort of the rows, which window functions
+// outside window and group steps are ordered by. A sort on columns that
+// are gone leaves them in the order of the rows.
+func (s *scope) defaultOrder() []sortKey {
+	var keys []sortKey
+	for _, col := range s.sorted {
+		sc := s.en.scope(s.schema)
+		fn, err := sc.expression(col.Expression)
+		if err != nil {
+			return nil
+		}
+		keys = append(keys, sortKey{fn: fn, desc: col.Descending})
+	}
+	return keys
+}
+
+// compute computes the function for every row of the partition. The rows
+// are ordered for the window without moving them, so each function can
+// have an order of its own.
+func (w *windowCall) compute(p *partition) ([]any, error) {
+	n := len(p.rows)
+	// pos lists the rows in the order of the window.
+	pos := make([]int, n)
+	for i := range pos {
+		pos[i] = i
+	}
+	keys := make([][]any, n)
+	if len(w.order) > 0 {
+		for i, row := range p.rows {
+			values, err := evalKeys(w.order, &env{row: row, part: p, i: i})
+			if err != nil {
+				return nil, err
+			}
+			keys[i] = values
+		}
+		slices.SortStableFunc(pos, func(a, b int) int { return compareKeys(keys[a], keys[b], w.order) })
+	}
+
+	// Rows are peers when their keys are equal; peers of the row at k are
+	// at first[k] up to last[k], exclusive.
+	first, last := make([]int, n), make([]int, n)
+	for k := 0; k < n; {
+		end := k + 1
+		for end < n && len(w.order) > 0 && compareKeys(keys[pos[k]], keys[pos[end]], w.order) == 0 {
+			end++
+		}
+		for j := k; j < end; j++ {
+			first[j], last[j] = k, end
+		}
+		k = end
+	}
+
+	args := make([]any, n)
+	for i, row := range p.rows {
+		var v any = true
+		if w.arg != nil {
+			var err error
+			if v, err = w.arg(&env{row: row, part: p, i: i}); err != nil {
+				return nil, err
+			}
+		}
+		args[i] = v
+	}
+
+	out := make([]any, n)
+	dense := int64(0)
+	for k, i := range pos {
+		switch w.n.Name {
+		case "row_number":
+			out[i] = int64(k + 1)
+		case "rank":
+			out[i] = int64(first[k] + 1)
+		case "dense_rank":
+			if first[k] == k {
+				dense++
+			}
+			out[i] = dense
+		case "percent_rank":
+			out[i] = 0.0
+			if n > 1 {
+				out[i] = float64(first[k]) / float64(n-1)
+			}
+		case "cume_dist":
+			out[i] = float64(last[k]) / float64(n)
+		case "lag":
+			if k > 0 {
+				out[i] = args[pos[k-1]]
+			}
+		case "lead":
+			if k+1 < n {
+				out[i] = args[pos[k+1]]
+			}
+		}
+	}
+	if w.kind == windowFunc && w.n.Name != "first" && w.n.Name != "last" {
+		return out, nil
+	}
+
+	// The rest are computed over the frame of each row. Frames that start
+	// at the first row grow with each row, so their aggregate is kept.
+	var running accumulator
+	runningEnd := 0
+	for k, i := range pos {
+		lo, hi, err := w.bounds(k, pos, keys, first, last)
+		if err != nil {
+			return nil, errorAt(w.n, err)
+		}
+		switch {
+		case lo >= hi:
+			if w.kind == aggregateFunc {
+				out[i] = newAccumulator(w.n.Name).result()
+			}
+			continue
+		case w.n.Name == "first":
+			out[i] = args[pos[lo]]
+			continue
+		case w.n.Name == "last":
+			out[i] = args[pos[hi-1]]
+			continue
+		}
+		var acc accumulator
+		if lo == 0 {
+			if running == nil || hi < runningEnd {
+				running, runningEnd = newAccumulator(w.n.Name), 0
+			}
+			if err := w.fold(running, args, pos[runningEnd:hi]); err != nil {
+				return nil, err
+			}
+			acc, runningEnd = running, hi
+		} else {
+			acc = newAccumulator(w.n.Name)
+			if err := w.fold(acc, args, pos[lo:hi]); err != nil {
+				return nil, err
+			}
+		}
+		out[i] = acc.result()
+	}
+	return out, nil
+}
+
+// fold adds the arguments of the rows at positions to acc.
+func (w *windowCall) fold(acc accumulator, args []any, positions []int) error {
+	for _, i := range positions {
+		if v := args[i]; v != nil {
+			if err := acc.add(v); err != nil {
+				return errorAt(w.n, fmt.Errorf("%s: %w", w.n.Name, err))
+			}
+		}
+	}
+	return nil
+}
+
+// bounds returns the frame of the row at position k, as positions from lo
+// up to hi, exclusive.
+func (w *windowCall) bounds(k int, pos []int, keys [][]any, first, last []int) (int, int, error) {
+	n := len(pos)
+	f := w.frame
+	switch f.unit {
+	case "":
+		if len(w.order) == 0 {
+			return 0, n, nil
+		}
+		return 0, last[k], nil
+	case "rows":
+		lo, hi := 0, n
+		if f.from {
+			lo = max(k+f.start, 0)
+		}
+		if f.to {
+			hi = min(k+f.end+1, n)
+		}
+		return lo, hi, nil
+	}
+
+	// A range frame holds the rows whose key is within the offsets of the
+	// key of the row.
+	lo, hi := 0, n
+	if f.from && f.start == 0 {
+		lo = first[k]
+	}
+	if f.to && f.end == 0 {
+		hi = last[k]
+	}
+	if !(f.from && f.start != 0 || f.to && f.end != 0) {
+		return lo, hi, nil
+	}
+	if len(w.order) != 1 {
+		return 0, 0, fmt.Errorf("a window range with offsets needs exactly one sort key")
+	}
+	dir := 1.0
+	if w.order[0].desc {
+		dir = -1
+	}
+	value := func(j int) (float64, bool) {
+		x, ok := number(keys[pos[j]][0])
+		return dir * x, ok
+	}
+	v, ok := value(k)
+	if !ok {
+		if keys[pos[k]][0] != nil {
+			return 0, 0, fmt.Errorf("a window range with offsets needs a numeric sort key, got %s", typeName(keys[pos[k]][0]))
+		}
+		return first[k], last[k], nil
+	}
+	// NULL keys sort together at one end; the numbers lie between a and b.
+	a, b := 0, n
+	for a < n && keys[pos[a]][0] == nil {
+		a++
+	}
+	for b > a && keys[pos[b-1]][0] == nil {
+		b--
+	}
+	search := func(holds func(x float64) bool) int {
+		return a + sort.Search(b-a, func(j int) bool {
+			x, _ := value(a + j)
+			return holds(x)
+		})
+	}
+	if f.from && f.start != 0 {
+		lo = search(func(x float64) bool { return x >= v+float64(f.start) })
+	}
+	if f.to && f.end != 0 {
+		hi = search(func(x float64) bool { return x > v+float64(f.end) })
+	}
+	return lo, hi, nil
+}
@@ -0,0 +1,261 @@
+// Package explain describes what a query does without running it: the
+// columns and types each step produces, the part of the SQL it becomes and
+// the declarations it uses.
+package explain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/compiler"
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/semantic"
+)
+
+// Formats are the output formats Write accepts.
+var Formats = []string{"tree", "json", "markdown"}
+
+// Plan explains one query.
+type Plan struct {
+	File   string             `json:"file"`
+	Target duql.TargetDialect `json:"target"`
+	// Dataset is what the query reads, as written.
+	Dataset string             `json:"dataset"`
+	Input   *semantic.Relation `json:"input"`
+	// Declarations are every name the query declares.
+	Declarations []string `json:"declarations,omitempty"`
+	Steps        []Step   `json:"steps"`
+	Tables       []Table  `json:"tables,omitempty"`
+	SQL          string   `json:"sql"`
+	// Unavailable says why SQL is empty when the target cannot express the
+	// query, as with a file dataset and a target that cannot read files.
+	// The columns of every step are explained all the same.
+	Unavailable string `json:"unavailable,omitempty"`
+	// Params are the arguments SQL expects, in the order they are passed.
+	Params []compiler.Param `json:"params,omitempty"`
+	// Problems are the unknown columns and type errors found, which do not
+	// stop a query from being explained.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// Step explains one step of Query.Steps.
+type Step struct {
+	Index  int                `json:"index"`
+	Type   string             `json:"type"`
+	Output *semantic.Relation `json:"output"`
+	// Table is the common table expression the step becomes, or empty when
+	// it is part of the final SELECT.
+	Table        string   `json:"table,omitempty"`
+	Declarations []string `json:"declarations,omitempty"`
+}
+
+// Table is a common table expression of the SQL.
+type Table struct {
+	Name string `json:"name"`
+	SQL  string `json:"sql"`
+}
+
+// New explains the query read from file, compiled for target, or for its
+// settings.target when target is empty. Provider may be nil. A query the
+// target cannot express is explained without its SQL.
+func New(file string, q *duql.Query, target duql.TargetDialect, provider catalog.Provider) (*Plan, error) {
+	res, err := compiler.Compile(q, compiler.Options{Target: target})
+	var unsupported *compiler.UnsupportedError
+	if errors.As(err, &unsupported) {
+		res, err = &compiler.Result{Target: unsupported.Target}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	analysis := semantic.Analyze(q, semantic.Options{Catalog: provider, Dir: filepath.Dir(file)})
+
+	p := &Plan{
+		File:    file,
+		Target:  res.Target,
+		Dataset: datasetName(q.Dataset),
+		Input:   analysis.Dataset,
+		SQL:     res.SQL,
+		Params:  res.Params,
+	}
+	if unsupported != nil {
+		p.Unavailable = unsupported.Error()
+	}
+	for name := range q.Declare {
+		p.Declarations = append(p.Declarations, name)
+	}
+	sort.Strings(p.Declarations)
+	for i, step := range analysis.Steps {
+		s := Step{Index: step.Index, Type: step.Type, Output: step.Relation}
+		if i < len(res.Steps) {
+			s.Table = res.Steps[i].Table
+			s.Declarations = res.Steps[i].Declarations
+		}
+		p.Steps = append(p.Steps, s)
+	}
+	for _, t := range res.Tables {
+		p.Tables = append(p.Tables, Table{Name: t.Name, SQL: t.SQL})
+	}
+	for _, problem := range analysis.Problems {
+		p.Problems = append(p.Problems, problem.Error())
+	}
+	return p, nil
+}
+
+func datasetName(ds duql.Dataset) string {
+	switch {
+	case ds.SQL != nil:
+		return "sql"
+	case ds.File != "":
+		return ds.File
+	case ds.Query != nil:
+		return fmt.Sprintf("%s with %d steps", datasetName(ds.Query.Dataset), len(ds.Query.Steps))
+	case ds.Complex != nil && ds.Complex.Format != "":
+		return fmt.Sprintf("%s (%s)", ds.Complex.Name, ds.Complex.Format)
+	case ds.Complex != nil:
+		return ds.Complex.Name
+	}
+	return ds.Simple
+}
+
+// Write writes the plans in the given format: an indented tree, JSON or
+// Markdown.
+func Write(w io.Writer, plans []*Plan, format string) error {
+	switch format {
+	case "", "tree":
+		for _, p := range plans {
+			if err := writeTree(w, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plans)
+	case "markdown", "md":
+		for _, p := range plans {
+			if err := writeMarkdown(w, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %s, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// becomes names the part of the SQL a step is written to.
+func becomes(table string) string {
+	if table == "" {
+		return "final SELECT"
+	}
+	return table
+}
+
+// columns lists the columns of a relation with their types.
+func columns(r *semantic.Relation) []string {
+	var cols []string
+	for _, col := range r.Columns {
+		if col.Type != "" {
+			cols = append(cols, col.Name+" "+col.Type)
+		} else {
+			cols = append(cols, col.Name)
+		}
+	}
+	if r.Open {
+		cols = append(cols, "… (columns not known)")
+	}
+	return cols
+}
+
+func writeTree(w io.Writer, p *Plan) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s [%s]\n", p.File, p.Target)
+	if len(p.Declarations) > 0 {
+		fmt.Fprintf(&b, "├── declare: %s\n", strings.Join(p.Declarations, ", "))
+	}
+	fmt.Fprintf(&b, "├── dataset: %s\n", p.Dataset)
+	for _, col := range columns(p.Input) {
+		fmt.Fprintf(&b, "│     %s\n", col)
+	}
+	for _, s := range p.Steps {
+		fmt.Fprintf(&b, "├── steps[%d] %s → %s", s.Index, s.Type, becomes(s.Table))
+		if len(s.Declarations) > 0 {
+			fmt.Fprintf(&b, " (uses %s)", strings.Join(s.Declarations, ", "))
+		}
+		b.WriteString("\n")
+		for _, col := range columns(s.Output) {
+			fmt.Fprintf(&b, "│     %s\n", col)
+		}
+	}
+	for _, problem := range p.Problems {
+		fmt.Fprintf(&b, "├── problem: %s\n", problem)
+	}
+	if len(p.Params) > 0 {
+		b.WriteString("├── params\n")
+		for _, param := range p.Params {
+			fmt.Fprintf(&b, "│     %s %s %s\n", param.Placeholder, param.Name, param.Type)
+		}
+	}
+	if p.Unavailable != "" {
+		fmt.Fprintf(&b, "└── sql: unavailable, %s\n\n", p.Unavailable)
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+	b.WriteString("└── sql\n")
+	for _, line := range strings.Split(p.SQL, "\n") {
+		fmt.Fprintf(&b, "      %s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMarkdown(w io.Writer, p *Plan) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", p.File)
+	fmt.Fprintf(&b, "Target: `%s`\n\n", p.Target)
+	if len(p.Declarations) > 0 {
+		fmt.Fprintf(&b, "Declares: %s\n\n", code(p.Declarations))
+	}
+	b.WriteString("| Step | Becomes | Uses | Columns |\n")
+	b.WriteString("| ---- | ------- | ---- | ------- |\n")
+	fmt.Fprintf(&b, "| dataset `%s` | | | %s |\n", p.Dataset, strings.Join(columns(p.Input), "<br>"))
+	for _, s := range p.Steps {
+		fmt.Fprintf(&b, "| `steps[%d]` %s | %s | %s | %s |\n",
+			s.Index, s.Type, becomes(s.Table), code(s.Declarations), strings.Join(columns(s.Output), "<br>"))
+	}
+	if len(p.Problems) > 0 {
+		b.WriteString("\nProblems:\n\n")
+		for _, problem := range p.Problems {
+			fmt.Fprintf(&b, "- %s\n", problem)
+		}
+	}
+	if len(p.Params) > 0 {
+		b.WriteString("\n| Placeholder | Param | Type |\n")
+		b.WriteString("| ----------- | ----- | ---- |\n")
+		for _, param := range p.Params {
+			fmt.Fprintf(&b, "| `%s` | `%s` | %s |\n", param.Placeholder, param.Name, param.Type)
+		}
+	}
+	if p.Unavailable != "" {
+		fmt.Fprintf(&b, "\nSQL is unavailable: %s.\n\n", p.Unavailable)
+	} else {
+		fmt.Fprintf(&b, "\n```sql\n%s\n```\n\n", p.SQL)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func code(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "`" + name + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,232 @@
+package expr
+
+import "strings"
+
+// Node is a parsed DUQL inline expression.
+type Node interface {
+	// Pos is the byte offset of the node within the expression text.
+	Pos() int
+}
+
+// Ident is a column, relation or declaration reference such as
+// `orders.customer_id` or `employees.*`.
+type Ident struct {
+	Parts []string
+	At    int
+}
+
+type Number struct {
+	Text string
+	At   int
+}
+
+type String struct {
+	Value string
+	At    int
+}
+
+type Bool struct {
+	Value bool
+	At    int
+}
+
+type Null struct {
+	At int
+}
+
+// Date is a @-prefixed date, time or timestamp literal, without the @.
+type Date struct {
+	Text string
+	At   int
+}
+
+// Interval is an `interval '30 days'` literal.
+type Interval struct {
+	Text string
+	At   int
+}
+
+// FString is an f"…" interpolated string; parts are String or expression nodes.
+type FString struct {
+	Parts []Node
+	At    int
+}
+
+// RawSQL is a sql"…" literal embedded in an expression.
+type RawSQL struct {
+	SQL string
+	At  int
+}
+
+// Param is a `$name` or `$1` runtime parameter reference.
+type Param struct {
+	Name string
+	At   int
+}
+
+type Unary struct {
+	Op string
+	X  Node
+	At int
+}
+
+type Binary struct {
+	Op   string
+	X, Y Node
+	At   int
+}
+
+// Range is `start..end`; either bound may be nil.
+type Range struct {
+	Start, End Node
+	At         int
+}
+
+type Array struct {
+	Items []Node
+	At    int
+}
+
+// Call is a function application, written either as f(a, b) or f a b.
+type Call struct {
+	Name string
+	Args []Node
+	At   int
+}
+
+// NamedArg is a `name:value` argument to a function call.
+type NamedArg struct {
+	Name  string
+	Value Node
+	At    int
+}
+
+type Case struct {
+	Whens []When
+	Else  Node
+	At    int
+}
+
+type When struct {
+	Cond, Value Node
+}
+
+// Lambda is a function definition such as `low:0 high x -> (x - low) / (high - low)`.
+type Lambda struct {
+	Params []LambdaParam
+	Body   Node
+	At     int
+}
+
+type LambdaParam struct {
+	Name    string
+	Default Node
+}
+
+func (n *Ident) Pos() int    { return n.At }
+func (n *Number) Pos() int   { return n.At }
+func (n *String) Pos() int   { return n.At }
+func (n *Bool) Pos() int     { return n.At }
+func (n *Null) Pos() int     { return n.At }
+func (n *Date) Pos() int     { return n.At }
+func (n *Interval) Pos() int { return n.At }
+func (n *FString) Pos() int  { return n.At }
+func (n *RawSQL) Pos() int   { return n.At }
+func (n *Param) Pos() int    { return n.At }
+func (n *Unary) Pos() int    { return n.At }
+func (n *Binary) Pos() int   { return n.At }
+func (n *Range) Pos() int    { return n.At }
+func (n *Array) Pos() int    { return n.At }
+func (n *Call) Pos() int     { return n.At }
+func (n *NamedArg) Pos() int { return n.At }
+func (n *Case) Pos() int     { return n.At }
+func (n *Lambda) Pos() int   { return n.At }
+
+// Name returns the dotted form of the identifier.
+func (n *Ident) Name() string {
+	return strings.Join(n.Parts, ".")
+}
+
+// Walk visits n and its children depth-first, stopping at any node for
+// which fn returns false.
+func Walk(n Node, fn func(Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *FString:
+		for _, p := range n.Parts {
+			Walk(p, fn)
+		}
+	case *Unary:
+		Walk(n.X, fn)
+	case *Binary:
+		Walk(n.X, fn)
+		Walk(n.Y, fn)
+	case *Range:
+		Walk(n.Start, fn)
+		Walk(n.End, fn)
+	case *Array:
+		for _, item := range n.Items {
+			Walk(item, fn)
+		}
+	case *Call:
+		for _, arg := range n.Args {
+			Walk(arg, fn)
+		}
+	case *NamedArg:
+		Walk(n.Value, fn)
+	case *Case:
+		for _, w := range n.Whens {
+			Walk(w.Cond, fn)
+			Walk(w.Value, fn)
+		}
+		Walk(n.Else, fn)
+	case *Lambda:
+		for _, p := range n.Params {
+			Walk(p.Default, fn)
+		}
+		Walk(n.Body, fn)
+	}
+}
+
+// Idents returns every identifier referenced by n, in source order.
+func Idents(n Node) []*Ident {
+	var idents []*Ident
+	Walk(n, func(n Node) bool {
+		if id, ok := n.(*Ident); ok {
+			idents = append(idents, id)
+		}
+		return true
+	})
+	return idents
+}
+
+// Concat returns the operands of a + that joins text, which is one with a
+// string, an f-string or another such + as an operand, with the parts of
+// f-strings spliced in. It returns nil for arithmetic.
+func Concat(n *Binary) []Node {
+	if n.Op != "+" {
+		return nil
+	}
+	x, xText := concatParts(n.X)
+	y, yText := concatParts(n.Y)
+	if !xText && !yText {
+		return nil
+	}
+	return append(x, y...)
+}
+
+func concatParts(n Node) ([]Node, bool) {
+	switch n := n.(type) {
+	case *String:
+		return []Node{n}, true
+	case *FString:
+		return n.Parts, true
+	case *Binary:
+		if parts := Concat(n); parts != nil {
+			return parts, true
+		}
+	}
+	return []Node{n}, false
+}
@@ -0,0 +1,56 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+// FromDUQL converts a YAML level expression into an expression tree.
+func FromDUQL(e duql.Expression) (Node, error) {
+	return fromValue(e.Value)
+}
+
+func fromValue(v interface{}) (Node, error) {
+	switch v := v.(type) {
+	case nil:
+		return &Null{}, nil
+	case string:
+		return Parse(v)
+	case bool:
+		return &Bool{Value: v}, nil
+	case int:
+		return &Number{Text: strconv.Itoa(v)}, nil
+	case int64:
+		return &Number{Text: strconv.FormatInt(v, 10)}, nil
+	case uint64:
+		return &Number{Text: strconv.FormatUint(v, 10)}, nil
+	case float64:
+		return &Number{Text: strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case *duql.RawSQL:
+		return &RawSQL{SQL: v.SQL}, nil
+	case *duql.Case:
+		c := &Case{}
+		for _, b := range v.Branches {
+			cond, err := FromDUQL(b.When)
+			if err != nil {
+				return nil, fmt.Errorf("invalid case condition: %w", err)
+			}
+			value, err := FromDUQL(b.Then)
+			if err != nil {
+				return nil, fmt.Errorf("invalid case result: %w", err)
+			}
+			if lit, ok := cond.(*Bool); ok && lit.Value {
+				c.Else = value
+				break
+			}
+			c.Whens = append(c.Whens, When{Cond: cond, Value: value})
+		}
+		if len(c.Whens) == 0 {
+			return c.Else, nil
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unsupported expression type: %T", v)
+}
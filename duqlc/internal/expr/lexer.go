@@ -0,0 +1,359 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokFString
+	tokRawSQL
+	tokDate
+	tokParam
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokColon
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	// spaceBefore distinguishes the call `f(x)` from the application `f (x)`.
+	spaceBefore bool
+}
+
+// Error is a syntax or resolution error at a position within an expression.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos int, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// operators are matched longest first.
+var operators = []string{
+	"==", "!=", ">=", "<=", "~=", "&&", "||", "??", "..", "->", "//", "**",
+	">", "<", "+", "-", "*", "/", "%", "^", "!", "|",
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	space := false
+	for i < len(src) {
+		c := src[i]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			space = true
+			continue
+		}
+		start := i
+		tok := token{pos: start, spaceBefore: space}
+		space = false
+
+		switch {
+		case (c == 's' && strings.HasPrefix(src[i:], "sql") && i+3 < len(src) && isQuote(src[i+3])):
+			body, end, err := lexQuoted(src, i+3)
+			if err != nil {
+				return nil, err
+			}
+			tok.kind, tok.text = tokRawSQL, body
+			i = end
+		case c == 'f' && i+1 < len(src) && isQuote(src[i+1]):
+			body, end, err := lexQuoted(src, i+1)
+			if err != nil {
+				return nil, err
+			}
+			tok.kind, tok.text = tokFString, body
+			i = end
+		case isIdentStart(c) || c == '`':
+			text, end, err := lexIdent(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tok.kind, tok.text = tokIdent, text
+			i = end
+		case isDigit(c):
+			end := lexNumber(src, i)
+			tok.kind, tok.text = tokNumber, strings.ReplaceAll(src[i:end], "_", "")
+			i = end
+		case isQuote(c):
+			body, end, err := lexQuoted(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tok.kind, tok.text = tokString, unescape(body)
+			i = end
+		case c == '@':
+			end := i + 1
+			for end < len(src) && strings.IndexByte("0123456789-:T.+Z", src[end]) >= 0 {
+				// Stop before a range operator so @a..@b lexes as two dates.
+				if src[end] == '.' && end+1 < len(src) && src[end+1] == '.' {
+					break
+				}
+				end++
+			}
+			if end == i+1 {
+				return nil, errorf(start, "expected a date after @")
+			}
+			tok.kind, tok.text = tokDate, src[i+1:end]
+			i = end
+		case c == '$':
+			end := i + 1
+			for end < len(src) && (isIdentStart(src[end]) || isDigit(src[end])) {
+				end++
+			}
+			if end == i+1 {
+				return nil, errorf(start, "expected a parameter name after $")
+			}
+			tok.kind, tok.text = tokParam, src[i+1:end]
+			i = end
+		case c == '(':
+			tok.kind, tok.text = tokLParen, "("
+			i++
+		case c == ')':
+			tok.kind, tok.text = tokRParen, ")"
+			i++
+		case c == '[':
+			tok.kind, tok.text = tokLBracket, "["
+			i++
+		case c == ']':
+			tok.kind, tok.text = tokRBracket, "]"
+			i++
+		case c == ',':
+			tok.kind, tok.text = tokComma, ","
+			i++
+		case c == ':':
+			tok.kind, tok.text = tokColon, ":"
+			i++
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					tok.kind, tok.text = tokOp, op
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, errorf(start, "unexpected character %q", c)
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(src), spaceBefore: true})
+	return tokens, nil
+}
+
+func isQuote(c byte) bool {
+	return c == '\'' || c == '"'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c))
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+// lexIdent reads a dotted identifier whose parts may be `backtick quoted`
+// and whose last part may be `*`.
+func lexIdent(src string, i int) (string, int, error) {
+	var parts []string
+	for {
+		switch {
+		case i < len(src) && src[i] == '`':
+			// A doubled backtick stands for a backtick within the name.
+			var name strings.Builder
+			j := i + 1
+			for {
+				if j >= len(src) {
+					return "", 0, errorf(i, "unterminated quoted identifier")
+				}
+				if src[j] == '`' {
+					if j+1 < len(src) && src[j+1] == '`' {
+						name.WriteByte('`')
+						j += 2
+						continue
+					}
+					break
+				}
+				name.WriteByte(src[j])
+				j++
+			}
+			parts = append(parts, name.String())
+			i = j + 1
+		case i < len(src) && isIdentStart(src[i]):
+			start := i
+			for i < len(src) && isIdentChar(src[i]) {
+				i++
+			}
+			parts = append(parts, src[start:i])
+		case i < len(src) && src[i] == '*' && len(parts) > 0:
+			parts = append(parts, "*")
+			i++
+			return joinParts(parts), i, nil
+		default:
+			return "", 0, errorf(i, "expected an identifier")
+		}
+		if i+1 < len(src) && src[i] == '.' && src[i+1] != '.' {
+			i++
+			continue
+		}
+		return joinParts(parts), i, nil
+	}
+}
+
+// joinParts joins identifier parts with a NUL separator so that parts
+// containing dots or spaces survive until the parser splits them again.
+func joinParts(parts []string) string {
+	return strings.Join(parts, "\x00")
+}
+
+func lexNumber(src string, i int) int {
+	for i < len(src) && (isDigit(src[i]) || src[i] == '_') {
+		i++
+	}
+	if i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+		i++
+		for i < len(src) && (isDigit(src[i]) || src[i] == '_') {
+			i++
+		}
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && isDigit(src[j]) {
+			i = j
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+// lexQuoted reads a single, double or triple quoted string starting at i
+// and returns its raw body.
+func lexQuoted(src string, i int) (string, int, error) {
+	q := src[i]
+	if strings.HasPrefix(src[i:], strings.Repeat(string(q), 3)) {
+		delim := strings.Repeat(string(q), 3)
+		end := strings.Index(src[i+3:], delim)
+		if end < 0 {
+			return "", 0, errorf(i, "unterminated string")
+		}
+		return src[i+3 : i+3+end], i + 6 + end, nil
+	}
+	j := i + 1
+	for j < len(src) {
+		switch src[j] {
+		case '\\':
+			j += 2
+			continue
+		case q:
+			return src[i+1 : j], j + 1, nil
+		}
+		j++
+	}
+	return "", 0, errorf(i, "unterminated string")
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\', '\'', '"':
+			b.WriteByte(s[i])
+		default:
+			// Unknown escapes are kept so regular expressions such as \s survive.
+			b.WriteByte('\\')
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// Rename rewrites the identifiers of the expression src that names maps to
+// another name, such as declarations imported under a namespace. Qualified
+// identifiers are only rewritten when the whole name maps, and strings and
+// raw SQL are left alone, as are the parameters of a function written as
+// a -> b. src is returned unchanged when it does not lex.
+func Rename(src string, names map[string]string) string {
+	tokens, err := lex(src)
+	if err != nil {
+		return src
+	}
+	if fn, err := Parse(src); err == nil {
+		if fn, ok := fn.(*Lambda); ok {
+			shadowed := make(map[string]string, len(names))
+			for k, v := range names {
+				shadowed[k] = v
+			}
+			for _, p := range fn.Params {
+				delete(shadowed, p.Name)
+			}
+			names = shadowed
+		}
+	}
+	var b strings.Builder
+	last := 0
+	for _, t := range tokens {
+		if t.kind != tokIdent {
+			continue
+		}
+		to, ok := names[strings.ReplaceAll(t.text, "\x00", ".")]
+		if !ok {
+			continue
+		}
+		_, end, err := lexIdent(src, t.pos)
+		if err != nil {
+			return src
+		}
+		b.WriteString(src[last:t.pos])
+		b.WriteString(to)
+		last = end
+	}
+	b.WriteString(src[last:])
+	return b.String()
+}
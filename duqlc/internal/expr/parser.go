@@ -0,0 +1,574 @@
+package expr
+
+import (
+	"strings"
+)
+
+// Parse parses a DUQL inline expression.
+func Parse(src string) (Node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+
+	var n Node
+	if p.isLambda() {
+		n, err = p.parseLambda()
+	} else if p.peek().kind == tokOp && p.peek().text == "==" {
+		// `==id` is the join shorthand for equality on a shared column name.
+		at := p.next().pos
+		var x Node
+		x, err = p.parseExpr(precPipe)
+		n = &Unary{Op: "==", X: x, At: at}
+	} else {
+		n, err = p.parseExpr(precPipe)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, errorf(t.pos, "unexpected %q", tokenText(t))
+	}
+	return n, nil
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+}
+
+const (
+	precPipe = iota + 1
+	precOr
+	precAnd
+	precCoalesce
+	precCompare
+	precRange
+	precAdd
+	precMul
+	precUnary
+	precPow
+)
+
+var binaryPrec = map[string]int{
+	"|":  precPipe,
+	"||": precOr,
+	"&&": precAnd,
+	"??": precCoalesce,
+	"==": precCompare, "!=": precCompare, "<": precCompare, "<=": precCompare,
+	">": precCompare, ">=": precCompare, "~=": precCompare,
+	"..": precRange,
+	"+":  precAdd, "-": precAdd,
+	"*": precMul, "/": precMul, "%": precMul, "//": precMul,
+	"^": precPow, "**": precPow,
+}
+
+// keywordOps are word operators and their symbolic equivalents.
+var keywordOps = map[string]string{
+	"or":      "||",
+	"and":     "&&",
+	"in":      "in",
+	"between": "between",
+}
+
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "in": true, "between": true,
+	"case": true, "when": true, "then": true, "else": true, "end": true,
+	"true": true, "false": true, "null": true, "interval": true,
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) peekAt(offset int) token {
+	if p.i+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.i+offset]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.peek()
+	if t.kind != kind {
+		return t, errorf(t.pos, "expected %s, found %q", what, tokenText(t))
+	}
+	return p.next(), nil
+}
+
+func (p *parser) isKeyword(t token, word string) bool {
+	return t.kind == tokIdent && t.text == word
+}
+
+// binaryOp returns the operator and precedence of t when it is a binary operator.
+func (p *parser) binaryOp(t token) (string, int, bool) {
+	switch t.kind {
+	case tokOp:
+		prec, ok := binaryPrec[t.text]
+		return t.text, prec, ok
+	case tokIdent:
+		if op, ok := keywordOps[t.text]; ok {
+			if op == "in" || op == "between" {
+				return op, precCompare, true
+			}
+			return op, binaryPrec[op], true
+		}
+	}
+	return "", 0, false
+}
+
+func (p *parser) parseExpr(minPrec int) (Node, error) {
+	var left Node
+	var err error
+	if t := p.peek(); t.kind == tokOp && t.text == ".." {
+		// An open range such as ..50.
+		p.next()
+		end, err := p.parseExpr(precRange + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &Range{End: end, At: t.pos}
+	} else {
+		left, err = p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		t := p.peek()
+		op, prec, ok := p.binaryOp(t)
+		if !ok || prec < minPrec {
+			return left, nil
+		}
+		p.next()
+
+		switch op {
+		case "|":
+			left, err = p.parsePipeStage(left)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case "..":
+			r := &Range{Start: left, At: left.Pos()}
+			if p.startsOperand(p.peek()) {
+				r.End, err = p.parseExpr(precRange + 1)
+				if err != nil {
+					return nil, err
+				}
+			}
+			left = r
+			continue
+		}
+
+		nextPrec := prec + 1
+		if prec == precPow {
+			nextPrec = prec // right associative
+		}
+		right, err := p.parseExpr(nextPrec)
+		if err != nil {
+			return nil, err
+		}
+		if op == "**" {
+			op = "^"
+		}
+		left = &Binary{Op: op, X: left, Y: right, At: t.pos}
+	}
+}
+
+// parsePipeStage applies a pipeline stage to value, passing value as the
+// last argument of the stage's function.
+func (p *parser) parsePipeStage(value Node) (Node, error) {
+	t := p.peek()
+	if t.kind != tokIdent {
+		return nil, errorf(t.pos, "expected a function after |, found %q", tokenText(t))
+	}
+	p.next()
+	name := identName(t.text)
+	var args []Node
+	var err error
+	if next := p.peek(); next.kind == tokLParen && !next.spaceBefore {
+		args, err = p.parseCallArgs()
+	} else {
+		args, err = p.parseApplicationArgs()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Call{Name: name, Args: append(args, value), At: t.pos}, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && (t.text == "-" || t.text == "!" || t.text == "+"):
+		p.next()
+		x, err := p.parseExpr(precUnary)
+		if err != nil {
+			return nil, err
+		}
+		if t.text == "+" {
+			return x, nil
+		}
+		return &Unary{Op: t.text, X: x, At: t.pos}, nil
+	case p.isKeyword(t, "not"):
+		p.next()
+		x, err := p.parseExpr(precUnary)
+		if err != nil {
+			return nil, err
+		}
+		return &Unary{Op: "!", X: x, At: t.pos}, nil
+	}
+	return p.parseApplication()
+}
+
+// parseApplication parses a primary expression, treating an identifier
+// followed by operands as a function application such as `sum amount`.
+func (p *parser) parseApplication() (Node, error) {
+	t := p.peek()
+	if t.kind == tokIdent && !keywords[t.text] && p.startsOperand(p.peekAt(1)) && !(p.peekAt(1).kind == tokLParen && !p.peekAt(1).spaceBefore) {
+		p.next()
+		args, err := p.parseApplicationArgs()
+		if err != nil {
+			return nil, err
+		}
+		return &Call{Name: identName(t.text), Args: args, At: t.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parseApplicationArgs parses space separated operands up to the next operator.
+func (p *parser) parseApplicationArgs() ([]Node, error) {
+	var args []Node
+	for p.startsOperand(p.peek()) {
+		arg, err := p.parseArg(p.parseRangeOperand)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// parseRangeOperand parses a primary, extending it to a range when it is
+// immediately followed by `..`, so `in 50..100` passes the whole range.
+func (p *parser) parseRangeOperand() (Node, error) {
+	start, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokOp || t.text != ".." || t.spaceBefore {
+		return start, nil
+	}
+	p.next()
+	r := &Range{Start: start, At: start.Pos()}
+	if t := p.peek(); p.startsOperand(t) && !t.spaceBefore {
+		if r.End, err = p.parsePrimary(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// parseArg parses a possibly named argument.
+func (p *parser) parseArg(value func() (Node, error)) (Node, error) {
+	t := p.peek()
+	if t.kind == tokIdent && !strings.Contains(t.text, "\x00") && p.peekAt(1).kind == tokColon {
+		p.next()
+		p.next()
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return &NamedArg{Name: t.text, Value: v, At: t.pos}, nil
+	}
+	return value()
+}
+
+// startsOperand reports whether t can begin an operand of a function application.
+func (p *parser) startsOperand(t token) bool {
+	switch t.kind {
+	case tokIdent:
+		switch t.text {
+		case "true", "false", "null", "interval", "case":
+			return true
+		}
+		return !keywords[t.text]
+	case tokNumber, tokString, tokFString, tokRawSQL, tokDate, tokParam, tokLBracket, tokLParen:
+		return true
+	}
+	return false
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &Number{Text: t.text, At: t.pos}, nil
+	case tokString:
+		return &String{Value: t.text, At: t.pos}, nil
+	case tokFString:
+		return p.parseFString(t)
+	case tokRawSQL:
+		return &RawSQL{SQL: t.text, At: t.pos}, nil
+	case tokDate:
+		return &Date{Text: t.text, At: t.pos}, nil
+	case tokParam:
+		return &Param{Name: t.text, At: t.pos}, nil
+	case tokLParen:
+		x, err := p.parseExpr(precPipe)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case tokLBracket:
+		arr := &Array{At: t.pos}
+		for p.peek().kind != tokRBracket {
+			item, err := p.parseExpr(precPipe)
+			if err != nil {
+				return nil, err
+			}
+			arr.Items = append(arr.Items, item)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+		if _, err := p.expect(tokRBracket, "]"); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &Bool{Value: t.text == "true", At: t.pos}, nil
+		case "null":
+			return &Null{At: t.pos}, nil
+		case "interval":
+			s, err := p.expect(tokString, "an interval string")
+			if err != nil {
+				return nil, err
+			}
+			return &Interval{Text: s.text, At: t.pos}, nil
+		case "case":
+			return p.parseCase(t)
+		}
+		if keywords[t.text] {
+			return nil, errorf(t.pos, "unexpected %q", t.text)
+		}
+		if next := p.peek(); next.kind == tokLParen && !next.spaceBefore {
+			args, err := p.parseCallArgs()
+			if err != nil {
+				return nil, err
+			}
+			return &Call{Name: identName(t.text), Args: args, At: t.pos}, nil
+		}
+		return &Ident{Parts: strings.Split(t.text, "\x00"), At: t.pos}, nil
+	}
+	return nil, errorf(t.pos, "unexpected %q", tokenText(t))
+}
+
+func (p *parser) parseCallArgs() ([]Node, error) {
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+	var args []Node
+	for p.peek().kind != tokRParen {
+		arg, err := p.parseArg(func() (Node, error) { return p.parseExpr(precPipe) })
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// parseCase parses `case when c then v ... [else v] [end]`.
+func (p *parser) parseCase(start token) (Node, error) {
+	c := &Case{At: start.pos}
+	for p.isKeyword(p.peek(), "when") {
+		p.next()
+		cond, err := p.parseExpr(precOr)
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword(p.peek(), "then") {
+			return nil, errorf(p.peek().pos, "expected then")
+		}
+		p.next()
+		value, err := p.parseExpr(precOr)
+		if err != nil {
+			return nil, err
+		}
+		c.Whens = append(c.Whens, When{Cond: cond, Value: value})
+	}
+	if len(c.Whens) == 0 {
+		return nil, errorf(p.peek().pos, "expected when after case")
+	}
+	if p.isKeyword(p.peek(), "else") {
+		p.next()
+		value, err := p.parseExpr(precOr)
+		if err != nil {
+			return nil, err
+		}
+		c.Else = value
+	}
+	if p.isKeyword(p.peek(), "end") {
+		p.next()
+	}
+	return c, nil
+}
+
+// parseFString splits f"…{expr}…" into literal and expression parts.
+func (p *parser) parseFString(t token) (Node, error) {
+	f := &FString{At: t.pos}
+	body := t.text
+	// The body starts after the f and opening quote.
+	offset := t.pos + 2
+	for len(body) > 0 {
+		open := strings.IndexByte(body, '{')
+		if open < 0 {
+			f.Parts = append(f.Parts, &String{Value: unescape(body), At: offset})
+			break
+		}
+		if open > 0 {
+			f.Parts = append(f.Parts, &String{Value: unescape(body[:open]), At: offset})
+		}
+		end := strings.IndexByte(body[open:], '}')
+		if end < 0 {
+			return nil, errorf(offset+open, "unterminated { in f-string")
+		}
+		inner, err := Parse(body[open+1 : open+end])
+		if err != nil {
+			if e, ok := err.(*Error); ok {
+				e.Pos += offset + open + 1
+			}
+			return nil, err
+		}
+		shift(inner, offset+open+1)
+		f.Parts = append(f.Parts, inner)
+		body = body[open+end+1:]
+		offset += open + end + 1
+	}
+	return f, nil
+}
+
+// shift moves every position in n by delta.
+func shift(n Node, delta int) {
+	Walk(n, func(n Node) bool {
+		switch n := n.(type) {
+		case *Ident:
+			n.At += delta
+		case *Number:
+			n.At += delta
+		case *String:
+			n.At += delta
+		case *Bool:
+			n.At += delta
+		case *Null:
+			n.At += delta
+		case *Date:
+			n.At += delta
+		case *Interval:
+			n.At += delta
+		case *FString:
+			n.At += delta
+		case *RawSQL:
+			n.At += delta
+		case *Param:
+			n.At += delta
+		case *Unary:
+			n.At += delta
+		case *Binary:
+			n.At += delta
+		case *Range:
+			n.At += delta
+		case *Array:
+			n.At += delta
+		case *Call:
+			n.At += delta
+		case *NamedArg:
+			n.At += delta
+		case *Case:
+			n.At += delta
+		case *Lambda:
+			n.At += delta
+		}
+		return true
+	})
+}
+
+// isLambda reports whether the expression is `params -> body`.
+func (p *parser) isLambda() bool {
+	for _, t := range p.tokens {
+		switch t.kind {
+		case tokIdent, tokColon, tokNumber, tokString, tokDate:
+			continue
+		case tokOp:
+			return t.text == "->"
+		}
+		return false
+	}
+	return false
+}
+
+func (p *parser) parseLambda() (Node, error) {
+	l := &Lambda{At: p.peek().pos}
+	for {
+		t := p.next()
+		if t.kind == tokOp && t.text == "->" {
+			break
+		}
+		if t.kind != tokIdent || strings.Contains(t.text, "\x00") {
+			return nil, errorf(t.pos, "expected a parameter name, found %q", tokenText(t))
+		}
+		param := LambdaParam{Name: t.text}
+		if p.peek().kind == tokColon {
+			p.next()
+			d, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			param.Default = d
+		}
+		l.Params = append(l.Params, param)
+	}
+	body, err := p.parseExpr(precPipe)
+	if err != nil {
+		return nil, err
+	}
+	l.Body = body
+	return l, nil
+}
+
+func identName(text string) string {
+	return strings.ReplaceAll(text, "\x00", ".")
+}
+
+func tokenText(t token) string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return identName(t.text)
+}
@@ -0,0 +1,282 @@
+// Package gogen writes Go code running DUQL queries on database/sql: one
+// function per query, taking its params and returning a slice of row
+// structs whose fields are typed from the columns the query outputs.
+package gogen
+
+import (
+	"fmt"
+	"go/format"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/compiler"
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/semantic"
+)
+
+// Query is a query ready to be written as Go.
+type Query struct {
+	File string
+	// Name is the Go name of the function, taken from the file name.
+	Name    string
+	Result  *compiler.Result
+	Params  duql.Params
+	Columns []semantic.Column
+}
+
+// New compiles the query read from file for target, or for its
+// settings.target when target is empty, and reads the types of its output
+// columns from provider, which may be nil. Every output column must be
+// known, so queries reading tables nothing describes must select their
+// columns.
+func New(file string, q *duql.Query, target duql.TargetDialect, provider catalog.Provider) (*Query, error) {
+	analysis := semantic.Analyze(q, semantic.Options{Catalog: provider, Dir: filepath.Dir(file)})
+	if len(analysis.Problems) > 0 {
+		return nil, analysis.Problems[0]
+	}
+	if analysis.Output.Open {
+		return nil, fmt.Errorf("the columns the query outputs are not all known; give a catalog describing its tables or select its columns")
+	}
+	selected, err := selectColumns(q, analysis.Output.Columns)
+	if err != nil {
+		return nil, err
+	}
+	res, err := compiler.Compile(selected, compiler.Options{Target: target})
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Params) > 0 && strings.Contains(res.Params[0].Placeholder, "{") {
+		return nil, fmt.Errorf("%s binds params with clickhouse.WithParameters, which database/sql cannot pass", res.Target)
+	}
+
+	name := filepath.Base(file)
+	for _, ext := range []string{".yaml", ".yml", ".duql"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return &Query{
+		File:    file,
+		Name:    exported(name),
+		Result:  res,
+		Params:  q.Params,
+		Columns: analysis.Output.Columns,
+	}, nil
+}
+
+// selectColumns returns q ending with a select of cols, so the SQL lists
+// the columns the rows are scanned into rather than selecting *, whose
+// columns can change with the table.
+func selectColumns(q *duql.Query, cols []semantic.Column) (*duql.Query, error) {
+	sel := &duql.Select{}
+	seen := make(map[string]bool)
+	for _, col := range cols {
+		if seen[col.Name] {
+			return nil, fmt.Errorf("the query outputs two columns named %s; select the columns to keep", col.Name)
+		}
+		seen[col.Name] = true
+		ref := "`" + strings.ReplaceAll(col.Name, "`", "``") + "`"
+		sel.Columns = append(sel.Columns, duql.NamedExpression{Expression: duql.Expression{Value: ref}})
+	}
+	out := *q
+	out.Steps = append(append(duql.Steps{}, q.Steps...), sel)
+	return &out, nil
+}
+
+// Write returns the formatted Go source of the function for q in package
+// pkg.
+func Write(pkg string, q *Query) ([]byte, error) {
+	var b strings.Builder
+	imports := map[string]bool{"context": true}
+
+	fmt.Fprintf(&b, "const %sSQL = %s\n\n", unexported(q.Name), quote(q.Result.SQL))
+
+	row := q.Name + "Row"
+	fmt.Fprintf(&b, "// %s is a row returned by %s.\ntype %s struct {\n", row, q.Name, row)
+	fields := make([]string, len(q.Columns))
+	seen := make(map[string]int)
+	for i, col := range q.Columns {
+		field := exported(col.Name)
+		if seen[field]++; seen[field] > 1 {
+			field = fmt.Sprintf("%s%d", field, seen[field])
+		}
+		fields[i] = field
+		typ := columnType(col.Type, col.Nullable)
+		if strings.Contains(typ, "time.") {
+			imports["time"] = true
+		}
+		if strings.HasPrefix(typ, "sql.") {
+			imports["database/sql"] = true
+		}
+		fmt.Fprintf(&b, "\t%s %s `json:%q`\n", field, typ, col.Name)
+	}
+	b.WriteString("}\n\n")
+
+	// The arguments of the function are the declared params, in order;
+	// the arguments of the query are as many as the placeholders want.
+	var params, args []string
+	names := make(map[string]string)
+	for _, p := range q.Params {
+		arg := unexported(exported(p.Name))
+		if token.IsKeyword(arg) || arg == "ctx" || arg == "db" || arg == "rows" || arg == "err" || arg == "out" {
+			arg += "Param"
+		}
+		names[p.Name] = arg
+		typ := paramTypes[p.Type]
+		if strings.Contains(typ, "time.") {
+			imports["time"] = true
+		}
+		params = append(params, arg+" "+typ)
+	}
+	for _, p := range q.Result.Params {
+		switch p.Placeholder[0] {
+		case ':', '@':
+			imports["database/sql"] = true
+			args = append(args, fmt.Sprintf("sql.Named(%q, %s)", p.Name, names[p.Name]))
+		default:
+			args = append(args, names[p.Name])
+		}
+	}
+
+	fmt.Fprintf(&b, "// %s runs %s, compiled for %s.\n", q.Name, filepath.ToSlash(q.File), q.Result.Target)
+	fmt.Fprintf(&b, "func %s(ctx context.Context, db DBTX", q.Name)
+	for _, p := range params {
+		b.WriteString(", " + p)
+	}
+	fmt.Fprintf(&b, ") ([]%s, error) {\n", row)
+	fmt.Fprintf(&b, "\trows, err := db.QueryContext(ctx, %sSQL", unexported(q.Name))
+	for _, a := range args {
+		b.WriteString(", " + a)
+	}
+	b.WriteString(")\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\tdefer rows.Close()\n")
+	fmt.Fprintf(&b, "\tvar out []%s\n\tfor rows.Next() {\n\t\tvar r %s\n\t\tif err := rows.Scan(", row, row)
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("&r." + field)
+	}
+	b.WriteString("); err != nil {\n\t\t\treturn nil, err\n\t\t}\n\t\tout = append(out, r)\n\t}\n")
+	b.WriteString("\treturn out, rows.Err()\n}\n")
+
+	var src strings.Builder
+	fmt.Fprintf(&src, "// Code generated by duql gen go. DO NOT EDIT.\n// source: %s\n\npackage %s\n\nimport (\n", filepath.ToSlash(q.File), pkg)
+	for _, path := range []string{"context", "database/sql", "time"} {
+		if imports[path] {
+			fmt.Fprintf(&src, "\t%q\n", path)
+		}
+	}
+	src.WriteString(")\n\n" + b.String())
+	return format.Source([]byte(src.String()))
+}
+
+// DB returns the Go source of the DBTX interface the functions run on, in
+// package pkg.
+func DB(pkg string) []byte {
+	return []byte(fmt.Sprintf(`// Code generated by duql gen go. DO NOT EDIT.
+
+package %s
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX is what the generated functions run queries on, such as *sql.DB,
+// *sql.Conn or *sql.Tx.
+type DBTX interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+`, pkg))
+}
+
+// columnType is the Go type a column of type typ is scanned into: a
+// sql.Null[T] when the column may be NULL, and T when the catalog says it
+// cannot be.
+func columnType(typ string, nullable bool) string {
+	var t string
+	switch semantic.KindOf(typ) {
+	case semantic.Boolean:
+		t = "bool"
+	case semantic.Integer:
+		t = "int64"
+	case semantic.Decimal:
+		t = "float64"
+	case semantic.Text:
+		t = "string"
+	case semantic.Date, semantic.Time, semantic.Timestamp:
+		t = "time.Time"
+	default:
+		return "any"
+	}
+	if nullable {
+		return "sql.Null[" + t + "]"
+	}
+	return t
+}
+
+var paramTypes = map[duql.ParamType]string{
+	duql.ParamString:    "string",
+	duql.ParamInteger:   "int64",
+	duql.ParamNumber:    "float64",
+	duql.ParamBoolean:   "bool",
+	duql.ParamDate:      "time.Time",
+	duql.ParamTimestamp: "time.Time",
+}
+
+// initialisms are written in upper case in Go names.
+var initialisms = map[string]bool{
+	"id": true, "url": true, "uri": true, "sql": true, "json": true, "api": true,
+	"http": true, "uuid": true, "ip": true, "html": true, "xml": true, "csv": true,
+}
+
+// exported turns a snake_case, kebab-case or dotted name into an exported
+// Go name: user_id becomes UserID.
+func exported(name string) string {
+	var b strings.Builder
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		if initialisms[strings.ToLower(w)] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		r := []rune(w)
+		b.WriteString(string(unicode.ToUpper(r[0])) + string(r[1:]))
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+// unexported lowers the first word of an exported name: UserID becomes
+// userID and ID becomes id.
+func unexported(name string) string {
+	r := []rune(name)
+	i := 0
+	for i < len(r) && unicode.IsUpper(r[i]) {
+		i++
+	}
+	switch {
+	case i == len(r):
+		return strings.ToLower(name)
+	case i > 1:
+		// An initialism followed by a word, as in IDFilter.
+		i--
+	case i == 0:
+		return name
+	}
+	return strings.ToLower(string(r[:i])) + string(r[i:])
+}
+
+// quote writes s as a raw string literal when it has no backquote.
+func quote(s string) string {
+	if !strings.Contains(s, "`") {
+		return "`\n" + s + "\n`"
+	}
+	return fmt.Sprintf("%q", s)
+}
@@ -0,0 +1,229 @@
+package gogen
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/duql"
+)
+
+var testCatalog = catalog.Tables{
+	"users": {Name: "users", Columns: []catalog.Column{
+		{Name: "id", Type: "bigint"},
+		{Name: "name", Type: "text"},
+		{Name: "score", Type: "double precision", Nullable: true},
+		{Name: "created_at", Type: "timestamp"},
+	}},
+}
+
+func newQuery(t *testing.T, file, src string, target duql.TargetDialect, p catalog.Provider) (*Query, error) {
+	t.Helper()
+	var q duql.Query
+	if err := yaml.Unmarshal([]byte(src), &q); err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	return New(file, &q, target, p)
+}
+
+func TestWrite(t *testing.T) {
+	const src = `
+params:
+  min_score: number
+  type: string
+dataset: users
+steps:
+  - filter: score > $min_score && name != $type
+  - select: [id, name, score, created_at]`
+	tests := []struct {
+		target duql.TargetDialect
+		want   []string
+	}{
+		{duql.Postgres, []string{
+			"func ActiveUsers(ctx context.Context, db DBTX, minScore float64, typeParam string) ([]ActiveUsersRow, error) {",
+			"db.QueryContext(ctx, activeUsersSQL, minScore, typeParam)",
+			"score > $1",
+		}},
+		{duql.MySQL, []string{
+			"db.QueryContext(ctx, activeUsersSQL, minScore, typeParam)",
+		}},
+		{duql.SQLite, []string{
+			`db.QueryContext(ctx, activeUsersSQL, sql.Named("min_score", minScore), sql.Named("type", typeParam))`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.target), func(t *testing.T) {
+			q, err := newQuery(t, "queries/active_users.yaml", src, tt.target, testCatalog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := Write("db", q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := append([]string{
+				"// Code generated by duql gen go. DO NOT EDIT.\n// source: queries/active_users.yaml\n\npackage db\n",
+				"\t\"context\"\n\t\"database/sql\"\n\t\"time\"\n",
+				"ID        int64             `json:\"id\"`",
+				"Name      string            `json:\"name\"`",
+				"Score     sql.Null[float64] `json:\"score\"`",
+				"CreatedAt time.Time         `json:\"created_at\"`",
+				"rows.Scan(&r.ID, &r.Name, &r.Score, &r.CreatedAt)",
+				"// ActiveUsers runs queries/active_users.yaml, compiled for " + string(tt.target) + ".",
+			}, tt.want...)
+			for _, w := range want {
+				if !strings.Contains(string(out), w) {
+					t.Errorf("output does not contain %q:\n%s", w, out)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteDuplicateFields(t *testing.T) {
+	q, err := newQuery(t, "counts.yml", `
+dataset: users
+steps:
+  - select: {user_id: id, user-id: id}`, duql.Postgres, testCatalog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Write("db", q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"UserID  int64 `json:\"user_id\"`", "UserID2 int64 `json:\"user-id\"`", "rows.Scan(&r.UserID, &r.UserID2)"} {
+		if !strings.Contains(string(out), w) {
+			t.Errorf("output does not contain %q:\n%s", w, out)
+		}
+	}
+	for _, path := range []string{`"database/sql"`, `"time"`} {
+		if strings.Contains(string(out), path) {
+			t.Errorf("output imports %s without using it:\n%s", path, out)
+		}
+	}
+}
+
+// TestNewSelectsColumns checks the SQL lists the columns a query outputs
+// rather than selecting *.
+func TestNewSelectsColumns(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"dataset: users", "SELECT id, name, score, created_at FROM users"},
+		{"dataset: users\nsteps:\n  - generate: {double: score * 2}", "SELECT id, name, score, created_at, score * 2 AS double FROM users"},
+		{"dataset: users\nsteps:\n  - select: [name, id]", "SELECT name, id FROM users"},
+	}
+	for _, tt := range tests {
+		q, err := newQuery(t, "q.yaml", tt.src, duql.Postgres, testCatalog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(strings.Fields(q.Result.SQL), " "); got != tt.want {
+			t.Errorf("%s\ngot %s\nwant %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		target  duql.TargetDialect
+		catalog catalog.Provider
+		want    string
+	}{
+		{
+			name:   "unknown columns",
+			src:    "dataset: events",
+			target: duql.Postgres,
+			want:   "the columns the query outputs are not all known",
+		},
+		{
+			name:    "unknown column",
+			src:     "dataset: users\nsteps:\n  - select: [missing]",
+			target:  duql.Postgres,
+			catalog: testCatalog,
+			want:    "unknown column missing",
+		},
+		{
+			name:    "duplicate columns",
+			src:     "dataset: users\nsteps:\n  - join: {dataset: users, where: users.id == users.id}",
+			target:  duql.Postgres,
+			catalog: testCatalog,
+			want:    "the query outputs two columns named id",
+		},
+		{
+			name:    "clickhouse params",
+			src:     "params: {n: integer}\ndataset: users\nsteps:\n  - filter: id == $n",
+			target:  duql.ClickHouse,
+			catalog: testCatalog,
+			want:    "clickhouse.WithParameters",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newQuery(t, "q.yaml", tt.src, tt.target, tt.catalog)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnType(t *testing.T) {
+	tests := []struct {
+		typ      string
+		nullable bool
+		want     string
+	}{
+		{"boolean", false, "bool"},
+		{"bigint", false, "int64"},
+		{"bigint", true, "sql.Null[int64]"},
+		{"numeric(10,2)", true, "sql.Null[float64]"},
+		{"varchar(20)", false, "string"},
+		{"date", false, "time.Time"},
+		{"timestamp with time zone", true, "sql.Null[time.Time]"},
+		{"jsonb", true, "any"},
+		{"", false, "any"},
+	}
+	for _, tt := range tests {
+		if got := columnType(tt.typ, tt.nullable); got != tt.want {
+			t.Errorf("columnType(%q, %v) = %s, want %s", tt.typ, tt.nullable, got, tt.want)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name, exported, unexported string
+	}{
+		{"user_id", "UserID", "userID"},
+		{"id", "ID", "id"},
+		{"active-users", "ActiveUsers", "activeUsers"},
+		{"api.url", "APIURL", "apiurl"},
+		{"id_filter", "IDFilter", "idFilter"},
+		{"2024_sales", "X2024Sales", "x2024Sales"},
+		{"", "X", "x"},
+	}
+	for _, tt := range tests {
+		if got := exported(tt.name); got != tt.exported {
+			t.Errorf("exported(%q) = %s, want %s", tt.name, got, tt.exported)
+		}
+		if got := unexported(tt.exported); got != tt.unexported {
+			t.Errorf("unexported(%q) = %s, want %s", tt.exported, got, tt.unexported)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := quote("SELECT 1"); got != "`\nSELECT 1\n`" {
+		t.Errorf("got %s", got)
+	}
+	if got := quote("SELECT `a`"); got != "\"SELECT `a`\"" {
+		t.Errorf("got %s", got)
+	}
+}
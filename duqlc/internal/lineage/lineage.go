@@ -0,0 +1,117 @@
+// Package lineage traces each output column of a query back to the columns
+// of the tables and files it is read or computed from, through select
+// renames, generated expressions, aggregates, joins and declarations.
+package lineage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/semantic"
+)
+
+// Formats are the output formats Write accepts.
+var Formats = []string{"json", "dot"}
+
+// Query is the lineage of the output columns of one query.
+type Query struct {
+	File    string            `json:"file"`
+	Columns []semantic.Column `json:"columns"`
+	// Open is set when the query outputs more columns than it lists, such
+	// as those of a table the catalog does not describe.
+	Open bool `json:"open,omitempty"`
+}
+
+// Trace returns the lineage of the query read from file. Provider may be
+// nil, in which case columns are traced to the tables the query names.
+func Trace(file string, q *duql.Query, provider catalog.Provider) *Query {
+	res := semantic.Analyze(q, semantic.Options{Catalog: provider, Dir: filepath.Dir(file)})
+	return &Query{File: file, Columns: res.Output.Columns, Open: res.Output.Open}
+}
+
+// Write writes the lineage of the queries as JSON or as a Graphviz DOT
+// graph from source columns to output columns.
+func Write(w io.Writer, queries []*Query, format string) error {
+	switch format {
+	case "", "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(queries)
+	case "dot":
+		_, err := io.WriteString(w, dot(queries))
+		return err
+	}
+	return fmt.Errorf("unknown format %s, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+func dot(queries []*Query) string {
+	// tables maps each source table to its columns, so that queries
+	// reading the same table share its nodes.
+	tables := make(map[string]map[string]bool)
+	var edges []string
+	var b strings.Builder
+	b.WriteString("digraph lineage {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+
+	for i, q := range queries {
+		fmt.Fprintf(&b, "  subgraph %s {\n", quote(fmt.Sprintf("cluster_query_%d", i)))
+		fmt.Fprintf(&b, "    label=%s;\n", quote(q.File))
+		for _, col := range q.Columns {
+			node := quote(q.File + ":" + col.Name)
+			fmt.Fprintf(&b, "    %s [label=%s];\n", node, quote(col.Name))
+			for _, o := range col.Lineage {
+				if tables[o.Table] == nil {
+					tables[o.Table] = make(map[string]bool)
+				}
+				tables[o.Table][o.Column] = true
+				edges = append(edges, fmt.Sprintf("  %s -> %s;\n", quote(tableName(o.Table)+"."+o.Column), node))
+			}
+		}
+		b.WriteString("  }\n")
+	}
+
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		fmt.Fprintf(&b, "  subgraph %s {\n", quote(fmt.Sprintf("cluster_table_%d", i)))
+		fmt.Fprintf(&b, "    label=%s;\n", quote(tableName(name)))
+		b.WriteString("    style=filled;\n    color=lightgrey;\n")
+		cols := make([]string, 0, len(tables[name]))
+		for col := range tables[name] {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		for _, col := range cols {
+			fmt.Fprintf(&b, "    %s [label=%s];\n", quote(tableName(name)+"."+col), quote(col))
+		}
+		b.WriteString("  }\n")
+	}
+	for _, edge := range edges {
+		b.WriteString(edge)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// tableName names the table of an origin, which may not be known.
+func tableName(table string) string {
+	if table == "" {
+		return "?"
+	}
+	return table
+}
+
+// quote writes s as a DOT identifier.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
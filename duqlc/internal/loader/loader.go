@@ -0,0 +1,406 @@
+// Package loader reads DUQL queries from files, along with the
+// declarations they import from other files.
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+	"github.com/theduql/duql/internal/project"
+)
+
+// Load reads the query in file and adds the declarations it imports to its
+// declare section as <namespace>.<name>. Imports are looked up next to the
+// importing file, then in the libraries of the project the query belongs
+// to. Datasets naming another DUQL file are loaded the same way, into
+// Dataset.Query. The ${name} variables of every file read are replaced
+// first. Errors name the file whose import failed.
+func Load(file string, opts Options) (*duql.Query, error) {
+	l := &loader{opts: opts, dir: filepath.Dir(file)}
+	return l.query(file, []string{file})
+}
+
+// Parse reads a query from data as if it were the contents of file, which
+// need not exist: its imports, datasets and project are looked up relative
+// to it all the same.
+func Parse(file string, data []byte, opts Options) (*duql.Query, error) {
+	l := &loader{opts: opts, dir: filepath.Dir(file)}
+	return l.parse(file, data, []string{file})
+}
+
+// Options control loading.
+type Options struct {
+	// Vars are values for ${name} variables, overriding every other source.
+	Vars map[string]string
+}
+
+type loader struct {
+	opts Options
+	// dir is where the project of the query is looked for; libraries and
+	// vars are what it declares once it is found.
+	dir       string
+	found     bool
+	libraries []string
+	vars      map[string]string
+}
+
+// read parses file with its variables replaced into out.
+func (l *loader) read(file string, out interface{}) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return l.decode(file, data, out)
+}
+
+// decode parses data, the contents of file, with its variables replaced
+// into out.
+func (l *loader) decode(file string, data []byte, out interface{}) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if err := l.interpolate(file, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	if err := doc.Decode(out); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// query reads the query in file along with what it imports and the queries
+// its datasets name. Stack lists the files being read, starting with the
+// query, to detect cycles.
+func (l *loader) query(file string, stack []string) (*duql.Query, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return l.parse(file, data, stack)
+}
+
+// parse reads the query in data, the contents of file, like query.
+func (l *loader) parse(file string, data []byte, stack []string) (*duql.Query, error) {
+	var query duql.Query
+	if err := l.decode(file, data, &query); err != nil {
+		return nil, err
+	}
+
+	if len(query.Import) > 0 {
+		imported, err := l.imports(file, query.Import, []string{file})
+		if err != nil {
+			return nil, err
+		}
+		if query.Declare == nil {
+			query.Declare = make(duql.Declare)
+		}
+		for _, d := range imported {
+			var value duql.DeclareValue
+			if err := d.value.Decode(&value); err != nil {
+				return nil, fmt.Errorf("%s: invalid declaration %s: %w", d.file, d.name, err)
+			}
+			query.Declare[d.name] = value
+		}
+	}
+
+	if err := l.datasets(file, &query, stack); err != nil {
+		return nil, err
+	}
+	return &query, nil
+}
+
+// datasets loads the queries the datasets of q name, relative to file.
+func (l *loader) datasets(file string, q *duql.Query, stack []string) error {
+	var load func(ds *duql.Dataset) error
+	var walk func(steps duql.Steps) error
+	load = func(ds *duql.Dataset) error {
+		if ds.Inline() {
+			if err := load(&ds.Query.Dataset); err != nil {
+				return err
+			}
+			return walk(ds.Query.Steps)
+		}
+		source := ds.QueryPath()
+		if source == "" {
+			return nil
+		}
+		path, err := l.resolve(file, source)
+		if err != nil {
+			return fmt.Errorf("%s: dataset %s: %w", file, source, err)
+		}
+		for i, f := range stack {
+			if sameFile(f, path) {
+				cycle := append(append([]string{}, stack[i:]...), path)
+				return fmt.Errorf("%s: dataset cycle: %s", file, strings.Join(cycle, " → "))
+			}
+		}
+		sub, err := l.query(path, append(stack, path))
+		if err != nil {
+			return err
+		}
+		ds.Query, ds.File = sub, path
+		return nil
+	}
+	walk = func(steps duql.Steps) error {
+		for _, step := range steps {
+			var err error
+			switch s := step.(type) {
+			case *duql.Join:
+				err = load(&s.Dataset)
+			case *duql.Append:
+				err = load(&s.Dataset)
+			case *duql.Union:
+				err = load(&s.Dataset)
+			case *duql.Intersect:
+				err = load(&s.Dataset)
+			case *duql.Except:
+				err = load(&s.Dataset)
+			case *duql.Group:
+				err = walk(s.Steps)
+			case *duql.Window:
+				err = walk(s.Steps)
+			case *duql.Loop:
+				err = walk(s.Steps)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := load(&q.Dataset); err != nil {
+		return err
+	}
+	if err := walk(q.Steps); err != nil {
+		return err
+	}
+	for _, v := range q.Declare {
+		if v.Pipeline == nil {
+			continue
+		}
+		if err := load(&v.Pipeline.Dataset); err != nil {
+			return err
+		}
+		if err := walk(v.Pipeline.Steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declaration is a declaration read from an imported file, named as the
+// importing file uses it.
+type declaration struct {
+	name  string
+	value *yaml.Node
+	// file is the file the declaration is written in.
+	file string
+}
+
+// library is the part of an imported file the loader reads.
+type library struct {
+	Import  []duql.Import `yaml:"import"`
+	Declare yaml.Node     `yaml:"declare"`
+}
+
+// imports reads the declarations file imports. Stack lists the files
+// being imported, starting with the query, to detect cycles.
+func (l *loader) imports(file string, imports []duql.Import, stack []string) ([]declaration, error) {
+	var out []declaration
+	seen := make(map[string]bool)
+	for _, imp := range imports {
+		if err := imp.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		ns := imp.Namespace()
+		if seen[ns] {
+			return nil, fmt.Errorf("%s: namespace %s is imported twice", file, ns)
+		}
+		seen[ns] = true
+
+		path, err := l.resolve(file, imp.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: import %s: %w", file, imp.Path, err)
+		}
+		for i, f := range stack {
+			if sameFile(f, path) {
+				cycle := append(append([]string{}, stack[i:]...), path)
+				return nil, fmt.Errorf("%s: import cycle: %s", file, strings.Join(cycle, " → "))
+			}
+		}
+		decls, err := l.library(path, append(stack, path))
+		if err != nil {
+			return nil, err
+		}
+
+		// References between the declarations of the library become
+		// references to their imported names.
+		names := make(map[string]string, len(decls))
+		for _, d := range decls {
+			names[d.name] = ns + "." + d.name
+		}
+		for _, d := range decls {
+			renameDeclaration(d.value, names)
+			out = append(out, declaration{name: ns + "." + d.name, value: d.value, file: d.file})
+		}
+	}
+	return out, nil
+}
+
+// library reads the declarations of an imported file, both its own and
+// those it imports in turn.
+func (l *loader) library(path string, stack []string) ([]declaration, error) {
+	var lib library
+	if err := l.read(path, &lib); err != nil {
+		return nil, err
+	}
+	decls, err := l.imports(path, lib.Import, stack)
+	if err != nil {
+		return nil, err
+	}
+	if lib.Declare.Kind == 0 {
+		return decls, nil
+	}
+	if lib.Declare.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: declare must be an object", path)
+	}
+	for i := 0; i < len(lib.Declare.Content); i += 2 {
+		decls = append(decls, declaration{
+			name:  lib.Declare.Content[i].Value,
+			value: lib.Declare.Content[i+1],
+			file:  path,
+		})
+	}
+	return decls, nil
+}
+
+// resolve finds an imported file next to the importing file, then in the
+// libraries.
+func (l *loader) resolve(from, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	if err := l.project(); err != nil {
+		return "", err
+	}
+	candidates := []string{filepath.Join(filepath.Dir(from), path)}
+	for _, lib := range l.libraries {
+		candidates = append(candidates, filepath.Join(lib, path))
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	if len(l.libraries) == 0 {
+		return "", fmt.Errorf("file not found")
+	}
+	return "", fmt.Errorf("file not found, nor in %s", strings.Join(l.libraries, ", "))
+}
+
+// project finds the libraries and vars of the project the query belongs
+// to, the first time they are needed.
+func (l *loader) project() error {
+	if l.found {
+		return nil
+	}
+	l.found = true
+	path := project.FindManifest(l.dir)
+	if path == "" {
+		return nil
+	}
+	m, err := project.LoadManifest(path)
+	if err != nil {
+		return err
+	}
+	l.vars = m.Vars
+	wd, _ := os.Getwd()
+	for _, lib := range m.Libraries {
+		path := m.Path(lib)
+		// The manifest is found by absolute path; name the libraries
+		// relative to the working directory in errors where possible.
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		l.libraries = append(l.libraries, path)
+	}
+	return nil
+}
+
+func sameFile(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return os.SameFile(ia, ib)
+}
+
+// renameDeclaration rewrites the references to names in the expressions
+// of a declaration. Parameters of a function shadow the names.
+func renameDeclaration(value *yaml.Node, names map[string]string) {
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i < len(value.Content); i += 2 {
+			if value.Content[i].Value != "parameters" {
+				continue
+			}
+			var params []duql.FunctionParameter
+			if err := value.Content[i+1].Decode(&params); err != nil {
+				break
+			}
+			shadowed := make(map[string]string, len(names))
+			for k, v := range names {
+				shadowed[k] = v
+			}
+			for _, p := range params {
+				delete(shadowed, p.Name)
+			}
+			names = shadowed
+		}
+	}
+	rename(value, names)
+}
+
+// rename rewrites the references to names in the expressions below n.
+// Mapping keys name columns and fields and are left alone, except for the
+// conditions of case branches.
+func rename(n *yaml.Node, names map[string]string) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == "!!str" {
+			n.Value = expr.Rename(n.Value, names)
+		}
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			rename(item, names)
+		}
+	case yaml.MappingNode:
+		for i := 0; i < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			switch key.Value {
+			case "parameters", "sql":
+				continue
+			case "case":
+				if value.Kind == yaml.SequenceNode {
+					for _, branch := range value.Content {
+						if branch.Kind == yaml.MappingNode && len(branch.Content) == 2 {
+							rename(branch.Content[0], names)
+						}
+					}
+				}
+			}
+			rename(value, names)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestStrictFileDatasets checks strict mode rejects raw SQL in the queries
+// a strict query reads from other files.
+func TestStrictFileDatasets(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "raw.yml", "dataset: orders\nsteps:\n  - filter: sql'amount > 1'\n")
+	writeFile(t, dir, "plain.yml", "dataset: orders\nsteps:\n  - filter: amount > 1\n")
+
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "main dataset",
+			src:  "settings: {strict: true}\ndataset: raw.yml",
+			want: "raw SQL is not allowed in strict mode: dataset(" + filepath.Join(dir, "raw.yml") + ").steps[0].filter",
+		},
+		{
+			name: "inline join dataset",
+			src: `settings: {strict: true}
+dataset: customers
+steps:
+  - join:
+      dataset:
+        dataset: raw.yml
+        steps:
+          - select: [customer_id]
+      where: customers.id == customer_id`,
+			want: "raw SQL is not allowed in strict mode: steps[0].join.dataset.dataset(" + filepath.Join(dir, "raw.yml") + ").steps[0].filter",
+		},
+		{
+			name: "no raw SQL",
+			src:  "settings: {strict: true}\ndataset: plain.yml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeFile(t, dir, "query.yml", tt.src)
+			q, err := Load(file, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = q.Validate()
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	duql "github.com/theduql/duql/internal/duql"
+)
+
+// varPattern matches a ${name} variable, or $${ written for a literal ${.
+var varPattern = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+
+var varName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// interpolate replaces the ${name} variables in the text of the document
+// read from file, in keys and values alike. A variable takes its value
+// from, in order, Options.Vars, the vars of the project manifest, the
+// environment variable of the same name and the default in the vars of the
+// file. The environment is only read for variables the file declares, so
+// an unrelated environment variable cannot slip past the type check.
+// Values declared in the file are checked against their type.
+func (l *loader) interpolate(file string, doc *yaml.Node) error {
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+
+	// The vars of the file are read as written; they are not interpolated.
+	declared := make(map[string]duql.Var)
+	lines := make(map[string]int)
+	var skip *yaml.Node
+	if root.Kind == yaml.MappingNode {
+		for i := 0; i < len(root.Content); i += 2 {
+			if root.Content[i].Value != "vars" {
+				continue
+			}
+			skip = root.Content[i+1]
+			if err := skip.Decode(&declared); err != nil {
+				return fmt.Errorf("%s:%d: invalid vars: %w", file, skip.Line, err)
+			}
+			for j := 0; j+1 < len(skip.Content); j += 2 {
+				lines[skip.Content[j].Value] = skip.Content[j].Line
+			}
+		}
+	}
+
+	values := make(map[string]string)
+	resolve := func(name string, line int) (string, error) {
+		if value, ok := values[name]; ok {
+			return value, nil
+		}
+		if !varName.MatchString(name) {
+			return "", fmt.Errorf("%s:%d: invalid variable name ${%s}", file, line, name)
+		}
+		v, isDeclared := declared[name]
+		value, ok := l.opts.Vars[name]
+		if !ok {
+			if err := l.project(); err != nil {
+				return "", err
+			}
+			value, ok = l.vars[name]
+		}
+		if !ok && isDeclared {
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok && isDeclared && v.Default != nil {
+			value, ok = *v.Default, true
+		}
+		if !ok {
+			return "", fmt.Errorf("%s:%d: unresolved variable ${%s}; set it with --var %s=… or in the vars of duql.yml, or declare it in vars to read it from the environment", file, line, name, name)
+		}
+		if isDeclared {
+			if err := v.Check(value); err != nil {
+				return "", fmt.Errorf("%s:%d: variable %s: %w", file, lines[name], name, err)
+			}
+		}
+		values[name] = value
+		return value, nil
+	}
+
+	var walk func(n *yaml.Node) error
+	walk = func(n *yaml.Node) error {
+		if n == skip {
+			return nil
+		}
+		if n.Kind == yaml.AliasNode {
+			return nil
+		}
+		if n.Kind != yaml.ScalarNode {
+			for _, c := range n.Content {
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		matches := varPattern.FindAllStringSubmatchIndex(n.Value, -1)
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			b.WriteString(n.Value[last:m[0]])
+			last = m[1]
+			if m[2] < 0 {
+				b.WriteString("${")
+				continue
+			}
+			line := n.Line + strings.Count(n.Value[:m[0]], "\n")
+			if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+				line++
+			}
+			value, err := resolve(n.Value[m[2]:m[3]], line)
+			if err != nil {
+				return err
+			}
+			b.WriteString(value)
+		}
+		b.WriteString(n.Value[last:])
+		n.Value = b.String()
+		// A plain scalar is typed by its value once replaced, so
+		// take: ${limit} is a number.
+		if n.Style == 0 && n.Tag == "!!str" {
+			n.Tag = ""
+		}
+		return nil
+	}
+	return walk(root)
+}
@@ -0,0 +1,108 @@
+package loader
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	duql "github.com/theduql/duql/internal/duql"
+)
+
+// TestInterpolatePrecedence checks a variable is taken from --var, then the
+// vars of duql.yml, then the environment, then its default.
+func TestInterpolatePrecedence(t *testing.T) {
+	const src = `vars:
+  duql_test_schema: {default: from_default}
+dataset: ${duql_test_schema}.orders`
+	tests := []struct {
+		name     string
+		vars     map[string]string
+		manifest bool
+		env      bool
+		want     string
+	}{
+		{"var", map[string]string{"duql_test_schema": "from_var"}, true, true, "from_var.orders"},
+		{"manifest", nil, true, true, "from_manifest.orders"},
+		{"environment", nil, false, true, "from_env.orders"},
+		{"default", nil, false, false, "from_default.orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.manifest {
+				writeFile(t, dir, "duql.yml", "vars:\n  duql_test_schema: from_manifest\n")
+			}
+			if tt.env {
+				t.Setenv("duql_test_schema", "from_env")
+			}
+			q, err := Parse(filepath.Join(dir, "q.yml"), []byte(src), Options{Vars: tt.vars})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Dataset.Simple != tt.want {
+				t.Errorf("got dataset %s, want %s", q.Dataset.Simple, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("duql_test_limit", "10")
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"escaped", "dataset: orders\nsteps:\n  - filter: note == '$${not_a_var}'", "note == '${not_a_var}'"},
+		{"declared environment", "vars:\n  duql_test_limit: {type: integer}\ndataset: orders\nsteps:\n  - filter: n < ${duql_test_limit}", "n < 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(filepath.Join(t.TempDir(), "q.yml"), []byte(tt.src), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.Steps[0].(*duql.Filter).Expression.Value; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateErrors(t *testing.T) {
+	t.Setenv("duql_test_limit", "ten")
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "undeclared environment variable",
+			src:  "dataset: orders\nsteps:\n  - take: ${duql_test_limit}",
+			want: "q.yml:3: unresolved variable ${duql_test_limit}",
+		},
+		{
+			name: "line in a block scalar",
+			src:  "dataset: orders\nsteps:\n  - filter: |\n      a > 1 &&\n      b < ${missing}",
+			want: "q.yml:5: unresolved variable ${missing}",
+		},
+		{
+			name: "invalid name",
+			src:  "dataset: ${1st}",
+			want: "q.yml:1: invalid variable name ${1st}",
+		},
+		{
+			name: "type names the declaration",
+			src:  "vars:\n  duql_test_limit: {type: integer}\ndataset: orders\nsteps:\n  - take: ${duql_test_limit}",
+			want: "q.yml:2: variable duql_test_limit:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(filepath.Join(t.TempDir(), "q.yml"), []byte(tt.src), Options{})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
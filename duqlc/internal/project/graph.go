@@ -0,0 +1,280 @@
+// Package project relates the queries of a directory to each other. A
+// query whose into names a result produces it, and queries that read that
+// name as their dataset, join it, append it or take its union, intersect
+// or except consume it.
+package project
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/duql"
+)
+
+// Query is one query of a project.
+type Query struct {
+	// File is the path of the query relative to the project root.
+	File string `json:"file"`
+	// Into is the result the query produces, if any.
+	Into string `json:"into,omitempty"`
+	// Reads are the tables and results the query reads, sorted. Local data
+	// files, raw SQL and declared pipelines are not listed.
+	Reads []string `json:"reads,omitempty"`
+}
+
+// Graph is the graph of producers and consumers of a project.
+type Graph struct {
+	Queries []*Query `json:"queries"`
+	// Producers maps each result to the query producing it.
+	Producers map[string]*Query `json:"-"`
+	// Sources are the names read that no query produces and that are, or
+	// may be, tables of the database.
+	Sources []string `json:"sources,omitempty"`
+	// Missing are the names read that no query produces and that the
+	// catalog does not describe either.
+	Missing []string `json:"missing,omitempty"`
+	// Cycles are the groups of queries that depend on each other, each as
+	// a list of files.
+	Cycles [][]string `json:"cycles,omitempty"`
+	// Conflicts are the results produced by more than one query.
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// New builds the graph of the queries read from files, which are named
+// relative to root. When tables is not nil, names read that no query
+// produces and the catalog does not describe are missing producers.
+func New(root string, files []string, queries []*duql.Query, tables catalog.Provider) (*Graph, error) {
+	g := &Graph{Producers: make(map[string]*Query)}
+	for i, q := range queries {
+		file := files[i]
+		if rel, err := filepath.Rel(root, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+		node := &Query{File: filepath.ToSlash(file), Reads: reads(q)}
+		if q.Into != nil {
+			node.Into = q.Into.Name
+		}
+		g.Queries = append(g.Queries, node)
+	}
+	sort.Slice(g.Queries, func(i, j int) bool { return g.Queries[i].File < g.Queries[j].File })
+
+	for _, q := range g.Queries {
+		if q.Into == "" {
+			continue
+		}
+		key := strings.ToLower(q.Into)
+		if other, ok := g.Producers[key]; ok {
+			g.Conflicts = append(g.Conflicts, fmt.Sprintf("%s is produced by both %s and %s", q.Into, other.File, q.File))
+			continue
+		}
+		g.Producers[key] = q
+	}
+
+	unproduced := make(map[string]bool)
+	for _, q := range g.Queries {
+		for _, name := range q.Reads {
+			if g.Producer(name) == nil {
+				unproduced[name] = true
+			}
+		}
+	}
+	for name := range unproduced {
+		if tables == nil {
+			g.Sources = append(g.Sources, name)
+			continue
+		}
+		t, err := tables.Table(name)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			g.Sources = append(g.Sources, name)
+		} else {
+			g.Missing = append(g.Missing, name)
+		}
+	}
+	sort.Strings(g.Sources)
+	sort.Strings(g.Missing)
+	g.Cycles = g.cycles()
+	return g, nil
+}
+
+// Producer returns the query producing name, or nil.
+func (g *Graph) Producer(name string) *Query {
+	return g.Producers[strings.ToLower(name)]
+}
+
+// dependencies returns the queries q reads the results of.
+func (g *Graph) dependencies(q *Query) []*Query {
+	var deps []*Query
+	for _, name := range q.Reads {
+		if p := g.Producer(name); p != nil {
+			deps = append(deps, p)
+		}
+	}
+	return deps
+}
+
+// Order returns the queries so that every query comes after the queries
+// producing what it reads. Queries that do not depend on each other keep
+// the order of their files. It fails when queries depend on each other in
+// a cycle.
+func (g *Graph) Order() ([]*Query, error) {
+	if len(g.Cycles) > 0 {
+		return nil, fmt.Errorf("queries depend on each other in a cycle: %s", strings.Join(g.Cycles[0], " → "))
+	}
+	done := make(map[*Query]bool)
+	var order []*Query
+	var visit func(q *Query)
+	visit = func(q *Query) {
+		if done[q] {
+			return
+		}
+		done[q] = true
+		for _, dep := range g.dependencies(q) {
+			visit(dep)
+		}
+		order = append(order, q)
+	}
+	for _, q := range g.Queries {
+		visit(q)
+	}
+	return order, nil
+}
+
+// cycles finds the strongly connected components of the queries that
+// contain a cycle, using Tarjan's algorithm.
+func (g *Graph) cycles() [][]string {
+	index := make(map[*Query]int)
+	low := make(map[*Query]int)
+	onStack := make(map[*Query]bool)
+	var stack []*Query
+	var cycles [][]string
+
+	var connect func(q *Query)
+	connect = func(q *Query) {
+		index[q] = len(index)
+		low[q] = index[q]
+		stack = append(stack, q)
+		onStack[q] = true
+
+		self := false
+		for _, dep := range g.dependencies(q) {
+			if dep == q {
+				self = true
+			}
+			if _, seen := index[dep]; !seen {
+				connect(dep)
+				low[q] = min(low[q], low[dep])
+			} else if onStack[dep] {
+				low[q] = min(low[q], index[dep])
+			}
+		}
+
+		if low[q] != index[q] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top.File)
+			if top == q {
+				break
+			}
+		}
+		if len(component) > 1 || self {
+			sort.Strings(component)
+			cycles = append(cycles, append(component, component[0]))
+		}
+	}
+	for _, q := range g.Queries {
+		if _, seen := index[q]; !seen {
+			connect(q)
+		}
+	}
+	return cycles
+}
+
+// reads lists the tables and results a query reads.
+func reads(q *duql.Query) []string {
+	names := make(map[string]bool)
+	var walk func(steps duql.Steps)
+	var add func(ds duql.Dataset)
+	add = func(ds duql.Dataset) {
+		if ds.SQL != nil {
+			return
+		}
+		if ds.Inline() {
+			add(ds.Query.Dataset)
+			walk(ds.Query.Steps)
+			return
+		}
+		if ds.Query != nil {
+			// A query read from another file reads what that file does.
+			for _, name := range reads(ds.Query) {
+				names[name] = true
+			}
+			return
+		}
+		if ds.QueryPath() != "" {
+			return
+		}
+		source := ds.Simple
+		if ds.Complex != nil {
+			if ds.Complex.Format != "" && ds.Complex.Format != duql.Table {
+				return
+			}
+			source = ds.Complex.Name
+		}
+		if source == "" || catalog.FileFormat(source) != "" {
+			return
+		}
+		if v, ok := q.Declare[source]; ok && v.Pipeline != nil {
+			return
+		}
+		names[source] = true
+	}
+	walk = func(steps duql.Steps) {
+		for _, step := range steps {
+			switch s := step.(type) {
+			case *duql.Join:
+				add(s.Dataset)
+			case *duql.Append:
+				add(s.Dataset)
+			case *duql.Union:
+				add(s.Dataset)
+			case *duql.Intersect:
+				add(s.Dataset)
+			case *duql.Except:
+				add(s.Dataset)
+			case *duql.Group:
+				walk(s.Steps)
+			case *duql.Window:
+				walk(s.Steps)
+			case *duql.Loop:
+				walk(s.Steps)
+			}
+		}
+	}
+
+	add(q.Dataset)
+	walk(q.Steps)
+	for _, v := range q.Declare {
+		if v.Pipeline != nil {
+			add(v.Pipeline.Dataset)
+			walk(v.Pipeline.Steps)
+		}
+	}
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
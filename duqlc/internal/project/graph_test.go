@@ -0,0 +1,154 @@
+package project
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/duql"
+)
+
+// graph builds the graph of the queries in srcs, keyed by file.
+func graph(t *testing.T, srcs map[string]string, tables catalog.Provider) *Graph {
+	t.Helper()
+	var files []string
+	var queries []*duql.Query
+	for file, src := range srcs {
+		var q duql.Query
+		if err := yaml.Unmarshal([]byte(src), &q); err != nil {
+			t.Fatalf("parsing %s: %v", file, err)
+		}
+		files = append(files, "/shop/"+file)
+		queries = append(queries, &q)
+	}
+	g, err := New("/shop", files, queries, tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func files(queries []*Query) []string {
+	var out []string
+	for _, q := range queries {
+		out = append(out, q.File)
+	}
+	return out
+}
+
+func TestOrder(t *testing.T) {
+	g := graph(t, map[string]string{
+		"a_report.yml":    "dataset: daily\nsteps:\n  - join: {dataset: customer_totals, where: ==customer_id}",
+		"b_daily.yml":     "dataset: clean_orders\ninto: daily",
+		"c_clean.yml":     "dataset: orders\ninto: clean_orders",
+		"d_totals.yml":    "dataset: clean_orders\nsteps:\n  - union: refunds\ninto: customer_totals",
+		"e_unrelated.yml": "dataset: customers",
+	}, catalog.Tables{"orders": {Name: "orders"}})
+
+	order, err := g.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"c_clean.yml", "d_totals.yml", "b_daily.yml", "a_report.yml", "e_unrelated.yml"}
+	if got := files(order); !reflect.DeepEqual(got, want) {
+		t.Errorf("got order %q, want %q", got, want)
+	}
+	if want := []string{"orders"}; !reflect.DeepEqual(g.Sources, want) {
+		t.Errorf("got sources %q, want %q", g.Sources, want)
+	}
+	if want := []string{"customers", "refunds"}; !reflect.DeepEqual(g.Missing, want) {
+		t.Errorf("got missing %q, want %q", g.Missing, want)
+	}
+	if p := g.Producer("Clean_Orders"); p == nil || p.File != "c_clean.yml" {
+		t.Errorf("got producer %v of Clean_Orders, want c_clean.yml", p)
+	}
+}
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name string
+		srcs map[string]string
+		want [][]string
+	}{
+		{
+			name: "two queries",
+			srcs: map[string]string{
+				"a.yml": "dataset: b_out\ninto: a_out",
+				"b.yml": "dataset: orders\nsteps:\n  - append: a_out\ninto: b_out",
+				"c.yml": "dataset: a_out\ninto: c_out",
+			},
+			want: [][]string{{"a.yml", "b.yml", "a.yml"}},
+		},
+		{
+			name: "query reading itself",
+			srcs: map[string]string{
+				"a.yml": "dataset: a_out\ninto: a_out",
+			},
+			want: [][]string{{"a.yml", "a.yml"}},
+		},
+		{
+			name: "none",
+			srcs: map[string]string{
+				"a.yml": "dataset: orders\ninto: a_out",
+				"b.yml": "dataset: a_out",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := graph(t, tt.srcs, nil)
+			if !reflect.DeepEqual(g.Cycles, tt.want) {
+				t.Errorf("got cycles %q, want %q", g.Cycles, tt.want)
+			}
+			_, err := g.Order()
+			if len(tt.want) > 0 {
+				want := "queries depend on each other in a cycle: " + strings.Join(tt.want[0], " → ")
+				if err == nil || err.Error() != want {
+					t.Errorf("got error %v, want %q", err, want)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	g := graph(t, map[string]string{
+		"a.yml": "dataset: orders\ninto: totals",
+		"b.yml": "dataset: refunds\ninto: Totals",
+	}, nil)
+	want := []string{"Totals is produced by both a.yml and b.yml"}
+	if !reflect.DeepEqual(g.Conflicts, want) {
+		t.Errorf("got conflicts %q, want %q", g.Conflicts, want)
+	}
+}
+
+func TestReads(t *testing.T) {
+	src := `
+declare:
+  recent:
+    dataset: orders
+    steps:
+      - filter: created_at > @2024-01-01
+dataset: recent
+steps:
+  - join: {dataset: {dataset: customers, steps: [{select: [id]}]}, where: ==id}
+  - join: {dataset: regions.csv, where: ==region}
+  - group:
+      by: [id]
+      steps:
+        - except: blocked
+  - append: {sql: "SELECT * FROM archive"}`
+	var q duql.Query
+	if err := yaml.Unmarshal([]byte(src), &q); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"blocked", "customers", "orders"}
+	if got := reads(&q); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/duql"
+)
+
+// ManifestFile is the name of the file describing a project. The directory
+// holding it is the root of the project.
+const ManifestFile = "duql.yml"
+
+// Manifest is the layout of a duql.yml file:
+//
+//	name: shop
+//	sources: [staging, marts]
+//	target: sql.postgres
+//	catalogs: [migrations, shop.catalog.yml]
+//	libraries: [lib]
+//	vars:
+//	  schema: analytics
+//	out: build
+//
+// Paths are relative to the manifest.
+type Manifest struct {
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Sources are the directories holding the queries. By default every
+	// query below the root is part of the project.
+	Sources []string `yaml:"sources,omitempty" json:"sources,omitempty"`
+	// Target is used for queries without a settings.target.
+	Target duql.TargetDialect `yaml:"target,omitempty" json:"target,omitempty"`
+	// Catalogs are YAML or JSON catalog files, directories or files of SQL
+	// DDL, or SQLite databases, consulted in order.
+	Catalogs []string `yaml:"catalogs,omitempty" json:"catalogs,omitempty"`
+	// Libraries are directories imports are looked up in when they are
+	// not found next to the importing file. They hold no queries.
+	Libraries []string `yaml:"libraries,omitempty" json:"libraries,omitempty"`
+	// Vars are values for the ${name} variables of the queries. Command
+	// line values and environment variables override them.
+	Vars map[string]string `yaml:"vars,omitempty" json:"vars,omitempty"`
+	// Out is the directory duql build writes to, build by default.
+	Out string `yaml:"out,omitempty" json:"out,omitempty"`
+
+	// Dir is the root of the project.
+	Dir string `yaml:"-" json:"-"`
+}
+
+// LoadManifest reads the manifest at path, which is either a duql.yml file
+// or the directory holding one.
+func LoadManifest(path string) (*Manifest, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, ManifestFile)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.Dir = filepath.Dir(path)
+	if len(m.Sources) == 0 {
+		m.Sources = []string{"."}
+	}
+	if m.Out == "" {
+		m.Out = "build"
+	}
+	if m.Target != "" {
+		m.Target = duql.ParseTargetDialect(string(m.Target))
+	}
+	return &m, nil
+}
+
+// FindManifest looks for the manifest of the project dir belongs to, in
+// dir and then in each of its parents. It returns "" when there is none.
+func FindManifest(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ManifestFile)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Path resolves a path of the manifest against the root of the project.
+func (m *Manifest) Path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(m.Dir, path)
+}
+
+// Catalog loads the catalogs of the project, or returns nil when there
+// are none.
+func (m *Manifest) Catalog() (catalog.Chain, error) {
+	var chain catalog.Chain
+	for _, path := range m.Catalogs {
+		tables, err := catalog.Load(m.Path(path))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, tables)
+	}
+	return chain, nil
+}
+
+// Files lists the query files of the project, sorted. The output and
+// library directories are skipped, and isQuery tells query files from the
+// others.
+func (m *Manifest) Files(isQuery func(path string) bool) ([]string, error) {
+	skip := map[string]bool{filepath.Clean(m.Path(m.Out)): true}
+	for _, lib := range m.Libraries {
+		skip[filepath.Clean(m.Path(lib))] = true
+	}
+	seen := make(map[string]bool)
+	var files []string
+	for _, source := range m.Sources {
+		err := filepath.Walk(m.Path(source), func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if skip[filepath.Clean(file)] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isQuery(file) && !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,215 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Formats are the output formats Write accepts.
+var Formats = []string{"dot", "mermaid", "order", "json"}
+
+// Write writes the graph as Graphviz DOT, as a Mermaid flowchart, as the
+// files in the order they can run, or as JSON. Missing producers, cycles
+// and conflicts are marked in the diagrams and listed as comments.
+func Write(w io.Writer, g *Graph, format string) error {
+	var out string
+	switch format {
+	case "", "dot":
+		out = g.dot()
+	case "mermaid":
+		out = g.mermaid()
+	case "order":
+		order, err := g.Order()
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		for _, q := range order {
+			b.WriteString(q.File + "\n")
+		}
+		out = b.String()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(g)
+	default:
+		return fmt.Errorf("unknown format %s, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+	_, err := io.WriteString(w, out)
+	return err
+}
+
+// results lists every table or result name in the graph once, by lower
+// case name, with the spelling first seen.
+func (g *Graph) results() ([]string, map[string]string) {
+	labels := make(map[string]string)
+	add := func(name string) {
+		if _, ok := labels[strings.ToLower(name)]; !ok {
+			labels[strings.ToLower(name)] = name
+		}
+	}
+	for _, q := range g.Queries {
+		if q.Into != "" {
+			add(q.Into)
+		}
+		for _, name := range q.Reads {
+			add(name)
+		}
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, labels
+}
+
+// problems lists the problems of the graph, one per line.
+func (g *Graph) problems() []string {
+	var lines []string
+	for _, name := range g.Missing {
+		lines = append(lines, fmt.Sprintf("missing producer: %s", name))
+	}
+	for _, cycle := range g.Cycles {
+		lines = append(lines, fmt.Sprintf("cycle: %s", strings.Join(cycle, " → ")))
+	}
+	for _, conflict := range g.Conflicts {
+		lines = append(lines, fmt.Sprintf("conflict: %s", conflict))
+	}
+	return lines
+}
+
+// inCycle reports whether the dependency of q on the result name is part
+// of a cycle.
+func (g *Graph) inCycle(q *Query, name string) bool {
+	p := g.Producer(name)
+	if p == nil {
+		return false
+	}
+	for _, cycle := range g.Cycles {
+		has := func(file string) bool {
+			for _, f := range cycle {
+				if f == file {
+					return true
+				}
+			}
+			return false
+		}
+		if has(q.File) && has(p.File) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Graph) isMissing(key string) bool {
+	for _, name := range g.Missing {
+		if strings.ToLower(name) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Graph) dot() string {
+	var b strings.Builder
+	b.WriteString("digraph project {\n")
+	b.WriteString("  rankdir=LR;\n")
+	for _, line := range g.problems() {
+		fmt.Fprintf(&b, "  // %s\n", line)
+	}
+	for _, q := range g.Queries {
+		fmt.Fprintf(&b, "  %s [shape=box, label=%s];\n", quote("query:"+q.File), quote(q.File))
+	}
+	keys, labels := g.results()
+	for _, key := range keys {
+		attrs := "shape=cylinder"
+		switch {
+		case g.isMissing(key):
+			attrs += ", color=red, style=dashed"
+		case g.Producer(key) == nil:
+			attrs += ", style=filled, fillcolor=lightgrey"
+		}
+		fmt.Fprintf(&b, "  %s [%s, label=%s];\n", quote("table:"+key), attrs, quote(labels[key]))
+	}
+	for _, q := range g.Queries {
+		if q.Into != "" {
+			fmt.Fprintf(&b, "  %s -> %s;\n", quote("query:"+q.File), quote("table:"+strings.ToLower(q.Into)))
+		}
+		for _, name := range q.Reads {
+			attrs := ""
+			if g.inCycle(q, name) {
+				attrs = " [color=red]"
+			}
+			fmt.Fprintf(&b, "  %s -> %s%s;\n", quote("table:"+strings.ToLower(name)), quote("query:"+q.File), attrs)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func (g *Graph) mermaid() string {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for _, line := range g.problems() {
+		fmt.Fprintf(&b, "  %%%% %s\n", line)
+	}
+	ids := make(map[*Query]string)
+	for i, q := range g.Queries {
+		ids[q] = fmt.Sprintf("q%d", i)
+		fmt.Fprintf(&b, "  %s[%s]\n", ids[q], mermaidLabel(q.File))
+	}
+	keys, labels := g.results()
+	tables := make(map[string]string)
+	var missing, sources []string
+	for i, key := range keys {
+		tables[key] = fmt.Sprintf("t%d", i)
+		fmt.Fprintf(&b, "  %s[(%s)]\n", tables[key], mermaidLabel(labels[key]))
+		switch {
+		case g.isMissing(key):
+			missing = append(missing, tables[key])
+		case g.Producer(key) == nil:
+			sources = append(sources, tables[key])
+		}
+	}
+	var cycleLinks []string
+	link := 0
+	for _, q := range g.Queries {
+		if q.Into != "" {
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[q], tables[strings.ToLower(q.Into)])
+			link++
+		}
+		for _, name := range q.Reads {
+			fmt.Fprintf(&b, "  %s --> %s\n", tables[strings.ToLower(name)], ids[q])
+			if g.inCycle(q, name) {
+				cycleLinks = append(cycleLinks, fmt.Sprint(link))
+			}
+			link++
+		}
+	}
+	if len(sources) > 0 {
+		b.WriteString("  classDef source fill:#eee\n")
+		fmt.Fprintf(&b, "  class %s source\n", strings.Join(sources, ","))
+	}
+	if len(missing) > 0 {
+		b.WriteString("  classDef missing stroke:#d00,stroke-dasharray:4\n")
+		fmt.Fprintf(&b, "  class %s missing\n", strings.Join(missing, ","))
+	}
+	if len(cycleLinks) > 0 {
+		fmt.Fprintf(&b, "  linkStyle %s stroke:#d00\n", strings.Join(cycleLinks, ","))
+	}
+	return b.String()
+}
+
+// quote writes s as a DOT identifier.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// mermaidLabel writes s as a quoted Mermaid label.
+func mermaidLabel(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
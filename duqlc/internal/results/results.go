@@ -0,0 +1,210 @@
+// Package results reads the rows a query returns and writes them as an
+// aligned table, CSV, JSON or newline-delimited JSON.
+package results
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+)
+
+// Formats are the output formats Write accepts.
+var Formats = []string{"table", "csv", "json", "ndjson"}
+
+// Set is the rows a query returned, each value as the driver scanned it.
+type Set struct {
+	Columns []string
+	Rows    [][]any
+	// Truncated is set when the query returned more rows than were read.
+	Truncated bool
+}
+
+// Rows are the rows Read reads: a *sql.Rows, or the rows of a query run
+// in memory.
+type Rows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+	Close() error
+}
+
+// Read reads at most max rows, or every row when max is 0, and closes
+// rows.
+func Read(rows Rows, max int) (*Set, error) {
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	set := &Set{Columns: columns}
+	for rows.Next() {
+		if max > 0 && len(set.Rows) == max {
+			set.Truncated = true
+			break
+		}
+		row := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		for i, v := range row {
+			// Drivers return text as bytes they may reuse.
+			if b, ok := v.([]byte); ok {
+				if utf8.Valid(b) {
+					row[i] = string(b)
+				} else {
+					row[i] = append([]byte(nil), b...)
+				}
+			}
+		}
+		set.Rows = append(set.Rows, row)
+	}
+	return set, rows.Err()
+}
+
+// Write writes set in format, table when empty.
+func Write(w io.Writer, set *Set, format string) error {
+	switch format {
+	case "", "table":
+		return writeTable(w, set)
+	case "csv":
+		return writeCSV(w, set)
+	case "json":
+		return writeJSON(w, set, true)
+	case "ndjson":
+		return writeJSON(w, set, false)
+	}
+	return fmt.Errorf("unknown format %s, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// writeTable aligns the columns under a header, with NULL for missing
+// values, and ends with the number of rows.
+func writeTable(w io.Writer, set *Set) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	rules := make([]string, len(set.Columns))
+	for i, col := range set.Columns {
+		rules[i] = strings.Repeat("─", utf8.RuneCountInString(col))
+	}
+	fmt.Fprintln(tw, strings.Join(set.Columns, "\t"))
+	fmt.Fprintln(tw, strings.Join(rules, "\t"))
+	cells := make([]string, len(set.Columns))
+	for _, row := range set.Rows {
+		for i, v := range row {
+			if v == nil {
+				cells[i] = "NULL"
+			} else {
+				// Tabs and newlines would break the alignment.
+				cells[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(text(v))
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	count := fmt.Sprintf("(%d rows)", len(set.Rows))
+	if len(set.Rows) == 1 {
+		count = "(1 row)"
+	}
+	if set.Truncated {
+		count = fmt.Sprintf("(first %d rows)", len(set.Rows))
+	}
+	_, err := fmt.Fprintln(w, count)
+	return err
+}
+
+// writeCSV writes a header and a record per row, with NULL as an empty
+// field.
+func writeCSV(w io.Writer, set *Set) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(set.Columns); err != nil {
+		return err
+	}
+	record := make([]string, len(set.Columns))
+	for _, row := range set.Rows {
+		for i, v := range row {
+			record[i] = ""
+			if v != nil {
+				record[i] = text(v)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSON writes an object per row with its keys in the order of the
+// columns, in an array or one per line.
+func writeJSON(w io.Writer, set *Set, array bool) error {
+	var b bytes.Buffer
+	if array {
+		b.WriteString("[")
+	}
+	for n, row := range set.Rows {
+		if array {
+			if n > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n  ")
+		}
+		b.WriteString("{")
+		for i, v := range row {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			key, _ := json.Marshal(set.Columns[i])
+			value, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", set.Columns[i], err)
+			}
+			b.Write(key)
+			b.WriteString(":")
+			b.Write(value)
+		}
+		b.WriteString("}")
+		if !array {
+			b.WriteString("\n")
+		}
+	}
+	if array {
+		if len(set.Rows) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("]\n")
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// text formats a value for the table and CSV.
+func text(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		// Dates come back as midnight UTC.
+		if v.Location() == time.UTC && v.Equal(v.Truncate(24*time.Hour)) {
+			return v.Format(time.DateOnly)
+		}
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		// Without an exponent, so large sums read as amounts.
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return fmt.Sprintf("%x", v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,28 @@
+package results
+
+import (
+	"testing"
+	"time"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{int64(42), "42"},
+		{2.5, "2.5"},
+		{1e21, "1000000000000000000000"},
+		{0.000001, "0.000001"},
+		{float64(3), "3"},
+		{"north", "north"},
+		{[]byte{0xca, 0xfe}, "cafe"},
+		{time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "2024-03-01"},
+		{time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC), "2024-03-01T09:30:00Z"},
+	}
+	for _, tt := range tests {
+		if got := text(tt.v); got != tt.want {
+			t.Errorf("text(%#v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,559 @@
+package semantic
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// Options control the analysis.
+type Options struct {
+	// Catalog describes the tables the query reads. When nil, tables have
+	// unknown columns and are not reported as missing.
+	Catalog catalog.Provider
+	// Dir is the directory local data files are looked up relative to,
+	// usually that of the query file.
+	Dir string
+}
+
+// Step is the relation produced by one step of Query.Steps.
+type Step struct {
+	Index    int       `json:"index"`
+	Type     string    `json:"type"`
+	Relation *Relation `json:"relation"`
+}
+
+// Result is the outcome of analyzing a query.
+type Result struct {
+	// Dataset is the relation the query starts from.
+	Dataset *Relation `json:"dataset"`
+	Steps   []Step    `json:"steps"`
+	// Output is the relation the query produces.
+	Output   *Relation  `json:"output"`
+	Problems []*Problem `json:"-"`
+}
+
+// Problem is a reference to a table or column that does not exist at the
+// step that uses it, or an expression whose types do not fit together.
+type Problem struct {
+	// Path locates the problem, such as steps[3].sort or
+	// declare.recent.dataset.
+	Path string
+	// Step is the index in Query.Steps the problem is in, or -1 when it is
+	// in the dataset or a declaration.
+	Step int
+	Err  error
+}
+
+func (p *Problem) Error() string {
+	return p.Path + ": " + p.Err.Error()
+}
+
+func (p *Problem) Unwrap() error {
+	return p.Err
+}
+
+// Pos returns the position of the problem within its expression, or -1
+// when it is not in an expression.
+func (p *Problem) Pos() int {
+	var e *expr.Error
+	if errors.As(p.Err, &e) {
+		return e.Pos
+	}
+	return -1
+}
+
+type analyzer struct {
+	opts Options
+	q    *duql.Query
+	// names that expressions can use besides columns: declared expressions,
+	// functions and tuples.
+	declared  map[string]bool
+	pipelines map[string]*Relation
+	// exprs and funcs are the declared expressions and functions, which
+	// are checked where they are used to follow their types and lineage.
+	exprs     map[string]expr.Node
+	funcs     map[string]*expr.Lambda
+	expanding map[string]bool
+	// files holds the tables inferred from local data files, by source.
+	files    catalog.Tables
+	step     int
+	problems []*Problem
+	// quiet suppresses problems while a declaration is checked at a use,
+	// since the positions would not point into the step.
+	quiet int
+	// origins collects the lineage of the expression being checked.
+	origins []Origin
+}
+
+// Analyze computes the relation after the dataset and after every step of
+// q, collecting a problem for each table or column that does not exist
+// where it is referenced and for each type error, such as comparing a
+// timestamp with text or summing a text column. Column types are inferred
+// from the catalog, literals and the standard library. Local csv, json and
+// parquet files are described by their own contents. Datasets nothing can
+// describe, such as raw SQL and files that are not on this machine, have
+// unknown columns.
+func Analyze(q *duql.Query, opts Options) *Result {
+	a := &analyzer{
+		opts:      opts,
+		q:         q,
+		declared:  make(map[string]bool),
+		pipelines: make(map[string]*Relation),
+		exprs:     make(map[string]expr.Node),
+		funcs:     make(map[string]*expr.Lambda),
+		expanding: make(map[string]bool),
+		files:     make(catalog.Tables),
+		step:      -1,
+	}
+	var pipelines []string
+	for name, value := range q.Declare {
+		if value.Pipeline != nil {
+			pipelines = append(pipelines, name)
+		} else {
+			a.declared[name] = true
+			a.declare(name, value)
+		}
+	}
+	sort.Strings(pipelines)
+	for _, name := range pipelines {
+		a.pipeline(name)
+	}
+
+	res := &Result{Dataset: a.dataset(q.Dataset, "dataset")}
+	r := res.Dataset
+	for i, step := range q.Steps {
+		a.step = i
+		r = a.stepRelation(r.copy(), step, fmt.Sprintf("steps[%d].%s", i, step.Type()))
+		res.Steps = append(res.Steps, Step{Index: i, Type: step.Type(), Relation: r})
+	}
+	res.Output = r
+	res.Problems = a.problems
+	return res
+}
+
+// declare parses a declared expression or function. Invalid ones are
+// reported when the query is compiled.
+func (a *analyzer) declare(name string, value duql.DeclareValue) {
+	switch {
+	case value.Function != nil:
+		fn := &expr.Lambda{}
+		for _, p := range value.Function.Parameters {
+			fn.Params = append(fn.Params, expr.LambdaParam{Name: p.Name})
+		}
+		body, err := expr.FromDUQL(value.Function.Expression)
+		if err != nil {
+			return
+		}
+		fn.Body = body
+		a.funcs[name] = fn
+	case value.Expression != nil:
+		n, err := expr.FromDUQL(*value.Expression)
+		if err != nil {
+			return
+		}
+		if fn, ok := n.(*expr.Lambda); ok {
+			a.funcs[name] = fn
+		} else {
+			a.exprs[name] = n
+		}
+	}
+}
+
+func (a *analyzer) problem(path string, err error) {
+	if a.quiet > 0 {
+		return
+	}
+	a.problems = append(a.problems, &Problem{Path: path, Step: a.step, Err: err})
+}
+
+// pipeline analyzes a declared pipeline once and returns its output.
+func (a *analyzer) pipeline(name string) *Relation {
+	if r, ok := a.pipelines[name]; ok {
+		if r == nil {
+			// The pipeline refers to itself; the compiler reports it.
+			r = open()
+			r.source(name, open())
+		}
+		return r
+	}
+	a.pipelines[name] = nil
+	step := a.step
+	a.step = -1
+	p := a.q.Declare[name].Pipeline
+	r := a.dataset(p.Dataset, "declare."+name+".dataset")
+	r = a.steps(r, p.Steps, "declare."+name+".steps")
+	a.step = step
+
+	out := &Relation{Columns: r.Columns, Open: r.Open, table: r.table}
+	out.source(name, r)
+	a.pipelines[name] = out
+	return out
+}
+
+// dataset returns the relation a dataset reads, reporting unknown tables.
+func (a *analyzer) dataset(ds duql.Dataset, path string) *Relation {
+	if ds.SQL != nil {
+		return open()
+	}
+	if ds.Query != nil {
+		return a.subquery(ds, path)
+	}
+	source := ds.Simple
+	format := duql.Table
+	if ds.Complex != nil {
+		source = ds.Complex.Name
+		if ds.Complex.Format != "" {
+			format = ds.Complex.Format
+		}
+	}
+	if _, ok := a.q.Declare[source]; ok && a.q.Declare[source].Pipeline != nil {
+		return a.pipeline(source).copy()
+	}
+
+	if f := catalog.FileFormat(source); f != "" {
+		format = duql.DataFormat(f)
+	}
+	if format != duql.Table {
+		base := filepath.Base(source)
+		name := strings.TrimSuffix(base, filepath.Ext(base))
+		t, err := a.file(source, format)
+		if err != nil {
+			a.problem(path, err)
+		}
+		return tableRelation(name, source, t)
+	}
+
+	name := source[strings.LastIndex(source, ".")+1:]
+	if a.opts.Catalog == nil {
+		return tableRelation(name, source, nil)
+	}
+	t, err := a.opts.Catalog.Table(source)
+	if err != nil {
+		a.problem(path, err)
+		return tableRelation(name, source, nil)
+	}
+	if t == nil {
+		a.problem(path, fmt.Errorf("unknown table %s", source))
+	}
+	return tableRelation(name, source, t)
+}
+
+// subquery returns the output of a dataset with steps of its own. A query
+// read from a DUQL file is analyzed with its own declarations, and its
+// problems are reported at the dataset.
+func (a *analyzer) subquery(ds duql.Dataset, path string) *Relation {
+	var r *Relation
+	name := ""
+	if ds.Inline() {
+		r = a.dataset(ds.Query.Dataset, path+".dataset")
+		r = a.steps(r, ds.Query.Steps, path+".steps")
+	} else {
+		sub := Analyze(ds.Query, Options{Catalog: a.opts.Catalog, Dir: filepath.Dir(ds.File)})
+		for _, p := range sub.Problems {
+			a.problem(path, fmt.Errorf("%s: %w", ds.File, p))
+		}
+		r = sub.Output
+		name = filepath.Base(ds.File)
+		name = strings.TrimSuffix(strings.TrimSuffix(name, filepath.Ext(name)), ".duql")
+	}
+	out := &Relation{Columns: r.Columns, Open: r.Open, table: r.table}
+	if name != "" {
+		out.source(name, r)
+	}
+	return out
+}
+
+// file infers the table in a local data file once. It returns nil when the
+// file is not found, since it may only exist where the query runs.
+func (a *analyzer) file(source string, format duql.DataFormat) (*catalog.Table, error) {
+	if t, ok := a.files[source]; ok {
+		return t, nil
+	}
+	a.files[source] = nil
+	candidates := []string{source}
+	if !filepath.IsAbs(source) {
+		candidates = []string{filepath.Join(a.opts.Dir, source), source}
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		t, err := catalog.InferFile(path, string(format))
+		if err != nil {
+			return nil, err
+		}
+		a.files[source] = t
+		return t, nil
+	}
+	return nil, nil
+}
+
+func (a *analyzer) steps(r *Relation, steps duql.Steps, path string) *Relation {
+	for i, step := range steps {
+		r = a.stepRelation(r.copy(), step, fmt.Sprintf("%s[%d].%s", path, i, step.Type()))
+	}
+	return r
+}
+
+// stepRelation returns the relation after step, given the one before it,
+// which it may modify.
+func (a *analyzer) stepRelation(r *Relation, step duql.Step, path string) *Relation {
+	switch s := step.(type) {
+	case *duql.Filter:
+		a.condition(r, s.Expression, "filter", path)
+	case *duql.Generate:
+		for _, e := range s.Expressions {
+			typ, origins := a.expression(r, e.Expression, path)
+			r.add(a.named(r, e, typ, origins))
+		}
+	case *duql.Select:
+		return a.selectColumns(r, s.Columns, path)
+	case *duql.SelectNot:
+		names := s.Columns
+		if s.Column != "" {
+			names = []string{s.Column}
+		}
+		for _, name := range names {
+			if !r.Open && r.Column(name) == nil {
+				a.unknown(r, name, -1, path)
+			}
+			r.remove(name, path)
+		}
+	case *duql.Sort:
+		for _, col := range s.Columns {
+			typ, origins := a.expression(r, col.Expression, path)
+			if col.Name != "" {
+				r.add(a.named(r, duql.NamedExpression{Name: col.Name, Expression: col.Expression}, typ, origins))
+			}
+		}
+	case *duql.Summarize:
+		return a.summarize(r, nil, s.Aggregations, path)
+	case *duql.Group:
+		return a.group(r, s, path)
+	case *duql.Join:
+		return a.join(r, s, path)
+	case *duql.Window:
+		for i, inner := range s.Steps {
+			r = a.stepRelation(r, inner, fmt.Sprintf("%s.steps[%d].%s", path, i, inner.Type()))
+		}
+	case *duql.Loop:
+		a.steps(r.copy(), s.Steps, path+".steps")
+	case *duql.Append:
+		r.combine(a.dataset(s.Dataset, path))
+	case *duql.Union:
+		r.combine(a.dataset(s.Dataset, path))
+	case *duql.Intersect:
+		a.dataset(s.Dataset, path)
+	case *duql.Except:
+		a.dataset(s.Dataset, path)
+	}
+	return r
+}
+
+// named returns the column a named expression of type typ, computed from
+// origins, produces. A plain column reference also keeps the source of the
+// column.
+func (a *analyzer) named(r *Relation, e duql.NamedExpression, typ string, origins []Origin) Column {
+	col := Column{Name: e.Name, Type: typ, Nullable: true, Lineage: origins}
+	n, err := expr.FromDUQL(e.Expression)
+	if err != nil {
+		return col
+	}
+	if id, ok := n.(*expr.Ident); ok {
+		if c := a.resolve(r, id); c != nil {
+			col.Type = c.Type
+			col.Nullable = c.Nullable
+			col.Source = c.Source
+		}
+	}
+	return col
+}
+
+// resolve returns the column an identifier refers to, if it is known.
+func (a *analyzer) resolve(r *Relation, id *expr.Ident) *Column {
+	switch len(id.Parts) {
+	case 1:
+		return r.Column(id.Parts[0])
+	case 2:
+		if s := r.Source(id.Parts[0]); s != nil {
+			return s.Column(id.Parts[1])
+		}
+	}
+	return nil
+}
+
+func (a *analyzer) selectColumns(in *Relation, cols []duql.NamedExpression, path string) *Relation {
+	out := in.derive()
+	for _, e := range cols {
+		typ, origins := a.expression(in, e.Expression, path)
+		if e.Name != "" {
+			out.add(a.named(in, e, typ, origins))
+			continue
+		}
+		n, err := expr.FromDUQL(e.Expression)
+		id, ok := n.(*expr.Ident)
+		if err != nil || !ok {
+			continue
+		}
+		switch last := id.Parts[len(id.Parts)-1]; {
+		case last != "*":
+			col := Column{Name: last, Nullable: true, Lineage: origins}
+			if c := a.resolve(in, id); c != nil {
+				col = *c
+			}
+			out.add(col)
+		case len(id.Parts) == 1:
+			for _, col := range in.Columns {
+				out.add(col)
+			}
+			out.Open = out.Open || in.Open
+		default:
+			s := in.Source(id.Parts[0])
+			if s == nil || s.Open {
+				out.Open = true
+			}
+			if s != nil {
+				for _, col := range s.Columns {
+					out.add(col)
+				}
+			}
+		}
+	}
+	dropRest(in, out, path)
+	return out
+}
+
+// dropRest records the input columns missing from out as removed by the
+// step at path.
+func dropRest(in, out *Relation, path string) {
+	for _, col := range in.Columns {
+		if out.Column(col.Name) == nil {
+			out.drop(col.Name, path)
+		}
+	}
+}
+
+// summarize returns the relation after aggregating, which has the group
+// keys and the aggregates.
+func (a *analyzer) summarize(in *Relation, keys []Column, aggs []duql.NamedExpression, path string) *Relation {
+	cols := make([]Column, len(aggs))
+	for i, e := range aggs {
+		typ, origins := a.expression(in, e.Expression, path)
+		cols[i] = Column{Name: e.Name, Type: typ, Nullable: !counts(e.Expression), Lineage: origins}
+	}
+	out := in.derive()
+	for _, k := range keys {
+		out.add(k)
+	}
+	for _, col := range cols {
+		out.add(col)
+	}
+	dropRest(in, out, path)
+	return out
+}
+
+// counts reports whether an aggregate is a count, which is never NULL.
+func counts(e duql.Expression) bool {
+	n, err := expr.FromDUQL(e)
+	if err != nil {
+		return false
+	}
+	call, ok := n.(*expr.Call)
+	return ok && (call.Name == "count" || call.Name == "count_distinct")
+}
+
+func (a *analyzer) group(r *Relation, g *duql.Group, path string) *Relation {
+	var keys []Column
+	for _, by := range g.By {
+		typ, origins := a.expression(r, duql.Expression{Value: by}, path)
+		n, err := expr.Parse(by)
+		if err != nil {
+			continue
+		}
+		if id, ok := n.(*expr.Ident); ok {
+			col := Column{Name: id.Parts[len(id.Parts)-1], Nullable: true, Lineage: origins}
+			if c := a.resolve(r, id); c != nil {
+				col = *c
+			}
+			keys = append(keys, col)
+			continue
+		}
+		keys = append(keys, Column{Name: duql.KeyName(by), Type: typ, Nullable: true, Lineage: origins})
+	}
+	if len(g.Steps) == 0 {
+		return a.summarize(r, keys, nil, path)
+	}
+	for i, step := range g.Steps {
+		p := fmt.Sprintf("%s.steps[%d].%s", path, i, step.Type())
+		if s, ok := step.(*duql.Summarize); ok {
+			r = a.summarize(r, keys, s.Aggregations, p)
+			continue
+		}
+		r = a.stepRelation(r, step, p)
+	}
+	return r
+}
+
+func (a *analyzer) join(left *Relation, j *duql.Join, path string) *Relation {
+	right := a.dataset(j.Dataset, path)
+	out := left.copy()
+	// The side a join does not keep every row of is NULL for the rows of
+	// the other side without a match, whether read plainly or qualified.
+	if j.Retain == duql.Right || j.Retain == duql.Full {
+		out = left.nullable()
+	}
+	if j.Retain == duql.Left || j.Retain == duql.Full {
+		right = right.nullable()
+	}
+	for name, s := range right.sources {
+		out.source(name, s)
+	}
+	out.Open = out.Open || right.Open
+	if right.Open {
+		// Unqualified columns the analysis cannot see may come from either
+		// side.
+		out.table = ""
+	}
+	out.join(right)
+
+	n, err := expr.FromDUQL(j.Where)
+	if err != nil {
+		return out
+	}
+	if u, ok := n.(*expr.Unary); ok && u.Op == "==" {
+		// `==id` needs the column on both sides.
+		if id, ok := u.X.(*expr.Ident); ok && len(id.Parts) == 1 {
+			x := a.ident(left, id, nil, path)
+			y := a.ident(right, id, nil, path)
+			if !compatible(KindOf(x), KindOf(y)) {
+				a.problem(path, &expr.Error{Pos: id.At, Msg: fmt.Sprintf("cannot compare %s (%s) with %s (%s)", id.Name(), x, id.Name(), y)})
+			}
+		}
+		return out
+	}
+	a.conditionNode(out, n, "join", path)
+	return out
+}
+
+// unknown reports a reference to a column r does not have, naming the
+// step that removed it when there was one. Pos is -1 for references
+// outside an expression.
+func (a *analyzer) unknown(r *Relation, name string, pos int, path string) {
+	msg := fmt.Sprintf("unknown column %s", name)
+	if by := r.droppedBy(name); by != "" {
+		msg = fmt.Sprintf("column %s was removed by %s", name, by)
+	}
+	if pos < 0 {
+		a.problem(path, errors.New(msg))
+		return
+	}
+	a.problem(path, &expr.Error{Pos: pos, Msg: msg})
+}
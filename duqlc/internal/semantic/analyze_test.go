@@ -0,0 +1,271 @@
+package semantic
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/theduql/duql/internal/catalog"
+	"github.com/theduql/duql/internal/duql"
+)
+
+var testCatalog = catalog.Tables{
+	"orders": {Name: "orders", Columns: []catalog.Column{
+		{Name: "id", Type: "bigint"},
+		{Name: "customer_id", Type: "bigint"},
+		{Name: "amount", Type: "numeric(10,2)", Nullable: true},
+		{Name: "status", Type: "text", Nullable: true},
+		{Name: "created_at", Type: "timestamp"},
+	}},
+	"customers": {Name: "customers", Columns: []catalog.Column{
+		{Name: "id", Type: "bigint"},
+		{Name: "name", Type: "varchar(100)"},
+	}},
+}
+
+func analyze(t *testing.T, src string, p catalog.Provider) *Result {
+	t.Helper()
+	var q duql.Query
+	if err := yaml.Unmarshal([]byte(src), &q); err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	return Analyze(&q, Options{Catalog: p})
+}
+
+// columns writes each column as name, type and "null" when nullable.
+func columns(r *Relation) []string {
+	var cols []string
+	for _, c := range r.Columns {
+		col := strings.TrimSpace(c.Name + " " + c.Type)
+		if c.Nullable {
+			col += " null"
+		}
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+func TestAnalyzeColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "dataset",
+			src:  "dataset: orders",
+			want: []string{"id bigint", "customer_id bigint", "amount numeric(10,2) null", "status text null", "created_at timestamp"},
+		},
+		{
+			name: "select renames and computes",
+			src: `
+dataset: orders
+steps:
+  - select: {order_id: id, total: amount * 2, late: created_at < @2024-01-01}`,
+			want: []string{"order_id bigint", "total numeric null", "late boolean null"},
+		},
+		{
+			name: "generate replaces in place",
+			src: `
+dataset: customers
+steps:
+  - generate: {name: id + 1, rank: 1}`,
+			want: []string{"id bigint", "name integer null", "rank integer null"},
+		},
+		{
+			name: "text concatenation",
+			src: `
+dataset: customers
+steps:
+  - select: {label: name + ' no. ' + id, n: id + 1 + ' of'}`,
+			want: []string{"label text null", "n text null"},
+		},
+		{
+			name: "group and summarize",
+			src: `
+dataset: orders
+steps:
+  - group:
+      by: [status]
+      steps:
+        - summarize: {n: count id, total: sum amount, avg: average amount, first: min created_at}`,
+			want: []string{"status text null", "n bigint", "total numeric(10,2) null", "avg numeric null", "first timestamp null"},
+		},
+		{
+			name: "computed group key",
+			src: `
+dataset: orders
+steps:
+  - group:
+      by: [year(created_at)]
+      summarize: {n: count id}`,
+			want: []string{"year_created_at integer null", "n bigint"},
+		},
+		{
+			name: "left join",
+			src: `
+dataset: orders
+steps:
+  - join: {dataset: customers, where: orders.customer_id == customers.id, retain: left}
+  - select: [orders.id, customers.name]`,
+			want: []string{"id bigint", "name varchar(100) null"},
+		},
+		{
+			name: "right join",
+			src: `
+dataset: orders
+steps:
+  - join: {dataset: customers, where: orders.customer_id == customers.id, retain: right}
+  - select: [orders.created_at, name]`,
+			want: []string{"created_at timestamp null", "name varchar(100)"},
+		},
+		{
+			name: "inner join",
+			src: `
+dataset: orders
+steps:
+  - join: {dataset: customers, where: orders.customer_id == customers.id}
+  - select: [customers.name]`,
+			want: []string{"name varchar(100)"},
+		},
+		{
+			name: "join keeps both sides",
+			src: `
+dataset: orders
+steps:
+  - join: {dataset: customers, where: orders.customer_id == customers.id}`,
+			want: []string{"id bigint", "customer_id bigint", "amount numeric(10,2) null", "status text null", "created_at timestamp", "id bigint", "name varchar(100)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := analyze(t, tt.src, testCatalog)
+			for _, p := range res.Problems {
+				t.Errorf("unexpected problem: %s", p)
+			}
+			if got := columns(res.Output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		catalog catalog.Provider
+		want    []string
+	}{
+		{
+			name: "removed column",
+			src: `
+dataset: orders
+steps:
+  - select: [id, amount]
+  - filter: status == "paid"`,
+			catalog: testCatalog,
+			want:    []string{"steps[1].filter: at position 0: column status was removed by steps[0].select (step 1)"},
+		},
+		{
+			name: "unknown column",
+			src: `
+dataset: orders
+steps:
+  - sort: [missing]`,
+			catalog: testCatalog,
+			want:    []string{"steps[0].sort: at position 0: unknown column missing (step 0)"},
+		},
+		{
+			name: "ambiguous column after a join",
+			src: `
+dataset: orders
+steps:
+  - join: {dataset: customers, where: orders.customer_id == customers.id}
+  - summarize: {n: count id, m: count orders.id, names: count name}`,
+			catalog: testCatalog,
+			want:    []string{"steps[1].summarize: at position 6: column id is ambiguous; qualify it as orders.id or customers.id (step 1)"},
+		},
+		{
+			name: "generated column shadows both sides",
+			src: `
+dataset: orders
+steps:
+  - join: {dataset: customers, where: orders.customer_id == customers.id}
+  - generate: {id: orders.id}
+  - filter: id > 3`,
+			catalog: testCatalog,
+		},
+		{
+			name:    "unknown table",
+			src:     "dataset: nope",
+			catalog: testCatalog,
+			want:    []string{"dataset: unknown table nope (step -1)"},
+		},
+		{
+			name: "no catalog",
+			src: `
+dataset: nope
+steps:
+  - select: [anything]`,
+		},
+		{
+			name: "column not selected without a catalog",
+			src: `
+dataset: nope
+steps:
+  - select: [a]
+  - filter: b > 1`,
+			want: []string{"steps[1].filter: at position 0: unknown column b (step 1)"},
+		},
+		{
+			name: "type errors",
+			src: `
+dataset: orders
+steps:
+  - filter: created_at > "x" && amount + status > 1
+  - summarize: {s: sum status}`,
+			catalog: testCatalog,
+			want: []string{
+				"steps[0].filter: at position 11: cannot compare created_at (timestamp) with text (step 0)",
+				"steps[0].filter: at position 27: cannot use status (text) in arithmetic; join text with an f-string such as f\"{a}{b}\" (step 0)",
+				"steps[1].summarize: at position 4: sum expects a number or interval, got status (text) (step 1)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := analyze(t, tt.src, tt.catalog)
+			var got []string
+			for _, p := range res.Problems {
+				got = append(got, fmt.Sprintf("%s (step %d)", p, p.Step))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnalyzeLineage(t *testing.T) {
+	res := analyze(t, `
+dataset: orders
+steps:
+  - join: {dataset: customers, where: orders.customer_id == customers.id}
+  - select: {who: customers.name, total: amount * 2 + orders.id}`, testCatalog)
+	for _, p := range res.Problems {
+		t.Errorf("unexpected problem: %s", p)
+	}
+	want := map[string][]Origin{
+		"who":   {{Table: "customers", Column: "name"}},
+		"total": {{Table: "orders", Column: "amount"}, {Table: "orders", Column: "id"}},
+	}
+	for _, c := range res.Output.Columns {
+		if !reflect.DeepEqual(c.Lineage, want[c.Name]) {
+			t.Errorf("%s: got lineage %v, want %v", c.Name, c.Lineage, want[c.Name])
+		}
+	}
+}
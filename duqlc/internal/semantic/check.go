@@ -0,0 +1,405 @@
+package semantic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/expr"
+)
+
+// expression checks e against r and returns its type, or "" when it is not
+// known, and the columns it is computed from.
+func (a *analyzer) expression(r *Relation, e duql.Expression, path string) (string, []Origin) {
+	n, err := expr.FromDUQL(e)
+	if err != nil {
+		// Syntax errors are reported when the query is compiled.
+		return "", nil
+	}
+	return a.node(r, n, path)
+}
+
+func (a *analyzer) node(r *Relation, n expr.Node, path string) (string, []Origin) {
+	outer := a.origins
+	a.origins = nil
+	typ := a.check(r, n, nil, path)
+	origins := a.origins
+	a.origins = outer
+	return typ, origins
+}
+
+// condition checks an expression that must be a boolean, such as a filter.
+func (a *analyzer) condition(r *Relation, e duql.Expression, what, path string) {
+	n, err := expr.FromDUQL(e)
+	if err != nil {
+		return
+	}
+	a.conditionNode(r, n, what, path)
+}
+
+func (a *analyzer) conditionNode(r *Relation, n expr.Node, what, path string) {
+	if t, _ := a.node(r, n, path); !accepts(boolean, t) {
+		a.typeError(path, n, "%s expects a boolean condition, got %s", what, describe(n, t))
+	}
+}
+
+// check checks the identifiers and types in n and returns its type; bound
+// holds lambda parameters in scope. Values of unknown type are never
+// reported.
+func (a *analyzer) check(r *Relation, n expr.Node, bound map[string]bool, path string) string {
+	switch n := n.(type) {
+	case *expr.Ident:
+		return a.ident(r, n, bound, path)
+	case *expr.Number:
+		if strings.ContainsAny(n.Text, ".eE") {
+			return typeDecimal
+		}
+		return typeInteger
+	case *expr.String:
+		return typeText
+	case *expr.FString:
+		for _, p := range n.Parts {
+			a.check(r, p, bound, path)
+		}
+		return typeText
+	case *expr.Bool:
+		return typeBoolean
+	case *expr.Null:
+		return typeNull
+	case *expr.Date:
+		return literalDate(n.Text)
+	case *expr.Interval:
+		return typeInterval
+	case *expr.Param:
+		p := a.q.Params.Lookup(n.Name)
+		if p == nil {
+			a.problem(path, &expr.Error{Pos: n.At, Msg: fmt.Sprintf("unknown parameter $%s; declare it in params", n.Name)})
+			return ""
+		}
+		return paramTypes[p.Type]
+	case *expr.Unary:
+		return a.unary(r, n, bound, path)
+	case *expr.Binary:
+		return a.binary(r, n, bound, path)
+	case *expr.Range:
+		a.check(r, n.Start, bound, path)
+		a.check(r, n.End, bound, path)
+	case *expr.Array:
+		for _, item := range n.Items {
+			a.check(r, item, bound, path)
+		}
+	case *expr.Call:
+		return a.call(r, n, bound, path)
+	case *expr.NamedArg:
+		return a.check(r, n.Value, bound, path)
+	case *expr.Case:
+		var typ string
+		for _, w := range n.Whens {
+			if t := a.check(r, w.Cond, bound, path); !accepts(boolean, t) {
+				a.typeError(path, w.Cond, "case expects a boolean condition, got %s", describe(w.Cond, t))
+			}
+			typ = common(typ, a.check(r, w.Value, bound, path))
+		}
+		if n.Else != nil {
+			typ = common(typ, a.check(r, n.Else, bound, path))
+		}
+		return typ
+	case *expr.Lambda:
+		inner := make(map[string]bool, len(bound)+len(n.Params))
+		for name := range bound {
+			inner[name] = true
+		}
+		for _, p := range n.Params {
+			inner[p.Name] = true
+			if p.Default != nil {
+				a.check(r, p.Default, bound, path)
+			}
+		}
+		a.check(r, n.Body, inner, path)
+	}
+	return ""
+}
+
+// ident checks a column reference and returns the type of the column.
+func (a *analyzer) ident(r *Relation, id *expr.Ident, bound map[string]bool, path string) string {
+	first := id.Parts[0]
+	if n, ok := a.exprs[id.Name()]; ok && !bound[first] {
+		return a.inline(r, id.Name(), n, nil, path)
+	}
+	// Fields of tuples, including imported ones named <namespace>.<name>.
+	owner := strings.Join(id.Parts[:len(id.Parts)-1], ".")
+	if bound[first] || a.declared[first] || a.declared[owner] || first == "*" || first == "this" {
+		return ""
+	}
+	if len(id.Parts) == 1 {
+		if qualified := r.ambiguity(first); qualified != nil {
+			msg := fmt.Sprintf("column %s is ambiguous", first)
+			if len(qualified) > 1 {
+				msg += "; qualify it as " + strings.Join(qualified, " or ")
+			}
+			a.problem(path, &expr.Error{Pos: id.At, Msg: msg})
+			return ""
+		}
+		if c := r.Column(first); c != nil {
+			a.origins = addOrigins(a.origins, c.Lineage...)
+			return c.Type
+		}
+		if r.Open {
+			a.origins = addOrigins(a.origins, Origin{Table: r.table, Column: first})
+		} else {
+			a.unknown(r, first, id.At, path)
+		}
+		return ""
+	}
+	s := r.Source(first)
+	if s == nil || len(id.Parts) != 2 || id.Parts[1] == "*" {
+		return ""
+	}
+	if c := s.Column(id.Parts[1]); c != nil {
+		a.origins = addOrigins(a.origins, c.Lineage...)
+		return c.Type
+	}
+	if s.Open {
+		a.origins = addOrigins(a.origins, Origin{Table: s.table, Column: id.Parts[1]})
+	} else {
+		a.problem(path, &expr.Error{Pos: id.At, Msg: fmt.Sprintf("unknown column %s", id.Name())})
+	}
+	return ""
+}
+
+// inline checks a declared expression or function body where it is used,
+// as the compiler expands it there, and returns its type.
+func (a *analyzer) inline(r *Relation, name string, n expr.Node, bound map[string]bool, path string) string {
+	if a.expanding[name] {
+		// The compiler reports declarations in terms of themselves.
+		return ""
+	}
+	a.expanding[name] = true
+	a.quiet++
+	typ := a.check(r, n, bound, path)
+	a.quiet--
+	delete(a.expanding, name)
+	return typ
+}
+
+func (a *analyzer) unary(r *Relation, n *expr.Unary, bound map[string]bool, path string) string {
+	t := a.check(r, n.X, bound, path)
+	switch n.Op {
+	case "-":
+		if k := KindOf(t); k == Boolean || k == Text {
+			a.typeError(path, n, "cannot negate %s", describe(n.X, t))
+		}
+		return t
+	case "!":
+		if !accepts(boolean, t) {
+			a.typeError(path, n, "! expects a boolean, got %s", describe(n.X, t))
+		}
+		return typeBoolean
+	}
+	return ""
+}
+
+func (a *analyzer) binary(r *Relation, n *expr.Binary, bound map[string]bool, path string) string {
+	if call, ok := a.rankBy(r, n, bound); ok {
+		return a.call(r, call, bound, path)
+	}
+	if parts := expr.Concat(n); parts != nil {
+		for _, p := range parts {
+			a.check(r, p, bound, path)
+		}
+		return typeText
+	}
+	x := a.check(r, n.X, bound, path)
+
+	switch n.Op {
+	case "in", "between":
+		var items []expr.Node
+		switch y := n.Y.(type) {
+		case *expr.Array:
+			items = y.Items
+		case *expr.Range:
+			items = []expr.Node{y.Start, y.End}
+		default:
+			a.check(r, n.Y, bound, path)
+		}
+		for _, item := range items {
+			if item != nil {
+				a.compare(n, n.X, x, item, a.check(r, item, bound, path), path)
+			}
+		}
+		return typeBoolean
+	}
+
+	y := a.check(r, n.Y, bound, path)
+	switch n.Op {
+	case "&&", "||":
+		for _, side := range []struct {
+			n   expr.Node
+			typ string
+		}{{n.X, x}, {n.Y, y}} {
+			if !accepts(boolean, side.typ) {
+				a.typeError(path, n, "%s expects booleans, got %s", n.Op, describe(side.n, side.typ))
+			}
+		}
+		return typeBoolean
+	case "==", "!=", "<", "<=", ">", ">=":
+		a.compare(n, n.X, x, n.Y, y, path)
+		return typeBoolean
+	case "~=":
+		for _, side := range []struct {
+			n   expr.Node
+			typ string
+		}{{n.X, x}, {n.Y, y}} {
+			if !accepts(textual, side.typ) {
+				a.typeError(path, n, "~= expects text, got %s", describe(side.n, side.typ))
+			}
+		}
+		return typeBoolean
+	case "??":
+		a.compare(n, n.X, x, n.Y, y, path)
+		return common(x, y)
+	}
+
+	t, ok := arithmetic(n.Op, x, y)
+	if ok {
+		return t
+	}
+	for _, side := range []struct {
+		n   expr.Node
+		typ string
+	}{{n.X, x}, {n.Y, y}} {
+		if k := KindOf(side.typ); k == Boolean || k == Text {
+			if k == Text && n.Op == "+" {
+				a.typeError(path, n, "cannot use %s in arithmetic; join text with an f-string such as f\"{a}{b}\"", describe(side.n, side.typ))
+				return ""
+			}
+			a.typeError(path, n, "cannot use %s in arithmetic", describe(side.n, side.typ))
+			return ""
+		}
+	}
+	a.typeError(path, n, "cannot use %s with %s and %s", n.Op, describe(n.X, x), describe(n.Y, y))
+	return ""
+}
+
+// compare reports values of op that cannot be compared with each other,
+// suggesting an @ literal for dates written as strings.
+func (a *analyzer) compare(op expr.Node, xn expr.Node, x string, yn expr.Node, y string, path string) {
+	if compatible(KindOf(x), KindOf(y)) {
+		return
+	}
+	msg := fmt.Sprintf("cannot compare %s with %s", describe(xn, x), describe(yn, y))
+	for _, n := range []expr.Node{xn, yn} {
+		if s, ok := n.(*expr.String); ok && looksLikeDate(s.Value) {
+			msg += fmt.Sprintf("; write @%s for a date", s.Value)
+		}
+	}
+	a.typeError(path, op, "%s", msg)
+}
+
+// rankBy reads `rank -amount` as the compiler does, as ranking by amount
+// descending rather than subtracting amount from a column named rank.
+func (a *analyzer) rankBy(r *Relation, n *expr.Binary, bound map[string]bool) (*expr.Call, bool) {
+	id, ok := n.X.(*expr.Ident)
+	if !ok || n.Op != "-" || len(id.Parts) != 1 {
+		return nil, false
+	}
+	name := id.Parts[0]
+	sig, ok := signatures[name]
+	if !ok || len(sig.args) != 0 || r.Column(name) != nil || bound[name] || a.declared[name] {
+		return nil, false
+	}
+	switch name {
+	case "row_number", "rank", "dense_rank", "percent_rank", "cume_dist":
+		arg := &expr.Unary{Op: "-", X: n.Y, At: n.At}
+		return &expr.Call{Name: name, Args: []expr.Node{arg}, At: id.At}, true
+	}
+	return nil, false
+}
+
+// call checks the arguments of a standard library function against its
+// signature and returns the type of its result. Other functions are
+// passed through to the database, so only their arguments are checked.
+func (a *analyzer) call(r *Relation, n *expr.Call, bound map[string]bool, path string) string {
+	if fn, ok := a.funcs[n.Name]; ok {
+		for _, arg := range n.Args {
+			a.check(r, arg, bound, path)
+		}
+		params := make(map[string]bool, len(fn.Params))
+		for _, p := range fn.Params {
+			params[p.Name] = true
+		}
+		return a.inline(r, n.Name, fn.Body, params, path)
+	}
+	sig, ok := signatures[n.Name]
+	if !ok || a.declared[n.Name] {
+		var typ string
+		for _, arg := range n.Args {
+			t := a.check(r, arg, bound, path)
+			if n.Name == "coalesce" {
+				typ = common(typ, t)
+			}
+		}
+		return typ
+	}
+
+	var args []string
+	for _, arg := range n.Args {
+		if id, ok := arg.(*expr.Ident); ok && id.Name() == "this" {
+			continue
+		}
+		t := a.check(r, arg, bound, path)
+		if _, ok := arg.(*expr.NamedArg); ok {
+			continue
+		}
+		if i := len(args); i < len(sig.args) && !accepts(sig.args[i], t) {
+			a.typeError(path, arg, "%s expects %s, got %s", n.Name, sig.args[i], describe(arg, t))
+		}
+		args = append(args, t)
+	}
+	if sig.result != "" || sig.same >= len(args) {
+		return sig.result
+	}
+	return args[sig.same]
+}
+
+// typeError reports a type error at the position of n.
+func (a *analyzer) typeError(path string, n expr.Node, format string, args ...any) {
+	a.problem(path, &expr.Error{Pos: n.Pos(), Msg: fmt.Sprintf(format, args...)})
+}
+
+// accepts reports whether a value of type typ belongs to the set. Values
+// of unknown, null or unchecked types are accepted by every set.
+func accepts(s kinds, typ string) bool {
+	switch k := KindOf(typ); k {
+	case Unknown, Null, Other:
+		return true
+	default:
+		return s.has(k)
+	}
+}
+
+// common returns the type of a value that is either x or y, such as the
+// branches of a case.
+func common(x, y string) string {
+	switch {
+	case x == "" || KindOf(x) == Null:
+		return y
+	case y == "" || KindOf(y) == Null || x == y:
+		return x
+	case KindOf(x) == Integer && KindOf(y) == Decimal:
+		return y
+	}
+	return x
+}
+
+// describe names a value in a message: columns by name and type, other
+// values by their type alone.
+func describe(n expr.Node, typ string) string {
+	if typ == "" {
+		typ = "unknown type"
+	}
+	if id, ok := n.(*expr.Ident); ok {
+		return fmt.Sprintf("%s (%s)", id.Name(), typ)
+	}
+	return typ
+}
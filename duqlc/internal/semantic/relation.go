@@ -0,0 +1,288 @@
+// Package semantic follows the columns available at each step of a query,
+// from its dataset through every step, with their types, and reports
+// references to columns that do not exist at the step that uses them and
+// expressions whose types do not fit together.
+package semantic
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/theduql/duql/internal/catalog"
+)
+
+// Column is one column of a relation.
+type Column struct {
+	Name string `json:"name"`
+	// Type is the column type when it is known: as the catalog names it for
+	// columns read from a table, or as inferred for computed columns.
+	Type string `json:"type,omitempty"`
+	// Nullable is unset only for columns known never to be NULL: columns
+	// the catalog declares NOT NULL and what is read or counted from them.
+	Nullable bool `json:"nullable"`
+	// Source is the table or relation the column was read from, empty for
+	// computed columns.
+	Source string `json:"source,omitempty"`
+	// Lineage are the columns of tables and files the column is read or
+	// computed from.
+	Lineage []Origin `json:"lineage,omitempty"`
+}
+
+// Origin is a column of a table or file as the query names it. Table is
+// empty when it is not known, as for columns of raw SQL.
+type Origin struct {
+	Table  string `json:"table,omitempty"`
+	Column string `json:"column"`
+}
+
+// addOrigins appends the origins dst does not have yet. Dst is never
+// modified in place, since columns of several relations share it.
+func addOrigins(dst []Origin, origins ...Origin) []Origin {
+	dst = dst[:len(dst):len(dst)]
+next:
+	for _, o := range origins {
+		for _, d := range dst {
+			if d == o {
+				continue next
+			}
+		}
+		dst = append(dst, o)
+	}
+	return dst
+}
+
+// Relation is the schema of the rows a step produces.
+type Relation struct {
+	// Columns are the columns known to exist, in output order.
+	Columns []Column `json:"columns"`
+	// Open means there may be columns besides Columns, because the relation
+	// reads a table, file or SQL the analysis cannot see into. References
+	// to columns of an open relation are never reported.
+	Open bool `json:"open,omitempty"`
+
+	// sources are the relations columns can be qualified with, such as the
+	// two sides of a join, by name.
+	sources map[string]*Relation
+	// dropped names the step that removed each column, by lower case name,
+	// so that later references can say where it went.
+	dropped map[string]string
+	// table is the table or file the relation reads directly, if any, so
+	// that columns of an open relation can still be traced to it.
+	table string
+	// ambiguous holds, by lower case name, the qualified names of columns
+	// both sides of a join have, which cannot be named unqualified.
+	ambiguous map[string][]string
+}
+
+// open returns a relation whose columns are not known.
+func open() *Relation {
+	return &Relation{Open: true}
+}
+
+// tableRelation returns the relation read from table t, which the query
+// names table, as name. A nil table has unknown columns.
+func tableRelation(name, table string, t *catalog.Table) *Relation {
+	if t == nil {
+		r := open()
+		r.table = table
+		s := open()
+		s.table = table
+		r.source(name, s)
+		return r
+	}
+	r := &Relation{Open: t.Open, table: table}
+	for _, col := range t.Columns {
+		r.Columns = append(r.Columns, Column{
+			Name:     col.Name,
+			Type:     col.Type,
+			Nullable: col.Nullable,
+			Source:   name,
+			Lineage:  []Origin{{Table: table, Column: col.Name}},
+		})
+	}
+	r.source(name, r.copy())
+	return r
+}
+
+// Column returns the column with the given name, or nil. Names are
+// compared without regard to case.
+func (r *Relation) Column(name string) *Column {
+	for i := range r.Columns {
+		if strings.EqualFold(r.Columns[i].Name, name) {
+			return &r.Columns[i]
+		}
+	}
+	return nil
+}
+
+// Source returns the relation that name qualifies, such as one side of a
+// join, or nil.
+func (r *Relation) Source(name string) *Relation {
+	return r.sources[strings.ToLower(name)]
+}
+
+func (r *Relation) source(name string, s *Relation) {
+	if r.sources == nil {
+		r.sources = make(map[string]*Relation)
+	}
+	r.sources[strings.ToLower(name)] = s
+}
+
+func (r *Relation) copy() *Relation {
+	c := &Relation{
+		Columns: append([]Column(nil), r.Columns...),
+		Open:    r.Open,
+		table:   r.table,
+	}
+	for name, s := range r.sources {
+		c.source(name, s)
+	}
+	for name, path := range r.dropped {
+		c.drop(name, path)
+	}
+	for name, qualified := range r.ambiguous {
+		c.ambiguate(name, qualified)
+	}
+	return c
+}
+
+// nullable returns a copy of r whose columns may all be NULL, as the side
+// of an outer join without a match is.
+func (r *Relation) nullable() *Relation {
+	c := r.copy()
+	for i := range c.Columns {
+		c.Columns[i].Nullable = true
+	}
+	for name, s := range c.sources {
+		c.source(name, s.nullable())
+	}
+	return c
+}
+
+// derive returns an empty relation that keeps the qualifiers of r, for
+// steps that replace every column.
+func (r *Relation) derive() *Relation {
+	c := &Relation{table: r.table}
+	for name, s := range r.sources {
+		c.source(name, s)
+	}
+	for name, path := range r.dropped {
+		c.drop(name, path)
+	}
+	return c
+}
+
+// add appends a column, replacing any column of the same name as a
+// generated column replaces the input column it shadows.
+func (r *Relation) add(col Column) {
+	if c := r.Column(col.Name); c != nil {
+		*c = col
+		if r.ambiguous[strings.ToLower(col.Name)] != nil {
+			// Both sides of the join are shadowed.
+			r.removeAfter(c)
+			delete(r.ambiguous, strings.ToLower(col.Name))
+		}
+		return
+	}
+	r.Columns = append(r.Columns, col)
+	delete(r.dropped, strings.ToLower(col.Name))
+}
+
+// removeAfter removes the columns named like c that come after it.
+func (r *Relation) removeAfter(c *Column) {
+	cols := r.Columns[:0]
+	for i := range r.Columns {
+		if &r.Columns[i] == c || !strings.EqualFold(r.Columns[i].Name, c.Name) {
+			cols = append(cols, r.Columns[i])
+		}
+	}
+	r.Columns = cols
+}
+
+// join appends the columns of the other side of a join. A column both
+// sides have is kept twice, as SELECT * returns it, and can then only be
+// named qualified.
+func (r *Relation) join(other *Relation) {
+	for _, col := range other.Columns {
+		if c := r.Column(col.Name); c != nil {
+			r.ambiguate(col.Name, []string{r.qualify(*c), other.qualify(col)})
+		}
+		r.Columns = append(r.Columns, col)
+	}
+}
+
+// qualify returns the qualified name col can be referred to by: the
+// relation it is read from, or else the first source that has it.
+func (r *Relation) qualify(col Column) string {
+	if col.Source != "" {
+		return col.Source + "." + col.Name
+	}
+	names := make([]string, 0, len(r.sources))
+	for name := range r.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if r.sources[name].Column(col.Name) != nil {
+			return name + "." + col.Name
+		}
+	}
+	return ""
+}
+
+func (r *Relation) ambiguate(name string, qualified []string) {
+	if r.ambiguous == nil {
+		r.ambiguous = make(map[string][]string)
+	}
+	name = strings.ToLower(name)
+	for _, q := range qualified {
+		if q != "" && !slices.Contains(r.ambiguous[name], q) {
+			r.ambiguous[name] = append(r.ambiguous[name], q)
+		}
+	}
+	if r.ambiguous[name] == nil {
+		r.ambiguous[name] = []string{}
+	}
+}
+
+// ambiguity returns the qualified names of a column name cannot tell
+// apart, or nil when it names at most one column.
+func (r *Relation) ambiguity(name string) []string {
+	return r.ambiguous[strings.ToLower(name)]
+}
+
+// remove drops a column, remembering the step that dropped it.
+func (r *Relation) remove(name, path string) {
+	for i := range r.Columns {
+		if strings.EqualFold(r.Columns[i].Name, name) {
+			r.Columns = append(r.Columns[:i], r.Columns[i+1:]...)
+			break
+		}
+	}
+	r.drop(name, path)
+}
+
+func (r *Relation) drop(name, path string) {
+	if r.dropped == nil {
+		r.dropped = make(map[string]string)
+	}
+	r.dropped[strings.ToLower(name)] = path
+}
+
+// droppedBy returns the step that removed the column, if any.
+func (r *Relation) droppedBy(name string) string {
+	return r.dropped[strings.ToLower(name)]
+}
+
+// combine adds the lineage of the rows of other, which are appended to
+// those of r, matching columns by position as SQL does. A column is
+// nullable when it is on either side.
+func (r *Relation) combine(other *Relation) {
+	for i := range r.Columns {
+		if i < len(other.Columns) {
+			r.Columns[i].Lineage = addOrigins(r.Columns[i].Lineage, other.Columns[i].Lineage...)
+			r.Columns[i].Nullable = r.Columns[i].Nullable || other.Columns[i].Nullable
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package semantic
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/theduql/duql/internal/duql"
+)
+
+// Kind is the family a column type belongs to. Type checks compare kinds,
+// so that integer and bigint, or text and varchar(200), are alike.
+type Kind int
+
+const (
+	Unknown Kind = iota
+	Null
+	Boolean
+	Integer
+	Decimal
+	Text
+	Date
+	Time
+	Timestamp
+	Interval
+	// Other is every type without checks of its own, such as json, lists,
+	// structs, uuids and binary data.
+	Other
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Null:
+		return "null"
+	case Boolean:
+		return "boolean"
+	case Integer:
+		return "integer"
+	case Decimal:
+		return "decimal"
+	case Text:
+		return "text"
+	case Date:
+		return "date"
+	case Time:
+		return "time"
+	case Timestamp:
+		return "timestamp"
+	case Interval:
+		return "interval"
+	case Other:
+		return "other"
+	}
+	return "unknown"
+}
+
+// Type names given to computed values. Columns read from a table keep the
+// type the catalog gives them.
+const (
+	typeBoolean   = "boolean"
+	typeInteger   = "integer"
+	typeBigint    = "bigint"
+	typeDecimal   = "numeric"
+	typeDouble    = "double"
+	typeText      = "text"
+	typeDate      = "date"
+	typeTime      = "time"
+	typeTimestamp = "timestamp"
+	typeInterval  = "interval"
+	typeNull      = "null"
+)
+
+// paramTypes are the types of declared parameters.
+var paramTypes = map[duql.ParamType]string{
+	duql.ParamString:    typeText,
+	duql.ParamInteger:   typeBigint,
+	duql.ParamNumber:    typeDouble,
+	duql.ParamBoolean:   typeBoolean,
+	duql.ParamDate:      typeDate,
+	duql.ParamTimestamp: typeTimestamp,
+}
+
+var typeArgs = regexp.MustCompile(`\s*\(.*\)`)
+
+// KindOf classifies a type name as written in a catalog or DDL, across
+// the spellings of the supported targets. Names it does not recognize are
+// Unknown, so that they are never reported.
+func KindOf(typ string) Kind {
+	t := strings.ToLower(strings.TrimSpace(typ))
+	if t == "" {
+		return Unknown
+	}
+	// ClickHouse wraps types, as in Nullable(Int64) and
+	// LowCardinality(Nullable(String)).
+	for _, wrapper := range []string{"lowcardinality(", "nullable("} {
+		if strings.HasPrefix(t, wrapper) && strings.HasSuffix(t, ")") {
+			t = strings.TrimSpace(t[len(wrapper) : len(t)-1])
+		}
+	}
+	if strings.HasSuffix(t, "[]") || strings.HasPrefix(t, "array") || strings.HasPrefix(t, "list") ||
+		strings.HasPrefix(t, "struct") || strings.HasPrefix(t, "map") || strings.HasPrefix(t, "tuple") {
+		return Other
+	}
+	t = typeArgs.ReplaceAllString(t, "")
+	t = strings.TrimPrefix(t, "unsigned ")
+	t = strings.TrimSuffix(t, " unsigned")
+
+	switch t {
+	case typeNull:
+		return Null
+	case "bool", "boolean", "bit":
+		return Boolean
+	case "date", "date32":
+		return Date
+	case "time", "time without time zone", "time with time zone", "timetz":
+		return Time
+	case "interval":
+		return Interval
+	case "real", "float", "float4", "float8", "float32", "float64", "double", "double precision",
+		"numeric", "decimal", "number", "money", "smallmoney", "bignumeric", "dec", "fixed":
+		return Decimal
+	case "json", "jsonb", "variant", "object", "uuid", "blob", "bytea", "binary", "varbinary",
+		"bytes", "image", "xml", "geometry", "geography", "inet", "cidr", "macaddr":
+		return Other
+	}
+	switch {
+	case strings.HasPrefix(t, "timestamp"), strings.HasPrefix(t, "datetime"), t == "smalldatetime":
+		return Timestamp
+	case strings.HasPrefix(t, "interval"):
+		return Interval
+	case strings.Contains(t, "int") && !strings.Contains(t, "interval") && !strings.Contains(t, "point"),
+		strings.HasSuffix(t, "serial"):
+		return Integer
+	case strings.Contains(t, "char"), strings.Contains(t, "text"), strings.Contains(t, "string"),
+		strings.Contains(t, "clob"), t == "name", t == "enum", strings.HasPrefix(t, "enum"):
+		return Text
+	}
+	return Unknown
+}
+
+// kinds is a set of kinds an argument accepts.
+type kinds uint
+
+func kindSet(ks ...Kind) kinds {
+	var s kinds
+	for _, k := range ks {
+		s |= 1 << k
+	}
+	return s
+}
+
+var (
+	anyKind  kinds
+	integral = kindSet(Integer)
+	numeric  = kindSet(Integer, Decimal)
+	textual  = kindSet(Text)
+	boolean  = kindSet(Boolean)
+	temporal = kindSet(Date, Timestamp)
+	summable = kindSet(Integer, Decimal, Interval)
+)
+
+// families are kinds whose values compare with each other.
+var families = [][]Kind{
+	{Integer, Decimal},
+	{Date, Timestamp},
+}
+
+func (s kinds) has(k Kind) bool {
+	return s == anyKind || s&(1<<k) != 0
+}
+
+// String describes the set as a message would, as in "expects a number".
+func (s kinds) String() string {
+	switch s {
+	case integral:
+		return "an integer"
+	case numeric:
+		return "a number"
+	case textual:
+		return "text"
+	case boolean:
+		return "a boolean"
+	case temporal:
+		return "a date or timestamp"
+	case summable:
+		return "a number or interval"
+	}
+	return "any value"
+}
+
+// signature is the type of a standard library function. Arguments are in
+// the order they are written in DUQL, so a piped value is the last one.
+type signature struct {
+	args []kinds
+	// result is the type of the value, or empty when it is that of the
+	// argument at same.
+	result string
+	same   int
+}
+
+func returns(result string, args ...kinds) signature {
+	return signature{args: args, result: result}
+}
+
+func sameAs(i int, args ...kinds) signature {
+	return signature{args: args, same: i}
+}
+
+var signatures = map[string]signature{
+	"sum":            sameAs(0, summable),
+	"avg":            returns(typeDecimal, summable),
+	"average":        returns(typeDecimal, summable),
+	"min":            sameAs(0, anyKind),
+	"max":            sameAs(0, anyKind),
+	"count":          returns(typeBigint),
+	"count_distinct": returns(typeBigint),
+	"stddev":         returns(typeDouble, numeric),
+	"median":         returns(typeDouble, numeric),
+	"any":            returns(typeBoolean, boolean),
+	"every":          returns(typeBoolean, boolean),
+
+	"row_number":   returns(typeBigint),
+	"rank":         returns(typeBigint),
+	"dense_rank":   returns(typeBigint),
+	"percent_rank": returns(typeDouble),
+	"cume_dist":    returns(typeDouble),
+	"lag":          sameAs(0, anyKind),
+	"lead":         sameAs(0, anyKind),
+	"first":        sameAs(0, anyKind),
+	"last":         sameAs(0, anyKind),
+
+	"is_null":           returns(typeBoolean, anyKind),
+	"current_date":      returns(typeDate),
+	"current_timestamp": returns(typeTimestamp),
+	"now":               returns(typeTimestamp),
+	"lower":             returns(typeText, textual),
+	"upper":             returns(typeText, textual),
+	"year":              returns(typeInteger, temporal),
+	"month":             returns(typeInteger, temporal),
+	"day":               returns(typeInteger, temporal),
+
+	"text.lower":       returns(typeText, textual),
+	"text.upper":       returns(typeText, textual),
+	"text.trim":        returns(typeText, textual),
+	"text.ltrim":       returns(typeText, textual),
+	"text.rtrim":       returns(typeText, textual),
+	"text.length":      returns(typeInteger, textual),
+	"text.starts_with": returns(typeBoolean, textual, textual),
+	"text.ends_with":   returns(typeBoolean, textual, textual),
+	"text.contains":    returns(typeBoolean, textual, textual),
+	"text.equals":      returns(typeBoolean, textual, textual),
+	"text.replace":     returns(typeText, textual, textual, textual),
+	"text.extract":     returns(typeText, integral, integral, textual),
+
+	"math.abs":   sameAs(0, numeric),
+	"math.floor": sameAs(0, numeric),
+	"math.ceil":  sameAs(0, numeric),
+	"math.round": sameAs(1, integral, numeric),
+	"math.pow":   returns(typeDouble, numeric, numeric),
+	"math.sqrt":  returns(typeDouble, numeric),
+	"math.exp":   returns(typeDouble, numeric),
+	"math.ln":    returns(typeDouble, numeric),
+	"math.log10": returns(typeDouble, numeric),
+	"math.pi":    returns(typeDouble),
+
+	"date.year":    returns(typeInteger, temporal),
+	"date.month":   returns(typeInteger, temporal),
+	"date.day":     returns(typeInteger, temporal),
+	"date.to_text": returns(typeText, textual, temporal),
+}
+
+// compatible reports whether values of kinds a and b can be compared or
+// combined with ??. Unknown and null values are compatible with anything.
+func compatible(a, b Kind) bool {
+	if a == b || a == Unknown || b == Unknown || a == Null || b == Null || a == Other || b == Other {
+		return true
+	}
+	for _, group := range families {
+		inA, inB := false, false
+		for _, k := range group {
+			inA = inA || k == a
+			inB = inB || k == b
+		}
+		if inA && inB {
+			return true
+		}
+	}
+	return false
+}
+
+// arithmetic returns the type of x op y for the arithmetic operators, and
+// false when the operator does not apply to the kinds.
+func arithmetic(op, x, y string) (string, bool) {
+	kx, ky := KindOf(x), KindOf(y)
+	if kx == Unknown || ky == Unknown || kx == Null || ky == Null || kx == Other || ky == Other {
+		return "", kx != Boolean && ky != Boolean && kx != Text && ky != Text
+	}
+	isNum := func(k Kind) bool { return k == Integer || k == Decimal }
+	isTime := func(k Kind) bool { return k == Date || k == Timestamp || k == Time }
+
+	switch {
+	case isNum(kx) && isNum(ky):
+		switch {
+		case op == "//":
+			return typeInteger, true
+		case op == "/" || op == "^":
+			return typeDecimal, true
+		case kx == Integer && ky == Integer:
+			if x == y {
+				return x, true
+			}
+			return typeInteger, true
+		}
+		return typeDecimal, true
+	case (op == "+" || op == "-") && isTime(kx) && ky == Interval:
+		return x, true
+	case op == "+" && kx == Interval && isTime(ky):
+		return y, true
+	case op == "-" && isTime(kx) && isTime(ky):
+		if kx == Date && ky == Date {
+			return typeInteger, true
+		}
+		return typeInterval, true
+	case (op == "+" || op == "-") && kx == Interval && ky == Interval:
+		return typeInterval, true
+	case (op == "*" || op == "/") && kx == Interval && isNum(ky), op == "*" && isNum(kx) && ky == Interval:
+		return typeInterval, true
+	}
+	return "", false
+}
+
+// literalDate is the type of an @ literal, as the compiler reads it.
+func literalDate(text string) string {
+	switch {
+	case !strings.Contains(text, "-"):
+		return typeTime
+	case strings.ContainsAny(text, "T:"):
+		return typeTimestamp
+	}
+	return typeDate
+}
+
+// looksLikeDate reports whether a string literal holds a date, so that a
+// message can suggest an @ literal instead.
+var looksLikeDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([T ][0-9:.]+)?`).MatchString
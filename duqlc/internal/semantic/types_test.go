@@ -0,0 +1,97 @@
+package semantic
+
+import "testing"
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		typ  string
+		want Kind
+	}{
+		{"", Unknown},
+		{"geometry_collection", Unknown},
+		{"null", Null},
+		{"BOOLEAN", Boolean},
+		{"bit", Boolean},
+		{"int", Integer},
+		{"bigint unsigned", Integer},
+		{"Nullable(Int64)", Integer},
+		{"bigserial", Integer},
+		{"numeric(10,2)", Decimal},
+		{"double precision", Decimal},
+		{"NUMBER(38, 0)", Decimal},
+		{"varchar(100)", Text},
+		{"LowCardinality(String)", Text},
+		{"LowCardinality(Nullable(String))", Text},
+		{"character varying", Text},
+		{"date", Date},
+		{"time with time zone", Time},
+		{"timestamp with time zone", Timestamp},
+		{"datetime2", Timestamp},
+		{"DateTime64(3)", Timestamp},
+		{"interval day to second", Interval},
+		{"jsonb", Other},
+		{"uuid", Other},
+		{"text[]", Other},
+		{"array<int64>", Other},
+		{"struct<a int>", Other},
+		{"point", Unknown},
+	}
+	for _, tt := range tests {
+		if got := KindOf(tt.typ); got != tt.want {
+			t.Errorf("KindOf(%q) = %s, want %s", tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		op, x, y string
+		want     string
+		ok       bool
+	}{
+		{"+", "integer", "integer", "integer", true},
+		{"+", "bigint", "bigint", "bigint", true},
+		{"+", "integer", "bigint", "integer", true},
+		{"*", "integer", "numeric(10,2)", "numeric", true},
+		{"/", "integer", "integer", "numeric", true},
+		{"//", "double", "integer", "integer", true},
+		{"+", "timestamp", "interval", "timestamp", true},
+		{"+", "interval", "date", "date", true},
+		{"-", "date", "date", "integer", true},
+		{"-", "timestamp", "date", "interval", true},
+		{"*", "interval", "integer", "interval", true},
+		{"*", "date", "integer", "", false},
+		{"+", "text", "integer", "", false},
+		{"+", "boolean", "", "", false},
+		{"+", "", "integer", "", true},
+		{"+", "json", "integer", "", true},
+	}
+	for _, tt := range tests {
+		got, ok := arithmetic(tt.op, tt.x, tt.y)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("arithmetic(%s, %q, %q) = %q, %v, want %q, %v", tt.op, tt.x, tt.y, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	tests := []struct {
+		a, b Kind
+		want bool
+	}{
+		{Integer, Decimal, true},
+		{Text, Text, true},
+		{Date, Timestamp, true},
+		{Null, Text, true},
+		{Unknown, Boolean, true},
+		{Other, Integer, true},
+		{Timestamp, Text, false},
+		{Boolean, Integer, false},
+		{Interval, Integer, false},
+	}
+	for _, tt := range tests {
+		if got := compatible(tt.a, tt.b); got != tt.want {
+			t.Errorf("compatible(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v3"
 
+	"github.com/theduql/duql/internal/catalog"
 	duql "github.com/theduql/duql/internal/duql"
+	"github.com/theduql/duql/internal/loader"
 	"github.com/theduql/duql/internal/logger"
+	"github.com/theduql/duql/internal/semantic"
 )
 
 func init() {
@@ -26,7 +29,23 @@ func init() {
 	// }
 }
 
+// Options control validation.
+type Options struct {
+	// Catalog describes the tables queries may read. It is consulted along
+	// with any catalog named in a query's settings.
+	Catalog catalog.Provider
+	// Vars are values for the ${name} variables of queries, given on the
+	// command line.
+	Vars map[string]string
+}
+
 func Validate(path string) error {
+	return ValidateWith(path, Options{})
+}
+
+// ValidateWith validates the file or directory at path, also checking
+// tables and columns against the catalogs in opts and the query settings.
+func ValidateWith(path string, opts Options) error {
 	log := logger.GetLogger()
 
 	info, err := os.Stat(path)
@@ -36,13 +55,13 @@ func Validate(path string) error {
 	}
 
 	if info.IsDir() {
-		return validateDir(path)
+		return validateDir(path, opts)
 	}
 
-	return validateFile(path)
+	return validateFile(path, opts)
 }
 
-func validateFile(file string) error {
+func validateFile(file string, opts Options) error {
 	log := logger.GetLogger()
 
 	log.Info(fmt.Sprintf("ℹ️  Validating File: %s", file))
@@ -56,9 +75,9 @@ func validateFile(file string) error {
 	log.Info(fmt.Sprintf("✅ Opened File: %s", file))
 	log.Debug("File contents", zap.String("content", string(data)))
 
-	// Attempt to unmarshal YAML into DUQL Query structure
-	var query duql.Query
-	err = yaml.Unmarshal(data, &query)
+	// Attempt to unmarshal YAML into DUQL Query structure, along with the
+	// declarations it imports
+	query, err := loader.Load(file, loader.Options{Vars: opts.Vars})
 	if err != nil {
 		log.Error(fmt.Sprintf("Invalid DUQL Query: %s", err))
 		return err
@@ -72,10 +91,70 @@ func validateFile(file string) error {
 
 	log.Info("✅ Valid YAML and conforms to DUQL schema")
 
+	provider, err := QueryCatalog(file, query, opts)
+	if err != nil {
+		log.Error(fmt.Sprintf("Unable to Load Catalog: %s", err))
+		return err
+	}
+	// Without a catalog, columns of local data files and columns removed
+	// by earlier steps are still checked.
+	problems := semantic.Analyze(query, semantic.Options{Catalog: provider, Dir: filepath.Dir(file)}).Problems
+	for _, problem := range problems {
+		log.Error(fmt.Sprintf("❌ %s: %s", file, problem))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %w", file, problems[0])
+	}
+	if provider != nil {
+		log.Info("✅ Tables and columns match the catalog")
+	}
+
 	return nil
 }
 
-func validateDir(dir string) error {
+// QueryCatalog combines the catalog in opts with the one named in the query
+// settings. It returns nil when there is neither.
+func QueryCatalog(file string, query *duql.Query, opts Options) (catalog.Provider, error) {
+	var chain catalog.Chain
+	if query.Settings != nil && query.Settings.Catalog != "" {
+		path := query.Settings.Catalog
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+		tables, err := catalog.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, tables)
+	}
+	if opts.Catalog != nil {
+		chain = append(chain, opts.Catalog)
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+// IsQueryFile reports whether a file found in a query directory holds a
+// query. Catalog files (*.catalog.yml), libraries of declarations to import
+// (*.lib.yml) and the project manifest (duql.yml) may sit next to the
+// queries.
+func IsQueryFile(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	if name == "duql.yml" {
+		return false
+	}
+	for _, ext := range []string{".catalog.yml", ".catalog.yaml", ".catalog.json", ".lib.yml", ".lib.yaml"} {
+		if strings.HasSuffix(name, ext) {
+			return false
+		}
+	}
+	ext := filepath.Ext(name)
+	return ext == ".duql" || ext == ".yml" || ext == ".yaml"
+}
+
+func validateDir(dir string, opts Options) error {
 	log := logger.GetLogger()
 
 	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
@@ -83,8 +162,8 @@ func validateDir(dir string) error {
 			log.Error("Error walking directory", zap.String("path", path), zap.Error(err))
 			return fmt.Errorf("error walking directory: %s", err.Error())
 		}
-		if !info.IsDir() && (filepath.Ext(path) == ".duql" || filepath.Ext(path) == ".yml" || filepath.Ext(path) == ".yaml") {
-			if err := validateFile(path); err != nil {
+		if !info.IsDir() && IsQueryFile(path) {
+			if err := validateFile(path, opts); err != nil {
 				return err
 			}
 		}